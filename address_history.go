@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AddressChange - прежний адрес посылки
+type AddressChange struct {
+	Address   string // адрес до изменения
+	ChangedAt string // когда адрес был заменён
+	Actor     string
+}
+
+// GetAddressHistory возвращает прежние адреса посылки от самого раннего к последнему
+func (s ParcelStore) GetAddressHistory(number int64) ([]AddressChange, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT address, changed_at, actor FROM parcel_address_history WHERE number = :number AND "+tenantScope+" ORDER BY id",
+		sql.Named("number", number), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []AddressChange{}
+	for rows.Next() {
+		c := AddressChange{}
+		if err := rows.Scan(&c.Address, &c.ChangedAt, &c.Actor); err != nil {
+			return nil, err
+		}
+		// прежний адрес скопирован из parcel как есть, в том числе зашифрованным
+		address, err := s.fields.decrypt("address", c.Address)
+		if err != nil {
+			return nil, err
+		}
+		c.Address = address
+		res = append(res, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// addAddressChange сохраняет прежний адрес посылки в рамках транзакции tx
+func (s ParcelStore) addAddressChange(tx *sql.Tx, number int64, previous string) error {
+	_, err := tx.ExecContext(s.context(), "INSERT INTO parcel_address_history (number, address, changed_at, actor, tenant_id) VALUES (:number, :address, :changed_at, :actor, "+parcelTenant+")",
+		sql.Named("number", number),
+		sql.Named("address", previous),
+		sql.Named("changed_at", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("actor", s.actor))
+	return err
+}
+
+// GetAddressHistory возвращает прежние адреса посылки, чтобы поддержка видела,
+// куда посылка направлялась изначально
+func (s ParcelService) GetAddressHistory(ctx context.Context, number int64) ([]AddressChange, error) {
+	if _, err := s.Get(ctx, number); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetAddressHistory(number)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetAddressHistory проверяет сохранение прежних адресов посылки
+func TestGetAddressHistory(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+
+	// add
+	parcel := getTestParcel()
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	history, err := store.GetAddressHistory(id)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	// set address
+	require.NoError(t, store.SetAddress(id, "first"))
+	require.NoError(t, store.WithActor("support-3").SetAddress(id, "second"))
+
+	// check
+	history, err = store.GetAddressHistory(id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, parcel.Address, history[0].Address)
+	assert.Equal(t, DefaultActor, history[0].Actor)
+	assert.Equal(t, "first", history[1].Address)
+	assert.Equal(t, "support-3", history[1].Actor)
+	assert.NotEmpty(t, history[1].ChangedAt)
+
+	// адрес отправленной посылки не меняется, история не пополняется
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	require.NoError(t, store.SetAddress(id, "third"))
+	history, err = store.GetAddressHistory(id)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+// TestServiceGetAddressHistory проверяет историю адресов через сервис
+func TestServiceGetAddressHistory(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Тверь"))
+
+	history, err := service.GetAddressHistory(ctx, p.Number)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "Псков", history[0].Address)
+
+	_, err = service.GetAddressHistory(ctx, p.Number+1000)
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NextCursorHeader - заголовок ответа /admin/parcels с курсором следующей
+// страницы, см. SearchPage. Нет заголовка - страница последняя
+const NextCursorHeader = "X-Next-Cursor"
+
+type apiBulkStatusRequest struct {
+	Numbers []int64 `json:"numbers"`
+	Status  string  `json:"status"`
+}
+
+type apiBulkCourierRequest struct {
+	Numbers []int64 `json:"numbers"`
+	Courier int     `json:"courier"`
+}
+
+type apiBulkResult struct {
+	Updated int `json:"updated"`
+}
+
+type apiTenantRequest struct {
+	Name string `json:"name"`
+}
+
+// WithAdminToken возвращает копию обработчика, в которой открыты адреса /admin/
+// для запросов с заголовком "Authorization: Bearer <token>". Без токена
+// адреса /admin/ не существуют
+func (h APIHandler) WithAdminToken(token string) APIHandler {
+	h.adminToken = token
+	return h
+}
+
+// authorizeAdmin сравнивает токен запроса с токеном администратора
+// за постоянное время. Если доступа нет, отвечает 404 или 401 и возвращает false
+func (h APIHandler) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if h.adminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: http.StatusText(http.StatusUnauthorized)})
+		return false
+	}
+	return true
+}
+
+// serveAdmin обрабатывает /admin/parcels, /admin/parcels/status, /admin/parcels/courier,
+// /admin/tenants и /admin/clients/{client}/erasure. Токен к этому моменту уже проверен в ServeHTTP, а магазин
+// посылок выбран заголовком TenantHeader, см. requestTenant
+func (h APIHandler) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/admin/parcels":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		query := r.URL.Query()
+		limit := 0
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				h.writeError(w, r, ValidationError{Field: "limit", Message: "must be a positive integer"})
+				return
+			}
+			limit = n
+		}
+		page, err := h.service.SearchPage(r.Context(), query.Get("filter"), query.Get("cursor"), limit)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		res := make([]apiParcel, len(page.Parcels))
+		for i, p := range page.Parcels {
+			res[i] = newAPIParcel(p)
+		}
+		if page.NextCursor != "" {
+			w.Header().Set(NextCursorHeader, page.NextCursor)
+		}
+		writeJSON(w, http.StatusOK, res)
+	case "/admin/parcels/export":
+		h.serveExport(w, r)
+	case "/admin/parcels/status":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		var req apiBulkStatusRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		updated, err := h.service.BulkSetStatus(r.Context(), req.Numbers, req.Status)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, apiBulkResult{Updated: updated})
+	case "/admin/parcels/courier":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		var req apiBulkCourierRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		updated, err := h.service.BulkAssignCourier(r.Context(), req.Numbers, req.Courier)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, apiBulkResult{Updated: updated})
+	case "/admin/tenants":
+		switch r.Method {
+		case http.MethodGet:
+			tenants, err := h.service.ListTenants(r.Context())
+			if err != nil {
+				h.writeError(w, r, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, tenants)
+		case http.MethodPost:
+			var req apiTenantRequest
+			if !decodeJSON(w, r, &req) {
+				return
+			}
+			t, err := h.service.CreateTenant(r.Context(), req.Name)
+			if err != nil {
+				h.writeError(w, r, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, t)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	default:
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/admin/clients/"); ok {
+			if client, ok := strings.CutSuffix(rest, "/erasure"); ok {
+				h.serveClientErasure(w, r, client)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminCall выполняет запрос к адресам /admin/ с токеном token
+func adminCall(t *testing.T, handler http.Handler, token, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestAdminAPI проверяет авторизацию и массовые операции /admin/
+func TestAdminAPI(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	handler := NewAPIHandler(service).WithAdminToken("secret")
+
+	// prepare
+	first, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	second, err := service.Register(ctx, 7, "Тверь")
+	require.NoError(t, err)
+	_, err = service.Register(ctx, 8, "Орёл")
+	require.NoError(t, err)
+	courier, err := service.AddCourier(ctx, "Иван", "+79990000000")
+	require.NoError(t, err)
+	numbers := fmt.Sprintf("[%d,%d]", first.Number, second.Number)
+
+	// без токена адреса /admin/ не существуют
+	rec := adminCall(t, NewAPIHandler(service), "secret", http.MethodGet, "/admin/parcels", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = adminCall(t, handler, "", http.MethodGet, "/admin/parcels", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+	rec = adminCall(t, handler, "wrong", http.MethodGet, "/admin/parcels", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// add
+	rec = adminCall(t, handler, "secret", http.MethodPost, "/admin/parcels/status",
+		`{"numbers":`+numbers+`,"status":"sent"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var res apiBulkResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, 2, res.Updated)
+
+	rec = adminCall(t, handler, "secret", http.MethodPost, "/admin/parcels/courier",
+		fmt.Sprintf(`{"numbers":%s,"courier":%d}`, numbers, courier.ID))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, 2, res.Updated)
+
+	// check
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/parcels?filter="+url.QueryEscape(`status = "sent"`), "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var parcels []apiParcel
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcels))
+	require.Len(t, parcels, 2)
+	assert.Equal(t, first.Number, parcels[0].Number)
+	assert.Empty(t, rec.Header().Get(NextCursorHeader))
+
+	// постраничная выдача по курсору
+	filter := url.QueryEscape(`status = "sent"`)
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/parcels?limit=1&filter="+filter, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcels))
+	require.Len(t, parcels, 1)
+	assert.Equal(t, first.Number, parcels[0].Number)
+	next := rec.Header().Get(NextCursorHeader)
+	require.NotEmpty(t, next)
+
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/parcels?limit=1&filter="+filter+"&cursor="+url.QueryEscape(next), "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcels))
+	require.Len(t, parcels, 1)
+	assert.Equal(t, second.Number, parcels[0].Number)
+	assert.Empty(t, rec.Header().Get(NextCursorHeader))
+
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/parcels?cursor="+url.QueryEscape(next), "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/parcels?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/parcels?limit=1000", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = adminCall(t, handler, "secret", http.MethodPost, "/admin/parcels/status",
+		`{"numbers":`+numbers+`,"status":"registered"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = adminCall(t, handler, "secret", http.MethodPost, "/admin/parcels/status", `{"numbers":[],"status":"sent"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = adminCall(t, handler, "secret", http.MethodPost, "/admin/parcels/courier",
+		fmt.Sprintf(`{"numbers":%s,"courier":1000}`, numbers))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = adminCall(t, handler, "secret", http.MethodDelete, "/admin/parcels", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAPIBody ограничивает размер тела запроса REST API
+const maxAPIBody = 1 << 20
+
+// DefaultBadgeTTL - сколько APIHandler кэширует статусы для значков
+const DefaultBadgeTTL = time.Minute
+
+// apiParcel - посылка в ответах REST API
+type apiParcel struct {
+	Number        int64         `json:"number"`
+	Tracking      string        `json:"tracking_number"`
+	Client        int64         `json:"client"`
+	Status        string        `json:"status"`
+	Address       string        `json:"address"`
+	CreatedAt     string        `json:"created_at"`
+	CancelReason  string        `json:"cancel_reason,omitempty"`
+	ReturnOf      int64         `json:"return_of,omitempty"`
+	Deadline      string        `json:"deadline,omitempty"`
+	ETA           string        `json:"eta,omitempty"`
+	Courier       int           `json:"courier,omitempty"`
+	Origin        int           `json:"origin,omitempty"`
+	Destination   int           `json:"destination,omitempty"`
+	Priority      string        `json:"priority"`
+	Parent        int64         `json:"parent,omitempty"`
+	WeightKg      float64       `json:"weight_kg,omitempty"`
+	LengthCm      float64       `json:"length_cm,omitempty"`
+	WidthCm       float64       `json:"width_cm,omitempty"`
+	HeightCm      float64       `json:"height_cm,omitempty"`
+	DeclaredValue Money         `json:"declared_value"`
+	DeliveryPrice Money         `json:"delivery_price"`
+	COD           Money         `json:"cod_amount"`
+	Recipient     *apiRecipient `json:"recipient,omitempty"`
+}
+
+type apiRecipient struct {
+	Client int64  `json:"client,omitempty"`
+	Name   string `json:"name"`
+	Phone  string `json:"phone,omitempty"`
+}
+
+func newAPIParcel(p Parcel) apiParcel {
+	res := apiParcel{
+		Number:        p.Number,
+		Tracking:      p.Tracking,
+		Client:        p.Client,
+		Status:        p.Status,
+		Address:       p.Address,
+		CreatedAt:     p.CreatedAt,
+		CancelReason:  p.CancelReason,
+		ReturnOf:      p.ReturnOf,
+		Deadline:      p.Deadline,
+		ETA:           p.ETA,
+		Courier:       p.Courier,
+		Origin:        p.Origin,
+		Destination:   p.Destination,
+		Priority:      p.Priority,
+		Parent:        p.Parent,
+		WeightKg:      p.WeightKg,
+		LengthCm:      p.LengthCm,
+		WidthCm:       p.WidthCm,
+		HeightCm:      p.HeightCm,
+		DeclaredValue: p.DeclaredValue,
+		DeliveryPrice: p.DeliveryPrice,
+		COD:           p.COD,
+	}
+	if p.Recipient != (Recipient{}) {
+		res.Recipient = &apiRecipient{Client: p.Recipient.Client, Name: p.Recipient.Name, Phone: p.Recipient.Phone}
+	}
+	return res
+}
+
+// apiParcelDetails - посылка с раскрытиями из параметра include
+type apiParcelDetails struct {
+	apiParcel
+	History         []StatusChange `json:"history,omitempty"`
+	AssignedCourier *Courier       `json:"assigned_courier,omitempty"`
+	Items           []Item         `json:"items,omitempty"`
+	Notes           []Note         `json:"notes,omitempty"`
+}
+
+func newAPIParcelDetails(d ParcelDetails) apiParcelDetails {
+	return apiParcelDetails{
+		apiParcel:       newAPIParcel(d.Parcel),
+		History:         d.History,
+		AssignedCourier: d.AssignedCourier,
+		Items:           d.Items,
+		Notes:           d.Notes,
+	}
+}
+
+type apiRegisterRequest struct {
+	Client  int64  `json:"client"`
+	Address string `json:"address"`
+}
+
+type apiAddressRequest struct {
+	Address string `json:"address"`
+}
+
+type apiStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// apiError - тело ответа с ошибкой
+type apiError struct {
+	Error string `json:"error"`
+	Field string `json:"field,omitempty"` // поле запроса для ошибок проверки
+}
+
+// APIHandler отдаёт ParcelService через REST API:
+//
+//	POST   /parcels                         регистрация посылки
+//	GET    /parcels/{number}                посылка, параметр include - раскрытия, см. ParseIncludes
+//	PATCH  /parcels/{number}/address        смена адреса
+//	PATCH  /parcels/{number}/status         смена статуса
+//	DELETE /parcels/{number}                удаление
+//	GET    /parcels/{number}/events         поток изменений посылки в формате Server-Sent Events
+//	GET    /clients/{client}/parcels        посылки клиента, параметры include или fields, см. ParseFields
+//	GET    /clients/{client}/events         поток изменений всех посылок клиента
+//	GET    /track/{tracking}                публичные сведения о посылке без авторизации, см. Track
+//	GET    /admin/parcels                   страница посылок по параметрам filter, cursor и limit, см. SearchPage
+//	GET    /admin/parcels/export            выгрузка в CSV по параметрам filter и fields, см. ExportCSV
+//	POST   /admin/parcels/status            массовая смена статуса, см. BulkSetStatus
+//	POST   /admin/parcels/courier           массовое назначение курьера, см. BulkAssignCourier
+//	POST   /admin/clients/{client}/erasure  обезличивание данных клиента, см. AnonymizeClient
+//	GET    /admin/debug/pprof/              профили pprof, если включены WithDiagnostics
+//	GET    /admin/debug/vars                переменные expvar, если включены WithDiagnostics
+//	GET    /openapi.yaml                    спецификация OpenAPI, по ней проверяются запросы
+//	GET    /healthz                         проверка, что процесс работает
+//	GET    /readyz                          проверка готовности БД, см. ParcelService.Ready
+//
+// Адреса /admin/ требуют токена администратора, см. WithAdminToken,
+// частота запросов ограничивается WithRateLimits, авторизация включается WithAuth.
+// Там же доступны SOAPHandler на /soap и BadgeHandler на /badge/
+type APIHandler struct {
+	service    ParcelService
+	mux        *http.ServeMux
+	handler    http.Handler
+	events     *eventBroker
+	adminToken string
+
+	ipLimiter     *rateLimiter
+	clientLimiter *rateLimiter
+	auth          *Authenticator
+	diagnostics   http.Handler // pprof и expvar, nil - отключены, см. WithDiagnostics
+}
+
+func NewAPIHandler(service ParcelService) APIHandler {
+	h := APIHandler{service: service, mux: http.NewServeMux(), events: newEventBroker(service.store)}
+	// спецификация встроена в бинарник, поэтому ошибка в ней - ошибка сборки
+	doc, err := loadOpenAPI()
+	if err != nil {
+		panic(err)
+	}
+	validator, err := newOpenAPIValidator(doc, h.mux)
+	if err != nil {
+		panic(err)
+	}
+	h.handler = validator
+
+	h.mux.HandleFunc("/openapi.yaml", serveOpenAPI)
+	h.mux.HandleFunc("/parcels", h.serveParcels)
+	h.mux.HandleFunc("/parcels/", h.serveParcel)
+	h.mux.HandleFunc("/clients/", h.serveClient)
+	h.mux.HandleFunc("/track/", h.serveTrack)
+	h.mux.HandleFunc("/admin/", h.serveAdmin)
+	h.mux.HandleFunc("/audit", h.serveAudit)
+	h.mux.Handle("/soap", NewSOAPHandler(service))
+	h.mux.Handle("/badge/", NewBadgeHandler(service, DefaultBadgeTTL))
+	return h
+}
+
+func (h APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// частые проверки Kubernetes не трассируются
+	if h.serveHealth(w, r) {
+		return
+	}
+	rec, r, span := traceHTTP(w, r)
+	defer func() { endHTTPSpan(span, rec.status) }()
+	w = rec
+
+	if h.rateLimited(w, r) {
+		return
+	}
+	if r = h.authenticate(w, r); r == nil {
+		return
+	}
+	// токен проверяется до проверки запроса по спецификации
+	admin := strings.HasPrefix(r.URL.Path, "/admin/")
+	if admin && !h.authorizeAdmin(w, r) {
+		return
+	}
+	if h.diagnostics != nil && strings.HasPrefix(r.URL.Path, "/admin/debug/") {
+		h.diagnostics.ServeHTTP(w, r)
+		return
+	}
+	tenant, err := h.requestTenant(r, admin)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.handler.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+}
+
+// apiShutdownTimeout - сколько RunAPI ждёт завершения текущих запросов при остановке
+const apiShutdownTimeout = 10 * time.Second
+
+// RunAPI обслуживает REST API на addr, пока не отменён ctx,
+// после чего дожидается завершения текущих запросов
+func RunAPI(ctx context.Context, addr string, h APIHandler) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// потоки событий не завершаются сами, поэтому закрываются до ожидания запросов
+	srv.RegisterOnShutdown(h.events.close)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// serveParcels обрабатывает /parcels
+func (h APIHandler) serveParcels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req apiRegisterRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	p, err := h.service.Register(r.Context(), req.Client, req.Address)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/parcels/"+strconv.FormatInt(p.Number, 10))
+	writeJSON(w, http.StatusCreated, newAPIParcel(p))
+}
+
+// serveParcel обрабатывает /parcels/{number} и /parcels/{number}/{address|status|events}
+func (h APIHandler) serveParcel(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/parcels/"), "/")
+	number, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			h.getParcel(w, r, number)
+		case http.MethodDelete:
+			if err := h.service.Delete(r.Context(), number); err != nil {
+				h.writeError(w, r, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+		return
+	}
+
+	if parts[1] == "events" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		// подписываемся до чтения посылки, чтобы не пропустить изменения между ними
+		sub := h.events.subscribe(number, 0, 0)
+		p, err := h.service.Get(r.Context(), number)
+		if err != nil {
+			h.events.unsubscribe(sub)
+			h.writeError(w, r, err)
+			return
+		}
+		first := newAPIParcel(p)
+		h.events.serveEvents(w, r, sub, &first)
+		return
+	}
+
+	if r.Method != http.MethodPatch {
+		methodNotAllowed(w, http.MethodPatch)
+		return
+	}
+	switch parts[1] {
+	case "address":
+		var req apiAddressRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		err = h.service.ChangeAddress(r.Context(), number, req.Address)
+	case "status":
+		var req apiStatusRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		err = h.service.SetStatus(r.Context(), number, req.Status)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.getParcel(w, r, number)
+}
+
+// getParcel отвечает посылкой с раскрытиями из параметра include
+func (h APIHandler) getParcel(w http.ResponseWriter, r *http.Request, number int64) {
+	include := r.URL.Query().Get("include")
+	if include == "" {
+		p, err := h.service.Get(r.Context(), number)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPIParcel(p))
+		return
+	}
+
+	d, err := h.service.GetDetails(r.Context(), number, include)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIParcelDetails(d))
+}
+
+// serveClient обрабатывает /clients/{client}/parcels и /clients/{client}/events
+func (h APIHandler) serveClient(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/clients/"), "/")
+	client, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 || (parts[1] != "parcels" && parts[1] != "events") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if parts[1] == "events" {
+		if err := validateClient(client); err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		// в событиях адреса посылок, поэтому права те же, что у списка посылок клиента
+		if err := requireClient(r.Context(), client); err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		tenant, _ := TenantFrom(r.Context())
+		h.events.serveEvents(w, r, h.events.subscribe(0, client, tenant), nil)
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case query.Has("fields") && query.Has("include"):
+		h.writeError(w, r, ValidationError{Field: "fields", Message: "cannot be combined with include"})
+	case query.Has("fields"):
+		rows, err := h.service.ClientParcelsFields(r.Context(), client, query.Get("fields"))
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rows)
+	default:
+		details, err := h.service.ClientParcelsDetails(r.Context(), client, query.Get("include"))
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		res := make([]apiParcelDetails, len(details))
+		for i, d := range details {
+			res[i] = newAPIParcelDetails(d)
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// decodeJSON читает тело запроса в v и при ошибке сам отвечает 400
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request body: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// apiStatus возвращает HTTP-статус для ошибки сервиса
+func apiStatus(err error) int {
+	switch {
+	case isInvalidArgument(err):
+		return http.StatusBadRequest
+	case isNotFound(err):
+		return http.StatusNotFound
+	case isConflict(err):
+		return http.StatusConflict
+	case errors.Is(err, ErrHookRejected):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnauthenticated):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// isInvalidArgument сообщает, вызвана ли ошибка неверными входными данными
+func isInvalidArgument(err error) bool {
+	return errors.Is(err, ErrInvalidParcel) || errors.Is(err, ErrInvalidCursor) ||
+		errors.Is(err, ErrInvalidFilter) || errors.Is(err, ErrUnknownInclude) ||
+		errors.Is(err, ErrUnknownField) || errors.Is(err, ErrInvalidPhone)
+}
+
+// isNotFound сообщает, вызвана ли ошибка отсутствующим объектом
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrParcelNotFound) || errors.Is(err, ErrCourierNotFound) ||
+		errors.Is(err, ErrTenantNotFound) || errors.Is(err, ErrLocationNotFound) ||
+		errors.Is(err, ErrWebhookNotFound) || errors.Is(err, ErrAPIKeyNotFound)
+}
+
+// isConflict сообщает, запрещена ли операция текущим состоянием посылки
+func isConflict(err error) bool {
+	return errors.Is(err, ErrParcelLocked) || errors.Is(err, ErrForbiddenTransition) ||
+		errors.Is(err, ErrCancelNotAllowed) || errors.Is(err, ErrRouteCompleted)
+}
+
+// writeError отвечает ошибкой сервиса, как writeAPIError, и записывает
+// внутреннюю ошибку в журнал сервиса, см. logInternalError
+func (h APIHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if apiStatus(err) == http.StatusInternalServerError {
+		logInternalError(r.Context(), h.service.logger, "rest", err)
+	}
+	writeAPIError(w, err)
+}
+
+// writeAPIError отвечает ошибкой сервиса. Текст внутренних ошибок
+// не раскрывается клиенту
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := apiStatus(err)
+	body := apiError{Error: err.Error()}
+	var verr ValidationError
+	if errors.As(err, &verr) {
+		body.Field = verr.Field
+	}
+	if status == http.StatusInternalServerError {
+		body.Error = http.StatusText(status)
+	}
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow ...string) {
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: http.StatusText(http.StatusMethodNotAllowed)})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiCall выполняет запрос к handler и возвращает ответ
+func apiCall(t *testing.T, handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestAPIHandler проверяет основные операции REST API
+func TestAPIHandler(t *testing.T) {
+	service, _ := newTestService(t)
+	handler := NewAPIHandler(service)
+
+	// register
+	rec := apiCall(t, handler, http.MethodPost, "/parcels", `{"client": 1, "address": "Псков"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created apiParcel
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, ParcelStatusRegistered, created.Status)
+	assert.NotEmpty(t, created.Tracking)
+	assert.Equal(t, fmt.Sprintf("/parcels/%d", created.Number), rec.Header().Get("Location"))
+	url := rec.Header().Get("Location")
+
+	// get
+	rec = apiCall(t, handler, http.MethodGet, url, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got apiParcel
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, created, got)
+
+	rec = apiCall(t, handler, http.MethodGet, url+"?include=history", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"history":[`)
+
+	// change address
+	rec = apiCall(t, handler, http.MethodPatch, url+"/address", `{"address": "Тверь"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "Тверь", got.Address)
+
+	// client parcels
+	rec = apiCall(t, handler, http.MethodGet, "/clients/1/parcels", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list []apiParcelDetails
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, created.Number, list[0].Number)
+
+	rec = apiCall(t, handler, http.MethodGet, "/clients/1/parcels?fields=status", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, fmt.Sprintf(`[{"number": %d, "status": "registered"}]`, created.Number), rec.Body.String())
+
+	// change status
+	rec = apiCall(t, handler, http.MethodPatch, url+"/status", `{"status": "sent"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, ParcelStatusSent, got.Status)
+
+	// отправленную посылку нельзя удалить
+	rec = apiCall(t, handler, http.MethodDelete, url, "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// delete
+	rec = apiCall(t, handler, http.MethodPost, "/parcels", `{"client": 1, "address": "Псков"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = apiCall(t, handler, http.MethodDelete, rec.Header().Get("Location"), "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+// TestAPIHandlerErrors проверяет коды ответов для ошибок
+func TestAPIHandlerErrors(t *testing.T) {
+	service, _ := newTestService(t)
+	handler := NewAPIHandler(service)
+
+	rec := apiCall(t, handler, http.MethodPost, "/parcels", `{"client": 0, "address": "Псков"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var body apiError
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "client", body.Field)
+
+	rec = apiCall(t, handler, http.MethodPost, "/parcels", `{"client": 1, "address": "Псков", "extra": 1}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = apiCall(t, handler, http.MethodGet, "/parcels/1000", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = apiCall(t, handler, http.MethodGet, "/parcels/abc", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = apiCall(t, handler, http.MethodPut, "/parcels/1", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, DELETE", rec.Header().Get("Allow"))
+
+	rec = apiCall(t, handler, http.MethodPost, "/parcels", `{"client": 1, "address": "Псков"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := rec.Header().Get("Location")
+
+	rec = apiCall(t, handler, http.MethodPatch, url+"/status", `{"status": "delivered"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = apiCall(t, handler, http.MethodGet, "/clients/1/parcels?include=client", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// SOAP и значки доступны через тот же обработчик
+	rec = apiCall(t, handler, http.MethodGet, "/soap?wsdl", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = apiCall(t, handler, http.MethodGet, "/badge/TRK-000000.json", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
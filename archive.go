@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Archive переносит в таблицу parcel_archive доставленные посылки,
+// зарегистрированные раньше, чем olderThan назад, и возвращает их количество.
+// Перенос выполняется в одной транзакции, поэтому посылка не может
+// одновременно оказаться в обеих таблицах или пропасть из обеих
+func (s ParcelStore) Archive(olderThan time.Duration) (int, error) {
+	now := time.Now().UTC()
+	cutoff := now.Add(-olderThan).Format(time.RFC3339)
+
+	tx, err := s.db.BeginTx(s.context(), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(s.context(), "INSERT INTO parcel_archive ("+parcelColumns+", zone, archived_at, tenant_id) "+
+		"SELECT "+parcelColumns+", zone, :archived_at, tenant_id FROM parcel WHERE status = :status AND created_at < :cutoff AND "+tenantScope,
+		sql.Named("archived_at", now.Format(time.RFC3339)),
+		sql.Named("status", ParcelStatusDelivered),
+		sql.Named("cutoff", cutoff),
+		s.tenantArg())
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(s.context(), "DELETE FROM parcel WHERE status = :status AND created_at < :cutoff AND "+tenantScope,
+		sql.Named("status", ParcelStatusDelivered),
+		sql.Named("cutoff", cutoff),
+		s.tenantArg())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), tx.Commit()
+}
+
+// GetArchived возвращает посылку из архива по номеру
+func (s ParcelStore) GetArchived(number int64) (Parcel, error) {
+	return s.scanParcel(s.db.QueryRowContext(s.context(), "SELECT "+parcelColumns+" FROM parcel_archive WHERE number = :number AND "+tenantScope,
+		sql.Named("number", number), s.tenantArg()))
+}
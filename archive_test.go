@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestArchive проверяет перенос старых доставленных посылок в архив
+func TestArchive(t *testing.T) {
+	// prepare
+	// настраиваем подключение к БД из конфигурации
+	db := openTestDB(t)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+
+	// доставленная посылка, зарегистрированная два дня назад
+	old := getTestParcel()
+	old.Status = ParcelStatusDelivered
+	old.CreatedAt = time.Now().UTC().Add(-48 * time.Hour).Format(time.RFC3339)
+	oldID, err := store.Add(old)
+	require.NoError(t, err)
+	old.Number = oldID
+
+	// свежая доставленная посылка в архив попасть не должна
+	fresh := getTestParcel()
+	fresh.Status = ParcelStatusDelivered
+	freshID, err := store.Add(fresh)
+	require.NoError(t, err)
+
+	// archive
+	n, err := store.Archive(24 * time.Hour)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 1)
+
+	// check
+	_, err = store.Get(oldID)
+	require.Error(t, err)
+	archived, err := store.GetArchived(oldID)
+	require.NoError(t, err)
+	assert.Equal(t, old, archived)
+
+	_, err = store.Get(freshID)
+	require.NoError(t, err)
+	_, err = store.GetArchived(freshID)
+	require.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// DefaultMaxAttempts - после скольких неудачных попыток вручения посылка
+// по умолчанию возвращается отправителю
+const DefaultMaxAttempts = 3
+
+// Результаты попытки вручения
+const (
+	AttemptDelivered = "delivered"
+	AttemptFailed    = "failed"
+)
+
+// DeliveryAttempt - попытка вручить посылку получателю
+type DeliveryAttempt struct {
+	AttemptedAt string // RFC3339
+	Outcome     string // AttemptDelivered или AttemptFailed
+	Reason      string // причина неудачи, например "получатель не открыл дверь"
+}
+
+// AddAttempt сохраняет попытку вручения отправленной посылки. Удачная попытка
+// переводит посылку в статус delivered, а неудачная, если она maxFailed-я по счёту, -
+// в статус return_to_sender. Возвращает новый статус посылки или пустую строку,
+// если статус не изменился
+func (s ParcelStore) AddAttempt(number int64, a DeliveryAttempt, maxFailed int) (string, error) {
+	// новый статус определяется до транзакции, чтобы хуки не выполнялись
+	// под блокировкой записи, как и в Expire
+	var status string
+	switch a.Outcome {
+	case AttemptDelivered:
+		status = ParcelStatusDelivered
+	case AttemptFailed:
+		var failed int
+		err := s.db.QueryRowContext(s.context(), "SELECT COUNT(*) FROM parcel_delivery_attempts WHERE number = :number AND outcome = :outcome AND "+tenantScope,
+			sql.Named("number", number),
+			sql.Named("outcome", AttemptFailed),
+			s.tenantArg()).Scan(&failed)
+		if err != nil {
+			return "", err
+		}
+		if failed+1 >= maxFailed {
+			status = ParcelStatusReturnToSender
+		}
+	}
+	if status != "" {
+		if err := s.preStatusChange(number, status); err != nil {
+			return "", err
+		}
+	}
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(s.context(), "INSERT INTO parcel_delivery_attempts (number, attempted_at, outcome, reason, tenant_id) VALUES (:number, :attempted_at, :outcome, :reason, "+parcelTenant+")",
+			sql.Named("number", number),
+			sql.Named("attempted_at", a.AttemptedAt),
+			sql.Named("outcome", a.Outcome),
+			sql.Named("reason", a.Reason))
+		if err != nil || status == "" {
+			return err
+		}
+
+		res, err := tx.ExecContext(s.context(), "UPDATE parcel SET status = :new WHERE number = :number AND status = :sent AND "+tenantScope,
+			sql.Named("new", status),
+			sql.Named("number", number),
+			sql.Named("sent", ParcelStatusSent),
+			s.tenantArg())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: parcel %d is not sent", ErrForbiddenTransition, number)
+		}
+		comment := a.Reason
+		if status == ParcelStatusReturnToSender {
+			comment = fmt.Sprintf("%d failed delivery attempts", maxFailed)
+		}
+		return s.addStatusChange(tx, number, status, comment)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if status != "" {
+		s.notify(ParcelEvent{Type: ParcelEventStatusChanged, Number: number, Status: status})
+	}
+	return status, nil
+}
+
+// ListAttempts возвращает попытки вручения посылки в порядке их записи
+func (s ParcelStore) ListAttempts(number int64) ([]DeliveryAttempt, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT attempted_at, outcome, reason FROM parcel_delivery_attempts WHERE number = :number AND "+tenantScope+" ORDER BY id",
+		sql.Named("number", number), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []DeliveryAttempt{}
+	for rows.Next() {
+		var a DeliveryAttempt
+		if err := rows.Scan(&a.AttemptedAt, &a.Outcome, &a.Reason); err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+// WithMaxAttempts возвращает копию сервиса, которая возвращает посылку
+// отправителю после n неудачных попыток вручения
+func (s ParcelService) WithMaxAttempts(n int) ParcelService {
+	s.maxAttempts = n
+	return s
+}
+
+// RecordAttempt записывает попытку вручения отправленной посылки курьером.
+// Если время попытки не задано, используется текущее
+func (s ParcelService) RecordAttempt(ctx context.Context, number int64, a DeliveryAttempt) (err error) {
+	defer s.logOp(ctx, "record_attempt", time.Now(), &err, slog.Int64("number", number), slog.String("outcome", a.Outcome))
+	switch a.Outcome {
+	case AttemptDelivered:
+	case AttemptFailed:
+		if strings.TrimSpace(a.Reason) == "" {
+			return ValidationError{Field: "reason", Message: "must not be empty for a failed attempt"}
+		}
+	default:
+		return ValidationError{Field: "outcome", Message: fmt.Sprintf("must be %s or %s", AttemptDelivered, AttemptFailed)}
+	}
+	if a.AttemptedAt == "" {
+		a.AttemptedAt = time.Now().UTC().Format(time.RFC3339)
+	} else if _, err := time.Parse(time.RFC3339, a.AttemptedAt); err != nil {
+		return ValidationError{Field: "attempted_at", Message: "must be RFC3339 time"}
+	}
+
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if err := checkParcelAccess(ctx, accessStatus, parcel); err != nil {
+		return err
+	}
+	if parcel.Status != ParcelStatusSent {
+		return fmt.Errorf("%w: parcel %d is %s", ErrForbiddenTransition, number, parcel.Status)
+	}
+
+	_, err = s.store.WithContext(ctx).AddAttempt(number, a, s.maxAttempts)
+	return err
+}
+
+// ListAttempts возвращает попытки вручения посылки
+func (s ParcelService) ListAttempts(ctx context.Context, number int64) ([]DeliveryAttempt, error) {
+	if _, err := s.Get(ctx, number); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).ListAttempts(number)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeliveryAttempts проверяет возврат отправителю после неудачных попыток вручения
+func TestDeliveryAttempts(t *testing.T) {
+	service, _ := newTestService(t)
+	service = service.WithMaxAttempts(2)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	failed := DeliveryAttempt{Outcome: AttemptFailed, Reason: "получатель не отвечает"}
+
+	// до отправки попытки вручения не записываются
+	assert.ErrorIs(t, service.RecordAttempt(ctx, p.Number, failed), ErrForbiddenTransition)
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+
+	// первая неудача - посылка остаётся у курьера
+	require.NoError(t, service.RecordAttempt(ctx, p.Number, failed))
+	assertStatus(t, service, p.Number, ParcelStatusSent)
+
+	// вторая неудача - посылка возвращается отправителю
+	require.NoError(t, service.RecordAttempt(ctx, p.Number, failed))
+	assertStatus(t, service, p.Number, ParcelStatusReturnToSender)
+
+	attempts, err := service.ListAttempts(ctx, p.Number)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, AttemptFailed, attempts[1].Outcome)
+	assert.Equal(t, failed.Reason, attempts[1].Reason)
+	assert.NotEmpty(t, attempts[1].AttemptedAt)
+
+	history, err := service.GetStatusHistory(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "2 failed delivery attempts", history[len(history)-1].Comment)
+
+	assert.ErrorIs(t, service.RecordAttempt(ctx, p.Number, failed), ErrForbiddenTransition)
+	require.NoError(t, service.SetStatus(ctx, p.Number, ParcelStatusReturned))
+}
+
+// TestDeliveryAttemptDelivered проверяет вручение с попытки и проверку входных данных
+func TestDeliveryAttemptDelivered(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+
+	// validation
+	assert.ErrorIs(t, service.RecordAttempt(ctx, p.Number, DeliveryAttempt{Outcome: AttemptFailed}), ErrInvalidParcel)
+	assert.ErrorIs(t, service.RecordAttempt(ctx, p.Number, DeliveryAttempt{Outcome: "lost"}), ErrInvalidParcel)
+	assert.ErrorIs(t, service.RecordAttempt(ctx, p.Number, DeliveryAttempt{Outcome: AttemptDelivered, AttemptedAt: "yesterday"}), ErrInvalidParcel)
+
+	require.NoError(t, service.RecordAttempt(ctx, p.Number, DeliveryAttempt{Outcome: AttemptDelivered, AttemptedAt: "2024-01-01T10:00:00Z"}))
+	assertStatus(t, service, p.Number, ParcelStatusDelivered)
+
+	attempts, err := service.ListAttempts(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, []DeliveryAttempt{{AttemptedAt: "2024-01-01T10:00:00Z", Outcome: AttemptDelivered}}, attempts)
+}
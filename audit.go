@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Действия в журнале аудита
+const (
+	AuditAdd        = "add"
+	AuditUpdate     = "update"
+	AuditSetStatus  = "set_status"
+	AuditSetAddress = "set_address"
+	AuditDelete     = "delete"
+)
+
+// auditParcelColumns - колонки посылки, которые записываются при добавлении и удалении
+var auditParcelColumns = strings.Split(parcelColumns+", zone", ", ")
+
+// AuditEntry - запись журнала аудита: кто, когда и как изменил посылку.
+// Before и After - значения изменённых колонок parcel до и после изменения,
+// у добавления нет Before, у удаления - After
+type AuditEntry struct {
+	ID     int64           `json:"id"`
+	Number int64           `json:"number"`
+	Action string          `json:"action"`
+	Actor  string          `json:"actor"`
+	At     string          `json:"at"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditQuery - отбор записей журнала аудита. Пустые поля не ограничивают выборку,
+// From и To - RFC3339, To не включается
+type AuditQuery struct {
+	Number int64
+	Actor  string
+	From   string
+	To     string
+	Limit  int
+}
+
+// auditValues возвращает значения колонок columns посылки number в транзакции tx
+// или nil, если посылки нет
+func (s ParcelStore) auditValues(tx *sql.Tx, number int64, columns []string) (map[string]any, error) {
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err := tx.QueryRowContext(s.context(), "SELECT "+strings.Join(columns, ", ")+" FROM parcel WHERE number = :number AND "+tenantScope,
+		sql.Named("number", number),
+		s.tenantArg()).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]any, len(columns))
+	for i, column := range columns {
+		// текст драйвер может вернуть байтами, а в JSON нужна строка
+		if b, ok := values[i].([]byte); ok {
+			values[i] = string(b)
+		}
+		res[column] = values[i]
+	}
+	return res, nil
+}
+
+// addAudit добавляет запись в журнал аудита в рамках транзакции tx.
+// Удалённой посылки в parcel уже нет, и запись получает магазин хранилища
+func (s ParcelStore) addAudit(tx *sql.Tx, number int64, action string, before, after map[string]any) error {
+	encode := func(values map[string]any) (string, error) {
+		if values == nil {
+			return "", nil
+		}
+		data, err := json.Marshal(values)
+		return string(data), err
+	}
+	b, err := encode(before)
+	if err != nil {
+		return err
+	}
+	a, err := encode(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(s.context(), "INSERT INTO audit_log (number, action, actor, at, before, after, tenant_id) "+
+		"VALUES (:number, :action, :actor, :at, :before, :after, COALESCE("+parcelTenant+", :tenant))",
+		sql.Named("number", number),
+		sql.Named("action", action),
+		sql.Named("actor", s.actor),
+		sql.Named("at", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("before", b),
+		sql.Named("after", a),
+		s.tenantArg())
+	return err
+}
+
+// audited выполняет change в транзакции tx и записывает в журнал аудита
+// значения колонок columns посылки number до и после него.
+// Если значения не изменились, запись не добавляется
+func (s ParcelStore) audited(tx *sql.Tx, number int64, action string, columns []string, change func() error) error {
+	before, err := s.auditValues(tx, number, columns)
+	if err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	after, err := s.auditValues(tx, number, columns)
+	if err != nil || reflect.DeepEqual(before, after) {
+		return err
+	}
+	return s.addAudit(tx, number, action, before, after)
+}
+
+// auditedUpdate выполняет query, обновляющий колонки columns посылки number,
+// и записывает изменение в журнал аудита в одной транзакции
+func (s ParcelStore) auditedUpdate(number int64, columns []string, query string, args ...any) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		return s.audited(tx, number, AuditUpdate, columns, func() error {
+			_, err := tx.ExecContext(s.context(), query, args...)
+			return err
+		})
+	})
+}
+
+// ListAudit возвращает записи журнала аудита, подходящие под q, в порядке их добавления
+func (s ParcelStore) ListAudit(q AuditQuery) ([]AuditEntry, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT id, number, action, actor, at, before, after FROM audit_log "+
+		"WHERE (:number = 0 OR number = :number) AND (:actor = '' OR actor = :actor) "+
+		"AND (:from = '' OR at >= :from) AND (:to = '' OR at < :to) AND "+tenantScope+" ORDER BY id LIMIT :limit",
+		sql.Named("number", q.Number),
+		sql.Named("actor", q.Actor),
+		sql.Named("from", q.From),
+		sql.Named("to", q.To),
+		sql.Named("limit", q.Limit),
+		s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after string
+		if err := rows.Scan(&e.ID, &e.Number, &e.Action, &e.Actor, &e.At, &before, &after); err != nil {
+			return nil, err
+		}
+		// снимки хранят колонки посылки как в БД, то есть зашифрованными
+		if before, err = mapAuditValues(before, s.fields.decrypt); err != nil {
+			return nil, err
+		}
+		if after, err = mapAuditValues(after, s.fields.decrypt); err != nil {
+			return nil, err
+		}
+		if before != "" {
+			e.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			e.After = json.RawMessage(after)
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// AuditLog возвращает записи журнала аудита, подходящие под q. Журнал доступен
+// только администраторам. Limit по умолчанию DefaultPageSize, не больше MaxPageSize
+func (s ParcelService) AuditLog(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	if err := requireRole(ctx, RoleAdmin); err != nil {
+		return nil, err
+	}
+	if q.Number < 0 {
+		return nil, ValidationError{Field: "number", Message: "must be a positive integer"}
+	}
+	var err error
+	if q.From, err = auditBound("from", q.From); err != nil {
+		return nil, err
+	}
+	if q.To, err = auditBound("to", q.To); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		return nil, ValidationError{Field: "limit", Message: fmt.Sprintf("must not exceed %d", MaxPageSize)}
+	}
+	return s.store.WithContext(ctx).ListAudit(q)
+}
+
+// auditBound проверяет границу периода в AuditQuery. Время в журнале хранится
+// в UTC, поэтому граница приводится к нему для сравнения строк
+func auditBound(field, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", ValidationError{Field: field, Message: "must be RFC3339 time"}
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// serveAudit обрабатывает GET /audit?number=&actor=&from=&to=&limit=
+func (h APIHandler) serveAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	q := AuditQuery{Actor: query.Get("actor"), From: query.Get("from"), To: query.Get("to")}
+	if v := query.Get("number"); v != "" {
+		number, err := parseNumber(v)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		q.Number = number
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			h.writeError(w, r, ValidationError{Field: "limit", Message: "must be a positive integer"})
+			return
+		}
+		q.Limit = limit
+	}
+
+	entries, err := h.service.AuditLog(r.Context(), q)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuditLog проверяет запись изменений посылок в журнал аудита и отбор записей
+func TestAuditLog(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	admin := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleAdmin, Tenant: DefaultTenant})
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	removed, err := service.Register(ctx, 7, "Тверь")
+	require.NoError(t, err)
+
+	// add
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Орёл"))
+	require.NoError(t, service.SetPriority(admin, p.Number, PriorityExpress))
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	require.NoError(t, service.Delete(ctx, removed.Number))
+
+	// check
+	entries, err := service.AuditLog(ctx, AuditQuery{Number: p.Number})
+	require.NoError(t, err)
+	actions := make([]string, len(entries))
+	for i, e := range entries {
+		actions[i] = e.Action
+	}
+	assert.Equal(t, []string{AuditAdd, AuditSetAddress, AuditUpdate, AuditSetStatus}, actions)
+	assert.Empty(t, entries[0].Before)
+	assert.JSONEq(t, `{"address":"Псков","zone":"псков"}`, string(entries[1].Before))
+	assert.JSONEq(t, `{"address":"Орёл","zone":"орёл"}`, string(entries[1].After))
+	assert.JSONEq(t, `{"priority":"express"}`, string(entries[2].After))
+	assert.Equal(t, "user:anna", entries[2].Actor)
+	assert.JSONEq(t, `{"status":"registered"}`, string(entries[3].Before))
+	assert.JSONEq(t, `{"status":"sent"}`, string(entries[3].After))
+
+	var added map[string]any
+	require.NoError(t, json.Unmarshal(entries[0].After, &added))
+	assert.Equal(t, "Псков", added["address"])
+	assert.Equal(t, ParcelStatusRegistered, added["status"])
+
+	entries, err = service.AuditLog(ctx, AuditQuery{Number: removed.Number})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, AuditDelete, entries[1].Action)
+	assert.Empty(t, entries[1].After)
+	assert.Contains(t, string(entries[1].Before), `"address":"Тверь"`)
+
+	entries, err = service.AuditLog(ctx, AuditQuery{Actor: "user:anna"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	entries, err = service.AuditLog(ctx, AuditQuery{From: time.Now().Add(time.Hour).Format(time.RFC3339)})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	entries, err = service.AuditLog(ctx, AuditQuery{To: time.Now().Add(time.Hour).Format(time.RFC3339), Limit: 3})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	_, err = service.AuditLog(ctx, AuditQuery{From: "вчера"})
+	var verr ValidationError
+	assert.ErrorAs(t, err, &verr)
+	dispatcher := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "oleg", Role: RoleDispatcher, Tenant: DefaultTenant})
+	_, err = service.AuditLog(dispatcher, AuditQuery{})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// журнал только дополняется
+	_, err = store.db.Exec("UPDATE audit_log SET actor = 'someone'")
+	assert.Error(t, err)
+	_, err = store.db.Exec("DELETE FROM audit_log")
+	assert.Error(t, err)
+}
+
+// TestAuditAPI проверяет GET /audit
+func TestAuditAPI(t *testing.T) {
+	service, _ := newTestService(t)
+	handler := NewAPIHandler(service)
+
+	// prepare
+	p, err := service.Register(context.Background(), 7, "Псков")
+	require.NoError(t, err)
+
+	// check
+	rec := apiCall(t, handler, http.MethodGet, fmt.Sprintf("/audit?number=%d", p.Number), "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var entries []AuditEntry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, AuditAdd, entries[0].Action)
+
+	rec = apiCall(t, handler, http.MethodGet, "/audit?number=abc", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiCall(t, handler, http.MethodGet, "/audit?from=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
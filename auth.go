@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnauthenticated возвращается, если запрос не содержит действующего ключа API или токена
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// ErrAPIKeyNotFound возвращается, если ключа API с указанным идентификатором нет
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// Виды субъектов запроса
+const (
+	PrincipalAPIKey = "apikey" // сервис, предъявивший ключ API
+	PrincipalUser   = "user"   // пользователь с токеном сессии
+)
+
+// APIKeyHeader - заголовок, в котором сервисы передают ключ API.
+// Токен пользователя передаётся в заголовке "Authorization: Bearer <token>"
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix отличает ключи трекера от других секретов, например в логах
+const apiKeyPrefix = "trk_"
+
+// tokenIssuer - издатель токенов сессий в поле iss
+const tokenIssuer = "tracker"
+
+// Principal - тот, от чьего имени выполняется запрос
+type Principal struct {
+	Kind    string // PrincipalAPIKey или PrincipalUser
+	Subject string // имя ключа или пользователь из токена
+	Role    string // RoleAdmin, RoleDispatcher, RoleCourier или RoleClient
+	Client  int64  // клиент для RoleClient
+	Courier int    // курьер для RoleCourier
+	Tenant  int64  // магазин, в котором работает субъект
+}
+
+// Actor возвращает исполнителя для истории изменений, например "user:anna"
+func (p Principal) Actor() string {
+	return p.Kind + ":" + p.Subject
+}
+
+type principalKey struct{}
+
+// WithPrincipal возвращает контекст с субъектом запроса
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom возвращает субъект запроса, сохранённый WithPrincipal
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// APIKey - ключ API сервиса. Сам ключ не хранится: в БД записан только
+// его SHA-256, а Prefix помогает узнать ключ в списке
+type APIKey struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Prefix    string `json:"prefix"`
+	Role      string `json:"role"` // RoleAdmin или RoleDispatcher
+	Tenant    int64  `json:"tenant"`
+	CreatedAt string `json:"created_at"`
+}
+
+// hashAPIKey возвращает хеш ключа для хранения в БД. Ключ случаен и длинен,
+// поэтому медленный хеш паролей не нужен
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddAPIKey сохраняет ключ с хешем hash и возвращает его идентификатор
+func (s ParcelStore) AddAPIKey(k APIKey, hash string) (int, error) {
+	res, err := s.db.ExecContext(s.context(), "INSERT INTO api_key (name, prefix, role, hash, created_at, tenant_id) VALUES (:name, :prefix, :role, :hash, :created_at, :tenant)",
+		sql.Named("name", k.Name),
+		sql.Named("prefix", k.Prefix),
+		sql.Named("role", k.Role),
+		sql.Named("hash", hash),
+		sql.Named("created_at", k.CreatedAt),
+		s.tenantArg())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// ListAPIKeys возвращает все ключи API магазина
+func (s ParcelStore) ListAPIKeys() ([]APIKey, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT id, name, prefix, role, tenant_id, created_at FROM api_key WHERE "+tenantScope+" ORDER BY id",
+		s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.Role, &k.Tenant, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, k)
+	}
+	return res, rows.Err()
+}
+
+// DeleteAPIKey удаляет ключ или возвращает sql.ErrNoRows
+func (s ParcelStore) DeleteAPIKey(id int) error {
+	res, err := s.db.ExecContext(s.context(), "DELETE FROM api_key WHERE id = :id AND "+tenantScope, sql.Named("id", id), s.tenantArg())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// apiKeyByHash возвращает ключ с хешем hash или sql.ErrNoRows. Ищет во всех
+// магазинах: магазин запроса определяется найденным ключом.
+// Читает основную БД, чтобы отозванный ключ не действовал, пока реплика отстаёт
+func (s ParcelStore) apiKeyByHash(hash string) (APIKey, error) {
+	var k APIKey
+	err := s.db.QueryRowContext(s.context(), "SELECT id, name, prefix, role, tenant_id, created_at FROM api_key WHERE hash = :hash", sql.Named("hash", hash)).
+		Scan(&k.ID, &k.Name, &k.Prefix, &k.Role, &k.Tenant, &k.CreatedAt)
+	return k, err
+}
+
+// CreateAPIKey создаёт ключ API с именем name и ролью role. Ключи выдаются
+// сервисам, поэтому роль - RoleAdmin или RoleDispatcher. Ключ возвращается
+// только здесь, повторно узнать его нельзя
+func (s ParcelService) CreateAPIKey(ctx context.Context, name, role string) (APIKey, string, error) {
+	if err := requireRole(ctx, RoleAdmin); err != nil {
+		return APIKey{}, "", err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return APIKey{}, "", ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if role != RoleAdmin && role != RoleDispatcher {
+		return APIKey{}, "", ValidationError{Field: "role", Message: fmt.Sprintf("must be %s or %s", RoleAdmin, RoleDispatcher)}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	store := s.store.WithContext(ctx)
+	k := APIKey{Name: name, Prefix: key[:len(apiKeyPrefix)+6], Role: role, Tenant: store.tenant, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	id, err := store.AddAPIKey(k, hashAPIKey(key))
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	k.ID = id
+	return k, key, nil
+}
+
+// ListAPIKeys возвращает все ключи API без самих ключей
+func (s ParcelService) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	if err := requireRole(ctx, RoleAdmin); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).ListAPIKeys()
+}
+
+// RevokeAPIKey удаляет ключ или возвращает ErrAPIKeyNotFound
+func (s ParcelService) RevokeAPIKey(ctx context.Context, id int) error {
+	if err := requireRole(ctx, RoleAdmin); err != nil {
+		return err
+	}
+	err := s.store.WithContext(ctx).DeleteAPIKey(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %d", ErrAPIKeyNotFound, id)
+	}
+	return err
+}
+
+// sessionClaims - поля токена сессии пользователя
+type sessionClaims struct {
+	Role    string `json:"role"`
+	Client  int64  `json:"client,omitempty"`
+	Courier int    `json:"courier,omitempty"`
+	Tenant  int64  `json:"tenant,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Authenticator проверяет ключи API по БД и токены сессий по подписи HS256
+type Authenticator struct {
+	store     ParcelStore
+	jwtSecret []byte
+	now       func() time.Time
+}
+
+// NewAuthenticator создаёт проверку запросов. Пустой jwtSecret отключает
+// токены сессий, и принимаются только ключи API
+func NewAuthenticator(store ParcelStore, jwtSecret string) *Authenticator {
+	return &Authenticator{store: store, jwtSecret: []byte(jwtSecret), now: time.Now}
+}
+
+// IssueToken выпускает токен сессии пользователя p.Subject с ролью p.Role
+// в магазине p.Tenant (по умолчанию DefaultTenant) на ttl
+func (a *Authenticator) IssueToken(p Principal, ttl time.Duration) (string, error) {
+	if len(a.jwtSecret) == 0 {
+		return "", errors.New("jwt secret is not configured")
+	}
+	if p.Subject == "" {
+		return "", ValidationError{Field: "subject", Message: "must not be empty"}
+	}
+	if err := validateRole(p); err != nil {
+		return "", err
+	}
+	if ttl <= 0 {
+		return "", ValidationError{Field: "ttl", Message: "must be positive"}
+	}
+	if p.Tenant == 0 {
+		p.Tenant = DefaultTenant
+	}
+
+	now := a.now()
+	claims := sessionClaims{
+		Role:    p.Role,
+		Client:  p.Client,
+		Courier: p.Courier,
+		Tenant:  p.Tenant,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   p.Subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.jwtSecret)
+}
+
+// Authenticate возвращает субъект запроса по ключу API или токену сессии.
+// Без них или при неверных данных возвращает ErrUnauthenticated
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	return a.authenticate(r.Context(), r.Header.Get(APIKeyHeader), r.Header.Get("Authorization"))
+}
+
+// authenticate проверяет ключ API key, а без него - значение authorization
+// вида "Bearer <токен>". Так проверяются и запросы REST, и вызовы gRPC
+func (a *Authenticator) authenticate(ctx context.Context, key, authorization string) (Principal, error) {
+	if key != "" {
+		k, err := a.store.WithContext(ctx).apiKeyByHash(hashAPIKey(key))
+		if errors.Is(err, sql.ErrNoRows) {
+			return Principal{}, fmt.Errorf("%w: unknown api key", ErrUnauthenticated)
+		}
+		if err != nil {
+			return Principal{}, err
+		}
+		return Principal{Kind: PrincipalAPIKey, Subject: k.Name, Role: k.Role, Tenant: k.Tenant}, nil
+	}
+
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || len(a.jwtSecret) == 0 {
+		return Principal{}, fmt.Errorf("%w: api key or bearer token required", ErrUnauthenticated)
+	}
+	var claims sessionClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) { return a.jwtSecret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(a.now))
+	if err != nil || claims.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: invalid bearer token", ErrUnauthenticated)
+	}
+	p := Principal{Kind: PrincipalUser, Subject: claims.Subject, Role: claims.Role, Client: claims.Client, Courier: claims.Courier, Tenant: claims.Tenant}
+	if p.Tenant == 0 {
+		p.Tenant = DefaultTenant
+	}
+	if validateRole(p) != nil {
+		return Principal{}, fmt.Errorf("%w: invalid role in bearer token", ErrUnauthenticated)
+	}
+	return p, nil
+}
+
+// publicAPIPaths открыты без авторизации: публичное отслеживание, значки и спецификация.
+// Адреса /admin/ проверяют собственный токен, см. WithAdminToken
+var publicAPIPaths = []string{"/track/", "/badge/", "/openapi.yaml", "/admin/"}
+
+// WithAuth возвращает копию обработчика, которая требует ключ API или токен
+// сессии для всех адресов, кроме publicAPIPaths. Субъект запроса доступен
+// обработчикам через PrincipalFrom и записывается исполнителем изменений
+func (h APIHandler) WithAuth(a *Authenticator) APIHandler {
+	h.auth = a
+	return h
+}
+
+// authenticate проверяет запрос и возвращает его с субъектом в контексте.
+// Если проверка не пройдена, отвечает 401 и возвращает nil
+func (h APIHandler) authenticate(w http.ResponseWriter, r *http.Request) *http.Request {
+	if h.auth == nil {
+		return r
+	}
+	for _, prefix := range publicAPIPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return r
+		}
+	}
+
+	p, err := h.auth.Authenticate(r)
+	if errors.Is(err, ErrUnauthenticated) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="tracker"`)
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: err.Error()})
+		return nil
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return nil
+	}
+	return r.WithContext(WithPrincipal(r.Context(), p))
+}
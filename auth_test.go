@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAPIKeys проверяет создание, проверку и отзыв ключей API
+func TestAPIKeys(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	auth := NewAuthenticator(store, "")
+
+	// add
+	k, key, err := service.CreateAPIKey(ctx, "billing", RoleDispatcher)
+	require.NoError(t, err)
+
+	// check
+	assert.True(t, strings.HasPrefix(key, k.Prefix))
+	keys, err := service.ListAPIKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "billing", keys[0].Name)
+
+	req := httptest.NewRequest(http.MethodGet, "/parcels/1", nil)
+	req.Header.Set(APIKeyHeader, key)
+	p, err := auth.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, Principal{Kind: PrincipalAPIKey, Subject: "billing", Role: RoleDispatcher, Tenant: DefaultTenant}, p)
+
+	require.NoError(t, service.RevokeAPIKey(ctx, k.ID))
+	_, err = auth.Authenticate(req)
+	require.ErrorIs(t, err, ErrUnauthenticated)
+	require.ErrorIs(t, service.RevokeAPIKey(ctx, k.ID), ErrAPIKeyNotFound)
+
+	_, _, err = service.CreateAPIKey(ctx, " ", RoleDispatcher)
+	var verr ValidationError
+	require.ErrorAs(t, err, &verr)
+	_, _, err = service.CreateAPIKey(ctx, "billing", RoleCourier)
+	require.ErrorAs(t, err, &verr)
+}
+
+// TestSessionTokens проверяет выпуск и проверку токенов сессий
+func TestSessionTokens(t *testing.T) {
+	_, store := newTestService(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := NewAuthenticator(store, "secret")
+	auth.now = func() time.Time { return now }
+	bearer := func(token string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/parcels/1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	// prepare
+	anna := Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleClient, Client: 7, Tenant: DefaultTenant}
+	token, err := auth.IssueToken(anna, time.Hour)
+	require.NoError(t, err)
+
+	// check
+	p, err := auth.Authenticate(bearer(token))
+	require.NoError(t, err)
+	assert.Equal(t, anna, p)
+	assert.Equal(t, "user:anna", p.Actor())
+
+	other := NewAuthenticator(store, "other")
+	other.now = auth.now
+	_, err = other.Authenticate(bearer(token))
+	require.ErrorIs(t, err, ErrUnauthenticated)
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "anna", "role": RoleAdmin, "iss": tokenIssuer, "exp": now.Add(time.Hour).Unix()}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = auth.Authenticate(bearer(none))
+	require.ErrorIs(t, err, ErrUnauthenticated)
+
+	now = now.Add(2 * time.Hour)
+	_, err = auth.Authenticate(bearer(token))
+	require.ErrorIs(t, err, ErrUnauthenticated)
+
+	_, err = NewAuthenticator(store, "").IssueToken(anna, time.Hour)
+	require.Error(t, err)
+	_, err = auth.IssueToken(Principal{Subject: "anna", Role: RoleCourier}, time.Hour)
+	require.Error(t, err, "курьеру нужен идентификатор курьера")
+	_, err = auth.Authenticate(httptest.NewRequest(http.MethodGet, "/parcels/1", nil))
+	require.ErrorIs(t, err, ErrUnauthenticated)
+}
+
+// TestAPIAuth проверяет, что WithAuth закрывает API, оставляя публичные адреса открытыми
+func TestAPIAuth(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	handler := NewAPIHandler(service).WithAuth(NewAuthenticator(store, "secret"))
+
+	// prepare
+	_, key, err := service.CreateAPIKey(ctx, "billing", RoleDispatcher)
+	require.NoError(t, err)
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+
+	// check
+	rec := apiCall(t, handler, http.MethodGet, "/parcels/1", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+
+	rec = apiCall(t, handler, http.MethodGet, "/track/"+p.Tracking, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = apiCall(t, handler, http.MethodGet, "/openapi.yaml", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// add
+	req := httptest.NewRequest(http.MethodPost, "/parcels", strings.NewReader(`{"client":7,"address":"Тверь"}`))
+	req.Header.Set(APIKeyHeader, key)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	// исполнителем изменений записывается субъект запроса
+	var created apiParcel
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	history, err := store.GetStatusHistory(created.Number)
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	assert.Equal(t, "apikey:billing", history[0].Actor)
+}
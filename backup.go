@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"modernc.org/sqlite"
+)
+
+// backupPagesPerStep - сколько страниц копируется за один шаг online backup.
+// Между шагами БД не заблокирована и сервис продолжает принимать запросы
+const backupPagesPerStep = 256
+
+// sqliteBackuper - методы соединения драйвера modernc.org/sqlite для online backup
+type sqliteBackuper interface {
+	NewBackup(dstUri string) (*sqlite.Backup, error)
+	NewRestore(srcUri string) (*sqlite.Backup, error)
+}
+
+// Backup записывает в w согласованный снимок основной БД,
+// используя online backup SQLite, поэтому его можно делать на работающем сервисе
+func (s ParcelStore) Backup(ctx context.Context, w io.Writer) error {
+	dir, err := os.MkdirTemp("", "tracker-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	err = s.withBackuper(ctx, func(b sqliteBackuper) error {
+		backup, err := b.NewBackup(path)
+		if err != nil {
+			return err
+		}
+		return runBackup(ctx, backup)
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// RestoreFrom заменяет содержимое основной БД снимком, прочитанным из r
+// (например, созданным Backup), и применяет к нему недостающие миграции
+func (s ParcelStore) RestoreFrom(ctx context.Context, r io.Reader) error {
+	dir, err := os.MkdirTemp("", "tracker-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "restore.db")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	err = s.withBackuper(ctx, func(b sqliteBackuper) error {
+		restore, err := b.NewRestore(path)
+		if err != nil {
+			return err
+		}
+		return runBackup(ctx, restore)
+	})
+	if err != nil {
+		return err
+	}
+
+	return migrate(s.db)
+}
+
+// withBackuper вызывает fn с соединением драйвера SQLite из пула основной БД
+func (s ParcelStore) withBackuper(ctx context.Context, fn func(sqliteBackuper) error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		// соединение может быть обёрнуто журналом запросов, см. openSQL
+		if w, ok := driverConn.(interface{ Unwrap() driver.Conn }); ok {
+			driverConn = w.Unwrap()
+		}
+		b, ok := driverConn.(sqliteBackuper)
+		if !ok {
+			return errors.New("backup is supported only for sqlite")
+		}
+		return fn(b)
+	})
+}
+
+// runBackup копирует страницы порциями до завершения или отмены ctx
+func runBackup(ctx context.Context, backup *sqlite.Backup) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(err, backup.Finish())
+		}
+
+		more, err := backup.Step(backupPagesPerStep)
+		if err != nil {
+			return errors.Join(err, backup.Finish())
+		}
+		if !more {
+			return backup.Finish()
+		}
+	}
+}
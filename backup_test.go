@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBackupRestore проверяет, что снимок БД восстанавливается в другой БД
+func TestBackupRestore(t *testing.T) {
+	// prepare
+	dir := t.TempDir()
+	src, err := OpenDB(filepath.Join(dir, "src.db"))
+	require.NoError(t, err)
+	defer src.Close()
+	srcStore, err := NewParcelStore(src)
+	require.NoError(t, err)
+
+	parcel := getTestParcel()
+	id, err := srcStore.Add(parcel)
+	require.NoError(t, err)
+	parcel.Number = id
+
+	// backup
+	var buf bytes.Buffer
+	require.NoError(t, srcStore.Backup(context.Background(), &buf))
+	require.NotZero(t, buf.Len())
+
+	// restore
+	// восстанавливаем снимок в пустую БД и проверяем, что посылка на месте
+	dst, err := OpenDB(filepath.Join(dir, "dst.db"))
+	require.NoError(t, err)
+	defer dst.Close()
+	dstStore, err := NewParcelStore(dst)
+	require.NoError(t, err)
+
+	require.NoError(t, dstStore.RestoreFrom(context.Background(), &buf))
+
+	stored, err := dstStore.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, parcel, stored)
+}
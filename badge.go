@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// badgeColors задаёт цвет значка для каждого статуса посылки
+var badgeColors = map[string]string{
+	ParcelStatusRegistered: "#9f9f9f",
+	ParcelStatusSent:       "#007ec6",
+	ParcelStatusDelivered:  "#4c1",
+	ParcelStatusCancelled:  "#e05d44",
+}
+
+// badgeStatus - JSON-ответ виджета
+type badgeStatus struct {
+	Tracking string `json:"tracking_number"`
+	Status   string `json:"status"`
+}
+
+// maxBadgeEntries ограничивает число статусов в кэше BadgeHandler:
+// адрес значка открыт без авторизации, и кэш не должен расти без предела
+const maxBadgeEntries = 10000
+
+type badgeEntry struct {
+	status  string
+	expires time.Time
+}
+
+// BadgeHandler отдаёт текущий статус посылки для встраивания на страницы магазинов:
+// GET <prefix>/<tracking>.json - небольшой JSON, GET <prefix>/<tracking>.svg - значок.
+// Посылка ищется по коду отслеживания, а не по номеру, который легко подобрать.
+// Статусы найденных посылок кэшируются в памяти на ttl, но не больше
+// maxBadgeEntries, а ответы разрешено кэшировать браузерам и CDN на тот же срок
+type BadgeHandler struct {
+	service ParcelService
+	ttl     time.Duration
+
+	mu    *sync.Mutex
+	cache map[string]badgeEntry
+	size  int // максимальное число записей в cache
+}
+
+func NewBadgeHandler(service ParcelService, ttl time.Duration) BadgeHandler {
+	return BadgeHandler{
+		service: service,
+		ttl:     ttl,
+		mu:      &sync.Mutex{},
+		cache:   map[string]badgeEntry{},
+		size:    maxBadgeEntries,
+	}
+}
+
+func (h BadgeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Base(r.URL.Path)
+	ext := path.Ext(name)
+	tracking := strings.ToUpper(strings.TrimSuffix(name, ext))
+	if tracking == "" || (ext != ".json" && ext != ".svg") {
+		http.NotFound(w, r)
+		return
+	}
+
+	status, err := h.status(r.Context(), tracking)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%s"`, tracking, status)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.ttl.Seconds())))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if ext == ".svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		fmt.Fprint(w, badgeSVG(status))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(badgeStatus{Tracking: tracking, Status: status})
+}
+
+// status возвращает статус посылки из кэша или из сервиса
+func (h BadgeHandler) status(ctx context.Context, tracking string) (string, error) {
+	now := time.Now()
+
+	h.mu.Lock()
+	entry, ok := h.cache[tracking]
+	if ok && !now.Before(entry.expires) {
+		delete(h.cache, tracking)
+	}
+	h.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.status, nil
+	}
+
+	// коды уникальны на весь экземпляр, поэтому значок не зависит от магазина.
+	// Ненайденные коды не кэшируются, иначе перебор кодов заполнил бы кэш
+	p, err := h.service.GetByTrackingNumber(WithTenant(ctx, 0), tracking)
+	if err != nil {
+		return "", err
+	}
+
+	h.mu.Lock()
+	h.store(tracking, badgeEntry{status: p.Status, expires: now.Add(h.ttl)}, now)
+	h.mu.Unlock()
+
+	return p.Status, nil
+}
+
+// store кладёт запись в кэш. Если кэш заполнен, из него сначала удаляются
+// устаревшие записи, а если их нет - произвольная запись. Вызывается под h.mu
+func (h BadgeHandler) store(tracking string, entry badgeEntry, now time.Time) {
+	if _, ok := h.cache[tracking]; !ok && len(h.cache) >= h.size {
+		for k, e := range h.cache {
+			if !now.Before(e.expires) {
+				delete(h.cache, k)
+			}
+		}
+		for k := range h.cache {
+			if len(h.cache) < h.size {
+				break
+			}
+			delete(h.cache, k)
+		}
+	}
+	h.cache[tracking] = entry
+}
+
+// badgeSVG рисует значок в стиле shields.io с подписью "parcel" и статусом
+func badgeSVG(status string) string {
+	color, ok := badgeColors[status]
+	if !ok {
+		color = "#9f9f9f"
+	}
+	// ширина текста оценивается по 7 пикселей на символ
+	labelWidth := 50
+	statusWidth := 7*len(status) + 10
+	width := labelWidth + statusWidth
+	text := html.EscapeString(status)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="parcel: %s">`+
+		`<rect width="%d" height="20" fill="#555"/>`+
+		`<rect x="%d" width="%d" height="20" fill="%s"/>`+
+		`<g fill="#fff" font-family="Verdana,sans-serif" font-size="11">`+
+		`<text x="6" y="14">parcel</text><text x="%d" y="14">%s</text></g></svg>`,
+		width, text, labelWidth, labelWidth, statusWidth, color, labelWidth+5, text)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBadgeHandler проверяет JSON и SVG виджета статуса и заголовки кэширования
+func TestBadgeHandler(t *testing.T) {
+	// prepare
+	db, err := OpenDB(filepath.Join(t.TempDir(), "badge.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+	service := NewParcelService(store)
+	handler := NewBadgeHandler(service, time.Minute)
+
+	p, err := service.Register(context.Background(), 1, "test")
+	require.NoError(t, err)
+	require.NotEmpty(t, p.Tracking)
+	tracking := p.Tracking
+
+	// json
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/badge/"+tracking+".json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "public, max-age=60", rec.Header().Get("Cache-Control"))
+
+	var body badgeStatus
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, badgeStatus{Tracking: p.Tracking, Status: ParcelStatusRegistered}, body)
+
+	// svg
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/badge/"+tracking+".svg", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), ParcelStatusRegistered)
+
+	// статус берётся из кэша даже после изменения в БД
+	require.NoError(t, service.NextStatus(context.Background(), p.Number))
+	etag := rec.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/badge/"+tracking+".svg", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	// по номеру посылки значок не отдаётся
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/badge/"+strconv.FormatInt(p.Number, 10)+".json", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// not found
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/badge/TRK-000000.json", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+// TestBadgeHandlerCacheBounded проверяет, что кэш значков не растёт без предела
+func TestBadgeHandlerCacheBounded(t *testing.T) {
+	// prepare
+	db, err := OpenDB(filepath.Join(t.TempDir(), "badge.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+	service := NewParcelService(store)
+	handler := NewBadgeHandler(service, time.Minute)
+	handler.size = 2
+	get := func(tracking string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/badge/"+tracking+".json", nil))
+		return rec.Code
+	}
+
+	// ненайденные коды не кэшируются
+	assert.Equal(t, http.StatusNotFound, get("TRK-000000"))
+	assert.Empty(t, handler.cache)
+
+	// устаревшая запись удаляется при заполнении кэша
+	handler.cache["TRK-EXPIRED"] = badgeEntry{status: ParcelStatusSent, expires: time.Now().Add(-time.Second)}
+	var tracking []string
+	for i := 0; i < 3; i++ {
+		p, err := service.Register(context.Background(), 1, "test")
+		require.NoError(t, err)
+		tracking = append(tracking, p.Tracking)
+	}
+	require.Equal(t, http.StatusOK, get(tracking[0]))
+	require.Equal(t, http.StatusOK, get(tracking[1]))
+	assert.Len(t, handler.cache, 2)
+	assert.NotContains(t, handler.cache, "TRK-EXPIRED")
+
+	// заполненный кэш вытесняет запись, а не растёт
+	require.Equal(t, http.StatusOK, get(tracking[2]))
+	assert.Len(t, handler.cache, 2)
+	assert.Contains(t, handler.cache, tracking[2])
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// GetMany возвращает посылки с номерами numbers, упорядоченные по номеру.
+// Отсутствующие номера пропускаются
+func (s ParcelStore) GetMany(numbers []int64) ([]Parcel, error) {
+	if len(numbers) == 0 {
+		return []Parcel{}, nil
+	}
+
+	in, args := namedList(numbers)
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE number IN ("+in+") AND "+tenantScope+" ORDER BY number", append(args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// AddBatch добавляет посылки ps в одной транзакции и возвращает их номера
+// в том же порядке. Хуки вызываются до транзакции, отказ любого хука
+// отменяет всю партию
+func (s ParcelStore) AddBatch(ps []Parcel) (_ []int64, err error) {
+	s, span := s.startSpan("add_batch")
+	defer func() { endSpan(span, err) }()
+	defer s.logOp("add_batch", time.Now(), &err, slog.Int("parcels", len(ps)))
+	sealed := make([]Parcel, len(ps))
+	for i, p := range ps {
+		if err := s.preAdd(p); err != nil {
+			return nil, err
+		}
+		if sealed[i], err = s.sealParcel(p); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]int64, len(ps))
+	err = s.inTx(func(tx *sql.Tx) (err error) {
+		for i, p := range ps {
+			if ids[i], err = s.insertParcel(tx, p, sealed[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, p := range ps {
+		s.notify(ParcelEvent{Type: ParcelEventAdded, Number: ids[i], Client: p.Client, Status: p.Status, Address: p.Address})
+	}
+	return ids, nil
+}
+
+// SetStatuses переводит посылки в статус status в одной транзакции.
+// expected - статус каждой посылки, по которому проверялся переход: если он
+// изменился до обновления, вся транзакция откатывается с ErrForbiddenTransition.
+// Хуки вызываются до транзакции, отказ любого хука отменяет всю операцию.
+// Возвращает число обновлённых посылок
+func (s ParcelStore) SetStatuses(expected map[int64]string, status string) (int, error) {
+	numbers := make([]int64, 0, len(expected))
+	for number := range expected {
+		if err := s.preStatusChange(number, status); err != nil {
+			return 0, fmt.Errorf("parcel %d: %w", number, err)
+		}
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	updated := 0
+	err := s.inTx(func(tx *sql.Tx) error {
+		updated = 0
+		for _, number := range numbers {
+			res, err := tx.ExecContext(s.context(), "UPDATE parcel SET status = :status WHERE number = :number AND status = :expected AND "+tenantScope,
+				sql.Named("status", status),
+				sql.Named("number", number),
+				sql.Named("expected", expected[number]),
+				s.tenantArg())
+			if err != nil {
+				return err
+			}
+			changed, err := s.recordStatusChange(tx, res, number, status)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				return fmt.Errorf("%w: parcel %d is no longer %s", ErrForbiddenTransition, number, expected[number])
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, number := range numbers {
+		s.notify(ParcelEvent{Type: ParcelEventStatusChanged, Number: number, Status: status})
+	}
+	return updated, nil
+}
+
+// AssignCouriers назначает курьера посылкам numbers в одной транзакции.
+// Если какая-либо посылка уже доставлена или не в пути, транзакция
+// откатывается с ErrForbiddenTransition. Возвращает число обновлённых посылок
+func (s ParcelStore) AssignCouriers(numbers []int64, courierID int) (int, error) {
+	var updated int64
+	err := s.inTx(func(tx *sql.Tx) error {
+		updated = 0
+		for _, number := range numbers {
+			var n int64
+			err := s.audited(tx, number, AuditUpdate, []string{"courier_id"}, func() error {
+				res, err := tx.ExecContext(s.context(), "UPDATE parcel SET courier_id = :courier WHERE number = :number AND status IN (:registered, :sent) AND "+tenantScope,
+					sql.Named("courier", courierID),
+					sql.Named("number", number),
+					sql.Named("registered", ParcelStatusRegistered),
+					sql.Named("sent", ParcelStatusSent),
+					s.tenantArg())
+				if err != nil {
+					return err
+				}
+				n, err = res.RowsAffected()
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return fmt.Errorf("%w: parcel %d is neither registered nor sent", ErrForbiddenTransition, number)
+			}
+			updated += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(updated), nil
+}
+
+// bulkParcels проверяет список номеров массовой операции и возвращает посылки.
+// Любой отсутствующий номер - ErrParcelNotFound
+func (s ParcelService) bulkParcels(ctx context.Context, numbers []int64) ([]Parcel, error) {
+	if len(numbers) == 0 {
+		return nil, ValidationError{Field: "numbers", Message: "must not be empty"}
+	}
+	if len(numbers) > MaxPageSize {
+		return nil, ValidationError{Field: "numbers", Message: fmt.Sprintf("must contain at most %d numbers", MaxPageSize)}
+	}
+	seen := make(map[int64]bool, len(numbers))
+	for _, n := range numbers {
+		if seen[n] {
+			return nil, ValidationError{Field: "numbers", Message: fmt.Sprintf("duplicate number %d", n)}
+		}
+		seen[n] = true
+	}
+
+	parcels, err := s.store.WithContext(ctx).GetMany(numbers)
+	if err != nil {
+		return nil, err
+	}
+	if len(parcels) < len(numbers) {
+		for _, p := range parcels {
+			delete(seen, p.Number)
+		}
+		for _, n := range numbers {
+			if seen[n] {
+				return nil, fmt.Errorf("%w: %d", ErrParcelNotFound, n)
+			}
+		}
+	}
+	return parcels, nil
+}
+
+// BulkSetStatus переводит посылки numbers в статус status: либо все, либо ни одну.
+// Каждый переход проверяется так же, как в SetStatus. Возвращает число
+// обновлённых посылок
+func (s ParcelService) BulkSetStatus(ctx context.Context, numbers []int64, status string) (_ int, err error) {
+	defer s.logOp(ctx, "bulk_set_status", time.Now(), &err, slog.Int("parcels", len(numbers)), slog.String("status", status))
+	if err := requireStaff(ctx); err != nil {
+		return 0, err
+	}
+	if err := validateStatus(status); err != nil {
+		return 0, err
+	}
+	parcels, err := s.bulkParcels(ctx, numbers)
+	if err != nil {
+		return 0, err
+	}
+
+	expected := make(map[int64]string, len(parcels))
+	for _, p := range parcels {
+		if err := checkConsolidated(p); err != nil {
+			return 0, err
+		}
+		if err := checkTransition(p.Status, status); err != nil {
+			return 0, fmt.Errorf("parcel %d: %w", p.Number, err)
+		}
+		expected[p.Number] = p.Status
+	}
+
+	return s.store.WithContext(ctx).SetStatuses(expected, status)
+}
+
+// BulkAssignCourier назначает курьера всем посылкам numbers: либо всем, либо ни одной.
+// Возвращает число обновлённых посылок
+func (s ParcelService) BulkAssignCourier(ctx context.Context, numbers []int64, courierID int) (_ int, err error) {
+	defer s.logOp(ctx, "bulk_assign_courier", time.Now(), &err, slog.Int("parcels", len(numbers)), slog.Int("courier", courierID))
+	if err := requireStaff(ctx); err != nil {
+		return 0, err
+	}
+	if _, err := s.bulkParcels(ctx, numbers); err != nil {
+		return 0, err
+	}
+	if _, err := s.GetCourier(ctx, courierID); err != nil {
+		return 0, err
+	}
+
+	return s.store.WithContext(ctx).AssignCouriers(numbers, courierID)
+}
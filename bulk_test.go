@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBulkSetStatus проверяет, что массовая смена статуса применяется ко всем посылкам или ни к одной
+func TestBulkSetStatus(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	first, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	second, err := service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+	var changed []int64
+	service.store.OnChange(func(e ParcelEvent) {
+		if e.Type == ParcelEventStatusChanged {
+			changed = append(changed, e.Number)
+		}
+	})
+
+	// add
+	updated, err := service.BulkSetStatus(ctx, []int64{second.Number, first.Number}, ParcelStatusSent)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated)
+
+	// check
+	parcels, err := service.store.GetMany([]int64{first.Number, second.Number})
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	for _, p := range parcels {
+		assert.Equal(t, ParcelStatusSent, p.Status)
+	}
+	assert.Equal(t, []int64{first.Number, second.Number}, changed)
+
+	// недопустимый переход одной посылки отменяет всю операцию
+	third, err := service.Register(ctx, 7, "Орёл")
+	require.NoError(t, err)
+	_, err = service.BulkSetStatus(ctx, []int64{first.Number, third.Number}, ParcelStatusDelivered)
+	require.ErrorIs(t, err, ErrForbiddenTransition)
+	p, err := service.Get(ctx, first.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, p.Status)
+
+	_, err = service.BulkSetStatus(ctx, []int64{first.Number, 1000}, ParcelStatusDelivered)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	_, err = service.BulkSetStatus(ctx, []int64{first.Number, first.Number}, ParcelStatusDelivered)
+	var verr ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "numbers", verr.Field)
+
+	_, err = service.BulkSetStatus(ctx, nil, ParcelStatusDelivered)
+	require.ErrorAs(t, err, &verr)
+	_, err = service.BulkSetStatus(ctx, []int64{first.Number}, "lost")
+	require.ErrorAs(t, err, &verr)
+}
+
+// TestBulkAssignCourier проверяет массовое назначение курьера
+func TestBulkAssignCourier(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	courier, err := service.AddCourier(ctx, "Иван", "+79990000000")
+	require.NoError(t, err)
+	first, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	second, err := service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+	delivered, err := service.Register(ctx, 8, "Орёл")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(ctx, delivered.Number))
+	require.NoError(t, service.NextStatus(ctx, delivered.Number))
+
+	// add
+	updated, err := service.BulkAssignCourier(ctx, []int64{first.Number, second.Number}, courier.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated)
+
+	// check
+	parcels, err := service.GetByCourier(ctx, courier.ID)
+	require.NoError(t, err)
+	assert.Len(t, parcels, 2)
+
+	// доставленная посылка отменяет всю операцию
+	other, err := service.AddCourier(ctx, "Пётр", "+79990000001")
+	require.NoError(t, err)
+	_, err = service.BulkAssignCourier(ctx, []int64{first.Number, delivered.Number}, other.ID)
+	require.ErrorIs(t, err, ErrForbiddenTransition)
+	parcels, err = service.GetByCourier(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Empty(t, parcels)
+
+	_, err = service.BulkAssignCourier(ctx, []int64{first.Number}, 1000)
+	require.ErrorIs(t, err, ErrCourierNotFound)
+}
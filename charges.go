@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money - денежная сумма в копейках. Целое число не накапливает
+// ошибок округления, в отличие от float64
+type Money int64
+
+// String возвращает сумму в рублях с двумя знаками после точки, например "1234.50"
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign, m = "-", -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+// ParseMoney разбирает сумму в рублях вида "1234", "1234.5" или "1234.50"
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	rub, kop, hasKop := strings.Cut(s, ".")
+	if rub == "" || strings.HasPrefix(rub, "+") || (hasKop && (kop == "" || len(kop) > 2)) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	neg := strings.HasPrefix(rub, "-")
+	r, err := strconv.ParseInt(strings.TrimPrefix(rub, "-"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	var k int64
+	if hasKop {
+		if len(kop) == 1 {
+			kop += "0"
+		}
+		if k, err = strconv.ParseInt(kop, 10, 64); err != nil || k < 0 {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	m := Money(r*100 + k)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+// MarshalJSON записывает сумму строкой "1234.50", чтобы клиенты
+// не переводили её в число с плавающей точкой
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + m.String() + `"`), nil
+}
+
+// UnmarshalJSON принимает сумму строкой, как её записывает MarshalJSON
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("amount must be a string: %s", data)
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Charges - денежные поля посылки
+type Charges struct {
+	DeclaredValue Money // объявленная ценность
+	DeliveryPrice Money // стоимость доставки
+	COD           Money // наложенный платёж, который курьер получает с получателя
+}
+
+// SetCharges сохраняет денежные поля посылки
+func (s ParcelStore) SetCharges(number int64, c Charges) error {
+	return s.auditedUpdate(number, []string{"declared_value", "delivery_price", "cod_amount"}, "UPDATE parcel SET declared_value = :declared_value, delivery_price = :delivery_price, cod_amount = :cod WHERE number = :number AND "+tenantScope,
+		sql.Named("declared_value", c.DeclaredValue),
+		sql.Named("delivery_price", c.DeliveryPrice),
+		sql.Named("cod", c.COD),
+		sql.Named("number", number),
+		s.tenantArg())
+}
+
+// SetCharges задаёт объявленную ценность, стоимость доставки и наложенный платёж,
+// пока посылка не отправлена
+func (s ParcelService) SetCharges(ctx context.Context, number int64, c Charges) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	if err := validateCharges(c); err != nil {
+		return err
+	}
+	if err := s.checkRegistered(ctx, number); err != nil {
+		return err
+	}
+
+	return s.store.WithContext(ctx).SetCharges(number, c)
+}
+
+func validateCharges(c Charges) error {
+	if c.DeclaredValue < 0 {
+		return ValidationError{Field: "declared_value", Message: "must not be negative"}
+	}
+	if c.DeliveryPrice < 0 {
+		return ValidationError{Field: "delivery_price", Message: "must not be negative"}
+	}
+	if c.COD < 0 {
+		return ValidationError{Field: "cod_amount", Message: "must not be negative"}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMoney проверяет разбор и вывод сумм в копейках
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		out  string
+	}{
+		{"0", 0, "0.00"},
+		{"1234", 123400, "1234.00"},
+		{"1234.5", 123450, "1234.50"},
+		{"0.07", 7, "0.07"},
+		{"-12.34", -1234, "-12.34"},
+	}
+	for _, tt := range tests {
+		m, err := ParseMoney(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, m)
+		assert.Equal(t, tt.out, m.String())
+	}
+
+	for _, bad := range []string{"", "1.", "1.234", "1,50", "abc", "1.-5", "+1"} {
+		_, err := ParseMoney(bad)
+		assert.Error(t, err, bad)
+	}
+
+	// в JSON сумма передаётся строкой
+	data, err := json.Marshal(Charges{DeliveryPrice: 34990})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"DeclaredValue":"0.00","DeliveryPrice":"349.90","COD":"0.00"}`, string(data))
+	var c Charges
+	require.NoError(t, json.Unmarshal(data, &c))
+	assert.Equal(t, Money(34990), c.DeliveryPrice)
+	assert.Error(t, json.Unmarshal([]byte(`{"COD":349.9}`), &c))
+}
+
+// TestSetCharges проверяет сохранение и проверку денежных полей посылки
+func TestSetCharges(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	c := Charges{DeclaredValue: 150000, DeliveryPrice: 34990, COD: 184990}
+
+	// set
+	require.NoError(t, service.SetCharges(ctx, p.Number, c))
+
+	// check
+	stored, err := store.Get(p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, c, stored.Charges)
+
+	// validation
+	assert.ErrorIs(t, service.SetCharges(ctx, p.Number, Charges{COD: -1}), ErrInvalidParcel)
+	assert.ErrorIs(t, service.SetCharges(ctx, p.Number+1, c), ErrParcelNotFound)
+
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	assert.ErrorIs(t, service.SetCharges(ctx, p.Number, c), ErrParcelLocked)
+}
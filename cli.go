@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Форматы вывода команд CLI
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// newRootCmd собирает команды CLI трекера поверх service.
+// store и cfg нужны только команде serve для фоновых задач и адресов серверов
+func newRootCmd(cfg Config, store ParcelStore, service ParcelService) *cobra.Command {
+	var output string
+	var tenant int64
+
+	root := &cobra.Command{
+		Use:           "tracker",
+		Short:         "Трекер посылок",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if output != OutputTable && output != OutputJSON {
+				return ValidationError{Field: "output", Message: fmt.Sprintf("must be %s or %s", OutputTable, OutputJSON)}
+			}
+			if tenant <= 0 {
+				return ValidationError{Field: "tenant", Message: "must be a positive integer"}
+			}
+			if _, err := service.GetTenant(cmd.Context(), tenant); err != nil {
+				return err
+			}
+			cmd.SetContext(WithTenant(cmd.Context(), tenant))
+			return nil
+		},
+	}
+	root.PersistentFlags().StringVarP(&output, "output", "o", OutputTable, "формат вывода: table или json")
+	root.PersistentFlags().Int64Var(&tenant, "tenant", DefaultTenant, "магазин, с данными которого работают команды")
+
+	// add
+	var client int64
+	var address string
+	add := &cobra.Command{
+		Use:   "add",
+		Short: "Зарегистрировать посылку",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := service.Register(cmd.Context(), client, address)
+			if err != nil {
+				return err
+			}
+			return printParcel(cmd.OutOrStdout(), output, p)
+		},
+	}
+	add.Flags().Int64Var(&client, "client", 0, "идентификатор клиента-отправителя")
+	add.Flags().StringVar(&address, "address", "", "адрес получателя")
+	add.MarkFlagRequired("client")
+	add.MarkFlagRequired("address")
+
+	// status
+	status := &cobra.Command{
+		Use:   "status <number> <status>",
+		Short: "Изменить статус посылки",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			number, err := parseNumber(args[0])
+			if err != nil {
+				return err
+			}
+			if err := service.SetStatus(cmd.Context(), number, args[1]); err != nil {
+				return err
+			}
+			p, err := service.Get(cmd.Context(), number)
+			if err != nil {
+				return err
+			}
+			return printParcel(cmd.OutOrStdout(), output, p)
+		},
+	}
+
+	// list
+	var listClient int64
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Показать посылки клиента",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			details, err := service.ClientParcelsDetails(cmd.Context(), listClient, "")
+			if err != nil {
+				return err
+			}
+			parcels := make([]Parcel, len(details))
+			for i, d := range details {
+				parcels[i] = d.Parcel
+			}
+			return printParcels(cmd.OutOrStdout(), output, parcels)
+		},
+	}
+	list.Flags().Int64Var(&listClient, "client", 0, "идентификатор клиента-отправителя")
+	list.MarkFlagRequired("client")
+
+	// delete
+	del := &cobra.Command{
+		Use:   "delete <number>",
+		Short: "Удалить зарегистрированную посылку",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			number, err := parseNumber(args[0])
+			if err != nil {
+				return err
+			}
+			if err := service.Delete(cmd.Context(), number); err != nil {
+				return err
+			}
+			if output == OutputJSON {
+				return encodeCLIJSON(cmd.OutOrStdout(), map[string]int64{"deleted": number})
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "Посылка %d удалена\n", number)
+			return err
+		},
+	}
+
+	// serve
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Запустить REST API и gRPC до SIGINT или SIGTERM",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.HTTPAddr == "" && cfg.GRPCAddr == "" {
+				return fmt.Errorf("задайте %s или %s", EnvHTTPAddr, EnvGRPCAddr)
+			}
+			if err := requireTenantAuth(store, cfg.AuthRequired); err != nil {
+				return err
+			}
+			serve(cmd.Context(), cfg, store, service)
+			return nil
+		},
+	}
+
+	// tui
+	tui := &cobra.Command{
+		Use:   "tui",
+		Short: "Просмотр и правка посылок в терминале",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunTUI(cmd.Context(), service)
+		},
+	}
+
+	root.AddCommand(add, status, list, del, serveCmd, tui, newAPIKeyCmd(service, &output), newTokenCmd(cfg, store), newTenantCmd(service, &output), newEncryptionCmd(store), newExportCmd(service), newImportCmd(service, &output), newSnapshotCmd(store, &output))
+	return root
+}
+
+// newAPIKeyCmd создаёт команду apikey с подкомандами create, list и revoke
+func newAPIKeyCmd(service ParcelService, output *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "Ключи API для вызовов из других сервисов",
+	}
+
+	var role string
+	create := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Создать ключ API. Ключ выводится один раз",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, key, err := service.CreateAPIKey(cmd.Context(), args[0], role)
+			if err != nil {
+				return err
+			}
+			if *output == OutputJSON {
+				return encodeCLIJSON(cmd.OutOrStdout(), map[string]any{"id": k.ID, "name": k.Name, "key": key})
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "Ключ %d (%s): %s\n", k.ID, k.Name, key)
+			return err
+		},
+	}
+	create.Flags().StringVar(&role, "role", RoleDispatcher, "роль ключа: admin или dispatcher")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Список ключей API",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := service.ListAPIKeys(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if *output == OutputJSON {
+				return encodeCLIJSON(cmd.OutOrStdout(), keys)
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tИМЯ\tПРЕФИКС\tРОЛЬ\tСОЗДАН")
+			for _, k := range keys {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.Role, k.CreatedAt)
+			}
+			return tw.Flush()
+		},
+	}
+
+	revoke := &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Отозвать ключ API",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.Atoi(args[0])
+			if err != nil || id <= 0 {
+				return ValidationError{Field: "id", Message: "must be a positive integer"}
+			}
+			if err := service.RevokeAPIKey(cmd.Context(), id); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "Ключ %d отозван\n", id)
+			return err
+		},
+	}
+
+	cmd.AddCommand(create, list, revoke)
+	return cmd
+}
+
+// newTokenCmd создаёт команду token, которая выпускает токен сессии пользователя
+func newTokenCmd(cfg Config, store ParcelStore) *cobra.Command {
+	p := Principal{Kind: PrincipalUser}
+	var ttl time.Duration
+	cmd := &cobra.Command{
+		Use:   "token <subject>",
+		Short: "Выпустить токен сессии пользователя, нужен " + EnvJWTSecret,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Subject = args[0]
+			p.Tenant, _ = TenantFrom(cmd.Context())
+			token, err := NewAuthenticator(store, cfg.JWTSecret).IssueToken(p, ttl)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), token)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&p.Role, "role", RoleClient, "роль: admin, dispatcher, courier или client")
+	cmd.Flags().Int64Var(&p.Client, "client", 0, "клиент для роли client")
+	cmd.Flags().IntVar(&p.Courier, "courier", 0, "курьер для роли courier")
+	cmd.Flags().DurationVar(&ttl, "ttl", 24*time.Hour, "срок действия токена")
+	return cmd
+}
+
+// newEncryptionCmd создаёт команды шифрования персональных данных
+func newEncryptionCmd(store ParcelStore) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "encryption",
+		Short: "Шифрование адресов и данных получателей, ключи в " + EnvEncryptionKeys,
+	}
+
+	rotate := &cobra.Command{
+		Use:   "rotate",
+		Short: "Перешифровать данные всех магазинов первым ключом из " + EnvEncryptionKeys,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := store.WithContext(cmd.Context()).AllTenants().RotateEncryption()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "Перешифровано строк: %d\n", n)
+			return err
+		},
+	}
+
+	cmd.AddCommand(rotate)
+	return cmd
+}
+
+// newExportCmd создаёт команду export, которая выгружает посылки в CSV
+func newExportCmd(service ParcelService) *cobra.Command {
+	var filter, fields, file string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Выгрузить посылки по фильтру в CSV, например манифест за день",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return service.ExportCSV(cmd.Context(), cmd.OutOrStdout(), filter, fields)
+			}
+			f, err := os.Create(file)
+			if err != nil {
+				return err
+			}
+			if err := service.ExportCSV(cmd.Context(), f, filter, fields); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+	cmd.Flags().StringVar(&filter, "filter", "", "фильтр посылок, см. ParseFilter, пусто - все посылки")
+	cmd.Flags().StringVar(&fields, "fields", "", "поля через запятую, пусто - все поля")
+	cmd.Flags().StringVar(&file, "file", "", "файл выгрузки, пусто - стандартный вывод")
+	return cmd
+}
+
+// newImportCmd создаёт команду import, которая добавляет посылки из CSV,
+// см. ParcelService.ImportCSV. Если в файле есть строки с ошибками,
+// команда завершается с ошибкой после вывода этих строк
+func newImportCmd(service ParcelService, output *string) *cobra.Command {
+	var file string
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Добавить посылки из CSV с колонками client, address и status, например из Excel",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if file != "" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			res, err := service.ImportCSV(cmd.Context(), in, dryRun)
+			if err != nil {
+				return err
+			}
+			if *output == OutputJSON {
+				if err := encodeCLIJSON(cmd.OutOrStdout(), res); err != nil {
+					return err
+				}
+			} else {
+				for _, e := range res.Errors {
+					fmt.Fprintln(cmd.OutOrStdout(), e)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "строк: %d, без ошибок: %d, добавлено: %d\n", res.Rows, res.Valid, res.Imported)
+			}
+			if len(res.Errors) > 0 {
+				return fmt.Errorf("%d rows with errors", len(res.Errors))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&file, "file", "", "файл импорта, пусто - стандартный ввод")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "только проверить строки, ничего не добавляя")
+	return cmd
+}
+
+// newSnapshotCmd создаёт команды переноса посылок магазина между окружениями
+// в снимке JSON, см. ParcelStore.ExportJSON и ParcelStore.ImportJSON
+func newSnapshotCmd(store ParcelStore, output *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Снимок посылок магазина с историей в JSON по объекту на строку",
+	}
+
+	var exportFile string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Записать снимок посылок магазина",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := store.WithContext(cmd.Context())
+			if exportFile == "" {
+				return store.ExportJSON(cmd.OutOrStdout())
+			}
+			f, err := os.Create(exportFile)
+			if err != nil {
+				return err
+			}
+			if err := store.ExportJSON(f); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+	exportCmd.Flags().StringVar(&exportFile, "file", "", "файл снимка, пусто - стандартный вывод")
+
+	var importFile string
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Добавить посылки из снимка в магазин с новыми номерами",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if importFile != "" {
+				f, err := os.Open(importFile)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			counts, err := store.WithContext(cmd.Context()).ImportJSON(in)
+			if err != nil {
+				return err
+			}
+			if *output == OutputJSON {
+				return encodeCLIJSON(cmd.OutOrStdout(), counts)
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ТАБЛИЦА\tСТРОК")
+			for _, table := range snapshotTables {
+				fmt.Fprintf(tw, "%s\t%d\n", table, counts[table])
+			}
+			return tw.Flush()
+		},
+	}
+	importCmd.Flags().StringVar(&importFile, "file", "", "файл снимка, пусто - стандартный ввод")
+
+	cmd.AddCommand(exportCmd, importCmd)
+	return cmd
+}
+
+// newTenantCmd создаёт команды управления магазинами
+func newTenantCmd(service ParcelService, output *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tenant",
+		Short: "Магазины экземпляра трекера",
+	}
+
+	create := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Создать магазин",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := service.CreateTenant(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if *output == OutputJSON {
+				return encodeCLIJSON(cmd.OutOrStdout(), t)
+			}
+			return nil
+		},
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Список магазинов",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tenants, err := service.ListTenants(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if *output == OutputJSON {
+				return encodeCLIJSON(cmd.OutOrStdout(), tenants)
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tИМЯ\tСОЗДАН")
+			for _, t := range tenants {
+				fmt.Fprintf(tw, "%d\t%s\t%s\n", t.ID, t.Name, t.CreatedAt)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.AddCommand(create, list)
+	return cmd
+}
+
+// parseNumber разбирает номер посылки из аргумента командной строки
+func parseNumber(arg string) (int64, error) {
+	number, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || number <= 0 {
+		return 0, ValidationError{Field: "number", Message: "must be a positive integer"}
+	}
+	return number, nil
+}
+
+// printParcel выводит одну посылку таблицей или объектом JSON
+func printParcel(w io.Writer, output string, p Parcel) error {
+	if output == OutputJSON {
+		return encodeCLIJSON(w, newAPIParcel(p))
+	}
+	return printParcels(w, output, []Parcel{p})
+}
+
+// printParcels выводит посылки таблицей или, для OutputJSON, массивом JSON
+// в том же виде, что и REST API
+func printParcels(w io.Writer, output string, parcels []Parcel) error {
+	if output == OutputJSON {
+		res := make([]apiParcel, len(parcels))
+		for i, p := range parcels {
+			res[i] = newAPIParcel(p)
+		}
+		return encodeCLIJSON(w, res)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "НОМЕР\tКОД\tКЛИЕНТ\tСТАТУС\tАДРЕС\tСОЗДАНА")
+	for _, p := range parcels {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\n", p.Number, p.Tracking, p.Client, p.Status, p.Address, p.CreatedAt)
+	}
+	return tw.Flush()
+}
+
+func encodeCLIJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
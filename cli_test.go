@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCLI выполняет команду CLI и возвращает её вывод
+func runCLI(t *testing.T, store ParcelStore, service ParcelService, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	cmd := newRootCmd(DefaultConfig(), store, service)
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.ExecuteContext(context.Background())
+	return out.String(), err
+}
+
+// TestCLI проверяет команды add, status, list и delete
+func TestCLI(t *testing.T) {
+	service, store := newTestService(t)
+
+	// add
+	out, err := runCLI(t, store, service, "add", "--client", "42", "--address", "Псков", "-o", "json")
+	require.NoError(t, err)
+	var p apiParcel
+	require.NoError(t, json.Unmarshal([]byte(out), &p))
+	assert.Equal(t, int64(42), p.Client)
+	assert.Equal(t, ParcelStatusRegistered, p.Status)
+	number := fmt.Sprint(p.Number)
+
+	// status
+	out, err = runCLI(t, store, service, "status", number, ParcelStatusSent)
+	require.NoError(t, err)
+	assert.Contains(t, out, "НОМЕР")
+	assert.Contains(t, out, ParcelStatusSent)
+
+	// list
+	out, err = runCLI(t, store, service, "list", "--client", "42", "--output", "json")
+	require.NoError(t, err)
+	var list []apiParcel
+	require.NoError(t, json.Unmarshal([]byte(out), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, p.Number, list[0].Number)
+
+	// delete
+	_, err = runCLI(t, store, service, "delete", number)
+	require.ErrorIs(t, err, ErrParcelLocked)
+
+	out, err = runCLI(t, store, service, "add", "--client", "42", "--address", "Тверь", "-o", "json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &p))
+	out, err = runCLI(t, store, service, "delete", fmt.Sprint(p.Number))
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("Посылка %d удалена\n", p.Number), out)
+
+	// check
+	_, err = service.Get(context.Background(), p.Number)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// runCLIStdout выполняет команду CLI с выводом в настоящий os.Stdout процесса
+// и возвращает всё, что в него записано, в том числе не через команду
+func runCLIStdout(t *testing.T, store ParcelStore, service ParcelService, args ...string) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	cmd := newRootCmd(DefaultConfig(), store, service)
+	cmd.SetArgs(args)
+	runErr := cmd.ExecuteContext(context.Background())
+	require.NoError(t, w.Close())
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, runErr)
+	return string(out)
+}
+
+// TestCLIStdoutJSON проверяет, что в stdout при -o json нет ничего, кроме JSON
+func TestCLIStdoutJSON(t *testing.T) {
+	service, store := newTestService(t)
+
+	// add
+	out := runCLIStdout(t, store, service, "add", "--client", "42", "--address", "Псков", "-o", "json")
+	var p apiParcel
+	require.NoError(t, json.Unmarshal([]byte(out), &p), out)
+
+	// check
+	out = runCLIStdout(t, store, service, "status", fmt.Sprint(p.Number), ParcelStatusSent, "-o", "json")
+	require.NoError(t, json.Unmarshal([]byte(out), &p), out)
+	assert.Equal(t, ParcelStatusSent, p.Status)
+}
+
+// TestCLIValidation проверяет отклонение некорректных аргументов
+func TestCLIValidation(t *testing.T) {
+	service, store := newTestService(t)
+
+	_, err := runCLI(t, store, service, "list", "--client", "1", "-o", "xml")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	_, err = runCLI(t, store, service, "delete", "abc")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	_, err = runCLI(t, store, service, "add", "--client", "1")
+	require.Error(t, err)
+
+	_, err = runCLI(t, store, service, "serve")
+	require.Error(t, err)
+}
+
+// TestCLIAPIKeys проверяет команды apikey create, list и revoke
+func TestCLIAPIKeys(t *testing.T) {
+	service, store := newTestService(t)
+
+	// add
+	out, err := runCLI(t, store, service, "apikey", "create", "billing", "-o", "json")
+	require.NoError(t, err)
+	var created struct {
+		ID  int    `json:"id"`
+		Key string `json:"key"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &created))
+	assert.True(t, strings.HasPrefix(created.Key, apiKeyPrefix))
+
+	// check
+	out, err = runCLI(t, store, service, "apikey", "list")
+	require.NoError(t, err)
+	assert.Contains(t, out, "billing")
+	assert.NotContains(t, out, created.Key)
+
+	_, err = runCLI(t, store, service, "apikey", "revoke", fmt.Sprint(created.ID))
+	require.NoError(t, err)
+	_, err = runCLI(t, store, service, "apikey", "revoke", fmt.Sprint(created.ID))
+	require.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+	_, err = runCLI(t, store, service, "token", "anna")
+	require.Error(t, err, "без секрета токены не выпускаются")
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Переменные окружения, из которых LoadConfig читает настройки БД
+const (
+	EnvDBDriver          = "TRACKER_DB_DRIVER"
+	EnvDBDSN             = "TRACKER_DB_DSN"
+	EnvDBMaxOpenConns    = "TRACKER_DB_MAX_OPEN_CONNS"
+	EnvDBMaxIdleConns    = "TRACKER_DB_MAX_IDLE_CONNS"
+	EnvDBConnMaxLifetime = "TRACKER_DB_CONN_MAX_LIFETIME"
+	EnvDBBusyTimeout     = "TRACKER_DB_BUSY_TIMEOUT"
+	EnvDBConnectAttempts = "TRACKER_DB_CONNECT_ATTEMPTS"
+	EnvDBReplicaDSNs     = "TRACKER_DB_REPLICA_DSNS" // список через запятую
+	EnvDBMaintenance     = "TRACKER_DB_MAINTENANCE_INTERVAL"
+	EnvProbeInterval     = "TRACKER_PROBE_INTERVAL"
+	EnvDBMaxReplicaLag   = "TRACKER_DB_MAX_REPLICA_LAG"
+	EnvExpireAfter       = "TRACKER_PARCEL_EXPIRE_AFTER"
+	EnvExpiryInterval    = "TRACKER_PARCEL_EXPIRY_INTERVAL"
+	EnvMaxWeightKg       = "TRACKER_PARCEL_MAX_WEIGHT_KG"
+	EnvMaxSideCm         = "TRACKER_PARCEL_MAX_SIDE_CM"
+	EnvCursorKey         = "TRACKER_CURSOR_KEY"
+	EnvMaxAttempts       = "TRACKER_MAX_DELIVERY_ATTEMPTS"
+	EnvHTTPAddr          = "TRACKER_HTTP_ADDR"
+	EnvGRPCAddr          = "TRACKER_GRPC_ADDR"
+	EnvWebhookInterval   = "TRACKER_WEBHOOK_INTERVAL"
+	EnvWebhookAttempts   = "TRACKER_WEBHOOK_MAX_ATTEMPTS"
+	EnvAdminToken        = "TRACKER_ADMIN_TOKEN"
+	EnvJWTSecret         = "TRACKER_JWT_SECRET"
+	EnvAuthRequired      = "TRACKER_AUTH_REQUIRED"
+	EnvRateIP            = "TRACKER_RATE_PER_IP"
+	EnvRateIPBurst       = "TRACKER_RATE_PER_IP_BURST"
+	EnvRateClient        = "TRACKER_RATE_PER_CLIENT"
+	EnvRateClientBurst   = "TRACKER_RATE_PER_CLIENT_BURST"
+	EnvEncryptionKeys    = "TRACKER_ENCRYPTION_KEYS" // см. ParseEncryptionKeys
+	EnvLogLevel          = "TRACKER_LOG_LEVEL"       // debug, info, warn или error
+	EnvLogFormat         = "TRACKER_LOG_FORMAT"      // text или json
+	EnvOTLPEndpoint      = "TRACKER_OTLP_ENDPOINT"   // например http://localhost:4318
+	EnvTraceSampleRatio  = "TRACKER_TRACE_SAMPLE_RATIO"
+	EnvSlowQuery         = "TRACKER_SLOW_QUERY_THRESHOLD"
+	EnvAdminDebug        = "TRACKER_ADMIN_DEBUG"
+)
+
+// Config содержит настройки подключения к БД.
+//
+// SQLite допускает только одного писателя, поэтому для драйвера sqlite
+// пул ограничен одним соединением: несколько соединений лишь конкурируют
+// за блокировку файла и получают SQLITE_BUSY
+type Config struct {
+	Driver           string          // имя драйвера database/sql, поддерживается только sqlite
+	DSN              string          // путь к файлу БД или DSN драйвера
+	ReplicaDSNs      []string        // реплики только для чтения, могут отсутствовать
+	MaxReplicaLag    int             // на сколько посылок реплика может отставать при старте
+	MaxOpenConns     int             // для sqlite должно быть равно 1
+	MaxIdleConns     int             // сколько соединений держать открытыми без дела
+	ConnMaxLifetime  time.Duration   // 0 - соединения не пересоздаются
+	BusyTimeout      time.Duration   // сколько ждать снятия блокировки SQLite
+	Retry            RetryPolicy     // повторные попытки подключения при старте
+	Maintenance      time.Duration   // периодичность VACUUM/ANALYZE, 0 - отключено
+	ProbeInterval    time.Duration   // периодичность синтетической проверки, 0 - отключена
+	ExpireAfter      time.Duration   // через сколько registered-посылка истекает, 0 - никогда
+	ExpiryInterval   time.Duration   // как часто искать истёкшие посылки
+	MaxWeightKg      float64         // максимальный вес посылки
+	MaxSideCm        float64         // максимальная длина любой стороны посылки
+	CursorKey        string          // ключ подписи курсоров, пусто - случайный при каждом запуске
+	MaxAttempts      int             // после скольких неудачных попыток вручения посылка возвращается отправителю
+	HTTPAddr         string          // адрес REST API, например ":8080", пусто - сервер не запускается
+	GRPCAddr         string          // адрес gRPC, например ":9090", пусто - сервер не запускается
+	WebhookInterval  time.Duration   // как часто serve отправляет очередь вебхуков, 0 - не отправляет
+	WebhookAttempts  int             // после скольких неудачных попыток доставка вебхука становится dead
+	AdminToken       string          // токен адресов /admin/ REST API, пусто - адреса отключены
+	AdminDebug       bool            // открыть pprof и expvar на /admin/debug/, см. WithDiagnostics
+	JWTSecret        string          // ключ подписи токенов сессий, пусто - принимаются только ключи API
+	AuthRequired     bool            // требовать ключ API или токен для REST API и gRPC, см. WithAuth
+	RateIP           RateLimit       // ограничение запросов REST API с одного IP-адреса
+	RateClient       RateLimit       // ограничение запросов REST API к посылкам одного клиента
+	EncryptionKeys   []EncryptionKey // ключи шифрования персональных данных, пусто - не шифруются
+	LogLevel         slog.Level      // уровень журнала, при debug в журнал пишутся и SQL-запросы
+	LogFormat        string          // LogFormatText или LogFormatJSON
+	OTLPEndpoint     string          // адрес приёмника трассировок и метрик OTLP/HTTP, пусто - не отправляются
+	TraceSampleRatio float64         // доля трассируемых запросов без входящей трассировки, от 0 до 1
+	SlowQuery        time.Duration   // запросы дольше записываются в журнал, 0 - не отслеживаются
+}
+
+// DefaultConfig возвращает настройки для локального файла tracker.db
+func DefaultConfig() Config {
+	return Config{
+		Driver:           "sqlite",
+		DSN:              "tracker.db",
+		MaxOpenConns:     1,
+		MaxIdleConns:     1,
+		BusyTimeout:      5 * time.Second,
+		Retry:            DefaultRetryPolicy,
+		ExpiryInterval:   time.Hour,
+		MaxWeightKg:      DefaultDimensionLimits.MaxWeightKg,
+		MaxSideCm:        DefaultDimensionLimits.MaxSideCm,
+		MaxAttempts:      DefaultMaxAttempts,
+		WebhookInterval:  10 * time.Second,
+		WebhookAttempts:  DefaultWebhookAttempts,
+		RateIP:           DefaultIPRateLimit,
+		RateClient:       DefaultClientRateLimit,
+		LogLevel:         slog.LevelInfo,
+		LogFormat:        LogFormatText,
+		TraceSampleRatio: 1,
+	}
+}
+
+// LoadConfig заполняет DefaultConfig значениями из переменных окружения
+// и проверяет результат
+func LoadConfig() (Config, error) {
+	cfg := DefaultConfig()
+
+	if v := os.Getenv(EnvDBDriver); v != "" {
+		cfg.Driver = v
+	}
+	if v := os.Getenv(EnvDBDSN); v != "" {
+		cfg.DSN = v
+	}
+	if v := os.Getenv(EnvDBReplicaDSNs); v != "" {
+		for _, dsn := range strings.Split(v, ",") {
+			if dsn = strings.TrimSpace(dsn); dsn != "" {
+				cfg.ReplicaDSNs = append(cfg.ReplicaDSNs, dsn)
+			}
+		}
+	}
+
+	var err error
+	if cfg.MaxOpenConns, err = envInt(EnvDBMaxOpenConns, cfg.MaxOpenConns); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxReplicaLag, err = envInt(EnvDBMaxReplicaLag, cfg.MaxReplicaLag); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxIdleConns, err = envInt(EnvDBMaxIdleConns, cfg.MaxIdleConns); err != nil {
+		return Config{}, err
+	}
+	if cfg.ConnMaxLifetime, err = envDuration(EnvDBConnMaxLifetime, cfg.ConnMaxLifetime); err != nil {
+		return Config{}, err
+	}
+	if cfg.BusyTimeout, err = envDuration(EnvDBBusyTimeout, cfg.BusyTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.Retry.MaxAttempts, err = envInt(EnvDBConnectAttempts, cfg.Retry.MaxAttempts); err != nil {
+		return Config{}, err
+	}
+	if cfg.Maintenance, err = envDuration(EnvDBMaintenance, cfg.Maintenance); err != nil {
+		return Config{}, err
+	}
+	if cfg.ProbeInterval, err = envDuration(EnvProbeInterval, cfg.ProbeInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.ExpireAfter, err = envDuration(EnvExpireAfter, cfg.ExpireAfter); err != nil {
+		return Config{}, err
+	}
+	if cfg.ExpiryInterval, err = envDuration(EnvExpiryInterval, cfg.ExpiryInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxWeightKg, err = envFloat(EnvMaxWeightKg, cfg.MaxWeightKg); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxSideCm, err = envFloat(EnvMaxSideCm, cfg.MaxSideCm); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxAttempts, err = envInt(EnvMaxAttempts, cfg.MaxAttempts); err != nil {
+		return Config{}, err
+	}
+	if cfg.WebhookInterval, err = envDuration(EnvWebhookInterval, cfg.WebhookInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.WebhookAttempts, err = envInt(EnvWebhookAttempts, cfg.WebhookAttempts); err != nil {
+		return Config{}, err
+	}
+	if cfg.AdminDebug, err = envBool(EnvAdminDebug, cfg.AdminDebug); err != nil {
+		return Config{}, err
+	}
+	if cfg.AuthRequired, err = envBool(EnvAuthRequired, cfg.AuthRequired); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateIP.Rate, err = envFloat(EnvRateIP, cfg.RateIP.Rate); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateIP.Burst, err = envInt(EnvRateIPBurst, cfg.RateIP.Burst); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateClient.Rate, err = envFloat(EnvRateClient, cfg.RateClient.Rate); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateClient.Burst, err = envInt(EnvRateClientBurst, cfg.RateClient.Burst); err != nil {
+		return Config{}, err
+	}
+	cfg.CursorKey = os.Getenv(EnvCursorKey)
+	cfg.HTTPAddr = os.Getenv(EnvHTTPAddr)
+	cfg.GRPCAddr = os.Getenv(EnvGRPCAddr)
+	cfg.AdminToken = os.Getenv(EnvAdminToken)
+	cfg.JWTSecret = os.Getenv(EnvJWTSecret)
+	if cfg.EncryptionKeys, err = ParseEncryptionKeys(os.Getenv(EnvEncryptionKeys)); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", EnvEncryptionKeys, err)
+	}
+	if v := os.Getenv(EnvLogLevel); v != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(v)); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", EnvLogLevel, err)
+		}
+	}
+	if v := os.Getenv(EnvLogFormat); v != "" {
+		cfg.LogFormat = v
+	}
+	cfg.OTLPEndpoint = os.Getenv(EnvOTLPEndpoint)
+	if cfg.TraceSampleRatio, err = envFloat(EnvTraceSampleRatio, cfg.TraceSampleRatio); err != nil {
+		return Config{}, err
+	}
+	if cfg.SlowQuery, err = envDuration(EnvSlowQuery, cfg.SlowQuery); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate проверяет, что настройки можно применить к подключению
+func (c Config) Validate() error {
+	var errs []error
+	if c.Driver != "sqlite" {
+		errs = append(errs, fmt.Errorf("unsupported driver %q", c.Driver))
+	}
+	if c.DSN == "" {
+		errs = append(errs, errors.New("dsn is empty"))
+	}
+	if c.MaxOpenConns < 0 {
+		errs = append(errs, errors.New("max open conns must not be negative"))
+	}
+	if c.Driver == "sqlite" && c.MaxOpenConns != 1 {
+		errs = append(errs, errors.New("sqlite requires exactly one open connection (single writer)"))
+	}
+	if c.MaxReplicaLag < 0 {
+		errs = append(errs, errors.New("max replica lag must not be negative"))
+	}
+	if c.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("max idle conns must not be negative"))
+	}
+	if c.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("conn max lifetime must not be negative"))
+	}
+	if c.BusyTimeout < 0 {
+		errs = append(errs, errors.New("busy timeout must not be negative"))
+	}
+	if c.Maintenance < 0 {
+		errs = append(errs, errors.New("maintenance interval must not be negative"))
+	}
+	if c.ProbeInterval < 0 {
+		errs = append(errs, errors.New("probe interval must not be negative"))
+	}
+	if c.ExpireAfter < 0 {
+		errs = append(errs, errors.New("expire after must not be negative"))
+	}
+	if c.ExpireAfter > 0 && c.ExpiryInterval <= 0 {
+		errs = append(errs, errors.New("expiry interval must be positive"))
+	}
+	if c.MaxWeightKg <= 0 {
+		errs = append(errs, errors.New("max weight must be positive"))
+	}
+	if c.MaxSideCm <= 0 {
+		errs = append(errs, errors.New("max side must be positive"))
+	}
+	if c.MaxAttempts < 1 {
+		errs = append(errs, errors.New("max delivery attempts must be positive"))
+	}
+	if c.WebhookInterval < 0 {
+		errs = append(errs, errors.New("webhook interval must not be negative"))
+	}
+	if c.WebhookAttempts < 1 {
+		errs = append(errs, errors.New("webhook attempts must be positive"))
+	}
+	if c.RateIP.Rate < 0 || c.RateClient.Rate < 0 {
+		errs = append(errs, errors.New("rate limits must not be negative"))
+	}
+	if (c.RateIP.Rate > 0 && c.RateIP.Burst < 1) || (c.RateClient.Rate > 0 && c.RateClient.Burst < 1) {
+		errs = append(errs, errors.New("rate limit bursts must be positive"))
+	}
+	if c.Retry.MaxAttempts < 1 {
+		errs = append(errs, errors.New("connect attempts must be positive"))
+	}
+	if c.LogFormat != LogFormatText && c.LogFormat != LogFormatJSON {
+		errs = append(errs, fmt.Errorf("unsupported log format %q", c.LogFormat))
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		errs = append(errs, errors.New("trace sample ratio must be between 0 and 1"))
+	}
+	if c.SlowQuery < 0 {
+		errs = append(errs, errors.New("slow query threshold must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// envInt читает целое число из переменной окружения name
+func envInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return n, nil
+}
+
+// envBool читает логическое значение из переменной окружения name
+func envBool(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+// envFloat читает дробное число из переменной окружения name
+func envFloat(name string, def float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return f, nil
+}
+
+// envDuration читает длительность (например, "5s") из переменной окружения name
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadConfig проверяет чтение настроек из переменных окружения
+func TestLoadConfig(t *testing.T) {
+	t.Setenv(EnvDBDSN, "other.db")
+	t.Setenv(EnvDBMaxIdleConns, "0")
+	t.Setenv(EnvDBConnMaxLifetime, "30m")
+	t.Setenv(EnvDBBusyTimeout, "2s")
+	t.Setenv(EnvLogLevel, "debug")
+	t.Setenv(EnvTraceSampleRatio, "0.25")
+	t.Setenv(EnvSlowQuery, "200ms")
+	t.Setenv(EnvAdminDebug, "true")
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "sqlite", cfg.Driver)
+	assert.Equal(t, "other.db", cfg.DSN)
+	assert.Equal(t, 1, cfg.MaxOpenConns)
+	assert.Equal(t, 0, cfg.MaxIdleConns)
+	assert.Equal(t, 30*time.Minute, cfg.ConnMaxLifetime)
+	assert.Equal(t, 2*time.Second, cfg.BusyTimeout)
+	assert.Equal(t, DefaultMaxAttempts, cfg.MaxAttempts)
+	assert.Equal(t, slog.LevelDebug, cfg.LogLevel)
+	assert.Equal(t, 0.25, cfg.TraceSampleRatio)
+	assert.Equal(t, 200*time.Millisecond, cfg.SlowQuery)
+	assert.True(t, cfg.AdminDebug)
+}
+
+// TestLoadConfigInvalid проверяет, что некорректные значения отклоняются
+func TestLoadConfigInvalid(t *testing.T) {
+	t.Setenv(EnvDBMaxOpenConns, "many")
+	_, err := LoadConfig()
+	require.Error(t, err)
+
+	t.Setenv(EnvDBMaxOpenConns, "")
+	t.Setenv(EnvMaxAttempts, "0")
+	_, err = LoadConfig()
+	require.Error(t, err)
+
+	t.Setenv(EnvMaxAttempts, "")
+	t.Setenv(EnvWebhookAttempts, "0")
+	_, err = LoadConfig()
+	require.Error(t, err)
+
+	t.Setenv(EnvWebhookAttempts, "")
+	t.Setenv(EnvRateIPBurst, "0")
+	_, err = LoadConfig()
+	require.Error(t, err)
+
+	t.Setenv(EnvRateIPBurst, "")
+	t.Setenv(EnvEncryptionKeys, "k1:c2hvcnQ=")
+	_, err = LoadConfig()
+	require.Error(t, err)
+
+	t.Setenv(EnvEncryptionKeys, "")
+	t.Setenv(EnvLogLevel, "verbose")
+	_, err = LoadConfig()
+	require.Error(t, err)
+
+	t.Setenv(EnvLogLevel, "")
+	t.Setenv(EnvLogFormat, "xml")
+	_, err = LoadConfig()
+	require.Error(t, err)
+
+	t.Setenv(EnvLogFormat, "")
+	t.Setenv(EnvTraceSampleRatio, "1.5")
+	_, err = LoadConfig()
+	require.Error(t, err)
+
+	t.Setenv(EnvTraceSampleRatio, "")
+	t.Setenv(EnvSlowQuery, "-1s")
+	_, err = LoadConfig()
+	require.Error(t, err)
+
+	t.Setenv(EnvSlowQuery, "")
+	t.Setenv(EnvDBDriver, "postgres")
+	_, err = LoadConfig()
+	require.Error(t, err)
+}
+
+// TestConfigSingleWriter проверяет ограничение пула одним соединением для sqlite
+func TestConfigSingleWriter(t *testing.T) {
+	cfg := DefaultConfig()
+	require.NoError(t, cfg.Validate())
+
+	cfg.MaxOpenConns = 4
+	require.Error(t, cfg.Validate())
+
+	t.Setenv(EnvDBMaxOpenConns, "0")
+	_, err := LoadConfig()
+	require.Error(t, err)
+}
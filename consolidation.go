@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// SetParent включает посылки numbers в консолидированную отправку parent,
+// parent = 0 возвращает их в самостоятельные
+func (s ParcelStore) SetParent(numbers []int64, parent int64) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, number := range numbers {
+			err := s.audited(tx, number, AuditUpdate, []string{"parent_number"}, func() error {
+				_, err := tx.ExecContext(s.context(), "UPDATE parcel SET parent_number = :parent WHERE number = :number AND "+tenantScope,
+					sql.Named("parent", parent),
+					sql.Named("number", number),
+					s.tenantArg())
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetChildren возвращает посылки консолидированной отправки parent, упорядоченные по номеру
+func (s ParcelStore) GetChildren(parent int64) ([]Parcel, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE parent_number = :parent AND "+tenantScope+" ORDER BY number",
+		sql.Named("parent", parent), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// propagateStatus переводит посылки консолидированной отправки parent в статус status
+// и записывает изменение в их историю. События подписчикам OnChange
+// отправляются только для самой консолидированной отправки
+func (s ParcelStore) propagateStatus(tx *sql.Tx, parent int64, status string) error {
+	rows, err := tx.QueryContext(s.context(), "SELECT number FROM parcel WHERE parent_number = :parent AND "+tenantScope,
+		sql.Named("parent", parent), s.tenantArg())
+	if err != nil {
+		return err
+	}
+	var children []int64
+	for rows.Next() {
+		var number int64
+		if err := rows.Scan(&number); err != nil {
+			rows.Close()
+			return err
+		}
+		children = append(children, number)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	comment := fmt.Sprintf("consolidated shipment %d", parent)
+	for _, number := range children {
+		_, err := tx.ExecContext(s.context(), "UPDATE parcel SET status = :status WHERE number = :number AND "+tenantScope,
+			sql.Named("status", status),
+			sql.Named("number", number),
+			s.tenantArg())
+		if err != nil {
+			return err
+		}
+		if err := s.addHistory(tx, number, status, comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConsolidated возвращает ErrParcelLocked для посылки, входящей в консолидированную
+// отправку: её статус меняется только вместе с отправкой
+func checkConsolidated(parcel Parcel) error {
+	if parcel.Parent != 0 {
+		return fmt.Errorf("%w: parcel %d moves with consolidated shipment %d", ErrParcelLocked, parcel.Number, parcel.Parent)
+	}
+	return nil
+}
+
+// Consolidate объединяет зарегистрированные посылки одного получателя в консолидированную
+// отправку: регистрирует посылку-отправку и включает в неё посылки numbers.
+// Дальше статус отправки переходит ко всем входящим в неё посылкам
+func (s ParcelService) Consolidate(ctx context.Context, numbers []int64) (_ Parcel, err error) {
+	defer s.logOp(ctx, "consolidate", time.Now(), &err, slog.Int("parcels", len(numbers)))
+	if err := requireStaff(ctx); err != nil {
+		return Parcel{}, err
+	}
+	if len(numbers) < 2 {
+		return Parcel{}, ValidationError{Field: "numbers", Message: "must contain at least 2 parcels"}
+	}
+
+	store := s.store.WithContext(ctx)
+	var first Parcel
+	seen := make(map[int64]bool, len(numbers))
+	for i, number := range numbers {
+		if seen[number] {
+			return Parcel{}, ValidationError{Field: "numbers", Message: fmt.Sprintf("parcel %d is listed twice", number)}
+		}
+		seen[number] = true
+
+		p, err := s.Get(ctx, number)
+		if err != nil {
+			return Parcel{}, err
+		}
+		if p.Status != ParcelStatusRegistered {
+			return Parcel{}, fmt.Errorf("%w: parcel %d is %s", ErrParcelLocked, number, p.Status)
+		}
+		if p.Parent != 0 {
+			return Parcel{}, fmt.Errorf("%w: parcel %d is already in consolidated shipment %d", ErrParcelLocked, number, p.Parent)
+		}
+		children, err := store.GetChildren(number)
+		if err != nil {
+			return Parcel{}, err
+		}
+		if len(children) > 0 {
+			return Parcel{}, fmt.Errorf("%w: parcel %d is a consolidated shipment", ErrParcelLocked, number)
+		}
+
+		if i == 0 {
+			first = p
+			continue
+		}
+		if p.Address != first.Address || p.Recipient != first.Recipient {
+			return Parcel{}, ValidationError{Field: "numbers", Message: fmt.Sprintf("parcel %d has a different recipient", number)}
+		}
+	}
+
+	now := time.Now().UTC()
+	eta, err := s.eta.Estimate(ctx, first.Address, now)
+	if err != nil {
+		return Parcel{}, err
+	}
+	shipment, err := addTracked(store, Parcel{
+		Client:    first.Client,
+		Status:    ParcelStatusRegistered,
+		Address:   first.Address,
+		CreatedAt: now.Format(time.RFC3339),
+		ETA:       eta,
+		Priority:  PriorityNormal,
+		Recipient: first.Recipient,
+	})
+	if err != nil {
+		return Parcel{}, err
+	}
+	if err := store.SetParent(numbers, shipment.Number); err != nil {
+		return Parcel{}, err
+	}
+
+	return shipment, nil
+}
+
+// Split возвращает посылку из консолидированной отправки в самостоятельные, пока отправка не отправлена
+func (s ParcelService) Split(ctx context.Context, number int64) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	p, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if p.Parent == 0 {
+		return ValidationError{Field: "number", Message: fmt.Sprintf("parcel %d is not in a consolidated shipment", number)}
+	}
+	if err := s.checkRegistered(ctx, p.Parent); err != nil {
+		return err
+	}
+	return s.store.WithContext(ctx).SetParent([]int64{number}, 0)
+}
+
+// GetChildren возвращает посылки консолидированной отправки
+func (s ParcelService) GetChildren(ctx context.Context, number int64) ([]Parcel, error) {
+	if _, err := s.Get(ctx, number); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetChildren(number)
+}
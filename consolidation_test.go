@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConsolidate проверяет объединение посылок и переход статуса к вложенным посылкам
+func TestConsolidate(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	var numbers []int64
+	for i := 0; i < 3; i++ {
+		p, err := service.Register(ctx, 1, "Псков")
+		require.NoError(t, err)
+		numbers = append(numbers, p.Number)
+	}
+
+	// add
+	shipment, err := service.Consolidate(ctx, numbers)
+	require.NoError(t, err)
+	assert.Equal(t, "Псков", shipment.Address)
+
+	children, err := service.GetChildren(ctx, shipment.Number)
+	require.NoError(t, err)
+	require.Len(t, children, 3)
+	for _, c := range children {
+		assert.Equal(t, shipment.Number, c.Parent)
+	}
+
+	// вложенной посылкой нельзя управлять отдельно
+	assert.ErrorIs(t, service.NextStatus(ctx, numbers[0]), ErrParcelLocked)
+	assert.ErrorIs(t, service.Cancel(ctx, numbers[0], "передумал"), ErrParcelLocked)
+
+	// split
+	require.NoError(t, service.Split(ctx, numbers[2]))
+	assert.ErrorIs(t, service.Split(ctx, numbers[2]), ErrInvalidParcel)
+
+	// статус отправки переходит к вложенным посылкам
+	require.NoError(t, service.NextStatus(ctx, shipment.Number))
+	assertStatus(t, service, numbers[0], ParcelStatusSent)
+	assertStatus(t, service, numbers[1], ParcelStatusSent)
+	assertStatus(t, service, numbers[2], ParcelStatusRegistered)
+
+	history, err := service.GetStatusHistory(ctx, numbers[0])
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, history[len(history)-1].Status)
+
+	// после отправки посылку из отправки не вернуть
+	assert.ErrorIs(t, service.Split(ctx, numbers[0]), ErrParcelLocked)
+}
+
+// TestConsolidateValidation проверяет ограничения на объединяемые посылки
+func TestConsolidateValidation(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	first, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	other, err := service.Register(ctx, 1, "Тверь")
+	require.NoError(t, err)
+	second, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+
+	_, err = service.Consolidate(ctx, []int64{first.Number})
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.Consolidate(ctx, []int64{first.Number, first.Number})
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.Consolidate(ctx, []int64{first.Number, other.Number})
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.Consolidate(ctx, []int64{first.Number, other.Number + 1000})
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+
+	shipment, err := service.Consolidate(ctx, []int64{first.Number, second.Number})
+	require.NoError(t, err)
+	third, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	_, err = service.Consolidate(ctx, []int64{first.Number, third.Number})
+	assert.ErrorIs(t, err, ErrParcelLocked)
+	_, err = service.Consolidate(ctx, []int64{shipment.Number, third.Number})
+	assert.ErrorIs(t, err, ErrParcelLocked)
+
+	// удаление отправки возвращает посылки в самостоятельные
+	require.NoError(t, service.Delete(ctx, shipment.Number))
+	p, err := service.Get(ctx, first.Number)
+	require.NoError(t, err)
+	assert.Zero(t, p.Parent)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ErrCourierNotFound возвращается, если курьера с указанным идентификатором нет
+var ErrCourierNotFound = errors.New("courier not found")
+
+// Courier - курьер, которому диспетчер назначает посылки для доставки
+type Courier struct {
+	ID    int
+	Name  string
+	Phone string
+}
+
+// AddCourier добавляет курьера и возвращает его идентификатор
+func (s ParcelStore) AddCourier(c Courier) (int, error) {
+	res, err := s.db.ExecContext(s.context(), "INSERT INTO courier (name, phone, tenant_id) VALUES (:name, :phone, :tenant)",
+		sql.Named("name", c.Name),
+		sql.Named("phone", c.Phone),
+		s.tenantArg())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// GetCourier возвращает курьера по идентификатору
+func (s ParcelStore) GetCourier(id int) (Courier, error) {
+	c := Courier{}
+	err := s.db.QueryRowContext(s.context(), "SELECT id, name, phone FROM courier WHERE id = :id AND "+tenantScope,
+		sql.Named("id", id), s.tenantArg()).Scan(&c.ID, &c.Name, &c.Phone)
+	return c, err
+}
+
+// AssignCourier назначает посылке курьера, courierID = 0 снимает назначение
+func (s ParcelStore) AssignCourier(number int64, courierID int) error {
+	return s.auditedUpdate(number, []string{"courier_id"}, "UPDATE parcel SET courier_id = :courier WHERE number = :number AND "+tenantScope,
+		sql.Named("courier", courierID),
+		sql.Named("number", number),
+		s.tenantArg())
+}
+
+// GetByCourier возвращает посылки, назначенные курьеру
+func (s ParcelStore) GetByCourier(courierID int) ([]Parcel, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE courier_id = :courier AND "+tenantScope+" ORDER BY number",
+		sql.Named("courier", courierID), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// AddCourier регистрирует курьера
+func (s ParcelService) AddCourier(ctx context.Context, name, phone string) (Courier, error) {
+	if err := requireStaff(ctx); err != nil {
+		return Courier{}, err
+	}
+	if strings.TrimSpace(name) == "" {
+		return Courier{}, ValidationError{Field: "name", Message: "must not be empty"}
+	}
+
+	c := Courier{Name: name, Phone: phone}
+	id, err := s.store.WithContext(ctx).AddCourier(c)
+	if err != nil {
+		return Courier{}, err
+	}
+	c.ID = id
+	return c, nil
+}
+
+// GetCourier возвращает курьера или ErrCourierNotFound
+func (s ParcelService) GetCourier(ctx context.Context, id int) (Courier, error) {
+	c, err := s.store.WithContext(ctx).GetCourier(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Courier{}, fmt.Errorf("%w: %d", ErrCourierNotFound, id)
+	}
+	return c, err
+}
+
+// AssignCourier назначает курьера на посылку. Назначить можно только
+// посылку, которая ещё не доставлена: зарегистрирована или в пути
+func (s ParcelService) AssignCourier(ctx context.Context, number int64, courierID int) (err error) {
+	defer s.logOp(ctx, "assign_courier", time.Now(), &err, slog.Int64("number", number), slog.Int("courier", courierID))
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if parcel.Status != ParcelStatusRegistered && parcel.Status != ParcelStatusSent {
+		return fmt.Errorf("%w: parcel %d is %s", ErrForbiddenTransition, number, parcel.Status)
+	}
+	if _, err := s.GetCourier(ctx, courierID); err != nil {
+		return err
+	}
+
+	if err := s.store.WithContext(ctx).AssignCourier(number, courierID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetByCourier возвращает посылки, которые везёт курьер
+func (s ParcelService) GetByCourier(ctx context.Context, courierID int) ([]Parcel, error) {
+	if p, ok := PrincipalFrom(ctx); ok && !(p.Role == RoleCourier && p.Courier == courierID) {
+		if err := requireStaff(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.GetCourier(ctx, courierID); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetByCourier(courierID)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAssignCourier проверяет назначение посылок курьеру и выборку по курьеру
+func TestAssignCourier(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	courier, err := service.AddCourier(ctx, "Иван", "+79990000000")
+	require.NoError(t, err)
+	require.NotZero(t, courier.ID)
+
+	p1, err := service.Register(ctx, 1, "Псков, ул. Садовая, д. 1")
+	require.NoError(t, err)
+	p2, err := service.Register(ctx, 2, "Псков, ул. Лесная, д. 2")
+	require.NoError(t, err)
+	_, err = service.Register(ctx, 3, "Псков, ул. Мира, д. 3")
+	require.NoError(t, err)
+
+	// assign
+	require.NoError(t, service.AssignCourier(ctx, p1.Number, courier.ID))
+	require.NoError(t, service.NextStatus(ctx, p2.Number))
+	require.NoError(t, service.AssignCourier(ctx, p2.Number, courier.ID))
+
+	// check
+	parcels, err := service.GetByCourier(ctx, courier.ID)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	assert.Equal(t, p1.Number, parcels[0].Number)
+	assert.Equal(t, p2.Number, parcels[1].Number)
+	assert.Equal(t, courier.ID, parcels[0].Courier)
+
+	// несуществующий курьер
+	assert.ErrorIs(t, service.AssignCourier(ctx, p1.Number, courier.ID+1), ErrCourierNotFound)
+	_, err = service.GetByCourier(ctx, courier.ID+1)
+	assert.ErrorIs(t, err, ErrCourierNotFound)
+
+	// доставленную посылку назначить нельзя
+	require.NoError(t, service.NextStatus(ctx, p2.Number))
+	assert.ErrorIs(t, service.AssignCourier(ctx, p2.Number, courier.ID), ErrForbiddenTransition)
+
+	_, err = service.AddCourier(ctx, " ", "")
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+}
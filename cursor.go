@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidCursor возвращается для курсора с неверной подписью
+// или выданного для другого запроса
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Ограничения размера страницы SearchPage
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// cursorOrder - порядок, в котором SearchPage выдаёт посылки. Он записывается
+// в курсор, чтобы курсоры не подошли, если порядок когда-нибудь изменится
+const cursorOrder = "number_asc"
+
+// Page - страница результатов поиска
+type Page struct {
+	Parcels    []Parcel
+	NextCursor string // пусто - страница последняя
+}
+
+// cursor - содержимое курсора. Клиент видит только подписанную base64-строку
+type cursor struct {
+	After  int64  `json:"a"`
+	Order  string `json:"o"`
+	Filter string `json:"f"` // хеш выражения фильтра
+}
+
+func randomCursorKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// WithCursorKey возвращает копию сервиса, подписывающую курсоры ключом key.
+// Без общего ключа курсоры, выданные одним экземпляром сервиса,
+// не принимаются другими и перестают действовать после перезапуска
+func (s ParcelService) WithCursorKey(key []byte) ParcelService {
+	s.cursorKey = key
+	return s
+}
+
+// SearchPage возвращает страницу посылок, подходящих под выражение фильтра,
+// в порядке возрастания номера. Для первой страницы cursor пустой, для следующих -
+// Page.NextCursor предыдущей страницы. Курсор привязан к выражению фильтра:
+// с другим выражением он отклоняется с ErrInvalidCursor
+func (s ParcelService) SearchPage(ctx context.Context, expr, token string, limit int) (Page, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return Page{}, ValidationError{Field: "limit", Message: fmt.Sprintf("must not exceed %d", MaxPageSize)}
+	}
+	f, err := s.parseFilter(expr)
+	if err != nil {
+		return Page{}, err
+	}
+
+	c := cursor{Order: cursorOrder, Filter: filterHash(expr)}
+	if token != "" {
+		if c, err = s.decodeCursor(token); err != nil {
+			return Page{}, err
+		}
+		if c.Order != cursorOrder || c.Filter != filterHash(expr) {
+			return Page{}, ErrInvalidCursor
+		}
+	}
+
+	// запрашиваем на одну посылку больше, чтобы узнать, есть ли следующая страница
+	parcels, err := s.store.WithContext(ctx).SearchAfter(scopeFilter(ctx, f), c.After, limit+1)
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Parcels: parcels}
+	if len(parcels) > limit {
+		page.Parcels = parcels[:limit]
+		c.After = page.Parcels[limit-1].Number
+		page.NextCursor = s.encodeCursor(c)
+	}
+	return page, nil
+}
+
+// filterHash возвращает хеш выражения фильтра без учёта пробелов по краям
+func filterHash(expr string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(expr)))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func (s ParcelService) encodeCursor(c cursor) string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.signCursor(payload))
+}
+
+func (s ParcelService) decodeCursor(token string) (cursor, error) {
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return cursor{}, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil || !hmac.Equal(sig, s.signCursor(payload)) {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (s ParcelService) signCursor(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.cursorKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearchPage проверяет постраничный поиск и проверку курсоров
+func TestSearchPage(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	var numbers []int64
+	for i := 0; i < 5; i++ {
+		p, err := service.Register(ctx, 1, "Псков")
+		require.NoError(t, err)
+		numbers = append(numbers, p.Number)
+	}
+	_, err := service.Register(ctx, 2, "Псков")
+	require.NoError(t, err)
+	expr := "client = 1"
+
+	// pages
+	var got []int64
+	token := ""
+	pages := 0
+	for {
+		page, err := service.SearchPage(ctx, expr, token, 2)
+		require.NoError(t, err)
+		pages++
+		for _, p := range page.Parcels {
+			got = append(got, p.Number)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		token = page.NextCursor
+	}
+	assert.Equal(t, numbers, got)
+	assert.Equal(t, 3, pages)
+
+	first, err := service.SearchPage(ctx, expr, "", 2)
+	require.NoError(t, err)
+	require.NotEmpty(t, first.NextCursor)
+
+	// курсор другого запроса
+	_, err = service.SearchPage(ctx, "client = 2", first.NextCursor, 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// подделанный курсор
+	payload, sig, _ := strings.Cut(first.NextCursor, ".")
+	forged := service.encodeCursor(cursor{After: 0, Order: cursorOrder, Filter: filterHash(expr)})
+	_, forgedSig, _ := strings.Cut(forged, ".")
+	_, err = service.SearchPage(ctx, expr, strings.Split(forged, ".")[0]+"."+sig, 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = service.SearchPage(ctx, expr, payload+"."+forgedSig, 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = service.SearchPage(ctx, expr, "garbage", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// курсор другого ключа
+	other := service.WithCursorKey([]byte("other key"))
+	_, err = other.SearchPage(ctx, expr, first.NextCursor, 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = service.SearchPage(ctx, expr, "", MaxPageSize+1)
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqlitePragmas выполняются драйвером на каждом новом соединении
+// после busy_timeout, чтобы переключение журнала тоже ждало блокировку
+var sqlitePragmas = []string{
+	"journal_mode(WAL)",
+	"synchronous(NORMAL)",
+	"foreign_keys(1)",
+}
+
+// Open открывает БД по настройкам cfg, проверяет соединение
+// с повторными попытками по cfg.Retry и настраивает пул соединений
+func Open(cfg Config) (*sql.DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return openWithRetry(cfg.Retry, func() (*sql.DB, error) {
+		return openPool(cfg, withPragmas(cfg.DSN, cfg.BusyTimeout))
+	})
+}
+
+// openPool открывает БД по dsn и настраивает пул соединений по cfg.
+// Через неё открывают БД все конструкторы, чтобы у sqlite всегда
+// было не больше cfg.MaxOpenConns соединений
+func openPool(cfg Config, dsn string) (*sql.DB, error) {
+	db, err := openSQL(cfg, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
+
+// OpenReplicas открывает реплики из cfg.ReplicaDSNs только для чтения.
+// Соединение с репликой не проверяется: недоступная реплика не мешает
+// старту, а ParcelStore читает из следующего подключения
+func OpenReplicas(cfg Config) ([]*sql.DB, error) {
+	replicas := make([]*sql.DB, 0, len(cfg.ReplicaDSNs))
+	for _, dsn := range cfg.ReplicaDSNs {
+		db, err := openPool(cfg, withPragmas(dsn, cfg.BusyTimeout)+"&_pragma=query_only(1)")
+		if err != nil {
+			closeAll(replicas)
+			return nil, err
+		}
+		replicas = append(replicas, db)
+	}
+	return replicas, nil
+}
+
+// closeAll закрывает все переданные подключения
+func closeAll(dbs []*sql.DB) {
+	for _, db := range dbs {
+		db.Close()
+	}
+}
+
+// OpenDB открывает БД SQLite по dsn с настройками DefaultConfig:
+// pragma для всех соединений и пул из одного соединения
+func OpenDB(dsn string) (*sql.DB, error) {
+	cfg := DefaultConfig()
+	return openPool(cfg, withPragmas(dsn, cfg.BusyTimeout))
+}
+
+// withPragmas добавляет busy_timeout и sqlitePragmas к параметрам dsn
+func withPragmas(dsn string, busyTimeout time.Duration) string {
+	params := make([]string, 0, len(sqlitePragmas)+1)
+	params = append(params, fmt.Sprintf("_pragma=busy_timeout(%d)", busyTimeout.Milliseconds()))
+	for _, p := range sqlitePragmas {
+		params = append(params, "_pragma="+p)
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(params, "&")
+}
+
+// RetryPolicy задаёт параметры повторных попыток подключения к БД
+type RetryPolicy struct {
+	MaxAttempts  int           // общее число попыток, включая первую
+	InitialDelay time.Duration // пауза перед второй попыткой
+	MaxDelay     time.Duration // верхняя граница паузы между попытками
+	Multiplier   float64       // во сколько раз растёт пауза после каждой попытки
+}
+
+// DefaultRetryPolicy подходит для ожидания перезапуска БД при старте сервиса
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: 100 * time.Millisecond,
+	MaxDelay:     5 * time.Second,
+	Multiplier:   2,
+}
+
+// OpenWithRetry открывает БД через OpenDB и проверяет соединение,
+// повторяя попытки с экспоненциально растущей паузой и случайным разбросом
+func OpenWithRetry(dsn string, policy RetryPolicy) (*sql.DB, error) {
+	return openWithRetry(policy, func() (*sql.DB, error) {
+		return OpenDB(dsn)
+	})
+}
+
+// openWithRetry вызывает open и проверяет соединение, пока не исчерпает попытки policy
+func openWithRetry(policy RetryPolicy, open func() (*sql.DB, error)) (*sql.DB, error) {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := policy.InitialDelay
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var db *sql.DB
+		db, err = open()
+		if err == nil {
+			if err = db.Ping(); err == nil {
+				return db, nil
+			}
+			db.Close()
+		}
+
+		if attempt == attempts {
+			break
+		}
+		time.Sleep(jitter(delay))
+		delay = policy.nextDelay(delay)
+	}
+
+	return nil, fmt.Errorf("open database after %d attempts: %w", attempts, err)
+}
+
+// nextDelay возвращает паузу перед следующей попыткой
+func (p RetryPolicy) nextDelay(delay time.Duration) time.Duration {
+	next := time.Duration(float64(delay) * p.Multiplier)
+	if p.MaxDelay > 0 && next > p.MaxDelay {
+		next = p.MaxDelay
+	}
+	return next
+}
+
+// jitter возвращает случайную паузу в диапазоне [delay/2, delay),
+// чтобы несколько экземпляров сервиса не переподключались одновременно
+func jitter(delay time.Duration) time.Duration {
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half))
+}
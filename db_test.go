@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenDBPragmas проверяет, что OpenDB настраивает соединение
+func TestOpenDBPragmas(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "pragma.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var journalMode string
+	err = db.QueryRow("PRAGMA journal_mode").Scan(&journalMode)
+	require.NoError(t, err)
+	assert.Equal(t, "wal", journalMode)
+
+	var busyTimeout, foreignKeys, synchronous int
+	require.NoError(t, db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	require.NoError(t, db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys))
+	require.NoError(t, db.QueryRow("PRAGMA synchronous").Scan(&synchronous))
+	assert.Equal(t, 5000, busyTimeout)
+	assert.Equal(t, 1, foreignKeys)
+	// 1 соответствует synchronous = NORMAL
+	assert.Equal(t, 1, synchronous)
+}
+
+// TestOpenWithRetry проверяет успешное подключение и отказ после исчерпания попыток
+func TestOpenWithRetry(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     2 * time.Millisecond,
+		Multiplier:   2,
+	}
+
+	db, err := OpenWithRetry(filepath.Join(t.TempDir(), "retry.db"), policy)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// каталога не существует, поэтому файл БД нельзя создать ни с одной попытки
+	_, err = OpenWithRetry(filepath.Join(t.TempDir(), "missing", "retry.db"), policy)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "3 attempts")
+}
+
+// TestRetryPolicyNextDelay проверяет рост паузы и её ограничение сверху
+func TestRetryPolicyNextDelay(t *testing.T) {
+	policy := RetryPolicy{Multiplier: 2, MaxDelay: 300 * time.Millisecond}
+
+	assert.Equal(t, 200*time.Millisecond, policy.nextDelay(100*time.Millisecond))
+	assert.Equal(t, 300*time.Millisecond, policy.nextDelay(200*time.Millisecond))
+}
+
+// TestOpenAppliesPool проверяет, что все конструкторы применяют настройки пула
+func TestOpenAppliesPool(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DSN = filepath.Join(t.TempDir(), "pool.db")
+	cfg.ReplicaDSNs = []string{cfg.DSN}
+
+	db, err := Open(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, 1, db.Stats().MaxOpenConnections)
+
+	replicas, err := OpenReplicas(cfg)
+	require.NoError(t, err)
+	defer closeAll(replicas)
+	assert.Equal(t, 1, replicas[0].Stats().MaxOpenConnections)
+
+	db, err = OpenDB(cfg.DSN)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, 1, db.Stats().MaxOpenConnections)
+
+	db, err = OpenWithRetry(cfg.DSN, DefaultRetryPolicy)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, 1, db.Stats().MaxOpenConnections)
+}
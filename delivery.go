@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// DeliveryProof - подтверждение вручения посылки для разбора спорных случаев
+type DeliveryProof struct {
+	RecipientName string
+	DeliveredAt   string // RFC3339, если не задано - время вызова MarkDelivered
+	PhotoRef      string // ссылка на фото вручения в файловом хранилище, необязательна
+	SignatureRef  string // ссылка на изображение подписи, необязательна
+}
+
+// MarkDelivered переводит отправленную посылку в статус delivered и сохраняет
+// подтверждение вручения в одной транзакции
+func (s ParcelStore) MarkDelivered(number int64, proof DeliveryProof) error {
+	if err := s.preStatusChange(number, ParcelStatusDelivered); err != nil {
+		return err
+	}
+	err := s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(s.context(), "UPDATE parcel SET status = :delivered WHERE number = :number AND status = :status AND "+tenantScope,
+			sql.Named("delivered", ParcelStatusDelivered),
+			sql.Named("number", number),
+			sql.Named("status", ParcelStatusSent),
+			s.tenantArg())
+		if err != nil {
+			return err
+		}
+		changed, err := s.recordStatusChange(tx, res, number, ParcelStatusDelivered)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return fmt.Errorf("%w: parcel %d is not sent", ErrForbiddenTransition, number)
+		}
+
+		name, err := s.fields.encrypt("recipient_name", proof.RecipientName)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(s.context(), "INSERT INTO parcel_delivery_proof (number, recipient_name, delivered_at, photo_ref, signature_ref, tenant_id) "+
+			"VALUES (:number, :recipient_name, :delivered_at, :photo_ref, :signature_ref, "+parcelTenant+")",
+			sql.Named("number", number),
+			sql.Named("recipient_name", name),
+			sql.Named("delivered_at", proof.DeliveredAt),
+			sql.Named("photo_ref", proof.PhotoRef),
+			sql.Named("signature_ref", proof.SignatureRef))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notify(ParcelEvent{Type: ParcelEventStatusChanged, Number: number, Status: ParcelStatusDelivered})
+	return nil
+}
+
+// GetDeliveryProof возвращает подтверждение вручения посылки
+func (s ParcelStore) GetDeliveryProof(number int64) (DeliveryProof, error) {
+	p := DeliveryProof{}
+	err := s.db.QueryRowContext(s.context(), "SELECT recipient_name, delivered_at, photo_ref, signature_ref FROM parcel_delivery_proof WHERE number = :number AND "+tenantScope,
+		sql.Named("number", number), s.tenantArg()).Scan(&p.RecipientName, &p.DeliveredAt, &p.PhotoRef, &p.SignatureRef)
+	if err != nil {
+		return DeliveryProof{}, err
+	}
+	p.RecipientName, err = s.fields.decrypt("recipient_name", p.RecipientName)
+	return p, err
+}
+
+// MarkDelivered отмечает вручение отправленной посылки получателю с подтверждением
+func (s ParcelService) MarkDelivered(ctx context.Context, number int64, proof DeliveryProof) (err error) {
+	defer s.logOp(ctx, "mark_delivered", time.Now(), &err, slog.Int64("number", number))
+	if strings.TrimSpace(proof.RecipientName) == "" {
+		return ValidationError{Field: "recipient_name", Message: "must not be empty"}
+	}
+	if proof.DeliveredAt == "" {
+		proof.DeliveredAt = time.Now().UTC().Format(time.RFC3339)
+	} else if _, err := time.Parse(time.RFC3339, proof.DeliveredAt); err != nil {
+		return ValidationError{Field: "delivered_at", Message: "must be RFC3339 time"}
+	}
+
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if err := checkParcelAccess(ctx, accessStatus, parcel); err != nil {
+		return err
+	}
+	if err := checkTransition(parcel.Status, ParcelStatusDelivered); err != nil {
+		return err
+	}
+
+	return s.store.WithContext(ctx).MarkDelivered(number, proof)
+}
+
+// GetDeliveryProof возвращает подтверждение вручения или ErrParcelNotFound,
+// если посылка не вручена с подтверждением
+func (s ParcelService) GetDeliveryProof(ctx context.Context, number int64) (DeliveryProof, error) {
+	proof, err := s.store.WithContext(ctx).GetDeliveryProof(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DeliveryProof{}, fmt.Errorf("%w: delivery proof of parcel %d", ErrParcelNotFound, number)
+	}
+	return proof, err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMarkDelivered проверяет вручение посылки с подтверждением
+func TestMarkDelivered(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	p, err := service.Register(ctx, 1, "test")
+	require.NoError(t, err)
+
+	proof := DeliveryProof{
+		RecipientName: "Иван Петров",
+		DeliveredAt:   "2024-05-01T12:00:00Z",
+		SignatureRef:  "signatures/1.png",
+	}
+
+	// посылку, которая ещё не отправлена, вручить нельзя
+	err = service.MarkDelivered(ctx, p.Number, proof)
+	require.ErrorIs(t, err, ErrForbiddenTransition)
+
+	// без имени получателя подтверждение не принимается
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	err = service.MarkDelivered(ctx, p.Number, DeliveryProof{})
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	// deliver
+	require.NoError(t, service.MarkDelivered(ctx, p.Number, proof))
+	assertStatus(t, service, p.Number, ParcelStatusDelivered)
+
+	stored, err := service.GetDeliveryProof(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, proof, stored)
+
+	_, err = service.GetDeliveryProof(ctx, 0)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"database/sql"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// WithDiagnostics возвращает копию обработчика, в которой открыты профили
+// net/http/pprof на /admin/debug/pprof/ и переменные expvar, в том числе
+// статистика памяти, на /admin/debug/vars. Как и остальные адреса /admin/,
+// они требуют токена администратора, см. WithAdminToken
+func (h APIHandler) WithDiagnostics() APIHandler {
+	h.diagnostics = newDiagnosticsHandler()
+	return h
+}
+
+// newDiagnosticsHandler отдаёт pprof и expvar по их обычным адресам /debug/ под /admin/.
+// Обработчики регистрируются явно: пакеты pprof и expvar добавляют их
+// только в http.DefaultServeMux, который API не обслуживает
+func newDiagnosticsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return http.StripPrefix("/admin", mux)
+}
+
+// publishDBStats публикует в expvar статистику пула соединений db под именем name
+func publishDBStats(name string, db *sql.DB) {
+	expvar.Publish(name, expvar.Func(func() any { return db.Stats() }))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDiagnostics проверяет адреса pprof и expvar под /admin/debug/
+func TestDiagnostics(t *testing.T) {
+	service, store := newTestService(t)
+	publishDBStats("test_db", store.db)
+	handler := NewAPIHandler(service).WithAdminToken("secret")
+
+	// prepare
+	rec := adminCall(t, handler, "secret", http.MethodGet, "/admin/debug/vars", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code, "без WithDiagnostics адресов нет")
+
+	// add
+	handler = handler.WithDiagnostics()
+
+	// check
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/debug/vars", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var vars map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &vars))
+	assert.Contains(t, vars, "memstats")
+	assert.Contains(t, string(vars["test_db"]), "OpenConnections")
+
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/debug/pprof/", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "heap")
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/debug/pprof/heap?debug=1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "heap profile")
+
+	rec = adminCall(t, handler, "", http.MethodGet, "/admin/debug/pprof/", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
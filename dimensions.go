@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Dimensions - вес и габариты посылки для тарификации и сортировки
+type Dimensions struct {
+	WeightKg float64
+	LengthCm float64
+	WidthCm  float64
+	HeightCm float64
+}
+
+// DimensionLimits - максимальные вес и габариты, которые принимает служба
+type DimensionLimits struct {
+	MaxWeightKg float64
+	MaxSideCm   float64
+}
+
+// DefaultDimensionLimits - ограничения для обычных посылок
+var DefaultDimensionLimits = DimensionLimits{MaxWeightKg: 30, MaxSideCm: 150}
+
+// WithDimensionLimits возвращает копию сервиса с другими ограничениями веса и габаритов
+func (s ParcelService) WithDimensionLimits(l DimensionLimits) ParcelService {
+	s.limits = l
+	return s
+}
+
+// SetDimensions сохраняет вес и габариты посылки
+func (s ParcelStore) SetDimensions(number int64, d Dimensions) error {
+	return s.auditedUpdate(number, []string{"weight_kg", "length_cm", "width_cm", "height_cm"}, "UPDATE parcel SET weight_kg = :weight, length_cm = :length, width_cm = :width, height_cm = :height WHERE number = :number AND "+tenantScope,
+		sql.Named("weight", d.WeightKg),
+		sql.Named("length", d.LengthCm),
+		sql.Named("width", d.WidthCm),
+		sql.Named("height", d.HeightCm),
+		sql.Named("number", number),
+		s.tenantArg())
+}
+
+// SetDimensions задаёт вес и габариты посылки, пока она не отправлена
+func (s ParcelService) SetDimensions(ctx context.Context, number int64, d Dimensions) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	if err := s.validateDimensions(d); err != nil {
+		return err
+	}
+	if err := s.checkRegistered(ctx, number); err != nil {
+		return err
+	}
+	return s.store.WithContext(ctx).SetDimensions(number, d)
+}
+
+// validateDimensions проверяет, что все значения положительны и не превышают ограничений
+func (s ParcelService) validateDimensions(d Dimensions) error {
+	if d.WeightKg <= 0 {
+		return ValidationError{Field: "weight_kg", Message: "must be positive"}
+	}
+	if d.WeightKg > s.limits.MaxWeightKg {
+		return ValidationError{Field: "weight_kg", Message: fmt.Sprintf("must not exceed %g", s.limits.MaxWeightKg)}
+	}
+	sides := []struct {
+		field string
+		value float64
+	}{
+		{"length_cm", d.LengthCm},
+		{"width_cm", d.WidthCm},
+		{"height_cm", d.HeightCm},
+	}
+	for _, side := range sides {
+		if side.value <= 0 {
+			return ValidationError{Field: side.field, Message: "must be positive"}
+		}
+		if side.value > s.limits.MaxSideCm {
+			return ValidationError{Field: side.field, Message: fmt.Sprintf("must not exceed %g", s.limits.MaxSideCm)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetDimensions проверяет сохранение и проверку веса и габаритов
+func TestSetDimensions(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	d := Dimensions{WeightKg: 1.5, LengthCm: 30, WidthCm: 20, HeightCm: 10}
+
+	// set
+	require.NoError(t, service.SetDimensions(ctx, p.Number, d))
+
+	// check
+	stored, err := store.Get(p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, d, stored.Dimensions)
+
+	// validation
+	for _, bad := range []Dimensions{
+		{WeightKg: 0, LengthCm: 30, WidthCm: 20, HeightCm: 10},
+		{WeightKg: 31, LengthCm: 30, WidthCm: 20, HeightCm: 10},
+		{WeightKg: 1, LengthCm: -1, WidthCm: 20, HeightCm: 10},
+		{WeightKg: 1, LengthCm: 30, WidthCm: 20, HeightCm: 151},
+	} {
+		assert.ErrorIs(t, service.SetDimensions(ctx, p.Number, bad), ErrInvalidParcel, bad)
+	}
+
+	// ограничения настраиваются
+	heavy := Dimensions{WeightKg: 50, LengthCm: 30, WidthCm: 20, HeightCm: 10}
+	freight := service.WithDimensionLimits(DimensionLimits{MaxWeightKg: 100, MaxSideCm: 300})
+	require.NoError(t, freight.SetDimensions(ctx, p.Number, heavy))
+
+	// после отправки габариты не меняются
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	assert.ErrorIs(t, service.SetDimensions(ctx, p.Number, d), ErrParcelLocked)
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrEncryptionKey возвращается, если зашифрованное значение нельзя расшифровать:
+// ключа с его идентификатором нет в настройках или значение повреждено
+var ErrEncryptionKey = errors.New("encryption key")
+
+// encryptedPrefix отличает зашифрованные значения от открытых, записанных
+// до включения шифрования: "enc:<key id>:<base64 nonce+ciphertext>"
+const encryptedPrefix = "enc:"
+
+// encryptionKeyID - допустимые идентификаторы ключей. Идентификатор входит
+// в шаблон LIKE при ротации, поэтому спецсимволов в нём нет
+var encryptionKeyID = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// encryptedColumns - колонки с персональными данными, которые шифрует хранилище.
+// Шифротекст привязан к имени колонки, поэтому значение нельзя переставить в другую
+var encryptedColumns = map[string]bool{
+	"address":         true,
+	"recipient_name":  true,
+	"recipient_phone": true,
+}
+
+// EncryptionKey - ключ AES-256 с идентификатором, который записывается
+// в каждое зашифрованное им значение
+type EncryptionKey struct {
+	ID  string
+	Key []byte
+}
+
+// ParseEncryptionKeys разбирает список ключей вида "2024-06:base64,2024-01:base64".
+// Первый ключ шифрует новые значения, остальные нужны, чтобы читать значения,
+// зашифрованные до ротации. Пустая строка - шифрование отключено
+func ParseEncryptionKeys(spec string) ([]EncryptionKey, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var keys []EncryptionKey
+	seen := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || !encryptionKeyID.MatchString(id) {
+			return nil, fmt.Errorf("encryption key %q: expected <id>:<base64 key>", item)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("encryption key %q: duplicate id", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q: must be 32 bytes in base64", id)
+		}
+		seen[id] = true
+		keys = append(keys, EncryptionKey{ID: id, Key: key})
+	}
+	return keys, nil
+}
+
+// FieldCipher шифрует колонки encryptedColumns в AES-GCM и строит слепой
+// индекс телефона получателя для поиска по точному совпадению
+type FieldCipher struct {
+	active string
+	aeads  map[string]cipher.AEAD
+	index  map[string][]byte // ключи слепого индекса, производные от ключей шифрования
+}
+
+// NewFieldCipher создаёт шифрование с ключами keys, первый из них активный
+func NewFieldCipher(keys []EncryptionKey) (*FieldCipher, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption keys")
+	}
+	c := &FieldCipher{active: keys[0].ID, aeads: map[string]cipher.AEAD{}, index: map[string][]byte{}}
+	for _, k := range keys {
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads[k.ID] = aead
+		mac := hmac.New(sha256.New, k.Key)
+		mac.Write([]byte("tracker blind index"))
+		c.index[k.ID] = mac.Sum(nil)
+	}
+	return c, nil
+}
+
+// encrypt шифрует значение колонки column активным ключом. Пустое значение
+// остаётся пустым, чтобы проверки вида recipient_phone != ” работали как раньше.
+// Без ключей значение возвращается открытым
+func (c *FieldCipher) encrypt(column, value string) (string, error) {
+	if c == nil || value == "" {
+		return value, nil
+	}
+	aead := c.aeads[c.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(column))
+	return encryptedPrefix + c.active + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt расшифровывает значение колонки column. Открытые значения,
+// записанные до включения шифрования, возвращаются как есть
+func (c *FieldCipher) decrypt(column, value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+	id, encoded, _ := strings.Cut(rest, ":")
+	if c == nil || c.aeads[id] == nil {
+		return "", fmt.Errorf("%w %q is not configured", ErrEncryptionKey, id)
+	}
+	aead := c.aeads[id]
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%w %q: malformed %s", ErrEncryptionKey, id, column)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("%w %q: cannot decrypt %s", ErrEncryptionKey, id, column)
+	}
+	return string(plain), nil
+}
+
+// blindIndex возвращает слепой индекс значения для активного ключа
+// или пустую строку без ключей и для пустого значения
+func (c *FieldCipher) blindIndex(value string) string {
+	if c == nil || value == "" {
+		return ""
+	}
+	return c.blindIndexWith(c.active, value)
+}
+
+func (c *FieldCipher) blindIndexWith(id, value string) string {
+	mac := hmac.New(sha256.New, c.index[id])
+	mac.Write([]byte(value))
+	return id + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// blindIndexes возвращает слепые индексы значения для всех ключей:
+// до завершения ротации строки могут быть проиндексированы прежним ключом
+func (c *FieldCipher) blindIndexes(value string) []string {
+	res := make([]string, 0, len(c.index))
+	for id := range c.index {
+		res = append(res, c.blindIndexWith(id, value))
+	}
+	return res
+}
+
+// WithEncryption возвращает копию хранилища, которая шифрует адреса, имена
+// и телефоны получателей в БД, в том числе в снимках журнала аудита и событиях
+// в очереди вебхуков, и расшифровывает их при чтении.
+// Поиск и группировка по зашифрованным полям с ним недоступны, см. checkEncryptedFields
+func (s ParcelStore) WithEncryption(c *FieldCipher) ParcelStore {
+	s.fields = c
+	return s
+}
+
+// sealParcel шифрует персональные данные посылки перед записью
+func (s ParcelStore) sealParcel(p Parcel) (Parcel, error) {
+	var err error
+	if p.Address, err = s.fields.encrypt("address", p.Address); err != nil {
+		return p, err
+	}
+	p.Recipient, err = s.sealRecipient(p.Recipient)
+	return p, err
+}
+
+// sealRecipient шифрует имя и телефон получателя перед записью
+func (s ParcelStore) sealRecipient(r Recipient) (Recipient, error) {
+	var err error
+	if r.Name, err = s.fields.encrypt("recipient_name", r.Name); err != nil {
+		return r, err
+	}
+	r.Phone, err = s.fields.encrypt("recipient_phone", r.Phone)
+	return r, err
+}
+
+// openParcel расшифровывает персональные данные прочитанной посылки
+func (s ParcelStore) openParcel(p *Parcel) error {
+	var err error
+	if p.Address, err = s.fields.decrypt("address", p.Address); err != nil {
+		return err
+	}
+	if p.Recipient.Name, err = s.fields.decrypt("recipient_name", p.Recipient.Name); err != nil {
+		return err
+	}
+	p.Recipient.Phone, err = s.fields.decrypt("recipient_phone", p.Recipient.Phone)
+	return err
+}
+
+// checkEncryptedFields запрещает условия и группировку по зашифрованным колонкам:
+// с шифрованием в БД нет открытых значений, с которыми их можно сравнить
+func (s ParcelStore) checkEncryptedFields(columns ...string) error {
+	if s.fields == nil {
+		return nil
+	}
+	for _, column := range columns {
+		if encryptedColumns[column] {
+			return fmt.Errorf("%w: field %q is encrypted", ErrInvalidFilter, column)
+		}
+	}
+	return nil
+}
+
+// encryptedTables - таблицы с зашифрованными колонками, их ключи и эти колонки
+var encryptedTables = []struct {
+	table   string
+	key     string
+	columns []string
+}{
+	{"parcel", "number", []string{"address", "recipient_name", "recipient_phone"}},
+	{"parcel_archive", "number", []string{"address", "recipient_name", "recipient_phone"}},
+	{"parcel_address_history", "id", []string{"address"}},
+	{"parcel_delivery_proof", "number", []string{"recipient_name"}},
+	{"webhook_delivery", "id", []string{"payload"}},
+}
+
+// auditEncryptedColumns - зашифрованные колонки посылки в снимках before и after
+// журнала аудита: снимки хранят значения колонок как в parcel
+var auditEncryptedColumns = []string{"address", "recipient_name", "recipient_phone"}
+
+// mapAuditValues применяет fn к зашифрованным колонкам снимка журнала аудита raw
+func mapAuditValues(raw string, fn func(column, value string) (string, error)) (string, error) {
+	if raw == "" {
+		return raw, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var values map[string]any
+	if err := dec.Decode(&values); err != nil {
+		return "", err
+	}
+	for _, column := range auditEncryptedColumns {
+		v, ok := values[column].(string)
+		if !ok || v == "" {
+			continue
+		}
+		var err error
+		if values[column], err = fn(column, v); err != nil {
+			return "", err
+		}
+	}
+	data, err := json.Marshal(values)
+	return string(data), err
+}
+
+// reseal перешифровывает активным ключом значение колонки column
+func (c *FieldCipher) reseal(column, value string) (string, error) {
+	plain, err := c.decrypt(column, value)
+	if err != nil {
+		return "", err
+	}
+	return c.encrypt(column, plain)
+}
+
+// RotateEncryption перешифровывает активным ключом значения, зашифрованные
+// прежними ключами или ещё открытые, и возвращает количество изменённых строк.
+// После ротации прежние ключи можно убрать из настроек
+func (s ParcelStore) RotateEncryption() (int, error) {
+	if s.fields == nil {
+		return 0, errors.New("encryption is not configured")
+	}
+	current := encryptedPrefix + s.fields.active + ":%"
+	total := 0
+	for _, t := range encryptedTables {
+		conds := make([]string, len(t.columns))
+		sets := make([]string, len(t.columns))
+		for i, column := range t.columns {
+			conds[i] = "(" + column + " != '' AND " + column + " NOT LIKE :current)"
+			sets[i] = column + " = :" + column
+		}
+		if t.table == "parcel" {
+			sets = append(sets, "recipient_phone_idx = :phone_idx")
+		}
+
+		err := s.inTx(func(tx *sql.Tx) error {
+			rows, err := tx.QueryContext(s.context(), "SELECT "+t.key+", "+strings.Join(t.columns, ", ")+" FROM "+t.table+
+				" WHERE ("+strings.Join(conds, " OR ")+") AND "+tenantScope,
+				sql.Named("current", current),
+				s.tenantArg())
+			if err != nil {
+				return err
+			}
+			type row struct {
+				key    int64
+				values []string
+			}
+			var stale []row
+			for rows.Next() {
+				r := row{values: make([]string, len(t.columns))}
+				dest := []any{&r.key}
+				for i := range r.values {
+					dest = append(dest, &r.values[i])
+				}
+				if err := rows.Scan(dest...); err != nil {
+					rows.Close()
+					return err
+				}
+				stale = append(stale, r)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			for _, r := range stale {
+				args := []any{sql.Named("key", r.key)}
+				for i, column := range t.columns {
+					plain, err := s.fields.decrypt(column, r.values[i])
+					if err != nil {
+						return fmt.Errorf("%s %d: %w", t.table, r.key, err)
+					}
+					sealed, err := s.fields.encrypt(column, plain)
+					if err != nil {
+						return err
+					}
+					args = append(args, sql.Named(column, sealed))
+					if column == "recipient_phone" {
+						args = append(args, sql.Named("phone_idx", s.fields.blindIndex(plain)))
+					}
+				}
+				if _, err := tx.ExecContext(s.context(), "UPDATE "+t.table+" SET "+strings.Join(sets, ", ")+" WHERE "+t.key+" = :key AND "+tenantScope, append(args, s.tenantArg())...); err != nil {
+					return err
+				}
+			}
+			total += len(stale)
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+	}
+	n, err := s.rotateAudit(current)
+	return total + n, err
+}
+
+// rotateAudit перешифровывает активным ключом зашифрованные колонки в снимках
+// журнала аудита и возвращает количество изменённых записей
+func (s ParcelStore) rotateAudit(current string) (int, error) {
+	var conds []string
+	for _, snapshot := range []string{"before", "after"} {
+		for _, column := range auditEncryptedColumns {
+			// у добавления нет before, у удаления - after
+			v := "COALESCE(json_extract(NULLIF(" + snapshot + ", ''), '$." + column + "'), '')"
+			conds = append(conds, "("+v+" != '' AND "+v+" NOT LIKE :current)")
+		}
+	}
+
+	total := 0
+	err := s.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(s.context(), "SELECT id, before, after FROM audit_log WHERE ("+strings.Join(conds, " OR ")+") AND "+tenantScope,
+			sql.Named("current", current),
+			s.tenantArg())
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id            int64
+			before, after string
+		}
+		var stale []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.before, &r.after); err != nil {
+				rows.Close()
+				return err
+			}
+			stale = append(stale, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range stale {
+			before, err := mapAuditValues(r.before, s.fields.reseal)
+			if err != nil {
+				return fmt.Errorf("audit_log %d: %w", r.id, err)
+			}
+			after, err := mapAuditValues(r.after, s.fields.reseal)
+			if err != nil {
+				return fmt.Errorf("audit_log %d: %w", r.id, err)
+			}
+			if _, err := tx.ExecContext(s.context(), "UPDATE audit_log SET before = :before, after = :after WHERE id = :id AND "+tenantScope,
+				sql.Named("before", before),
+				sql.Named("after", after),
+				sql.Named("id", r.id),
+				s.tenantArg()); err != nil {
+				return err
+			}
+		}
+		total = len(stale)
+		return nil
+	})
+	return total, err
+}
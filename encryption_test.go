@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEncryptionKey возвращает ключ с идентификатором id, заполненный байтом b
+func testEncryptionKey(id string, b byte) EncryptionKey {
+	return EncryptionKey{ID: id, Key: bytes.Repeat([]byte{b}, 32)}
+}
+
+// newTestCipher создаёт шифрование с ключами keys, первый из них активный
+func newTestCipher(t *testing.T, keys ...EncryptionKey) *FieldCipher {
+	t.Helper()
+	c, err := NewFieldCipher(keys)
+	require.NoError(t, err)
+	return c
+}
+
+// rawParcelColumn читает значение колонки посылки из БД в обход шифрования
+func rawParcelColumn(t *testing.T, store ParcelStore, number int64, column string) string {
+	t.Helper()
+	var v string
+	require.NoError(t, store.db.QueryRow("SELECT "+column+" FROM parcel WHERE number = ?", number).Scan(&v))
+	return v
+}
+
+// TestParseEncryptionKeys проверяет разбор ключей из настроек
+func TestParseEncryptionKeys(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	keys, err := ParseEncryptionKeys("2024-06:" + key + ", 2024-01:" + key)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "2024-06", keys[0].ID)
+	assert.Len(t, keys[1].Key, 32)
+
+	keys, err = ParseEncryptionKeys("")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	for _, spec := range []string{key, "k1:" + key + ",k1:" + key, "k1:c2hvcnQ=", "k_1:" + key, "k1:not base64"} {
+		_, err := ParseEncryptionKeys(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// TestFieldEncryption проверяет, что адрес и данные получателя хранятся
+// в БД зашифрованными и прозрачно расшифровываются при чтении
+func TestFieldEncryption(t *testing.T) {
+	_, store := newTestService(t)
+	store = store.WithEncryption(newTestCipher(t, testEncryptionKey("k1", 1)))
+	service := NewParcelService(store)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	dispatcher := NewWebhookDispatcher(store, DefaultWebhookAttempts)
+	dispatcher.Subscribe(func(err error) { t.Error(err) })
+	_, err = service.AddWebhook(ctx, 7, "http://example.com/hook", "secret")
+	require.NoError(t, err)
+
+	// add
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Орёл"))
+	require.NoError(t, service.SetRecipient(ctx, p.Number, Recipient{Name: "Анна", Phone: "8 (999) 123-45-67"}))
+
+	// check
+	for _, column := range []string{"address", "recipient_name", "recipient_phone"} {
+		assert.True(t, strings.HasPrefix(rawParcelColumn(t, store, p.Number, column), "enc:k1:"), column)
+	}
+	assert.Equal(t, "орёл", rawParcelColumn(t, store, p.Number, "zone"))
+	// снимки журнала аудита и очередь вебхуков тоже хранят данные зашифрованными
+	for _, query := range []string{"SELECT group_concat(before || after) FROM audit_log", "SELECT group_concat(payload) FROM webhook_delivery"} {
+		var raw string
+		require.NoError(t, store.db.QueryRow(query).Scan(&raw))
+		assert.Contains(t, raw, "enc:k1:", query)
+		assert.NotContains(t, raw, "Орёл", query)
+		assert.NotContains(t, raw, "Анна", query)
+	}
+
+	entries, err := store.ListAudit(AuditQuery{Number: p.Number, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.JSONEq(t, `{"address": "Орёл", "zone": "орёл"}`, string(entries[1].After))
+	assert.Contains(t, string(entries[2].After), `"recipient_name":"Анна"`)
+	deliveries, err := store.ListWebhookDeliveries(7, WebhookPending)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Contains(t, deliveries[0].Payload, `"address":"Орёл"`)
+
+	got, err := service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "Орёл", got.Address)
+	assert.Equal(t, Recipient{Name: "Анна", Phone: "+79991234567"}, got.Recipient)
+
+	parcels, err := service.GetByPhone(ctx, "+79991234567")
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, p.Number, parcels[0].Number)
+
+	history, err := service.GetAddressHistory(ctx, p.Number)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "Псков", history[0].Address)
+
+	rows, err := service.SearchFields(ctx, "client = 7", "number,address")
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "Орёл", rows[0]["address"])
+
+	// в БД нет открытых значений, с которыми можно сравнить условие
+	_, err = service.Search(ctx, `address ~ "Орёл"`)
+	var verr ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "filter", verr.Field)
+	_, err = service.SaveReport(ctx, Report{Name: "по телефонам", GroupBy: "recipient_phone", Format: ReportFormatJSON})
+	assert.ErrorAs(t, err, &verr)
+}
+
+// TestEncryptionRotation проверяет шифрование записанных ранее открытых значений
+// и перешифровку новым ключом
+func TestEncryptionRotation(t *testing.T) {
+	service, plain := newTestService(t)
+	ctx := context.Background()
+	old, fresh := testEncryptionKey("k1", 1), testEncryptionKey("k2", 2)
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.SetRecipient(ctx, p.Number, Recipient{Name: "Анна", Phone: "+79991234567"}))
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Орёл"))
+
+	// открытые значения читаются и с шифрованием
+	store := plain.WithEncryption(newTestCipher(t, old))
+	got, err := store.Get(p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "Орёл", got.Address)
+
+	n, err := store.RotateEncryption()
+	require.NoError(t, err)
+	assert.Equal(t, 5, n) // посылка, прежний адрес и три записи журнала аудита
+	assert.True(t, strings.HasPrefix(rawParcelColumn(t, store, p.Number, "address"), "enc:k1:"))
+
+	// add
+	store = plain.WithEncryption(newTestCipher(t, fresh, old))
+	parcels, err := store.GetByPhone("+79991234567")
+	require.NoError(t, err)
+	assert.Len(t, parcels, 1, "до ротации телефон ищется по индексу прежнего ключа")
+
+	n, err = store.RotateEncryption()
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	n, err = store.RotateEncryption()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// check
+	store = plain.WithEncryption(newTestCipher(t, fresh))
+	got, err = store.Get(p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "Орёл", got.Address)
+	assert.Equal(t, "Анна", got.Recipient.Name)
+	history, err := store.GetAddressHistory(p.Number)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "Псков", history[0].Address)
+	parcels, err = store.GetByPhone("+79991234567")
+	require.NoError(t, err)
+	assert.Len(t, parcels, 1)
+	entries, err := store.ListAudit(AuditQuery{Number: p.Number, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Contains(t, string(entries[0].After), `"address":"Псков"`)
+
+	_, err = plain.WithEncryption(newTestCipher(t, old)).Get(p.Number)
+	assert.ErrorIs(t, err, ErrEncryptionKey)
+	_, err = plain.RotateEncryption()
+	assert.Error(t, err)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ClientErasure - запись об обезличивании данных клиента, см. AnonymizeClient
+type ClientErasure struct {
+	ID       int64  `json:"id"`
+	Client   int64  `json:"client"`
+	ErasedAt string `json:"erased_at"`
+	Actor    string `json:"actor"`
+	Parcels  int    `json:"parcels"` // сколько посылок было обезличено
+}
+
+// redactAudit возвращает SQL, который затирает персональные данные в снимке
+// колонки column журнала аудита. Триггер audit_log_no_update разрешает только такое изменение
+func redactAudit(column string) string {
+	return "CASE WHEN " + column + " = '' THEN '' ELSE json_replace(" + column + ", '$.address', '', '$.recipient_name', '', '$.recipient_phone', '') END"
+}
+
+// AnonymizeClient затирает адреса, данные получателей, заметки и подтверждения
+// вручения всех посылок клиента, в том числе архивных и тех, где клиент
+// только получатель, их прежние адреса
+// и снимки в журнале аудита, и сохраняет запись об этом в одной транзакции.
+// Статусы, зоны, стоимость и габариты остаются, поэтому статистика не меняется.
+// Место затёртых значений в файле БД освобождается при VACUUM
+func (s ParcelStore) AnonymizeClient(client int64) (ClientErasure, error) {
+	e := ClientErasure{Client: client, ErasedAt: time.Now().UTC().Format(time.RFC3339), Actor: s.actor}
+	own := "(client = :client OR recipient_client = :client)"
+	numbers := "(SELECT number FROM parcel WHERE " + own + " AND " + tenantScope +
+		" UNION ALL SELECT number FROM parcel_archive WHERE " + own + " AND " + tenantScope + ")"
+	queries := []string{
+		"UPDATE parcel SET address = '', recipient_name = '', recipient_phone = '', recipient_phone_idx = '' WHERE " + own + " AND " + tenantScope,
+		"UPDATE parcel_archive SET address = '', recipient_name = '', recipient_phone = '' WHERE " + own + " AND " + tenantScope,
+		"UPDATE parcel_address_history SET address = '' WHERE number IN " + numbers + " AND " + tenantScope,
+		"UPDATE parcel_notes SET text = '' WHERE number IN " + numbers + " AND " + tenantScope,
+		"UPDATE parcel_delivery_proof SET recipient_name = '', photo_ref = '', signature_ref = '' WHERE number IN " + numbers + " AND " + tenantScope,
+		"UPDATE audit_log SET before = " + redactAudit("before") + ", after = " + redactAudit("after") + " WHERE number IN " + numbers + " AND " + tenantScope,
+	}
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(s.context(), "SELECT COUNT(*) FROM "+numbers,
+			sql.Named("client", client),
+			s.tenantArg()).Scan(&e.Parcels)
+		if err != nil {
+			return err
+		}
+		for _, query := range queries {
+			if _, err := tx.ExecContext(s.context(), query, sql.Named("client", client), s.tenantArg()); err != nil {
+				return err
+			}
+		}
+		if err := s.redactWebhookPayloads(tx, client); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(s.context(), "INSERT INTO client_erasure (client, erased_at, actor, parcels, tenant_id) VALUES (:client, :erased_at, :actor, :parcels, :tenant)",
+			sql.Named("client", client),
+			sql.Named("erased_at", e.ErasedAt),
+			sql.Named("actor", e.Actor),
+			sql.Named("parcels", e.Parcels),
+			s.tenantArg())
+		if err != nil {
+			return err
+		}
+		e.ID, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return ClientErasure{}, err
+	}
+	return e, nil
+}
+
+// redactWebhookPayloads убирает адрес из событий, ещё не отправленных вебхукам
+// клиента. Тело события может быть зашифровано, поэтому оно меняется не в SQL
+func (s ParcelStore) redactWebhookPayloads(tx *sql.Tx, client int64) error {
+	rows, err := tx.QueryContext(s.context(), "SELECT id, payload FROM webhook_delivery WHERE event_type = :type "+
+		"AND webhook_id IN (SELECT id FROM webhook WHERE client = :client AND "+tenantScope+") AND "+tenantScope,
+		sql.Named("type", ParcelEventAddressChanged),
+		sql.Named("client", client),
+		s.tenantArg())
+	if err != nil {
+		return err
+	}
+	payloads := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var payload string
+		if err := rows.Scan(&id, &payload); err != nil {
+			rows.Close()
+			return err
+		}
+		payloads[id] = payload
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, payload := range payloads {
+		plain, err := s.fields.decrypt("payload", payload)
+		if err != nil {
+			return fmt.Errorf("webhook_delivery %d: %w", id, err)
+		}
+		var event WebhookEvent
+		if err := json.Unmarshal([]byte(plain), &event); err != nil {
+			return fmt.Errorf("webhook_delivery %d: %w", id, err)
+		}
+		event.Address = ""
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		sealed, err := s.fields.encrypt("payload", string(data))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(s.context(), "UPDATE webhook_delivery SET payload = :payload WHERE id = :id",
+			sql.Named("payload", sealed),
+			sql.Named("id", id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListErasures возвращает записи об обезличивании данных клиента в порядке выполнения
+func (s ParcelStore) ListErasures(client int64) ([]ClientErasure, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT id, client, erased_at, actor, parcels FROM client_erasure WHERE client = :client AND "+tenantScope+" ORDER BY id",
+		sql.Named("client", client), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []ClientErasure{}
+	for rows.Next() {
+		var e ClientErasure
+		if err := rows.Scan(&e.ID, &e.Client, &e.ErasedAt, &e.Actor, &e.Parcels); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// AnonymizeClient необратимо обезличивает данные клиента по запросу на удаление
+// персональных данных (GDPR). Доступно только администраторам
+func (s ParcelService) AnonymizeClient(ctx context.Context, client int64) (_ ClientErasure, err error) {
+	defer s.logOp(ctx, "anonymize_client", time.Now(), &err, slog.Int64("client", client))
+	if err := requireRole(ctx, RoleAdmin); err != nil {
+		return ClientErasure{}, err
+	}
+	if err := validateClient(client); err != nil {
+		return ClientErasure{}, err
+	}
+	e, err := s.store.WithContext(ctx).AnonymizeClient(client)
+	if err != nil {
+		return ClientErasure{}, err
+	}
+	return e, nil
+}
+
+// ClientErasures возвращает записи об обезличивании данных клиента
+func (s ParcelService) ClientErasures(ctx context.Context, client int64) ([]ClientErasure, error) {
+	if err := requireRole(ctx, RoleAdmin); err != nil {
+		return nil, err
+	}
+	if err := validateClient(client); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).ListErasures(client)
+}
+
+// serveClientErasure обрабатывает /admin/clients/{client}/erasure:
+// POST обезличивает данные клиента, GET возвращает записи об этом
+func (h APIHandler) serveClientErasure(w http.ResponseWriter, r *http.Request, client string) {
+	id, err := strconv.ParseInt(client, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		erasures, err := h.service.ClientErasures(r.Context(), id)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, erasures)
+	case http.MethodPost:
+		e, err := h.service.AnonymizeClient(r.Context(), id)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, e)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAnonymizeClient проверяет, что обезличивание затирает персональные данные
+// клиента и сохраняет статистику и чужие посылки
+func TestAnonymizeClient(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	admin := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleAdmin, Tenant: DefaultTenant})
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.SetRecipient(ctx, p.Number, Recipient{Name: "Олег", Phone: "+79991234567"}))
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Орёл"))
+	_, err = service.AddNote(ctx, p.Number, "курьер", "код домофона 15")
+	require.NoError(t, err)
+
+	delivered, err := service.Register(ctx, 7, "Тверь")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(ctx, delivered.Number))
+	require.NoError(t, service.MarkDelivered(ctx, delivered.Number, DeliveryProof{RecipientName: "Олег", PhotoRef: "photos/1.jpg"}))
+
+	other, err := service.Register(ctx, 8, "Псков")
+	require.NoError(t, err)
+
+	// add
+	e, err := service.AnonymizeClient(admin, 7)
+	require.NoError(t, err)
+	assert.Equal(t, 2, e.Parcels)
+	assert.Equal(t, "user:anna", e.Actor)
+
+	// check
+	got, err := service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Empty(t, got.Address)
+	assert.Equal(t, Recipient{}, got.Recipient)
+	assert.Equal(t, ParcelStatusRegistered, got.Status)
+	assert.Equal(t, "орёл", rawParcelColumn(t, store, p.Number, "zone"))
+
+	notes, err := service.ListNotes(ctx, p.Number)
+	require.NoError(t, err)
+	require.Len(t, notes, 1)
+	assert.Empty(t, notes[0].Text)
+	history, err := service.GetAddressHistory(ctx, p.Number)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Empty(t, history[0].Address)
+	proof, err := store.GetDeliveryProof(delivered.Number)
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryProof{DeliveredAt: proof.DeliveredAt}, proof)
+
+	entries, err := service.AuditLog(ctx, AuditQuery{Number: p.Number})
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, string(entry.Before)+string(entry.After), "Псков")
+		assert.NotContains(t, string(entry.Before)+string(entry.After), "Олег")
+	}
+	assert.Contains(t, string(entries[0].After), `"status":"registered"`)
+
+	got, err = service.Get(ctx, other.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "Псков", got.Address)
+
+	erasures, err := service.ClientErasures(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, []ClientErasure{e}, erasures)
+
+	// журнал аудита по-прежнему нельзя изменить иначе, чем затереть персональные данные
+	_, err = store.db.Exec("UPDATE audit_log SET after = '{}'")
+	assert.Error(t, err)
+
+	dispatcher := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "oleg", Role: RoleDispatcher, Tenant: DefaultTenant})
+	_, err = service.AnonymizeClient(dispatcher, 8)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = service.AnonymizeClient(ctx, 0)
+	var verr ValidationError
+	assert.ErrorAs(t, err, &verr)
+}
+
+// TestAnonymizeRecipient проверяет обезличивание клиента, который только
+// получатель посылок, в том числе архивных
+func TestAnonymizeRecipient(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	admin := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleAdmin, Tenant: DefaultTenant})
+	recipient := Recipient{Client: 9, Name: "Олег", Phone: "+79991234567"}
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.SetRecipient(ctx, p.Number, recipient))
+	archived, err := service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+	require.NoError(t, service.SetRecipient(ctx, archived.Number, recipient))
+	require.NoError(t, service.NextStatus(ctx, archived.Number))
+	require.NoError(t, service.NextStatus(ctx, archived.Number))
+	n, err := store.Archive(-time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	own, err := service.Register(ctx, 7, "Орёл")
+	require.NoError(t, err)
+
+	// add
+	e, err := service.AnonymizeClient(admin, 9)
+	require.NoError(t, err)
+	assert.Equal(t, 2, e.Parcels)
+
+	// check
+	// идентификатор клиента остаётся, как и у отправителя
+	got, err := service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, Recipient{Client: 9}, got.Recipient)
+	assert.Empty(t, got.Address)
+	assert.Equal(t, int64(7), got.Client)
+	got, err = store.GetArchived(archived.Number)
+	require.NoError(t, err)
+	assert.Equal(t, Recipient{Client: 9}, got.Recipient)
+	entries, err := service.AuditLog(admin, AuditQuery{Number: p.Number})
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		assert.NotContains(t, string(entry.Before)+string(entry.After), "Олег")
+	}
+
+	got, err = service.Get(ctx, own.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "Орёл", got.Address, "посылки без этого получателя не меняются")
+}
+
+// TestAnonymizeClientEncrypted проверяет обезличивание при шифровании полей:
+// адрес убирается и из зашифрованных событий в очереди вебхуков
+func TestAnonymizeClientEncrypted(t *testing.T) {
+	_, store := newTestService(t)
+	store = store.WithEncryption(newTestCipher(t, testEncryptionKey("k1", 1)))
+	service := NewParcelService(store)
+	ctx := context.Background()
+	admin := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleAdmin, Tenant: DefaultTenant})
+
+	// prepare
+	dispatcher := NewWebhookDispatcher(store, DefaultWebhookAttempts)
+	dispatcher.Subscribe(func(err error) { t.Error(err) })
+	_, err := service.AddWebhook(ctx, 7, "http://example.com/hook", "secret")
+	require.NoError(t, err)
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Орёл"))
+
+	// add
+	_, err = service.AnonymizeClient(admin, 7)
+	require.NoError(t, err)
+
+	// check
+	deliveries, err := store.ListWebhookDeliveries(7, WebhookPending)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	var event WebhookEvent
+	require.NoError(t, json.Unmarshal([]byte(deliveries[0].Payload), &event))
+	assert.Equal(t, ParcelEventAddressChanged, event.Type)
+	assert.Empty(t, event.Address)
+	entries, err := service.AuditLog(admin, AuditQuery{Number: p.Number})
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, string(entry.Before)+string(entry.After), "Орёл")
+	}
+}
+
+// TestAnonymizeClientAPI проверяет адрес /admin/clients/{client}/erasure
+func TestAnonymizeClientAPI(t *testing.T) {
+	service, _ := newTestService(t)
+	handler := NewAPIHandler(service).WithAdminToken("secret")
+
+	// prepare
+	_, err := service.Register(context.Background(), 7, "Псков")
+	require.NoError(t, err)
+
+	// add
+	rec := adminCall(t, handler, "secret", http.MethodPost, "/admin/clients/7/erasure", "")
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var e ClientErasure
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &e))
+	assert.Equal(t, 1, e.Parcels)
+
+	// check
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/clients/7/erasure", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var erasures []ClientErasure
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &erasures))
+	assert.Equal(t, []ClientErasure{e}, erasures)
+
+	rec = adminCall(t, handler, "secret", http.MethodPost, "/admin/clients/abc/erasure", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = adminCall(t, handler, "", http.MethodPost, "/admin/clients/7/erasure", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
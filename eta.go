@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// etaSampleSize - по скольким последним доставкам в зону оценивается срок доставки
+const etaSampleSize = 100
+
+// DefaultETA используется, если в зону ещё не было доставок
+const DefaultETA = 72 * time.Hour
+
+// deliveryZone выделяет зону доставки из адреса: первую часть до запятой,
+// обычно это населённый пункт, например "Псков" для "Псков, ул. Садовая, д. 5"
+func deliveryZone(address string) string {
+	zone, _, _ := strings.Cut(address, ",")
+	return strings.ToLower(strings.TrimSpace(zone))
+}
+
+// AverageDeliveryTime возвращает среднее время от регистрации до доставки
+// по последним etaSampleSize доставленным посылкам в зону адреса address
+// и false, если доставок в эту зону ещё не было
+func (s ParcelStore) AverageDeliveryTime(address string) (time.Duration, bool, error) {
+	var days sql.NullFloat64
+	err := s.db.QueryRowContext(s.context(), "SELECT AVG(julianday(h.changed_at) - julianday(p.created_at)) FROM ("+
+		"SELECT p.number, p.created_at FROM parcel p WHERE p.zone = :zone AND p.status = :delivered AND "+tenantScope+" "+
+		"ORDER BY p.number DESC LIMIT :limit) p "+
+		"JOIN parcel_status_history h ON h.number = p.number AND h.status = :delivered",
+		sql.Named("zone", deliveryZone(address)),
+		sql.Named("delivered", ParcelStatusDelivered),
+		sql.Named("limit", etaSampleSize),
+		s.tenantArg()).Scan(&days)
+	if err != nil || !days.Valid {
+		return 0, false, err
+	}
+	return time.Duration(days.Float64 * float64(24*time.Hour)), true, nil
+}
+
+// SetETA сохраняет расчётную дату доставки посылки
+func (s ParcelStore) SetETA(number int64, eta string) error {
+	return s.auditedUpdate(number, []string{"eta"}, "UPDATE parcel SET eta = :eta WHERE number = :number AND "+tenantScope,
+		sql.Named("eta", eta),
+		sql.Named("number", number),
+		s.tenantArg())
+}
+
+// ETACalculator оценивает дату доставки посылки по истории доставок в её зону
+type ETACalculator struct {
+	store    ParcelStore
+	fallback time.Duration
+}
+
+func NewETACalculator(store ParcelStore, fallback time.Duration) ETACalculator {
+	return ETACalculator{store: store, fallback: fallback}
+}
+
+// Estimate возвращает расчётную дату доставки в RFC3339 для посылки
+// на адрес address, зарегистрированной в момент registered
+func (c ETACalculator) Estimate(ctx context.Context, address string, registered time.Time) (string, error) {
+	avg, ok, err := c.store.WithContext(ctx).AverageDeliveryTime(address)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		avg = c.fallback
+	}
+	return registered.Add(avg).UTC().Format(time.RFC3339), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeliveryZone проверяет выделение зоны доставки из адреса
+func TestDeliveryZone(t *testing.T) {
+	assert.Equal(t, "псков", deliveryZone("Псков, д. Пушкина, ул. Колотушкина, д. 5"))
+	assert.Equal(t, "test", deliveryZone(" Test "))
+}
+
+// TestETA проверяет расчёт даты доставки по истории доставок в зону
+func TestETA(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// в зону ещё не доставляли, поэтому срок - DefaultETA от регистрации
+	p, err := service.Register(ctx, 1, "Псков, ул. Садовая, д. 1")
+	require.NoError(t, err)
+	created, err := time.Parse(time.RFC3339, p.CreatedAt)
+	require.NoError(t, err)
+	assert.Equal(t, created.Add(DefaultETA).Format(time.RFC3339), p.ETA)
+
+	stored, err := service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, p.ETA, stored.ETA)
+
+	// посылка в Псков доставлена за два дня
+	old := getTestParcel()
+	old.Address = "Псков, ул. Лесная, д. 2"
+	old.CreatedAt = time.Now().UTC().Add(-48 * time.Hour).Format(time.RFC3339)
+	id, err := store.Add(old)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(id, ParcelStatusDelivered))
+
+	avg, ok, err := store.AverageDeliveryTime("псков, ул. Мира")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.InDelta(t, (48 * time.Hour).Seconds(), avg.Seconds(), 5)
+
+	// при смене адреса срок пересчитывается по новой зоне
+	p, err = service.Register(ctx, 1, "Москва, ул. Тверская, д. 1")
+	require.NoError(t, err)
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Псков, ул. Мира, д. 3"))
+	stored, err = service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	eta, err := time.Parse(time.RFC3339, stored.ETA)
+	require.NoError(t, err)
+	assert.InDelta(t, (48 * time.Hour).Seconds(), eta.Sub(created).Seconds(), 10)
+}
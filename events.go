@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Типы событий, которые ParcelStore передаёт подписчикам OnChange
+const (
+	ParcelEventAdded          = "added"
+	ParcelEventStatusChanged  = "status_changed"
+	ParcelEventAddressChanged = "address_changed"
+	ParcelEventDeleted        = "deleted"
+)
+
+// ParcelEvent описывает изменение посылки. Заполняются только поля,
+// относящиеся к типу события: например, Address - для added и address_changed
+type ParcelEvent struct {
+	Type       string
+	Number     int64
+	Client     int64
+	Status     string
+	Address    string
+	Actor      string
+	Tenant     int64
+	OccurredAt time.Time
+}
+
+// observers - подписчики на изменения посылок и хуки, общие для всех копий ParcelStore
+type observers struct {
+	mu       sync.RWMutex
+	handlers []func(ParcelEvent)
+	hooks    []Hooks
+}
+
+// OnChange подписывает fn на изменения посылок. fn вызывается синхронно
+// после фиксации изменения в БД, поэтому не должна выполнять долгих операций
+func (s ParcelStore) OnChange(fn func(event ParcelEvent)) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	s.events.handlers = append(s.events.handlers, fn)
+}
+
+// notify передаёт событие всем подписчикам
+func (s ParcelStore) notify(event ParcelEvent) {
+	if s.events == nil {
+		return
+	}
+	event.Actor = s.actor
+	event.OccurredAt = time.Now().UTC()
+	// хранилище всех магазинов, например у фоновой задачи, ищет магазин посылки
+	event.Tenant = s.tenant
+	if event.Tenant == 0 {
+		if tenant, err := s.tenantOf(event.Number); err == nil {
+			event.Tenant = tenant
+		}
+	}
+
+	s.events.mu.RLock()
+	handlers := s.events.handlers
+	s.events.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(event)
+	}
+	if event.Type == ParcelEventStatusChanged && event.Status == ParcelStatusDelivered {
+		s.postDelivery(event.Number)
+	}
+}
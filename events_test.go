@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOnChange проверяет события об изменениях посылки
+func TestOnChange(t *testing.T) {
+	// prepare
+	// настраиваем подключение к БД из конфигурации
+	db := openTestDB(t)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+
+	var events []ParcelEvent
+	store.OnChange(func(event ParcelEvent) {
+		events = append(events, event)
+	})
+
+	// mutate
+	// копия хранилища с другим исполнителем использует тех же подписчиков
+	parcel := getTestParcel()
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NoError(t, store.SetAddress(id, "new address"))
+	require.NoError(t, store.WithActor("operator").Delete(id))
+
+	// изменения несуществующей посылки событий не порождают
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	require.NoError(t, store.Delete(id))
+
+	// check
+	require.Len(t, events, 3)
+	assert.Equal(t, ParcelEventAdded, events[0].Type)
+	assert.Equal(t, id, events[0].Number)
+	assert.Equal(t, parcel.Client, events[0].Client)
+	assert.Equal(t, ParcelEventAddressChanged, events[1].Type)
+	assert.Equal(t, "new address", events[1].Address)
+	assert.Equal(t, ParcelEventDeleted, events[2].Type)
+	assert.Equal(t, "operator", events[2].Actor)
+	for _, e := range events {
+		assert.False(t, e.OccurredAt.IsZero())
+	}
+}
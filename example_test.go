@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// openExampleStore создаёт хранилище в отдельном временном файле БД
+func openExampleStore() (ParcelStore, func()) {
+	dir, err := os.MkdirTemp("", "tracker-example")
+	if err != nil {
+		panic(err)
+	}
+	db, err := OpenDB(filepath.Join(dir, "tracker.db"))
+	if err != nil {
+		panic(err)
+	}
+	store, err := NewParcelStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return store, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Хранилище можно использовать напрямую: оно создаёт схему при первом подключении
+func ExampleParcelStore() {
+	store, done := openExampleStore()
+	defer done()
+
+	number, err := store.Add(Parcel{
+		Client:    1000,
+		Status:    ParcelStatusRegistered,
+		Address:   "Псков, ул. Некрасова, 1",
+		CreatedAt: "2024-01-01T10:00:00Z",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := store.SetStatus(number, ParcelStatusSent); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	p, err := store.Get(number)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(p.Number, p.Status, p.Address)
+	// Output: 1 sent Псков, ул. Некрасова, 1
+}
+
+// Подписчик OnChange получает события после фиксации изменений в БД,
+// например чтобы передать их в очередь сообщений
+func ExampleParcelStore_OnChange() {
+	store, done := openExampleStore()
+	defer done()
+
+	store.OnChange(func(event ParcelEvent) {
+		fmt.Println(event.Type, event.Number, event.Status)
+	})
+
+	number, err := store.Add(Parcel{Client: 1000, Status: ParcelStatusRegistered, Address: "Псков", CreatedAt: "2024-01-01T10:00:00Z"})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := store.WithActor("courier-7").SetStatus(number, ParcelStatusSent); err != nil {
+		fmt.Println(err)
+		return
+	}
+	// Output:
+	// added 1 registered
+	// status_changed 1 sent
+}
+
+// Выражения фильтра разбираются в параметризованный SQL, значения в запрос не подставляются
+func ExampleParseFilter() {
+	store, done := openExampleStore()
+	defer done()
+
+	for _, address := range []string{"Москва", "Псков", "Москва"} {
+		if _, err := store.Add(Parcel{Client: 1000, Status: ParcelStatusRegistered, Address: address, CreatedAt: "2024-01-01T10:00:00Z"}); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	f, err := ParseFilter(`address = "Москва" AND number > 1`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	parcels, err := store.Search(f)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, p := range parcels {
+		fmt.Println(p.Number, p.Address)
+	}
+	// Output: 3 Москва
+}
+
+// Сервис проверяет входные данные, рассчитывает срок доставки и выдаёт код отслеживания.
+// Вывод не проверяется: код отслеживания и время регистрации каждый раз разные
+func ExampleParcelService() {
+	store, done := openExampleStore()
+	defer done()
+
+	ctx := context.Background()
+	service := NewParcelService(store)
+
+	p, err := service.Register(ctx, 1000, "Псков")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := service.NextStatus(ctx, p.Number); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := service.PrintClientParcels(ctx, p.Client); err != nil {
+		fmt.Println(err)
+	}
+}
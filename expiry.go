@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Expire переводит в статус expired посылки, которые остаются в статусе registered
+// дольше olderThan с момента регистрации, и возвращает их количество.
+// Подписчики OnChange получают событие status_changed по каждой посылке
+func (s ParcelStore) Expire(olderThan time.Duration) (int, error) {
+	cutoff := time.Now().UTC().Add(-olderThan).Format(time.RFC3339)
+	comment := fmt.Sprintf("not sent within %s", olderThan)
+
+	stale, err := s.staleRegistered(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	// хуки могут обращаться к внешним системам, поэтому вызываются до транзакции;
+	// отклонённые хуком посылки остаются в статусе registered
+	candidates := stale[:0]
+	for _, p := range stale {
+		if s.preStatusChange(p.Number, ParcelStatusExpired) == nil {
+			candidates = append(candidates, p)
+		}
+	}
+
+	var expired []Parcel
+	err = s.inTx(func(tx *sql.Tx) error {
+		for _, p := range candidates {
+			// посылку могли отправить, пока работали хуки
+			res, err := tx.ExecContext(s.context(), "UPDATE parcel SET status = :expired WHERE number = :number AND status = :status AND "+tenantScope,
+				sql.Named("expired", ParcelStatusExpired),
+				sql.Named("number", p.Number),
+				sql.Named("status", ParcelStatusRegistered),
+				s.tenantArg())
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				continue
+			}
+			if err := s.addStatusChange(tx, p.Number, ParcelStatusExpired, comment); err != nil {
+				return err
+			}
+			expired = append(expired, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range expired {
+		s.notify(ParcelEvent{Type: ParcelEventStatusChanged, Number: p.Number, Client: p.Client, Status: ParcelStatusExpired})
+	}
+	return len(expired), nil
+}
+
+// staleRegistered возвращает номера и клиентов посылок в статусе registered,
+// зарегистрированных раньше cutoff
+func (s ParcelStore) staleRegistered(cutoff string) ([]Parcel, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT number, client FROM parcel WHERE status = :status AND created_at < :cutoff AND "+tenantScope+" ORDER BY number",
+		sql.Named("status", ParcelStatusRegistered),
+		sql.Named("cutoff", cutoff),
+		s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Parcel{}
+	for rows.Next() {
+		var p Parcel
+		if err := rows.Scan(&p.Number, &p.Client); err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+// RunExpiry вызывает Expire каждые interval до отмены ctx.
+// Ошибки не прерывают расписание и передаются в onError, если он задан
+func (s ParcelStore) RunExpiry(ctx context.Context, interval, olderThan time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	store := s.WithContext(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.Expire(olderThan); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExpire проверяет, что устаревшие registered-посылки переходят в expired,
+// а свежие и уже отправленные не меняются
+func TestExpire(t *testing.T) {
+	service, store := newTestService(t)
+
+	var events []ParcelEvent
+	store.OnChange(func(e ParcelEvent) { events = append(events, e) })
+
+	// prepare
+	old := getTestParcel()
+	old.CreatedAt = time.Now().UTC().Add(-48 * time.Hour).Format(time.RFC3339)
+	stale, err := store.Add(old)
+	require.NoError(t, err)
+
+	sent, err := store.Add(old)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(sent, ParcelStatusSent))
+
+	fresh, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	events = nil
+
+	// expire
+	n, err := store.Expire(24 * time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// check
+	assertStatus(t, service, stale, ParcelStatusExpired)
+	assertStatus(t, service, sent, ParcelStatusSent)
+	assertStatus(t, service, fresh, ParcelStatusRegistered)
+
+	require.Len(t, events, 1)
+	assert.Equal(t, ParcelEventStatusChanged, events[0].Type)
+	assert.Equal(t, stale, events[0].Number)
+	assert.Equal(t, ParcelStatusExpired, events[0].Status)
+
+	history, err := store.GetStatusHistory(stale)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusExpired, history[len(history)-1].Status)
+
+	// истёкшую посылку нельзя отправить
+	assert.ErrorIs(t, checkTransition(ParcelStatusExpired, ParcelStatusSent), ErrForbiddenTransition)
+
+	// повторный запуск ничего не меняет
+	n, err = store.Expire(24 * time.Hour)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// по расписанию
+	again, err := store.Add(old)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.RunExpiry(ctx, time.Millisecond, 24*time.Hour, nil)
+	assert.Eventually(t, func() bool {
+		p, err := store.Get(again)
+		return err == nil && p.Status == ParcelStatusExpired
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+
+	"github.com/Yandex-Practicum/go-db-sql-final/export"
+)
+
+// exportPageSize - сколько строк EachFields читает из БД за один запрос
+const exportPageSize = MaxPageSize
+
+// EachFields передаёт fn выбранные поля посылок, подходящих под фильтр, по одной
+// в порядке номеров, не загружая весь результат в память. Строки читаются
+// страницами по exportPageSize, и пока fn их обрабатывает, например медленно
+// отправляет клиенту, соединение с БД свободно для других запросов
+func (s ParcelStore) EachFields(filter Filter, f Fields, fn func(row map[string]any) error) error {
+	var after int64
+	for {
+		page, err := s.searchFieldsAfter(filter, f, after, exportPageSize)
+		if err != nil {
+			return err
+		}
+		for _, row := range page {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+		// номер посылки всегда первое поле проекции, см. ParseFields
+		after = page[len(page)-1]["number"].(int64)
+	}
+}
+
+// searchFieldsAfter возвращает выбранные поля не больше limit посылок с номером
+// больше after, подходящих под фильтр, упорядоченных по номеру
+func (s ParcelStore) searchFieldsAfter(filter Filter, f Fields, after int64, limit int) ([]map[string]any, error) {
+	s = s.withFilter(filter)
+	args := append([]any{sql.Named("after", after), sql.Named("limit", limit)}, filter.args...)
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+f.columns()+" FROM parcel WHERE number > :after AND ("+filter.where+") AND "+tenantScope+" ORDER BY number LIMIT :limit", append(args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanFields(rows, f)
+}
+
+// ExportCSV записывает в w в формате CSV поля fields, см. ParseFields, посылок,
+// подходящих под выражение фильтра, например манифест отправок за день.
+// Строки записываются по мере чтения из БД. Ошибка в фильтре или полях
+// возвращается до записи в w
+func (s ParcelService) ExportCSV(ctx context.Context, w io.Writer, expr, fields string) error {
+	filter, err := s.parseFilter(expr)
+	if err != nil {
+		return err
+	}
+	f, err := parseFields(fields)
+	if err != nil {
+		return err
+	}
+
+	out, err := export.NewCSV(w, f.Names())
+	if err != nil {
+		return err
+	}
+	if err := s.store.WithContext(ctx).EachFields(scopeFilter(ctx, filter), f, out.Write); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// exportResponse отправляет заголовки выгрузки с первыми данными,
+// чтобы до них ошибку можно было вернуть обычным ответом с ошибкой
+type exportResponse struct {
+	http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (w *exportResponse) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.Header().Set("Content-Type", w.contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+w.filename+`"`)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// serveExport обрабатывает GET /admin/parcels/export: выгрузку посылок
+// по параметру filter с полями из параметра fields в формате CSV
+func (h APIHandler) serveExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	query := r.URL.Query()
+	res := &exportResponse{ResponseWriter: w, contentType: "text/csv; charset=utf-8", filename: "parcels.csv"}
+	err := h.service.ExportCSV(r.Context(), res, query.Get("filter"), query.Get("fields"))
+	if err != nil && !res.started {
+		h.writeError(w, r, err)
+	}
+	// после начала выгрузки ошибку уже не передать кодом ответа, выгрузка обрывается
+}
@@ -0,0 +1,81 @@
+// Package export записывает выгрузки посылок, например ежедневные манифесты,
+// построчно, не собирая всю выгрузку в памяти
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CSV записывает строки выгрузки в CSV: сначала заголовок с именами колонок,
+// затем по строке на запись. Данные уходят в w по мере заполнения буфера
+type CSV struct {
+	w       *csv.Writer
+	columns []string
+	line    []string
+}
+
+// NewCSV создаёт выгрузку в w с колонками columns и записывает заголовок
+func NewCSV(w io.Writer, columns []string) (*CSV, error) {
+	c := &CSV{w: csv.NewWriter(w), columns: columns, line: make([]string, len(columns))}
+	if err := c.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Write записывает строку row со значениями колонок. Колонок, которых нет в row,
+// в строке остаются пустыми, а лишние значения row не записываются
+func (c *CSV) Write(row map[string]any) error {
+	for i, column := range c.columns {
+		c.line[i] = Format(row[column])
+	}
+	return c.w.Write(c.line)
+}
+
+// Flush записывает в w остаток буфера и возвращает первую ошибку записи
+func (c *CSV) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Format переводит значение колонки в текст ячейки: nil - пустая ячейка,
+// числа - без экспоненты, значения с методом String - через него.
+// Строки, которые электронная таблица приняла бы за формулу,
+// например "=HYPERLINK(...)" в адресе, начинаются с апострофа
+func Format(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return escapeFormula(v)
+	case []byte:
+		return escapeFormula(string(v))
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// escapeFormula защищает строку от выполнения как формулы в электронной таблице.
+// Телефоны вида +79991234567 и отрицательные числа остаются как есть
+func escapeFormula(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '@', '\t', '\r':
+		return "'" + s
+	case '+', '-':
+		if _, err := strconv.ParseFloat(s[1:], 64); err != nil {
+			return "'" + s
+		}
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rubles int64
+
+func (r rubles) String() string { return "10.50" }
+
+// TestCSV проверяет заголовок, порядок колонок и запись значений
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := NewCSV(&buf, []string{"number", "address", "weight_kg", "cod_amount", "recipient_phone"})
+	require.NoError(t, err)
+
+	require.NoError(t, c.Write(map[string]any{"number": int64(1), "address": "Псков, ул. Мира, 1", "weight_kg": 1.25, "cod_amount": rubles(1050), "recipient_phone": "+79991234567"}))
+	require.NoError(t, c.Write(map[string]any{"number": int64(2), "address": "=HYPERLINK(\"x\")", "extra": "нет"}))
+	require.NoError(t, c.Flush())
+
+	assert.Equal(t, "number,address,weight_kg,cod_amount,recipient_phone\n"+
+		"1,\"Псков, ул. Мира, 1\",1.25,10.50,+79991234567\n"+
+		"2,\"'=HYPERLINK(\"\"x\"\")\",,,\n", buf.String())
+}
+
+// TestFormat проверяет защиту ячеек от формул
+func TestFormat(t *testing.T) {
+	tests := map[any]string{
+		nil:         "",
+		"":          "",
+		"-5":        "-5",
+		"+7999":     "+7999",
+		"+cmd|' /C": "'+cmd|' /C",
+		"@SUM(A1)":  "'@SUM(A1)",
+		int64(-3):   "-3",
+		1e21:        "1000000000000000000000",
+	}
+	for v, want := range tests {
+		assert.Equal(t, want, Format(v), v)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExportCSV проверяет выгрузку выбранных полей посылок по фильтру
+func TestExportCSV(t *testing.T) {
+	service, store := newTestService(t)
+	service = NewParcelService(store.WithEncryption(newTestCipher(t, testEncryptionKey("k1", 1))))
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков, ул. Мира, 1")
+	require.NoError(t, err)
+	require.NoError(t, service.SetCharges(ctx, p.Number, Charges{COD: 150050}))
+	_, err = service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+
+	// add
+	var buf bytes.Buffer
+	require.NoError(t, service.ExportCSV(ctx, &buf, "client = 7", "status,address,cod_amount"))
+
+	// check
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"number", "status", "address", "cod_amount"},
+		{strconv.FormatInt(p.Number, 10), ParcelStatusRegistered, "Псков, ул. Мира, 1", "1500.50"},
+	}, records)
+
+	buf.Reset()
+	err = service.ExportCSV(ctx, &buf, "client = 7", "volume")
+	var verr ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "fields", verr.Field)
+	err = service.ExportCSV(ctx, &buf, "client ==", "")
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "filter", verr.Field)
+	assert.Zero(t, buf.Len(), "при ошибке в запросе ничего не записано")
+}
+
+// TestExportCSVAPI проверяет адрес /admin/parcels/export и команду export
+func TestExportCSVAPI(t *testing.T) {
+	service, store := newTestService(t)
+	handler := NewAPIHandler(service).WithAdminToken("secret")
+
+	// prepare
+	p, err := service.Register(context.Background(), 7, "Псков")
+	require.NoError(t, err)
+
+	// add
+	rec := adminCall(t, handler, "secret", http.MethodGet, "/admin/parcels/export?filter=client%20%3D%207&fields=client", "")
+
+	// check
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "parcels.csv")
+	assert.Equal(t, "number,client\n"+strconv.FormatInt(p.Number, 10)+",7\n", rec.Body.String())
+
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/parcels/export?fields=volume", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	rec = adminCall(t, handler, "", http.MethodGet, "/admin/parcels/export", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	file := filepath.Join(t.TempDir(), "manifest.csv")
+	_, err = runCLI(t, store, service, "export", "--filter", `status = "registered"`, "--fields", "status", "--file", file)
+	require.NoError(t, err)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "number,status\n"+strconv.FormatInt(p.Number, 10)+",registered\n", string(data))
+}
+
+// TestExportCSVReleasesConnection проверяет, что выгрузка читает посылки страницами
+// и не занимает единственное соединение с БД, пока строки записываются
+func TestExportCSVReleasesConnection(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	parcels := make([]Parcel, exportPageSize+1)
+	for i := range parcels {
+		parcels[i] = Parcel{Client: 7, Status: ParcelStatusRegistered, Address: "Псков", CreatedAt: "2024-01-01T00:00:00Z", Priority: PriorityNormal}
+	}
+	_, err := addTrackedBatch(store, parcels)
+	require.NoError(t, err)
+	filter, err := ParseFilter("client = 7")
+	require.NoError(t, err)
+	f, err := ParseFields("status")
+	require.NoError(t, err)
+
+	// add
+	var rows int
+	err = store.EachFields(filter, f, func(row map[string]any) error {
+		rows++
+		if rows%exportPageSize != 1 {
+			return nil
+		}
+		// при занятом соединении запись ждала бы конца выгрузки
+		writeCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		_, err := service.Register(writeCtx, 8, "Тверь")
+		return err
+	})
+
+	// check
+	require.NoError(t, err)
+	assert.Equal(t, exportPageSize+1, rows)
+	written, err := store.GetByClient(8)
+	require.NoError(t, err)
+	assert.Len(t, written, 2)
+}
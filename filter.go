@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidFilter возвращается ParseFilter для выражения с ошибкой
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// filterFields - поля, доступные в выражениях фильтра, и их колонки в таблице parcel.
+// Имена колонок берутся только отсюда, поэтому в SQL не попадает пользовательский ввод
+var filterFields = map[string]string{
+	"number":          "number",
+	"tracking_number": "tracking_number",
+	"client":          "client",
+	"status":          "status",
+	"address":         "address",
+	"created_at":      "created_at",
+	"deadline":        "deadline",
+	"eta":             "eta",
+	"courier":         "courier_id",
+	"origin":          "origin_id",
+	"destination":     "destination_id",
+	"priority":        "priority",
+	"recipient":       "recipient_client",
+	"recipient_phone": "recipient_phone",
+	"parent":          "parent_number",
+}
+
+// filterOps - операторы сравнения и их SQL. Оператор ~ ищет подстроку через LIKE,
+// поэтому регистр не учитывается только для латиницы
+var filterOps = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+	"~":  "LIKE",
+}
+
+// Filter - разобранное выражение фильтра, готовое к выполнению.
+// Получается через ParseFilter
+type Filter struct {
+	where   string
+	args    []any
+	columns []string // колонки parcel в условиях, см. checkEncryptedFields
+}
+
+// ParseFilter разбирает выражение вида
+//
+//	status = "sent" AND created_at > "2024-01-01" AND address ~ "Moscow"
+//
+// Выражение состоит из сравнений "поле оператор значение", объединённых
+// через AND, OR и NOT, и скобок. Значение - строка в двойных кавычках
+// или целое число. Пустое выражение выбирает все посылки.
+// Сравнение tag = "fragile" выбирает посылки с тегом, см. AddTag
+func ParseFilter(expr string) (Filter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return Filter{}, err
+	}
+	if len(tokens) == 0 {
+		return Filter{where: "1"}, nil
+	}
+
+	p := &filterParser{tokens: tokens}
+	where, err := p.or()
+	if err != nil {
+		return Filter{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return Filter{}, p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return Filter{where: where, args: p.args, columns: p.columns}, nil
+}
+
+type filterTokenKind int
+
+const (
+	tokenIdent filterTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string // для строк - значение без кавычек
+	pos  int
+}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenLParen, text: "(", pos: start})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenRParen, text: ")", pos: start})
+			i++
+		case r == '"':
+			var sb strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string at %d", ErrInvalidFilter, start)
+			}
+			i++
+			tokens = append(tokens, filterToken{kind: tokenString, text: sb.String(), pos: start})
+		case strings.ContainsRune("=!<>~", r):
+			i++
+			if i < len(runes) && runes[i] == '=' && r != '=' && r != '~' {
+				i++
+			}
+			op := string(runes[start:i])
+			if _, ok := filterOps[op]; !ok {
+				return nil, fmt.Errorf("%w: unknown operator %q at %d", ErrInvalidFilter, op, start)
+			}
+			tokens = append(tokens, filterToken{kind: tokenOp, text: op, pos: start})
+		case r == '-' || unicode.IsDigit(r):
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: string(runes[start:i]), pos: start})
+		case r == '_' || unicode.IsLetter(r):
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q at %d", ErrInvalidFilter, r, start)
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser разбирает выражение рекурсивным спуском:
+//
+//	or   = and { OR and }
+//	and  = not { AND not }
+//	not  = NOT not | term
+//	term = "(" or ")" | field op value
+type filterParser struct {
+	tokens  []filterToken
+	pos     int
+	args    []any
+	columns []string
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidFilter, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenIdent && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, p.errorf("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *filterParser) or() (string, error) {
+	left, err := p.and()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (string, error) {
+	left, err := p.not()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("AND") {
+		right, err := p.not()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) not() (string, error) {
+	if p.keyword("NOT") {
+		expr, err := p.not()
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + expr, nil
+	}
+	return p.term()
+}
+
+func (p *filterParser) term() (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if t.kind == tokenLParen {
+		expr, err := p.or()
+		if err != nil {
+			return "", err
+		}
+		if t, err := p.next(); err != nil || t.kind != tokenRParen {
+			return "", p.errorf("missing ) for ( at %d", t.pos)
+		}
+		return expr, nil
+	}
+
+	if t.kind != tokenIdent {
+		return "", p.errorf("expected field name at %d, got %q", t.pos, t.text)
+	}
+	field := strings.ToLower(t.text)
+	column, ok := filterFields[field]
+	if !ok && field != "tag" {
+		return "", p.errorf("unknown field %q at %d", t.text, t.pos)
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if op.kind != tokenOp {
+		return "", p.errorf("expected operator at %d, got %q", op.pos, op.text)
+	}
+
+	v, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	var value any
+	switch v.kind {
+	case tokenString:
+		value = v.text
+	case tokenNumber:
+		n, err := strconv.ParseInt(v.text, 10, 64)
+		if err != nil {
+			return "", p.errorf("invalid number %q at %d", v.text, v.pos)
+		}
+		value = n
+	default:
+		return "", p.errorf("expected value at %d, got %q", v.pos, v.text)
+	}
+
+	name := "f" + strconv.Itoa(len(p.args))
+	if field == "tag" {
+		return p.tagTerm(name, op, v, value)
+	}
+	p.columns = append(p.columns, column)
+	if op.text == "~" {
+		s, ok := value.(string)
+		if !ok {
+			return "", p.errorf("~ requires a string at %d", v.pos)
+		}
+		p.args = append(p.args, sql.Named(name, "%"+escapeLike(s)+"%"))
+		return column + " LIKE :" + name + ` ESCAPE '\'`, nil
+	}
+	p.args = append(p.args, sql.Named(name, value))
+	return column + " " + filterOps[op.text] + " :" + name, nil
+}
+
+// tagTerm переводит сравнение tag = "fragile" в подзапрос к parcel_tags.
+// Для тегов поддерживаются только = и !=
+func (p *filterParser) tagTerm(name string, op, v filterToken, value any) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", p.errorf("tag requires a string at %d", v.pos)
+	}
+	in := "IN"
+	switch op.text {
+	case "=":
+	case "!=":
+		in = "NOT IN"
+	default:
+		return "", p.errorf("tag supports only = and != at %d", op.pos)
+	}
+	p.args = append(p.args, sql.Named(name, normalizeTag(s)))
+	return "number " + in + " (SELECT number FROM parcel_tags WHERE tag = :" + name + ")", nil
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// SearchAfter возвращает не больше limit посылок с номером больше after,
+// подходящих под фильтр, упорядоченных по номеру
+func (s ParcelStore) SearchAfter(f Filter, after int64, limit int) (_ []Parcel, err error) {
+	s, span := s.withFilter(f).startSpan("search_after")
+	defer func() { endSpan(span, err) }()
+	args := append([]any{sql.Named("after", after), sql.Named("limit", limit)}, f.args...)
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE number > :after AND ("+f.where+") AND "+tenantScope+" ORDER BY number LIMIT :limit", append(args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// Search возвращает посылки, подходящие под фильтр, упорядоченные по номеру
+func (s ParcelStore) Search(f Filter) (_ []Parcel, err error) {
+	s, span := s.withFilter(f).startSpan("search")
+	defer func() { endSpan(span, err) }()
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE ("+f.where+") AND "+tenantScope+" ORDER BY number", append(f.args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// Search возвращает посылки, подходящие под выражение фильтра, см. ParseFilter
+func (s ParcelService) Search(ctx context.Context, expr string) ([]Parcel, error) {
+	f, err := s.parseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).Search(scopeFilter(ctx, f))
+}
+
+// parseFilter разбирает выражение фильтра и переводит ошибку в ValidationError.
+// С шифрованием условия по зашифрованным полям тоже ошибка
+func (s ParcelService) parseFilter(expr string) (Filter, error) {
+	f, err := ParseFilter(expr)
+	if err == nil {
+		err = s.store.checkEncryptedFields(f.columns...)
+	}
+	if err != nil {
+		return Filter{}, ValidationError{Field: "filter", Message: strings.TrimPrefix(err.Error(), ErrInvalidFilter.Error()+": ")}
+	}
+	return f, nil
+}
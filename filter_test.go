@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseFilter проверяет перевод выражений фильтра в параметризованный SQL
+func TestParseFilter(t *testing.T) {
+	f, err := ParseFilter(`status = "sent" AND created_at > "2024-01-01" AND address ~ "Moscow"`)
+	require.NoError(t, err)
+	assert.Equal(t, `((status = :f0 AND created_at > :f1) AND address LIKE :f2 ESCAPE '\')`, f.where)
+	assert.Equal(t, []any{sql.Named("f0", "sent"), sql.Named("f1", "2024-01-01"), sql.Named("f2", "%Moscow%")}, f.args)
+
+	f, err = ParseFilter(`NOT (client = 1 or client = 2) and address ~ "50%"`)
+	require.NoError(t, err)
+	assert.Equal(t, `(NOT (client = :f0 OR client = :f1) AND address LIKE :f2 ESCAPE '\')`, f.where)
+	assert.Equal(t, sql.Named("f2", `%50\%%`), f.args[2])
+
+	f, err = ParseFilter(`tag != "Fragile"`)
+	require.NoError(t, err)
+	assert.Equal(t, `number NOT IN (SELECT number FROM parcel_tags WHERE tag = :f0)`, f.where)
+	assert.Equal(t, []any{sql.Named("f0", "fragile")}, f.args)
+
+	f, err = ParseFilter("  ")
+	require.NoError(t, err)
+	assert.Equal(t, "1", f.where)
+
+	for _, expr := range []string{
+		`status`,
+		`status =`,
+		`status = sent`,
+		`password = "x"`,
+		`status == "sent"`,
+		`(status = "sent"`,
+		`status = "sent`,
+		`client ~ 1`,
+		`status = "sent" DROP`,
+		`status = "sent"; DELETE FROM parcel`,
+	} {
+		_, err := ParseFilter(expr)
+		assert.ErrorIs(t, err, ErrInvalidFilter, expr)
+	}
+}
+
+// TestSearch проверяет поиск посылок по выражению фильтра
+func TestSearch(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	moscow, err := service.Register(ctx, 1, "Москва, ул. Тверская, д. 1")
+	require.NoError(t, err)
+	pskov, err := service.Register(ctx, 1, "Псков, ул. Садовая, д. 1")
+	require.NoError(t, err)
+	_, err = service.Register(ctx, 2, "Москва, ул. Арбат, д. 2")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(ctx, pskov.Number))
+
+	// search
+	res, err := service.Search(ctx, `client = 1 AND address ~ "Москва"`)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, moscow.Number, res[0].Number)
+
+	res, err = service.Search(ctx, `status = "sent" OR client = 2`)
+	require.NoError(t, err)
+	assert.Len(t, res, 2)
+
+	res, err = service.Search(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, res, 3)
+
+	_, err = service.Search(ctx, `status = `)
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+}
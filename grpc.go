@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Yandex-Practicum/go-db-sql-final/trackerpb"
+)
+
+// GRPCServer реализует trackerpb.ParcelServiceServer поверх ParcelService
+type GRPCServer struct {
+	trackerpb.UnimplementedParcelServiceServer
+	service ParcelService
+}
+
+func NewGRPCServer(service ParcelService) *GRPCServer {
+	return &GRPCServer{service: service}
+}
+
+// RunGRPC обслуживает gRPC на addr, пока не отменён ctx,
+// после чего дожидается завершения текущих вызовов.
+// Субъект вызова определяет auth, см. authUnary
+func RunGRPC(ctx context.Context, addr string, service ParcelService, auth *Authenticator, authRequired bool) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := newGRPCServer(service, auth, authRequired)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(lis)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	srv.GracefulStop()
+	return nil
+}
+
+func (s *GRPCServer) RegisterParcel(ctx context.Context, req *trackerpb.RegisterParcelRequest) (*trackerpb.Parcel, error) {
+	p, err := s.service.Register(ctx, req.GetClient(), req.GetAddress())
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+	return newPBParcel(p), nil
+}
+
+func (s *GRPCServer) GetParcel(ctx context.Context, req *trackerpb.GetParcelRequest) (*trackerpb.Parcel, error) {
+	return s.get(ctx, req.GetNumber())
+}
+
+func (s *GRPCServer) ListClientParcels(ctx context.Context, req *trackerpb.ListClientParcelsRequest) (*trackerpb.ListClientParcelsResponse, error) {
+	parcels, err := s.service.ClientParcelsDetails(ctx, req.GetClient(), "")
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	res := &trackerpb.ListClientParcelsResponse{Parcels: make([]*trackerpb.Parcel, len(parcels))}
+	for i, p := range parcels {
+		res.Parcels[i] = newPBParcel(p.Parcel)
+	}
+	return res, nil
+}
+
+func (s *GRPCServer) ChangeAddress(ctx context.Context, req *trackerpb.ChangeAddressRequest) (*trackerpb.Parcel, error) {
+	if err := s.service.ChangeAddress(ctx, req.GetNumber(), req.GetAddress()); err != nil {
+		return nil, s.error(ctx, err)
+	}
+	return s.get(ctx, req.GetNumber())
+}
+
+func (s *GRPCServer) SetStatus(ctx context.Context, req *trackerpb.SetStatusRequest) (*trackerpb.Parcel, error) {
+	if err := s.service.SetStatus(ctx, req.GetNumber(), req.GetStatus()); err != nil {
+		return nil, s.error(ctx, err)
+	}
+	return s.get(ctx, req.GetNumber())
+}
+
+func (s *GRPCServer) NextStatus(ctx context.Context, req *trackerpb.NextStatusRequest) (*trackerpb.Parcel, error) {
+	if err := s.service.NextStatus(ctx, req.GetNumber()); err != nil {
+		return nil, s.error(ctx, err)
+	}
+	return s.get(ctx, req.GetNumber())
+}
+
+func (s *GRPCServer) CancelParcel(ctx context.Context, req *trackerpb.CancelParcelRequest) (*trackerpb.Parcel, error) {
+	if err := s.service.Cancel(ctx, req.GetNumber(), req.GetReason()); err != nil {
+		return nil, s.error(ctx, err)
+	}
+	return s.get(ctx, req.GetNumber())
+}
+
+func (s *GRPCServer) DeleteParcel(ctx context.Context, req *trackerpb.DeleteParcelRequest) (*trackerpb.DeleteParcelResponse, error) {
+	if err := s.service.Delete(ctx, req.GetNumber()); err != nil {
+		return nil, s.error(ctx, err)
+	}
+	return &trackerpb.DeleteParcelResponse{}, nil
+}
+
+// get возвращает посылку в виде сообщения trackerpb.Parcel
+func (s *GRPCServer) get(ctx context.Context, number int64) (*trackerpb.Parcel, error) {
+	p, err := s.service.Get(ctx, number)
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+	return newPBParcel(p), nil
+}
+
+func newPBParcel(p Parcel) *trackerpb.Parcel {
+	return &trackerpb.Parcel{
+		Number:         p.Number,
+		TrackingNumber: p.Tracking,
+		Client:         p.Client,
+		Status:         p.Status,
+		Address:        p.Address,
+		CreatedAt:      p.CreatedAt,
+		CancelReason:   p.CancelReason,
+		Eta:            p.ETA,
+		Priority:       p.Priority,
+	}
+}
+
+// newGRPCServer создаёт сервер gRPC с GRPCServer, вызовы которого трассируются,
+// см. traceUnary, и выполняются от имени субъекта из метаданных, см. authUnary
+func newGRPCServer(service ParcelService, auth *Authenticator, authRequired bool) *grpc.Server {
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(traceUnary, authUnary(auth, authRequired, service.logger)))
+	trackerpb.RegisterParcelServiceServer(srv, NewGRPCServer(service))
+	return srv
+}
+
+// authUnary проверяет ключ API из метаданных x-api-key или токен из authorization,
+// как Authenticate для REST, и выполняет вызов от имени субъекта в его магазине.
+// Вызов без них выполняется без субъекта в DefaultTenant, а при required отклоняется.
+// Внутренние ошибки проверки записываются в logger
+func authUnary(a *Authenticator, required bool, logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		key, authorization := metadataCarrier(md).Get(APIKeyHeader), metadataCarrier(md).Get("authorization")
+		if key == "" && authorization == "" {
+			if required {
+				return nil, grpcError(fmt.Errorf("%w: api key or bearer token required", ErrUnauthenticated))
+			}
+			return handler(WithTenant(ctx, DefaultTenant), req)
+		}
+
+		p, err := a.authenticate(ctx, key, authorization)
+		if err != nil {
+			st := grpcError(err)
+			if status.Code(st) == codes.Internal {
+				logInternalError(ctx, logger, "grpc", err)
+			}
+			return nil, st
+		}
+		return handler(WithTenant(WithPrincipal(ctx, p), p.Tenant), req)
+	}
+}
+
+// error переводит ошибку сервиса в статус gRPC, см. grpcError,
+// и записывает внутреннюю ошибку в журнал сервиса, см. logInternalError
+func (s *GRPCServer) error(ctx context.Context, err error) error {
+	st := grpcError(err)
+	if status.Code(st) == codes.Internal {
+		logInternalError(ctx, s.service.logger, "grpc", err)
+	}
+	return st
+}
+
+// grpcError переводит ошибку сервиса в статус gRPC с теми же правилами, что и apiStatus
+func grpcError(err error) error {
+	var code codes.Code
+	switch {
+	case isInvalidArgument(err):
+		code = codes.InvalidArgument
+	case isNotFound(err):
+		code = codes.NotFound
+	case isConflict(err), errors.Is(err, ErrHookRejected):
+		code = codes.FailedPrecondition
+	case errors.Is(err, ErrForbidden):
+		code = codes.PermissionDenied
+	case errors.Is(err, ErrUnauthenticated):
+		code = codes.Unauthenticated
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Yandex-Practicum/go-db-sql-final/trackerpb"
+)
+
+// newTestGRPCClient поднимает GRPCServer в памяти и возвращает клиента к нему
+func newTestGRPCClient(t *testing.T, service ParcelService) trackerpb.ParcelServiceClient {
+	t.Helper()
+	return newTestGRPCServerClient(t, newGRPCServer(service, NewAuthenticator(service.store, "secret"), false))
+}
+
+// newTestGRPCServerClient обслуживает srv в памяти и возвращает клиента к нему
+func newTestGRPCServerClient(t *testing.T, srv *grpc.Server) trackerpb.ParcelServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return trackerpb.NewParcelServiceClient(conn)
+}
+
+// TestGRPCServer проверяет основные операции gRPC-сервиса
+func TestGRPCServer(t *testing.T) {
+	service, _ := newTestService(t)
+	client := newTestGRPCClient(t, service)
+	ctx := context.Background()
+
+	// register
+	created, err := client.RegisterParcel(ctx, &trackerpb.RegisterParcelRequest{Client: 1, Address: "Псков"})
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusRegistered, created.GetStatus())
+	assert.NotEmpty(t, created.GetTrackingNumber())
+
+	// get
+	got, err := client.GetParcel(ctx, &trackerpb.GetParcelRequest{Number: created.GetNumber()})
+	require.NoError(t, err)
+	assert.Equal(t, created.GetAddress(), got.GetAddress())
+
+	// change address
+	got, err = client.ChangeAddress(ctx, &trackerpb.ChangeAddressRequest{Number: created.GetNumber(), Address: "Тверь"})
+	require.NoError(t, err)
+	assert.Equal(t, "Тверь", got.GetAddress())
+
+	// list
+	list, err := client.ListClientParcels(ctx, &trackerpb.ListClientParcelsRequest{Client: 1})
+	require.NoError(t, err)
+	require.Len(t, list.GetParcels(), 1)
+	assert.Equal(t, created.GetNumber(), list.GetParcels()[0].GetNumber())
+
+	// next status
+	got, err = client.NextStatus(ctx, &trackerpb.NextStatusRequest{Number: created.GetNumber()})
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, got.GetStatus())
+
+	// delete
+	_, err = client.DeleteParcel(ctx, &trackerpb.DeleteParcelRequest{Number: created.GetNumber()})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+// TestGRPCErrors проверяет коды ошибок gRPC
+func TestGRPCErrors(t *testing.T) {
+	service, _ := newTestService(t)
+	client := newTestGRPCClient(t, service)
+	ctx := context.Background()
+
+	_, err := client.GetParcel(ctx, &trackerpb.GetParcelRequest{Number: 999})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.RegisterParcel(ctx, &trackerpb.RegisterParcelRequest{Client: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	created, err := client.RegisterParcel(ctx, &trackerpb.RegisterParcelRequest{Client: 1, Address: "Псков"})
+	require.NoError(t, err)
+	_, err = client.SetStatus(ctx, &trackerpb.SetStatusRequest{Number: created.GetNumber(), Status: ParcelStatusDelivered})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.DeleteParcel(ctx, &trackerpb.DeleteParcelRequest{Number: created.GetNumber()})
+	require.NoError(t, err)
+	_, err = client.GetParcel(ctx, &trackerpb.GetParcelRequest{Number: created.GetNumber()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestGRPCAuth проверяет, что вызовы gRPC выполняются от имени субъекта из метаданных
+// в его магазине, а при обязательной авторизации без него отклоняются
+func TestGRPCAuth(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	auth := NewAuthenticator(store, "secret")
+	client := newTestGRPCServerClient(t, newGRPCServer(service, auth, true))
+
+	// prepare
+	_, key, err := service.CreateAPIKey(ctx, "billing", RoleDispatcher)
+	require.NoError(t, err)
+	north, err := service.CreateTenant(ctx, "north")
+	require.NoError(t, err)
+	_, northKey, err := service.CreateAPIKey(WithTenant(ctx, north.ID), "north", RoleDispatcher)
+	require.NoError(t, err)
+	token, err := auth.IssueToken(Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleClient, Client: 7, Tenant: DefaultTenant}, time.Hour)
+	require.NoError(t, err)
+	other, err := service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "x-api-key", key)
+	}
+	withToken := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+
+	// check
+	_, err = client.GetParcel(ctx, &trackerpb.GetParcelRequest{Number: other.Number})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.GetParcel(withKey("wrong"), &trackerpb.GetParcelRequest{Number: other.Number})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	created, err := client.RegisterParcel(withKey(key), &trackerpb.RegisterParcelRequest{Client: 7, Address: "Псков"})
+	require.NoError(t, err)
+	history, err := store.GetStatusHistory(created.GetNumber())
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	assert.Equal(t, "apikey:billing", history[0].Actor)
+
+	// магазин вызова - магазин ключа
+	_, err = client.GetParcel(withKey(northKey), &trackerpb.GetParcelRequest{Number: other.Number})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// клиент видит только свои посылки
+	_, err = client.GetParcel(withToken, &trackerpb.GetParcelRequest{Number: created.GetNumber()})
+	require.NoError(t, err)
+	_, err = client.GetParcel(withToken, &trackerpb.GetParcelRequest{Number: other.Number})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.RegisterParcel(withToken, &trackerpb.RegisterParcelRequest{Client: 8, Address: "Орёл"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+// TestGRPCErrorMatchesAPIStatus проверяет, что каждая ошибка сервиса переводится
+// в статус gRPC и в HTTP-статус по одним правилам
+func TestGRPCErrorMatchesAPIStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		http int
+		grpc codes.Code
+	}{
+		{ErrInvalidParcel, http.StatusBadRequest, codes.InvalidArgument},
+		{ValidationError{Field: "address", Message: "must not be empty"}, http.StatusBadRequest, codes.InvalidArgument},
+		{ErrInvalidCursor, http.StatusBadRequest, codes.InvalidArgument},
+		{ErrInvalidFilter, http.StatusBadRequest, codes.InvalidArgument},
+		{ErrUnknownInclude, http.StatusBadRequest, codes.InvalidArgument},
+		{ErrUnknownField, http.StatusBadRequest, codes.InvalidArgument},
+		{ErrInvalidPhone, http.StatusBadRequest, codes.InvalidArgument},
+		{ErrParcelNotFound, http.StatusNotFound, codes.NotFound},
+		{ErrCourierNotFound, http.StatusNotFound, codes.NotFound},
+		{ErrTenantNotFound, http.StatusNotFound, codes.NotFound},
+		{ErrLocationNotFound, http.StatusNotFound, codes.NotFound},
+		{ErrWebhookNotFound, http.StatusNotFound, codes.NotFound},
+		{ErrAPIKeyNotFound, http.StatusNotFound, codes.NotFound},
+		{ErrParcelLocked, http.StatusConflict, codes.FailedPrecondition},
+		{ErrForbiddenTransition, http.StatusConflict, codes.FailedPrecondition},
+		{ErrCancelNotAllowed, http.StatusConflict, codes.FailedPrecondition},
+		{ErrRouteCompleted, http.StatusConflict, codes.FailedPrecondition},
+		{ErrHookRejected, http.StatusUnprocessableEntity, codes.FailedPrecondition},
+		{ErrForbidden, http.StatusForbidden, codes.PermissionDenied},
+		{ErrUnauthenticated, http.StatusUnauthorized, codes.Unauthenticated},
+		{ErrEncryptionKey, http.StatusInternalServerError, codes.Internal},
+		{ErrSchemaVersion, http.StatusInternalServerError, codes.Internal},
+		{ErrInvalidSnapshot, http.StatusInternalServerError, codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			// ошибки сервиса обычно обёрнуты в подробности
+			err := fmt.Errorf("parcel 1: %w", tt.err)
+			assert.Equal(t, tt.http, apiStatus(err))
+			assert.Equal(t, tt.grpc, status.Code(grpcError(err)))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrSchemaVersion возвращается Ready, если версия схемы БД не совпадает
+// с migrations: миграции ещё не применены или БД обновлена более новой версией
+var ErrSchemaVersion = errors.New("schema version does not match migrations")
+
+// readyTimeout - сколько /readyz ждёт ответа БД
+const readyTimeout = 2 * time.Second
+
+// schemaVersion возвращает номер последнего применённого шага migrations
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Ready проверяет, что основная БД отвечает и к ней применены все миграции
+func (s ParcelStore) Ready() error {
+	if err := s.db.PingContext(s.context()); err != nil {
+		return err
+	}
+	version, err := schemaVersion(s.context(), s.db)
+	if err != nil {
+		return err
+	}
+	if version != len(migrations) {
+		return fmt.Errorf("%w: version %d, want %d", ErrSchemaVersion, version, len(migrations))
+	}
+	return nil
+}
+
+// Ready проверяет, готов ли сервис обслуживать запросы, см. ParcelStore.Ready
+func (s ParcelService) Ready(ctx context.Context) error {
+	return s.store.WithContext(ctx).Ready()
+}
+
+// apiHealth - тело ответа /healthz и /readyz
+type apiHealth struct {
+	Status string `json:"status"`          // ok или unavailable
+	Error  string `json:"error,omitempty"` // почему сервис не готов
+}
+
+// serveHealth обрабатывает /healthz и /readyz и возвращает false для других адресов.
+// /healthz отвечает, пока процесс работает, /readyz - только если готова БД.
+// Проверки не требуют авторизации и не учитываются в ограничении частоты запросов
+func (h APIHandler) serveHealth(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Path != "/healthz" && r.URL.Path != "/readyz" {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return true
+	}
+
+	if r.URL.Path == "/readyz" {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if err := h.service.Ready(ctx); err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, apiHealth{Status: "unavailable", Error: err.Error()})
+			return true
+		}
+	}
+	writeJSON(w, http.StatusOK, apiHealth{Status: "ok"})
+	return true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHealthEndpoints проверяет /healthz и /readyz
+func TestHealthEndpoints(t *testing.T) {
+	service, store := newTestService(t)
+	handler := NewAPIHandler(service).WithAuth(NewAuthenticator(store, "secret")).WithRateLimits(RateLimit{Rate: 1, Burst: 1}, RateLimit{})
+
+	// check
+	for _, target := range []string{"/healthz", "/readyz", "/readyz"} {
+		rec := apiCall(t, handler, http.MethodGet, target, "")
+		require.Equal(t, http.StatusOK, rec.Code, target)
+		var res apiHealth
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, apiHealth{Status: "ok"}, res)
+	}
+	rec := apiCall(t, handler, http.MethodPost, "/readyz", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	// миграции ещё не применены
+	_, err := store.db.Exec("PRAGMA user_version = 1")
+	require.NoError(t, err)
+	rec = apiCall(t, handler, http.MethodGet, "/readyz", "")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var res apiHealth
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, "unavailable", res.Status)
+	assert.Contains(t, res.Error, ErrSchemaVersion.Error())
+	assert.ErrorIs(t, store.Ready(), ErrSchemaVersion)
+
+	// БД недоступна, а процесс по-прежнему жив
+	require.NoError(t, store.db.Close())
+	rec = apiCall(t, handler, http.MethodGet, "/readyz", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	rec = apiCall(t, handler, http.MethodGet, "/healthz", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// MaxClockSkew - насколько время устройства может расходиться со временем сервера,
+// чтобы ему можно было доверять при упорядочивании истории
+const MaxClockSkew = 10 * time.Minute
+
+// StatusChange - запись истории статусов посылки
+type StatusChange struct {
+	Status     string
+	ChangedAt  string // согласованное время изменения, по нему упорядочена история
+	ReceivedAt string // когда изменение получил сервер
+	DeviceAt   string // время по часам устройства, пусто, если изменение сделано на сервере
+	Actor      string
+	Comment    string // пояснение к изменению, например причина отмены
+}
+
+// WithDeviceTime возвращает копию хранилища, которая записывает в историю
+// время изменения статуса по часам устройства курьера
+func (s ParcelStore) WithDeviceTime(t time.Time) ParcelStore {
+	s.deviceTime = t
+	return s
+}
+
+// reconcileTime выбирает время изменения: время устройства принимается,
+// если оно отличается от времени получения не больше чем на MaxClockSkew
+// и не находится в будущем, иначе используется время получения сервером
+func reconcileTime(device, received time.Time) time.Time {
+	if device.IsZero() || device.After(received) || received.Sub(device) > MaxClockSkew {
+		return received
+	}
+	return device
+}
+
+// GetStatusHistory возвращает все изменения статуса посылки в хронологическом порядке
+func (s ParcelStore) GetStatusHistory(number int64) ([]StatusChange, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT status, changed_at, received_at, device_at, actor, comment FROM parcel_status_history WHERE number = :number AND "+tenantScope+" ORDER BY changed_at, id",
+		sql.Named("number", number), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []StatusChange{}
+	for rows.Next() {
+		c := StatusChange{}
+		if err := rows.Scan(&c.Status, &c.ChangedAt, &c.ReceivedAt, &c.DeviceAt, &c.Actor, &c.Comment); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// recordStatusChange добавляет запись в историю, только если UPDATE изменил посылку,
+// и сообщает, была ли посылка изменена
+func (s ParcelStore) recordStatusChange(tx *sql.Tx, res sql.Result, number int64, status string) (bool, error) {
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, s.addStatusChange(tx, number, status, "")
+}
+
+// addStatusChange добавляет запись в историю статусов посылки. Если посылка -
+// консолидированная отправка, новый статус в той же транзакции получают входящие в неё посылки
+func (s ParcelStore) addStatusChange(tx *sql.Tx, number int64, status, comment string) error {
+	if err := s.addHistory(tx, number, status, comment); err != nil {
+		return err
+	}
+	return s.propagateStatus(tx, number, status)
+}
+
+// addHistory добавляет одну запись в историю статусов посылки, а смену
+// прежнего статуса записывает и в журнал аудита
+func (s ParcelStore) addHistory(tx *sql.Tx, number int64, status, comment string) error {
+	received := time.Now().UTC()
+	var device string
+	if !s.deviceTime.IsZero() {
+		device = s.deviceTime.UTC().Format(time.RFC3339)
+	}
+
+	// изменение не может произойти раньше предыдущего изменения этой посылки
+	changed := reconcileTime(s.deviceTime, received).UTC().Format(time.RFC3339)
+	var last, previous string
+	err := tx.QueryRowContext(s.context(), "SELECT changed_at, status FROM parcel_status_history WHERE number = :number AND "+tenantScope+
+		" ORDER BY changed_at DESC, id DESC LIMIT 1",
+		sql.Named("number", number), s.tenantArg()).Scan(&last, &previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if last > changed {
+		changed = last
+	}
+
+	_, err = tx.ExecContext(s.context(), "INSERT INTO parcel_status_history (number, status, changed_at, received_at, device_at, actor, comment, tenant_id) "+
+		"VALUES (:number, :status, :changed_at, :received_at, :device_at, :actor, :comment, "+parcelTenant+")",
+		sql.Named("number", number),
+		sql.Named("status", status),
+		sql.Named("changed_at", changed),
+		sql.Named("received_at", received.Format(time.RFC3339)),
+		sql.Named("device_at", device),
+		sql.Named("actor", s.actor),
+		sql.Named("comment", comment))
+	if err != nil || previous == "" {
+		// у новой посылки первый статус записывается вместе с её добавлением
+		return err
+	}
+	return s.addAudit(tx, number, AuditSetStatus, map[string]any{"status": previous}, map[string]any{"status": status})
+}
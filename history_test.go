@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetStatusHistory проверяет запись истории статусов
+func TestGetStatusHistory(t *testing.T) {
+	// prepare
+	// настраиваем подключение к БД из конфигурации
+	db := openTestDB(t)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+
+	// add
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// set status
+	// первый переход выполняет система, второй - курьер
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	require.NoError(t, store.WithActor("courier-7").SetStatus(id, ParcelStatusDelivered))
+
+	// check
+	history, err := store.GetStatusHistory(id)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+
+	assert.Equal(t, ParcelStatusRegistered, history[0].Status)
+	assert.Equal(t, ParcelStatusSent, history[1].Status)
+	assert.Equal(t, DefaultActor, history[1].Actor)
+	assert.Equal(t, ParcelStatusDelivered, history[2].Status)
+	assert.Equal(t, "courier-7", history[2].Actor)
+	for _, c := range history {
+		assert.NotEmpty(t, c.ChangedAt)
+	}
+
+	// для несуществующей посылки история не записывается
+	require.NoError(t, store.SetStatus(0, ParcelStatusSent))
+	history, err = store.GetStatusHistory(0)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+// TestReconcileTime проверяет выбор времени изменения при расхождении часов
+func TestReconcileTime(t *testing.T) {
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// время устройства в пределах окна принимается
+	device := received.Add(-3 * time.Minute)
+	assert.Equal(t, device, reconcileTime(device, received))
+
+	// время из будущего, слишком старое или отсутствующее заменяется временем получения
+	assert.Equal(t, received, reconcileTime(received.Add(time.Minute), received))
+	assert.Equal(t, received, reconcileTime(received.Add(-time.Hour), received))
+	assert.Equal(t, received, reconcileTime(time.Time{}, received))
+}
+
+// TestReportStatus проверяет запись времени устройства и порядок истории:
+// время изменения не может оказаться раньше предыдущего изменения
+func TestReportStatus(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	p, err := service.Register(ctx, 1, "test")
+	require.NoError(t, err)
+
+	// по часам курьера посылка отправлена минуту назад, то есть раньше регистрации
+	device := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	require.NoError(t, service.ReportStatus(ctx, p.Number, ParcelStatusSent, device))
+
+	history, err := store.GetStatusHistory(p.Number)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	sent := history[1]
+	assert.Equal(t, ParcelStatusSent, sent.Status)
+	assert.Equal(t, device.Format(time.RFC3339), sent.DeviceAt)
+	assert.Equal(t, history[0].ChangedAt, sent.ChangedAt)
+	assert.NotEmpty(t, sent.ReceivedAt)
+	assert.Empty(t, history[0].DeviceAt)
+}
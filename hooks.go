@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrHookRejected возвращается, если изменение посылки отклонено хуком
+var ErrHookRejected = errors.New("rejected by hook")
+
+// Hooks - точки расширения для логики конкретной установки.
+// Pre-хуки вызываются до изменения в БД и могут его отклонить, вернув ошибку.
+// PostDelivery вызывается после фиксации доставки, как подписчики OnChange.
+// Любое поле может быть nil
+type Hooks struct {
+	PreAdd          func(ctx context.Context, p Parcel) error
+	PreStatusChange func(ctx context.Context, number int64, status string) error
+	PostDelivery    func(ctx context.Context, number int64)
+}
+
+// Use подключает хуки ко всем копиям ParcelStore. Хуки вызываются
+// в порядке подключения, первая ошибка pre-хука отклоняет изменение
+func (s ParcelStore) Use(h Hooks) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	s.events.hooks = append(s.events.hooks, h)
+}
+
+func (s ParcelStore) hooks() []Hooks {
+	if s.events == nil {
+		return nil
+	}
+	s.events.mu.RLock()
+	defer s.events.mu.RUnlock()
+	return s.events.hooks
+}
+
+func (s ParcelStore) preAdd(p Parcel) error {
+	for _, h := range s.hooks() {
+		if h.PreAdd == nil {
+			continue
+		}
+		if err := h.PreAdd(s.context(), p); err != nil {
+			return fmt.Errorf("%w: %w", ErrHookRejected, err)
+		}
+	}
+	return nil
+}
+
+func (s ParcelStore) preStatusChange(number int64, status string) error {
+	for _, h := range s.hooks() {
+		if h.PreStatusChange == nil {
+			continue
+		}
+		if err := h.PreStatusChange(s.context(), number, status); err != nil {
+			return fmt.Errorf("%w: %w", ErrHookRejected, err)
+		}
+	}
+	return nil
+}
+
+func (s ParcelStore) postDelivery(number int64) {
+	for _, h := range s.hooks() {
+		if h.PostDelivery != nil {
+			h.PostDelivery(s.context(), number)
+		}
+	}
+}
+
+// HTTPHook вызывает внешний сервис для каждого хука: отправляет POST на URL
+// с JSON {"hook": ..., "parcel": ..., "number": ..., "status": ...}.
+// Ответ 2xx разрешает изменение, любой другой ответ или отсутствие ответа
+// за Timeout его отклоняет. Ошибки PostDelivery передаются в OnError
+type HTTPHook struct {
+	URL     string
+	Timeout time.Duration // 0 - DefaultHookTimeout
+	Client  *http.Client  // nil - http.DefaultClient
+	OnError func(error)
+}
+
+// DefaultHookTimeout ограничивает время ответа внешнего хука
+const DefaultHookTimeout = 2 * time.Second
+
+// hookRequest - тело запроса HTTPHook
+type hookRequest struct {
+	Hook   string  `json:"hook"`
+	Parcel *Parcel `json:"parcel,omitempty"`
+	Number int64   `json:"number,omitempty,string"`
+	Status string  `json:"status,omitempty"`
+}
+
+// Hooks возвращает хуки для подключения через ParcelStore.Use
+func (h HTTPHook) Hooks() Hooks {
+	return Hooks{
+		PreAdd: func(ctx context.Context, p Parcel) error {
+			return h.call(ctx, hookRequest{Hook: "pre_add", Parcel: &p})
+		},
+		PreStatusChange: func(ctx context.Context, number int64, status string) error {
+			return h.call(ctx, hookRequest{Hook: "pre_status_change", Number: number, Status: status})
+		},
+		PostDelivery: func(ctx context.Context, number int64) {
+			err := h.call(ctx, hookRequest{Hook: "post_delivery", Number: number, Status: ParcelStatusDelivered})
+			if err != nil && h.OnError != nil {
+				h.OnError(err)
+			}
+		},
+	}
+}
+
+func (h HTTPHook) call(ctx context.Context, req hookRequest) error {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultHookTimeout
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s hook: %s: %s", req.Hook, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
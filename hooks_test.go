@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHooks проверяет, что pre-хуки могут отклонить изменение,
+// а PostDelivery вызывается после доставки
+func TestHooks(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	var delivered []int64
+	store.Use(Hooks{
+		PreAdd: func(_ context.Context, p Parcel) error {
+			if p.Client == 13 {
+				return errors.New("blocked client")
+			}
+			return nil
+		},
+		PreStatusChange: func(_ context.Context, _ int64, status string) error {
+			if status == ParcelStatusCancelled {
+				return errors.New("cancellation disabled")
+			}
+			return nil
+		},
+		PostDelivery: func(_ context.Context, number int64) { delivered = append(delivered, number) },
+	})
+
+	// pre-add
+	_, err := service.Register(ctx, 13, "Псков")
+	assert.ErrorIs(t, err, ErrHookRejected)
+
+	// pre-status-change
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	assert.ErrorIs(t, service.Cancel(ctx, p.Number, "передумал"), ErrHookRejected)
+	assertStatus(t, service, p.Number, ParcelStatusRegistered)
+
+	// post-delivery
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	assert.Equal(t, []int64{p.Number}, delivered)
+}
+
+// TestHTTPHook проверяет вызов внешнего хука и отклонение по ответу и таймауту
+func TestHTTPHook(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		hooks []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req hookRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		hooks = append(hooks, req.Hook)
+		mu.Unlock()
+		switch {
+		case req.Parcel != nil && req.Parcel.Client == 13:
+			http.Error(w, "blocked client", http.StatusForbidden)
+		case req.Status == ParcelStatusCancelled:
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	service, store := newTestService(t)
+	store.Use(HTTPHook{URL: srv.URL, Timeout: 20 * time.Millisecond}.Hooks())
+	ctx := context.Background()
+
+	_, err := service.Register(ctx, 13, "Псков")
+	assert.ErrorIs(t, err, ErrHookRejected)
+	assert.ErrorContains(t, err, "blocked client")
+
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	assert.ErrorIs(t, service.Cancel(ctx, p.Number, "передумал"), context.DeadlineExceeded)
+
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"pre_add", "pre_add", "pre_status_change", "pre_status_change", "pre_status_change", "post_delivery"}, hooks)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportBatchSize - сколько посылок импорта добавляется в одной транзакции
+const ImportBatchSize = 100
+
+// importColumns - колонки файла импорта. client и address обязательны,
+// без status посылка регистрируется в статусе registered
+var importColumns = []string{"client", "address", "status"}
+
+// utf8BOM - метка порядка байтов, с которой Excel сохраняет CSV в UTF-8
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// ImportRowError - ошибка в строке файла импорта. Line - номер строки файла
+// с единицы, Field - колонка, если ошибка относится к ней
+type ImportRowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ImportRowError) String() string {
+	if e.Field == "" {
+		return fmt.Sprintf("строка %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("строка %d: %s: %s", e.Line, e.Field, e.Message)
+}
+
+// ImportResult - итог импорта: Rows строк данных, из них Valid прошли проверку,
+// Imported добавлены в БД. При пробном запуске Imported всегда 0
+type ImportResult struct {
+	Rows     int              `json:"rows"`
+	Valid    int              `json:"valid"`
+	Imported int              `json:"imported"`
+	DryRun   bool             `json:"dry_run"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// newImportReader читает CSV с заголовком из r и возвращает номера колонок
+// importColumns в строке. Файл из Excel читается как есть: метка BOM
+// пропускается, а разделитель ";" распознаётся по строке заголовка
+func newImportReader(r io.Reader) (*csv.Reader, map[string]int, error) {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(bom, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	cr := csv.NewReader(br)
+	// ошибки в строке возвращаются по строкам, в том числе о числе полей
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	head, _ := br.Peek(br.Size())
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		head = head[:i]
+	}
+	if bytes.Count(head, []byte(";")) > bytes.Count(head, []byte(",")) {
+		cr.Comma = ';'
+	}
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, ValidationError{Field: "header", Message: "file is empty"}
+	}
+	if err != nil {
+		return nil, nil, ValidationError{Field: "header", Message: err.Error()}
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "client", "address", "status":
+		default:
+			return nil, nil, ValidationError{Field: "header", Message: fmt.Sprintf("unknown column %q, expected %s", name, strings.Join(importColumns, ", "))}
+		}
+		if _, ok := columns[name]; ok {
+			return nil, nil, ValidationError{Field: "header", Message: fmt.Sprintf("duplicate column %q", name)}
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"client", "address"} {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, ValidationError{Field: "header", Message: fmt.Sprintf("missing column %q", name)}
+		}
+	}
+	return cr, columns, nil
+}
+
+// ImportCSV добавляет посылки из CSV с заголовком client,address[,status],
+// например выгрузку из Excel. Каждая строка проверяется: клиент с положительным
+// идентификатором, данные которого не обезличены, непустой адрес и известный
+// статус. Строки с ошибками пропускаются и попадают в ImportResult.Errors,
+// остальные добавляются транзакциями по ImportBatchSize посылок. При dryRun
+// строки только проверяются. Ошибка БД прерывает импорт, уже добавленные
+// партии остаются в БД и учтены в ImportResult.Imported
+func (s ParcelService) ImportCSV(ctx context.Context, r io.Reader, dryRun bool) (res ImportResult, err error) {
+	start := time.Now()
+	// итог импорта известен только в конце
+	defer func() {
+		s.logOp(ctx, "import", start, &err, slog.Bool("dry_run", dryRun),
+			slog.Int("rows", res.Rows), slog.Int("imported", res.Imported), slog.Int("errors", len(res.Errors)))
+	}()
+	res = ImportResult{DryRun: dryRun, Errors: []ImportRowError{}}
+	cr, columns, err := newImportReader(r)
+	if err != nil {
+		return res, err
+	}
+
+	store := s.store.WithContext(ctx)
+	erased := map[int64]bool{}
+	batch := make([]Parcel, 0, ImportBatchSize)
+	flush := func() error {
+		if dryRun || len(batch) == 0 {
+			batch = batch[:0]
+			return nil
+		}
+		if _, err := addTrackedBatch(store, batch); err != nil {
+			return err
+		}
+		res.Imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			res.Rows++
+			res.Errors = append(res.Errors, ImportRowError{Line: parseErr.StartLine, Message: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		res.Rows++
+		line, _ := cr.FieldPos(0)
+
+		p, err := s.importRow(ctx, store, columns, record, erased)
+		var verr ValidationError
+		if errors.As(err, &verr) {
+			res.Errors = append(res.Errors, ImportRowError{Line: line, Field: verr.Field, Message: verr.Message})
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		res.Valid++
+		if dryRun {
+			continue
+		}
+
+		now := time.Now().UTC()
+		p.CreatedAt = now.Format(time.RFC3339)
+		if p.ETA, err = s.eta.Estimate(ctx, p.Address, now); err != nil {
+			return res, err
+		}
+		batch = append(batch, p)
+		if len(batch) == ImportBatchSize {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// importRow проверяет строку record файла импорта и возвращает посылку из неё.
+// Ошибки в данных строки возвращаются как ValidationError. erased запоминает
+// проверенных клиентов: true - данные клиента обезличены
+func (s ParcelService) importRow(ctx context.Context, store ParcelStore, columns map[string]int, record []string, erased map[int64]bool) (Parcel, error) {
+	value := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	if len(record) != len(columns) {
+		return Parcel{}, ValidationError{Field: "row", Message: fmt.Sprintf("expected %d fields, got %d", len(columns), len(record))}
+	}
+
+	client, err := strconv.ParseInt(value("client"), 10, 64)
+	if err != nil {
+		return Parcel{}, ValidationError{Field: "client", Message: fmt.Sprintf("not a number: %q", value("client"))}
+	}
+	if err := validateClient(client); err != nil {
+		return Parcel{}, err
+	}
+	if err := requireClient(ctx, client); err != nil {
+		return Parcel{}, ValidationError{Field: "client", Message: err.Error()}
+	}
+	gone, ok := erased[client]
+	if !ok {
+		erasures, err := store.ListErasures(client)
+		if err != nil {
+			return Parcel{}, err
+		}
+		gone = len(erasures) > 0
+		erased[client] = gone
+	}
+	if gone {
+		return Parcel{}, ValidationError{Field: "client", Message: fmt.Sprintf("client %d is erased", client)}
+	}
+
+	address := value("address")
+	if err := validateAddress(address); err != nil {
+		return Parcel{}, err
+	}
+	status := value("status")
+	if status == "" {
+		status = ParcelStatusRegistered
+	}
+	if err := validateStatus(status); err != nil {
+		return Parcel{}, err
+	}
+
+	return Parcel{
+		Client:   client,
+		Status:   status,
+		Address:  address,
+		Priority: PriorityNormal,
+	}, nil
+}
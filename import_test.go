@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImportCSV проверяет проверку строк импорта, пробный запуск и добавление посылок
+func TestImportCSV(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	admin := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleAdmin, Tenant: DefaultTenant})
+
+	// prepare
+	_, err := service.Register(ctx, 9, "Тверь")
+	require.NoError(t, err)
+	_, err = service.AnonymizeClient(admin, 9)
+	require.NoError(t, err)
+	// так файл сохраняет Excel: метка BOM и разделитель ";"
+	file := "\xef\xbb\xbfClient;Address;Status\r\n" +
+		"7;Псков, ул. Мира, 1;\r\n" +
+		"7;\"Орёл; пр. Победы, 2\";sent\r\n" +
+		"0;Псков;\r\n" +
+		"семь;Псков;\r\n" +
+		"7; ;\r\n" +
+		"7;Псков;lost\r\n" +
+		"9;Тверь;\r\n" +
+		"7;Псков\r\n"
+
+	// check
+	res, err := service.ImportCSV(ctx, strings.NewReader(file), true)
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Rows: 8, Valid: 2, DryRun: true, Errors: []ImportRowError{
+		{Line: 4, Field: "client", Message: "must be positive"},
+		{Line: 5, Field: "client", Message: `not a number: "семь"`},
+		{Line: 6, Field: "address", Message: "must not be empty"},
+		{Line: 7, Field: "status", Message: `unknown status "lost"`},
+		{Line: 8, Field: "client", Message: "client 9 is erased"},
+		{Line: 9, Field: "row", Message: "expected 3 fields, got 2"},
+	}}, res)
+	parcels, err := store.GetByClient(7)
+	require.NoError(t, err)
+	assert.Empty(t, parcels, "пробный запуск ничего не добавляет")
+
+	// add
+	res, err = service.ImportCSV(ctx, strings.NewReader(file), false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Imported)
+	assert.Len(t, res.Errors, 6)
+
+	// check
+	parcels, err = store.GetByClient(7)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	assert.Equal(t, "Псков, ул. Мира, 1", parcels[0].Address)
+	assert.Equal(t, ParcelStatusRegistered, parcels[0].Status)
+	assert.Equal(t, "Орёл; пр. Победы, 2", parcels[1].Address)
+	assert.Equal(t, ParcelStatusSent, parcels[1].Status)
+	for _, p := range parcels {
+		assert.True(t, strings.HasPrefix(p.Tracking, "TRK-"))
+		assert.NotEmpty(t, p.ETA)
+		history, err := store.GetStatusHistory(p.Number)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, p.Status, history[0].Status)
+	}
+
+	for _, file := range []string{"", "client,status\n7,sent\n", "client,address,weight\n", "client,address,client\n"} {
+		_, err = service.ImportCSV(ctx, strings.NewReader(file), true)
+		var verr ValidationError
+		require.ErrorAs(t, err, &verr, file)
+		assert.Equal(t, "header", verr.Field)
+	}
+}
+
+// TestImportCSVBatches проверяет, что посылки добавляются транзакциями
+// по ImportBatchSize и отказ в партии не отменяет уже добавленные
+func TestImportCSVBatches(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	var file strings.Builder
+	file.WriteString("client,address\n")
+	for i := 1; i <= 2*ImportBatchSize+1; i++ {
+		fmt.Fprintf(&file, "7,Псков дом %d\n", i)
+	}
+	reject := errors.New("адрес вне зоны доставки")
+	store.Use(Hooks{PreAdd: func(ctx context.Context, p Parcel) error {
+		if p.Address == fmt.Sprintf("Псков дом %d", ImportBatchSize+2) {
+			return reject
+		}
+		return nil
+	}})
+
+	// add
+	res, err := service.ImportCSV(ctx, strings.NewReader(file.String()), false)
+
+	// check
+	require.ErrorIs(t, err, reject)
+	assert.Equal(t, ImportBatchSize, res.Imported)
+	parcels, err := store.GetByClient(7)
+	require.NoError(t, err)
+	assert.Len(t, parcels, ImportBatchSize, "отклонённая партия добавляется целиком или никак")
+}
+
+// TestImportCLI проверяет команду import
+func TestImportCLI(t *testing.T) {
+	service, store := newTestService(t)
+	file := filepath.Join(t.TempDir(), "parcels.csv")
+	require.NoError(t, os.WriteFile(file, []byte("client,address\n7,Псков\n0,Тверь\n"), 0o600))
+
+	// check
+	out, err := runCLI(t, store, service, "import", "--file", file, "--dry-run")
+	require.Error(t, err)
+	assert.Contains(t, out, "строка 3: client: must be positive")
+	assert.Contains(t, out, "строк: 2, без ошибок: 1, добавлено: 0")
+
+	// add
+	require.NoError(t, os.WriteFile(file, []byte("client,address\n7,Псков\n"), 0o600))
+	out, err = runCLI(t, store, service, "import", "--file", file)
+	require.NoError(t, err)
+	assert.Contains(t, out, "добавлено: 1")
+	parcels, err := store.GetByClient(7)
+	require.NoError(t, err)
+	assert.Len(t, parcels, 1)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownInclude возвращается ParseIncludes для неизвестного раскрытия
+var ErrUnknownInclude = errors.New("unknown include")
+
+// IncludeHistoryLimit - сколько последних записей истории статусов
+// добавляется к посылке при раскрытии history
+const IncludeHistoryLimit = 5
+
+// Includes - связанные данные, которые нужно загрузить вместе с посылками.
+// Получается через ParseIncludes
+type Includes struct {
+	History bool // последние IncludeHistoryLimit записей истории статусов
+	Courier bool // назначенный курьер
+	Items   bool // вложения
+	Notes   bool // заметки
+}
+
+// ParseIncludes разбирает список раскрытий через запятую, как в параметре
+// запроса include=history,courier
+func ParseIncludes(spec string) (Includes, error) {
+	var inc Includes
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "history":
+			inc.History = true
+		case "courier":
+			inc.Courier = true
+		case "items":
+			inc.Items = true
+		case "notes":
+			inc.Notes = true
+		default:
+			return Includes{}, fmt.Errorf("%w: %q", ErrUnknownInclude, strings.TrimSpace(name))
+		}
+	}
+	return inc, nil
+}
+
+// ParcelDetails - посылка вместе с раскрытыми связанными данными.
+// Нераскрытые поля остаются пустыми
+type ParcelDetails struct {
+	Parcel
+	History         []StatusChange `json:",omitempty"` // от более ранних записей к последней
+	AssignedCourier *Courier       `json:",omitempty"` // курьер по Parcel.Courier
+	Items           []Item         `json:",omitempty"`
+	Notes           []Note         `json:",omitempty"`
+}
+
+// Expand загружает связанные данные для посылок. Каждое раскрытие читается
+// одним запросом для всех посылок, а не отдельным запросом на каждую
+func (s ParcelStore) Expand(parcels []Parcel, inc Includes) ([]ParcelDetails, error) {
+	res := make([]ParcelDetails, len(parcels))
+	numbers := make([]int64, len(parcels))
+	var couriers []int64
+	for i, p := range parcels {
+		res[i].Parcel = p
+		numbers[i] = p.Number
+		if p.Courier != 0 {
+			couriers = append(couriers, int64(p.Courier))
+		}
+	}
+	if len(parcels) == 0 {
+		return res, nil
+	}
+
+	if inc.History {
+		history, err := s.latestHistory(numbers, IncludeHistoryLimit)
+		if err != nil {
+			return nil, err
+		}
+		for i := range res {
+			res[i].History = history[res[i].Number]
+		}
+	}
+	if inc.Courier && len(couriers) > 0 {
+		byID, err := s.couriersByID(couriers)
+		if err != nil {
+			return nil, err
+		}
+		for i := range res {
+			if c, ok := byID[res[i].Courier]; ok {
+				res[i].AssignedCourier = &c
+			}
+		}
+	}
+	if inc.Items {
+		items, err := s.itemsByNumber(numbers)
+		if err != nil {
+			return nil, err
+		}
+		for i := range res {
+			res[i].Items = items[res[i].Number]
+		}
+	}
+	if inc.Notes {
+		notes, err := s.notesByNumber(numbers)
+		if err != nil {
+			return nil, err
+		}
+		for i := range res {
+			res[i].Notes = notes[res[i].Number]
+		}
+	}
+	return res, nil
+}
+
+// latestHistory возвращает не больше limit последних записей истории каждой посылки
+func (s ParcelStore) latestHistory(numbers []int64, limit int) (map[int64][]StatusChange, error) {
+	in, args := namedList(numbers)
+	args = append(args, sql.Named("limit", limit))
+	rows, err := s.db.QueryContext(s.context(), "SELECT number, status, changed_at, received_at, device_at, actor, comment FROM ("+
+		"SELECT *, ROW_NUMBER() OVER (PARTITION BY number ORDER BY changed_at DESC, id DESC) AS pos "+
+		"FROM parcel_status_history WHERE number IN ("+in+") AND "+tenantScope+
+		") WHERE pos <= :limit ORDER BY number, changed_at, id", append(args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int64][]StatusChange)
+	for rows.Next() {
+		var number int64
+		c := StatusChange{}
+		if err := rows.Scan(&number, &c.Status, &c.ChangedAt, &c.ReceivedAt, &c.DeviceAt, &c.Actor, &c.Comment); err != nil {
+			return nil, err
+		}
+		res[number] = append(res[number], c)
+	}
+	return res, rows.Err()
+}
+
+// couriersByID возвращает курьеров по идентификаторам
+func (s ParcelStore) couriersByID(ids []int64) (map[int]Courier, error) {
+	in, args := namedList(ids)
+	rows, err := s.db.QueryContext(s.context(), "SELECT id, name, phone FROM courier WHERE id IN ("+in+") AND "+tenantScope, append(args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int]Courier)
+	for rows.Next() {
+		c := Courier{}
+		if err := rows.Scan(&c.ID, &c.Name, &c.Phone); err != nil {
+			return nil, err
+		}
+		res[c.ID] = c
+	}
+	return res, rows.Err()
+}
+
+// itemsByNumber возвращает вложения посылок в порядке добавления
+func (s ParcelStore) itemsByNumber(numbers []int64) (map[int64][]Item, error) {
+	in, args := namedList(numbers)
+	rows, err := s.db.QueryContext(s.context(), "SELECT number, description, quantity, unit_value FROM parcel_items WHERE number IN ("+in+") AND "+tenantScope+" ORDER BY id", append(args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int64][]Item)
+	for rows.Next() {
+		var number int64
+		var it Item
+		if err := rows.Scan(&number, &it.Description, &it.Quantity, &it.UnitValue); err != nil {
+			return nil, err
+		}
+		res[number] = append(res[number], it)
+	}
+	return res, rows.Err()
+}
+
+// notesByNumber возвращает заметки посылок в порядке добавления
+func (s ParcelStore) notesByNumber(numbers []int64) (map[int64][]Note, error) {
+	in, args := namedList(numbers)
+	rows, err := s.db.QueryContext(s.context(), "SELECT number, id, author, text, created_at FROM parcel_notes WHERE number IN ("+in+") AND "+tenantScope+" ORDER BY id", append(args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int64][]Note)
+	for rows.Next() {
+		var number int64
+		var n Note
+		if err := rows.Scan(&number, &n.ID, &n.Author, &n.Text, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		res[number] = append(res[number], n)
+	}
+	return res, rows.Err()
+}
+
+// parseIncludes переводит ошибку ParseIncludes в ValidationError
+func parseIncludes(spec string) (Includes, error) {
+	inc, err := ParseIncludes(spec)
+	if err != nil {
+		return Includes{}, ValidationError{Field: "include", Message: strings.TrimPrefix(err.Error(), ErrUnknownInclude.Error()+": ")}
+	}
+	return inc, nil
+}
+
+// GetDetails возвращает посылку с раскрытиями из include, см. ParseIncludes
+func (s ParcelService) GetDetails(ctx context.Context, number int64, include string) (ParcelDetails, error) {
+	inc, err := parseIncludes(include)
+	if err != nil {
+		return ParcelDetails{}, err
+	}
+	p, err := s.Get(ctx, number)
+	if err != nil {
+		return ParcelDetails{}, err
+	}
+	res, err := s.store.WithContext(ctx).Expand([]Parcel{p}, inc)
+	if err != nil {
+		return ParcelDetails{}, err
+	}
+	return res[0], nil
+}
+
+// ClientParcelsDetails возвращает посылки клиента с раскрытиями из include
+func (s ParcelService) ClientParcelsDetails(ctx context.Context, client int64, include string) ([]ParcelDetails, error) {
+	if err := validateClient(client); err != nil {
+		return nil, err
+	}
+	if err := requireClient(ctx, client); err != nil {
+		return nil, err
+	}
+	inc, err := parseIncludes(include)
+	if err != nil {
+		return nil, err
+	}
+	store := s.store.WithContext(ctx)
+	parcels, err := store.GetByClient(client)
+	if err != nil {
+		return nil, err
+	}
+	return store.Expand(parcels, inc)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseIncludes проверяет разбор списка раскрытий
+func TestParseIncludes(t *testing.T) {
+	inc, err := ParseIncludes("history, courier")
+	require.NoError(t, err)
+	assert.Equal(t, Includes{History: true, Courier: true}, inc)
+
+	inc, err = ParseIncludes("")
+	require.NoError(t, err)
+	assert.Equal(t, Includes{}, inc)
+
+	_, err = ParseIncludes("history,client")
+	assert.ErrorIs(t, err, ErrUnknownInclude)
+}
+
+// TestClientParcelsDetails проверяет раскрытие связанных данных для списка посылок
+func TestClientParcelsDetails(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	courier, err := service.AddCourier(ctx, "Иван", "+70000000000")
+	require.NoError(t, err)
+	first, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.AssignCourier(ctx, first.Number, courier.ID))
+	require.NoError(t, service.AddItems(ctx, first.Number, []Item{{Description: "Книга", Quantity: 1}}))
+	note, err := service.AddNote(ctx, first.Number, "operator-1", "код домофона 1234")
+	require.NoError(t, err)
+	// истории больше, чем раскрывается
+	for i := 0; i < IncludeHistoryLimit; i++ {
+		require.NoError(t, store.SetStatus(first.Number, ParcelStatusSent))
+	}
+	second, err := service.Register(ctx, 1, "Тверь")
+	require.NoError(t, err)
+
+	// check
+	details, err := service.ClientParcelsDetails(ctx, 1, "history,courier,items,notes")
+	require.NoError(t, err)
+	require.Len(t, details, 2)
+
+	assert.Equal(t, first.Number, details[0].Number)
+	assert.Len(t, details[0].History, IncludeHistoryLimit)
+	assert.Equal(t, ParcelStatusSent, details[0].History[IncludeHistoryLimit-1].Status)
+	require.NotNil(t, details[0].AssignedCourier)
+	assert.Equal(t, courier, *details[0].AssignedCourier)
+	assert.Equal(t, []Item{{Description: "Книга", Quantity: 1}}, details[0].Items)
+	assert.Equal(t, []Note{note}, details[0].Notes)
+
+	assert.Equal(t, second.Number, details[1].Number)
+	assert.Len(t, details[1].History, 1)
+	assert.Nil(t, details[1].AssignedCourier)
+	assert.Empty(t, details[1].Items)
+
+	// без раскрытий связанные данные не загружаются
+	one, err := service.GetDetails(ctx, first.Number, "")
+	require.NoError(t, err)
+	assert.Equal(t, first.Number, one.Number)
+	assert.Nil(t, one.History)
+	assert.Nil(t, one.AssignedCourier)
+
+	_, err = service.GetDetails(ctx, first.Number, "client")
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+}
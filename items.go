@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Item - вложение посылки для таможенной декларации и претензий о повреждении
+type Item struct {
+	Description string
+	Quantity    int
+	UnitValue   Money // стоимость одной единицы
+}
+
+// AddItems добавляет вложения посылки в одной транзакции
+func (s ParcelStore) AddItems(number int64, items []Item) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, it := range items {
+			_, err := tx.ExecContext(s.context(), "INSERT INTO parcel_items (number, description, quantity, unit_value, tenant_id) "+
+				"VALUES (:number, :description, :quantity, :unit_value, "+parcelTenant+")",
+				sql.Named("number", number),
+				sql.Named("description", it.Description),
+				sql.Named("quantity", it.Quantity),
+				sql.Named("unit_value", it.UnitValue))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetItems возвращает вложения посылки в порядке добавления
+func (s ParcelStore) GetItems(number int64) ([]Item, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT description, quantity, unit_value FROM parcel_items WHERE number = :number AND "+tenantScope+" ORDER BY id",
+		sql.Named("number", number), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Item{}
+	for rows.Next() {
+		var it Item
+		if err := rows.Scan(&it.Description, &it.Quantity, &it.UnitValue); err != nil {
+			return nil, err
+		}
+		res = append(res, it)
+	}
+	return res, rows.Err()
+}
+
+// AddItems добавляет вложения посылки, пока она не отправлена
+func (s ParcelService) AddItems(ctx context.Context, number int64, items []Item) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	for _, it := range items {
+		if strings.TrimSpace(it.Description) == "" {
+			return ValidationError{Field: "description", Message: "must not be empty"}
+		}
+		if it.Quantity <= 0 {
+			return ValidationError{Field: "quantity", Message: "must be positive"}
+		}
+		if it.UnitValue < 0 {
+			return ValidationError{Field: "unit_value", Message: "must not be negative"}
+		}
+	}
+	if err := s.checkRegistered(ctx, number); err != nil {
+		return err
+	}
+	return s.store.WithContext(ctx).AddItems(number, items)
+}
+
+// GetItems возвращает вложения посылки
+func (s ParcelService) GetItems(ctx context.Context, number int64) ([]Item, error) {
+	if _, err := s.Get(ctx, number); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetItems(number)
+}
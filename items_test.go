@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestItems проверяет добавление вложений и их удаление вместе с посылкой
+func TestItems(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	items := []Item{
+		{Description: "Книга", Quantity: 2, UnitValue: 49900},
+		{Description: "Кружка", Quantity: 1, UnitValue: 35000},
+	}
+
+	// add
+	require.NoError(t, service.AddItems(ctx, p.Number, items))
+
+	// check
+	stored, err := service.GetItems(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, items, stored)
+
+	// validation
+	assert.ErrorIs(t, service.AddItems(ctx, p.Number, []Item{{Description: "Книга"}}), ErrInvalidParcel)
+	assert.ErrorIs(t, service.AddItems(ctx, p.Number, []Item{{Quantity: 1}}), ErrInvalidParcel)
+	_, err = service.GetItems(ctx, p.Number+1)
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+
+	// delete
+	require.NoError(t, service.Delete(ctx, p.Number))
+	stored, err = store.GetItems(p.Number)
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+}
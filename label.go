@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Yandex-Practicum/go-db-sql-final/labels"
+)
+
+// Label возвращает PNG этикетки посылки с кодом отслеживания
+// в формате labels.FormatCode128 или labels.FormatQR
+func (s ParcelService) Label(ctx context.Context, number int64, format string) ([]byte, error) {
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if parcel.Tracking == "" {
+		return nil, fmt.Errorf("%w: parcel %d has no tracking number", ErrParcelNotFound, number)
+	}
+
+	var buf bytes.Buffer
+	err = labels.Render(&buf, format, parcel.Tracking)
+	if errors.Is(err, labels.ErrUnknownFormat) {
+		return nil, ValidationError{Field: "format", Message: fmt.Sprintf("unknown label format %q", format)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
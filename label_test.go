@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+
+	"github.com/Yandex-Practicum/go-db-sql-final/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLabel проверяет выдачу этикетки посылки
+func TestLabel(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+
+	data, err := service.Label(ctx, p.Number, labels.FormatQR)
+	require.NoError(t, err)
+	_, err = png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	_, err = service.Label(ctx, p.Number, "pdf")
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.Label(ctx, p.Number+1, labels.FormatCode128)
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+}
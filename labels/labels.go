@@ -0,0 +1,67 @@
+// Package labels рисует штрихкоды для печати на этикетках посылок
+package labels
+
+import (
+	"errors"
+	"image/png"
+	"io"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+)
+
+// Форматы этикеток
+const (
+	FormatCode128 = "code128"
+	FormatQR      = "qr"
+)
+
+// ErrUnknownFormat возвращается для формата, которого нет среди Format*
+var ErrUnknownFormat = errors.New("unknown label format")
+
+// Размеры изображений в пикселях. Линейный штрихкод растягивается по ширине,
+// модули QR-кода - до квадрата QRSize
+const (
+	Code128Width  = 400
+	Code128Height = 100
+	QRSize        = 256
+)
+
+// Code128 записывает в w PNG со штрихкодом Code128 для кода code
+func Code128(w io.Writer, code string) error {
+	bc, err := code128.Encode(code)
+	if err != nil {
+		return err
+	}
+	return writePNG(w, bc, Code128Width, Code128Height)
+}
+
+// QR записывает в w PNG с QR-кодом для кода code. Используется средний уровень
+// коррекции ошибок: этикетки мнутся, но код должен оставаться небольшим
+func QR(w io.Writer, code string) error {
+	bc, err := qr.Encode(code, qr.M, qr.Auto)
+	if err != nil {
+		return err
+	}
+	return writePNG(w, bc, QRSize, QRSize)
+}
+
+// Render записывает в w PNG выбранного формата
+func Render(w io.Writer, format, code string) error {
+	switch format {
+	case FormatCode128:
+		return Code128(w, code)
+	case FormatQR:
+		return QR(w, code)
+	}
+	return ErrUnknownFormat
+}
+
+func writePNG(w io.Writer, bc barcode.Barcode, width, height int) error {
+	scaled, err := barcode.Scale(bc, width, height)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, scaled)
+}
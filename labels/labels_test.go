@@ -0,0 +1,34 @@
+package labels
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRender проверяет, что этикетки обоих форматов - PNG нужного размера
+func TestRender(t *testing.T) {
+	tests := []struct {
+		format        string
+		width, height int
+	}{
+		{FormatCode128, Code128Width, Code128Height},
+		{FormatQR, QRSize, QRSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Render(&buf, tt.format, "TRK-9F3K2A"))
+
+			img, err := png.Decode(&buf)
+			require.NoError(t, err)
+			assert.Equal(t, tt.width, img.Bounds().Dx())
+			assert.Equal(t, tt.height, img.Bounds().Dy())
+		})
+	}
+
+	assert.ErrorIs(t, Render(&bytes.Buffer{}, "pdf417", "TRK-9F3K2A"), ErrUnknownFormat)
+}
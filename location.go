@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Виды мест, через которые проходят посылки
+const (
+	LocationPickupPoint   = "pickup_point"
+	LocationWarehouse     = "warehouse"
+	LocationSortingCenter = "sorting_center"
+)
+
+// ErrLocationNotFound возвращается, если места с указанным идентификатором нет
+var ErrLocationNotFound = errors.New("location not found")
+
+// Location - пункт выдачи, склад или сортировочный центр
+type Location struct {
+	ID      int
+	Kind    string // LocationPickupPoint, LocationWarehouse или LocationSortingCenter
+	Name    string
+	Address string
+}
+
+// AddLocation добавляет место и возвращает его идентификатор
+func (s ParcelStore) AddLocation(l Location) (int, error) {
+	res, err := s.db.ExecContext(s.context(), "INSERT INTO location (kind, name, address, tenant_id) VALUES (:kind, :name, :address, :tenant)",
+		sql.Named("kind", l.Kind),
+		sql.Named("name", l.Name),
+		sql.Named("address", l.Address),
+		s.tenantArg())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// GetLocation возвращает место по идентификатору
+func (s ParcelStore) GetLocation(id int) (Location, error) {
+	l := Location{}
+	err := s.db.QueryRowContext(s.context(), "SELECT id, kind, name, address FROM location WHERE id = :id AND "+tenantScope,
+		sql.Named("id", id), s.tenantArg()).Scan(&l.ID, &l.Kind, &l.Name, &l.Address)
+	return l, err
+}
+
+// SetLocations задаёт место отправления и место назначения посылки
+func (s ParcelStore) SetLocations(number int64, origin, destination int) error {
+	return s.auditedUpdate(number, []string{"origin_id", "destination_id"}, "UPDATE parcel SET origin_id = :origin, destination_id = :destination WHERE number = :number AND "+tenantScope,
+		sql.Named("origin", origin),
+		sql.Named("destination", destination),
+		sql.Named("number", number),
+		s.tenantArg())
+}
+
+// GetByDestinationPoint возвращает посылки, которые направлены в место location
+func (s ParcelStore) GetByDestinationPoint(location int) ([]Parcel, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE destination_id = :destination AND "+tenantScope+" ORDER BY number",
+		sql.Named("destination", location), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// AddLocation регистрирует пункт выдачи или склад
+func (s ParcelService) AddLocation(ctx context.Context, kind, name, address string) (Location, error) {
+	if err := requireStaff(ctx); err != nil {
+		return Location{}, err
+	}
+	if kind != LocationPickupPoint && kind != LocationWarehouse && kind != LocationSortingCenter {
+		return Location{}, ValidationError{Field: "kind", Message: fmt.Sprintf("unknown location kind %q", kind)}
+	}
+	if strings.TrimSpace(name) == "" {
+		return Location{}, ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if err := validateAddress(address); err != nil {
+		return Location{}, err
+	}
+
+	l := Location{Kind: kind, Name: name, Address: address}
+	id, err := s.store.WithContext(ctx).AddLocation(l)
+	if err != nil {
+		return Location{}, err
+	}
+	l.ID = id
+	return l, nil
+}
+
+// GetLocation возвращает место или ErrLocationNotFound
+func (s ParcelService) GetLocation(ctx context.Context, id int) (Location, error) {
+	l, err := s.store.WithContext(ctx).GetLocation(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Location{}, fmt.Errorf("%w: %d", ErrLocationNotFound, id)
+	}
+	return l, err
+}
+
+// SetLocations задаёт место отправления и место назначения зарегистрированной посылки.
+// Нулевой идентификатор означает, что место не задано
+func (s ParcelService) SetLocations(ctx context.Context, number int64, origin, destination int) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	if err := s.checkRegistered(ctx, number); err != nil {
+		return err
+	}
+	for _, id := range []int{origin, destination} {
+		if id == 0 {
+			continue
+		}
+		if _, err := s.GetLocation(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	return s.store.WithContext(ctx).SetLocations(number, origin, destination)
+}
+
+// GetByDestinationPoint возвращает посылки, направленные в пункт выдачи или на склад
+func (s ParcelService) GetByDestinationPoint(ctx context.Context, location int) ([]Parcel, error) {
+	if err := requireStaff(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := s.GetLocation(ctx, location); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetByDestinationPoint(location)
+}
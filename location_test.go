@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLocations проверяет привязку посылок к складу и пункту выдачи
+func TestLocations(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	warehouse, err := service.AddLocation(ctx, LocationWarehouse, "Склад", "Псков, ул. Складская, д. 1")
+	require.NoError(t, err)
+	point, err := service.AddLocation(ctx, LocationPickupPoint, "ПВЗ на Садовой", "Псков, ул. Садовая, д. 10")
+	require.NoError(t, err)
+
+	p, err := service.Register(ctx, 1, "Псков, ул. Садовая, д. 12")
+	require.NoError(t, err)
+	_, err = service.Register(ctx, 2, "Псков, ул. Лесная, д. 2")
+	require.NoError(t, err)
+
+	// set
+	require.NoError(t, service.SetLocations(ctx, p.Number, warehouse.ID, point.ID))
+
+	// check
+	stored, err := store.Get(p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, warehouse.ID, stored.Origin)
+	assert.Equal(t, point.ID, stored.Destination)
+
+	parcels, err := service.GetByDestinationPoint(ctx, point.ID)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, p.Number, parcels[0].Number)
+
+	// ошибки
+	assert.ErrorIs(t, service.SetLocations(ctx, p.Number, 0, point.ID+10), ErrLocationNotFound)
+	_, err = service.GetByDestinationPoint(ctx, point.ID+10)
+	assert.ErrorIs(t, err, ErrLocationNotFound)
+	_, err = service.AddLocation(ctx, "shop", "Магазин", "Псков")
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	assert.ErrorIs(t, service.SetLocations(ctx, p.Number, 0, 0), ErrParcelLocked)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Форматы журнала, см. Config.LogFormat
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// NewLogger создаёт журнал с уровнем и форматом из cfg, который пишет в w
+func NewLogger(cfg Config, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.LogLevel}
+	if cfg.LogFormat == LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// WithLogger возвращает копию хранилища, которая записывает в logger
+// каждую операцию с посылками на уровне debug, а неудачную - на уровне warn
+func (s ParcelStore) WithLogger(logger *slog.Logger) ParcelStore {
+	s.logger = logger
+	return s
+}
+
+// logOp записывает в журнал хранилища операцию op, начатую в start.
+// Вызывается через defer, поэтому ошибка передаётся указателем на результат метода
+func (s ParcelStore) logOp(op string, start time.Time, err *error, attrs ...slog.Attr) {
+	logOperation(s.context(), s.logger, slog.LevelDebug, "store."+op, start, *err, attrs...)
+}
+
+// WithLogger возвращает копию сервиса, которая записывает в logger
+// каждую операцию с посылками на уровне info, а неудачную - на уровне warn
+func (s ParcelService) WithLogger(logger *slog.Logger) ParcelService {
+	s.logger = logger
+	return s
+}
+
+// logOp записывает в журнал сервиса операцию op, начатую в start, см. ParcelStore.logOp
+func (s ParcelService) logOp(ctx context.Context, op string, start time.Time, err *error, attrs ...slog.Attr) {
+	logOperation(ctx, s.logger, slog.LevelInfo, "service."+op, start, *err, attrs...)
+}
+
+// logInternalError записывает на уровне error внутреннюю ошибку err вызова API api,
+// текст которой не отдаётся клиенту. Без журнала сервиса ошибка записывается
+// в slog.Default, чтобы не потеряться
+func logInternalError(ctx context.Context, logger *slog.Logger, api string, err error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.LogAttrs(ctx, slog.LevelError, "internal error", slog.String("api", api), slog.String("error", err.Error()))
+}
+
+// logOperation записывает операцию с её длительностью и ошибкой. Без журнала ничего не делает
+func logOperation(ctx context.Context, logger *slog.Logger, level slog.Level, op string, start time.Time, err error, attrs ...slog.Attr) {
+	if logger == nil {
+		return
+	}
+	attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	logger.LogAttrs(ctx, level, op, attrs...)
+}
+
+// openSQL открывает пул соединений драйвера cfg.Driver, в котором для каждого
+// выполненного запроса создаётся спан, см. startDBSpan. При уровне журнала debug
+// запросы к тому же записываются в slog.Default(), см. sqlConn
+func openSQL(cfg Config, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(cfg.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+	c := sqlConnector{driver: drv, dsn: dsn}
+	if cfg.LogLevel <= slog.LevelDebug {
+		c.logger = slog.Default()
+	}
+	return sql.OpenDB(c), nil
+}
+
+// sqlConnector создаёт соединения драйвера, которые трассируют запросы
+// и, если задан logger, записывают их в журнал
+type sqlConnector struct {
+	driver driver.Driver
+	dsn    string
+	logger *slog.Logger
+}
+
+func (c sqlConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sqlConn{Conn: conn, logger: c.logger}, nil
+}
+
+func (c sqlConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// sqlConn создаёт спаны запросов, выполненных через ExecContext и QueryContext,
+// с числом затронутых или прочитанных строк, сообщает о медленных запросах,
+// см. WithSlowQueryThreshold, и записывает эти запросы на уровне debug
+// с длительностью и параметрами. Строковые параметры в журнале скрываются:
+// в них адреса, телефоны и токены. Подготовленные запросы не трассируются
+// и не записываются, database/sql готовит их, только если драйвер
+// не выполняет запросы напрямую
+type sqlConn struct {
+	driver.Conn
+	logger *slog.Logger // nil - запросы не записываются
+}
+
+// Unwrap возвращает соединение драйвера, например для online backup
+func (c sqlConn) Unwrap() driver.Conn {
+	return c.Conn
+}
+
+func (c sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	op := storeOperation(ctx)
+	ctx, span := startDBSpan(ctx, "exec", op, query)
+	start := time.Now()
+	res, err := execer.ExecContext(ctx, query, args)
+	c.log(ctx, query, args, start, err)
+	reportSlowQuery(ctx, op, query, start)
+	if err == nil {
+		if n, err := res.RowsAffected(); err == nil {
+			span.SetAttributes(attrRowsAffected.Int64(n))
+		}
+	}
+	endSpan(span, err)
+	return res, err
+}
+
+func (c sqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	op := storeOperation(ctx)
+	ctx, span := startDBSpan(ctx, "query", op, query)
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.log(ctx, query, args, start, err)
+	if err != nil {
+		reportSlowQuery(ctx, op, query, start)
+		endSpan(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, end: func(n int64, err error) {
+		reportSlowQuery(ctx, op, query, start)
+		span.SetAttributes(attrRowsReturned.Int64(n))
+		endSpan(span, err)
+	}}, nil
+}
+
+func (c sqlConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c sqlConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c sqlConn) log(ctx context.Context, query string, args []driver.NamedValue, start time.Time, err error) {
+	if c.logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("query", strings.Join(strings.Fields(query), " ")),
+		slog.String("args", redactArgs(args)),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "sql", attrs...)
+}
+
+// redactArgs перечисляет параметры запроса, заменяя строки и байты на ***
+func redactArgs(args []driver.NamedValue) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		name := arg.Name
+		if name == "" {
+			name = fmt.Sprint(arg.Ordinal)
+		}
+		value := arg.Value
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				value = "***"
+			}
+		case []byte:
+			value = "***"
+		}
+		parts[i] = fmt.Sprintf("%s=%v", name, value)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Yandex-Practicum/go-db-sql-final/trackerpb"
+)
+
+// logEntries разбирает записи журнала в формате JSON
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var res []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		res = append(res, entry)
+	}
+	return res
+}
+
+// TestOperationLogging проверяет записи об операциях хранилища и сервиса
+func TestOperationLogging(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.LogLevel = slog.LevelDebug
+	cfg.LogFormat = LogFormatJSON
+	logger := NewLogger(cfg, &buf)
+
+	_, store := newTestService(t)
+	store = store.WithLogger(logger)
+	service := NewParcelService(store).WithLogger(logger)
+	ctx := context.Background()
+
+	// add
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	require.Error(t, service.NextStatus(ctx, p.Number+100))
+
+	// check
+	byMsg := map[string]map[string]any{}
+	for _, entry := range logEntries(t, &buf) {
+		byMsg[entry["msg"].(string)] = entry
+	}
+	register := byMsg["service.register"]
+	require.NotNil(t, register)
+	assert.Equal(t, "INFO", register["level"])
+	assert.EqualValues(t, 7, register["client"])
+	assert.Contains(t, register, "duration")
+	assert.NotContains(t, register, "error")
+
+	add := byMsg["store.add"]
+	require.NotNil(t, add)
+	assert.Equal(t, "DEBUG", add["level"])
+	assert.EqualValues(t, 7, add["client"])
+
+	next := byMsg["service.next_status"]
+	require.NotNil(t, next)
+	assert.Equal(t, "WARN", next["level"])
+	assert.EqualValues(t, p.Number+100, next["number"])
+	assert.Contains(t, next["error"], ErrParcelNotFound.Error())
+}
+
+// TestSQLLogging проверяет журнал SQL-запросов при уровне debug
+func TestSQLLogging(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	cfg := DefaultConfig()
+	cfg.DSN = filepath.Join(t.TempDir(), "logged.db")
+	cfg.LogLevel = slog.LevelDebug
+	db, err := Open(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// add
+	_, err = db.Exec("CREATE TABLE t (client integer, address text)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO t (client, address) VALUES (:client, :address)", sql.Named("client", 7), sql.Named("address", "Псков"))
+	require.NoError(t, err)
+
+	// check
+	out := buf.String()
+	assert.Contains(t, out, "INSERT INTO t (client, address) VALUES (:client, :address)")
+	assert.Contains(t, out, "client=7 address=***")
+	assert.NotContains(t, out, "Псков")
+
+	// обёртка соединения не мешает online backup
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+	var backup bytes.Buffer
+	require.NoError(t, store.Backup(context.Background(), &backup))
+	assert.NotZero(t, backup.Len())
+
+	// на уровне info запросы не записываются
+	buf.Reset()
+	cfg.DSN = filepath.Join(t.TempDir(), "quiet.db")
+	cfg.LogLevel = slog.LevelInfo
+	quiet, err := Open(cfg)
+	require.NoError(t, err)
+	defer quiet.Close()
+	_, err = quiet.Exec("CREATE TABLE t (client integer)")
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
+
+// TestInternalErrorLogging проверяет, что внутренние ошибки REST API и gRPC
+// записываются в журнал сервиса, а персональные данные в него не попадают
+func TestInternalErrorLogging(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.LogFormat = LogFormatJSON
+	_, store := newTestService(t)
+	service := NewParcelService(store).WithLogger(NewLogger(cfg, &buf))
+	handler := NewAPIHandler(service)
+	client := newTestGRPCClient(t, service)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	require.NoError(t, service.MarkDelivered(ctx, p.Number, DeliveryProof{RecipientName: "Иван Петров"}))
+	assert.NotContains(t, buf.String(), "Иван")
+
+	// add
+	// ошибка БД - внутренняя ошибка
+	require.NoError(t, store.db.Close())
+	res := apiCall(t, handler, http.MethodGet, fmt.Sprintf("/parcels/%d", p.Number), "")
+	require.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.NotContains(t, res.Body.String(), "sql")
+	_, err = client.GetParcel(ctx, &trackerpb.GetParcelRequest{Number: p.Number})
+	require.Equal(t, codes.Internal, status.Code(err))
+
+	// check
+	apis := map[string]bool{}
+	for _, entry := range logEntries(t, &buf) {
+		if entry["msg"] == "internal error" {
+			assert.Equal(t, "ERROR", entry["level"])
+			assert.Contains(t, entry["error"], "closed")
+			apis[entry["api"].(string)] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{"rest": true, "grpc": true}, apis)
+}
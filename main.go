@@ -1,179 +1,183 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
-	"time"
-
-	_ "modernc.org/sqlite"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 const (
-	ParcelStatusRegistered = "registered"
-	ParcelStatusSent       = "sent"
-	ParcelStatusDelivered  = "delivered"
+	ParcelStatusRegistered      = "registered"
+	ParcelStatusSent            = "sent"
+	ParcelStatusDelivered       = "delivered"
+	ParcelStatusCancelled       = "cancelled"
+	ParcelStatusReturnRequested = "return_requested"
+	ParcelStatusReturning       = "returning"
+	ParcelStatusReturned        = "returned"
+	ParcelStatusExpired         = "expired"
+	ParcelStatusReturnToSender  = "return_to_sender"
 )
 
 type Parcel struct {
-	Number    int
-	Client    int
-	Status    string
-	Address   string
-	CreatedAt string
-}
-
-type ParcelService struct {
-	store ParcelStore
-}
-
-func NewParcelService(store ParcelStore) ParcelService {
-	return ParcelService{store: store}
+	Number       int64
+	Tracking     string // код отслеживания для клиентов, см. newTrackingNumber
+	Client       int64  // клиент-отправитель
+	Status       string
+	Address      string // адрес получателя
+	CreatedAt    string
+	CancelReason string
+	ReturnOf     int64  // номер исходной посылки, если это обратная доставка, иначе 0
+	Deadline     string // обещанный срок доставки в RFC3339, пусто - срок не задан
+	ETA          string // расчётная дата доставки в RFC3339, см. ETACalculator
+	Courier      int    // идентификатор назначенного курьера, 0 - не назначен
+	Origin       int    // склад или пункт отправления, 0 - не задан
+	Destination  int    // пункт выдачи или склад назначения, 0 - доставка на адрес
+	Dimensions          // вес и габариты, нули - ещё не измерены
+	Charges             // объявленная ценность, стоимость доставки и наложенный платёж
+	Priority     string // PriorityNormal, PriorityExpress или PriorityUrgent
+	Recipient    Recipient
+	Parent       int64 // номер консолидированной отправки, в которую входит посылка, иначе 0
 }
 
-func (s ParcelService) Register(client int, address string) (Parcel, error) {
-	parcel := Parcel{
-		Client:    client,
-		Status:    ParcelStatusRegistered,
-		Address:   address,
-		CreatedAt: time.Now().UTC().Format(time.RFC3339),
-	}
-
-	id, err := s.store.Add(parcel)
-	if err != nil {
-		return parcel, err
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
-
-	parcel.Number = id
-
-	fmt.Printf("Новая посылка № %d на адрес %s от клиента с идентификатором %d зарегистрирована %s\n",
-		parcel.Number, parcel.Address, parcel.Client, parcel.CreatedAt)
-
-	return parcel, nil
 }
 
-func (s ParcelService) PrintClientParcels(client int) error {
-	parcels, err := s.store.GetByClient(client)
+// run настраивает подключение к БД и выполняет команду CLI из args
+func run(args []string) error {
+	ctx := context.Background()
+
+	cfg, err := LoadConfig()
 	if err != nil {
 		return err
 	}
-
-	fmt.Printf("Посылки клиента %d:\n", client)
-	for _, parcel := range parcels {
-		fmt.Printf("Посылка № %d на адрес %s от клиента с идентификатором %d зарегистрирована %s, статус %s\n",
-			parcel.Number, parcel.Address, parcel.Client, parcel.CreatedAt, parcel.Status)
-	}
-	fmt.Println()
-
-	return nil
-}
-
-func (s ParcelService) NextStatus(number int) error {
-	parcel, err := s.store.Get(number)
+	// журнал по умолчанию нужен до открытия БД: в него пишутся SQL-запросы, см. openSQL
+	logger := NewLogger(cfg, os.Stderr)
+	slog.SetDefault(logger)
+	shutdownTelemetry, err := SetupTelemetry(ctx, cfg)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err := shutdownTelemetry(ctx); err != nil {
+			slog.Error("отправка трассировок и метрик", "error", err)
+		}
+	}()
 
-	var nextStatus string
-	switch parcel.Status {
-	case ParcelStatusRegistered:
-		nextStatus = ParcelStatusSent
-	case ParcelStatusSent:
-		nextStatus = ParcelStatusDelivered
-	case ParcelStatusDelivered:
-		return nil
-	}
-
-	fmt.Printf("У посылки № %d новый статус: %s\n", number, nextStatus)
-
-	return s.store.SetStatus(number, nextStatus)
-}
-
-func (s ParcelService) ChangeAddress(number int, address string) error {
-	return s.store.SetAddress(number, address)
-}
-
-func (s ParcelService) Delete(number int) error {
-	return s.store.Delete(number)
-}
-
-func main() {
-	// настройте подключение к БД
-
-	db, err := sql.Open("sqlite", "tracker.db")
+	db, err := Open(cfg)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 	defer db.Close()
 
-	store := NewParcelStore(db)
-	service := NewParcelService(store)
-
-	// регистрация посылки
-	client := 1
-	address := "Псков, д. Пушкина, ул. Колотушкина, д. 5"
-	p, err := service.Register(client, address)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	// изменение адреса
-	newAddress := "Саратов, д. Верхние Зори, ул. Козлова, д. 25"
-	err = service.ChangeAddress(p.Number, newAddress)
+	replicas, err := OpenReplicas(cfg)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
+	defer closeAll(replicas)
 
-	// изменение статуса
-	err = service.NextStatus(p.Number)
+	store, err := NewParcelStore(db, replicas...)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
-
-	// вывод посылок клиента
-	err = service.PrintClientParcels(client)
+	// до начала работы прогреваем БД и отключаем отстающие реплики
+	store, err = store.Warmup(ctx, cfg.MaxReplicaLag)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
-
-	// попытка удаления отправленной посылки
-	err = service.Delete(p.Number)
-	if err != nil {
-		fmt.Println(err)
-		return
+	if len(cfg.EncryptionKeys) > 0 {
+		fields, err := NewFieldCipher(cfg.EncryptionKeys)
+		if err != nil {
+			return err
+		}
+		store = store.WithEncryption(fields)
 	}
-
-	// вывод посылок клиента
-	// предыдущая посылка не должна удалиться, т.к. её статус НЕ «зарегистрирована»
-	err = service.PrintClientParcels(client)
-	if err != nil {
-		fmt.Println(err)
-		return
+	store = store.WithLogger(logger).WithSlowQueryThreshold(cfg.SlowQuery)
+	service := NewParcelService(store).WithLogger(logger).WithDimensionLimits(DimensionLimits{MaxWeightKg: cfg.MaxWeightKg, MaxSideCm: cfg.MaxSideCm})
+	service = service.WithMaxAttempts(cfg.MaxAttempts)
+	if cfg.CursorKey != "" {
+		service = service.WithCursorKey([]byte(cfg.CursorKey))
 	}
 
-	// регистрация новой посылки
-	p, err = service.Register(client, address)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
+	// события ставятся в очередь вебхуков любой командой, отправляет их serve
+	NewWebhookDispatcher(store, cfg.WebhookAttempts).Subscribe(func(err error) {
+		slog.Error("очередь вебхуков", "error", err)
+	})
 
-	// удаление новой посылки
-	err = service.Delete(p.Number)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
+	cmd := newRootCmd(cfg, store, service)
+	cmd.SetArgs(args)
+	return cmd.ExecuteContext(ctx)
+}
 
-	// вывод посылок клиента
-	// здесь не должно быть последней посылки, т.к. она должна была успешно удалиться
-	err = service.PrintClientParcels(client)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
+// serve запускает фоновые задачи и настроенные серверы и ждёт сигнала остановки.
+// Если один сервер завершился с ошибкой, останавливаются и остальные
+func serve(ctx context.Context, cfg Config, store ParcelStore, service ParcelService) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Maintenance > 0 {
+		go store.RunMaintenance(ctx, cfg.Maintenance, func(err error) {
+			slog.Error("обслуживание БД", "error", err)
+		})
+	}
+
+	if cfg.ProbeInterval > 0 {
+		go service.RunProbe(ctx, cfg.ProbeInterval, func(res ProbeResult) {
+			if !res.OK {
+				slog.Error("синтетическая проверка", "step", res.Step, "error", res.Err)
+			}
+		})
+	}
+
+	if cfg.ExpireAfter > 0 {
+		go store.AllTenants().RunExpiry(ctx, cfg.ExpiryInterval, cfg.ExpireAfter, func(err error) {
+			slog.Error("истечение посылок", "error", err)
+		})
+	}
+
+	if cfg.WebhookInterval > 0 {
+		go NewWebhookDispatcher(store.AllTenants(), cfg.WebhookAttempts).Run(ctx, cfg.WebhookInterval, func(err error) {
+			slog.Error("отправка вебхуков", "error", err)
+		})
+	}
+
+	var wg sync.WaitGroup
+	run := func(name, addr string, fn func(context.Context, string) error) {
+		if addr == "" {
+			return
+		}
+		slog.Info(name+" слушает", "addr", addr)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(ctx, addr); err != nil {
+				slog.Error(name, "error", err)
+				stop()
+			}
+		}()
+	}
+	run("REST API", cfg.HTTPAddr, func(ctx context.Context, addr string) error {
+		h := NewAPIHandler(service).
+			WithAdminToken(cfg.AdminToken).
+			WithRateLimits(cfg.RateIP, cfg.RateClient)
+		if cfg.AuthRequired {
+			h = h.WithAuth(NewAuthenticator(store, cfg.JWTSecret))
+		}
+		if cfg.AdminDebug {
+			publishDBStats("tracker_db", store.db)
+			h = h.WithDiagnostics()
+		}
+		return RunAPI(ctx, addr, h)
+	})
+	run("gRPC", cfg.GRPCAddr, func(ctx context.Context, addr string) error {
+		return RunGRPC(ctx, addr, service, NewAuthenticator(store, cfg.JWTSecret), cfg.AuthRequired)
+	})
+	wg.Wait()
 }
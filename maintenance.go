@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// maintenanceQueries выполняются при обслуживании БД по порядку:
+// обновление статистики планировщика, сжатие файла и усечение журнала WAL
+var maintenanceQueries = []string{
+	"ANALYZE",
+	"VACUUM",
+	"PRAGMA wal_checkpoint(TRUNCATE)",
+}
+
+// Maintain выполняет обслуживание основной БД. Метод можно вызывать вручную,
+// RunMaintenance вызывает его по расписанию
+func (s ParcelStore) Maintain(ctx context.Context) error {
+	for _, q := range maintenanceQueries {
+		if _, err := s.db.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunMaintenance вызывает Maintain каждые interval до отмены ctx.
+// Ошибки не прерывают расписание и передаются в onError, если он задан
+func (s ParcelStore) RunMaintenance(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Maintain(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMaintain проверяет ручной запуск обслуживания БД
+func TestMaintain(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "maintain.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Maintain(context.Background()))
+}
+
+// TestRunMaintenance проверяет, что обслуживание выполняется по расписанию
+// и ошибки передаются в onError
+func TestRunMaintenance(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "maintain.db"))
+	require.NoError(t, err)
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+	// на закрытой БД каждое обслуживание завершается ошибкой
+	require.NoError(t, db.Close())
+
+	var failures atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		store.RunMaintenance(ctx, time.Millisecond, func(error) { failures.Add(1) })
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return failures.Load() >= 2 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxNoteLength - максимальная длина текста заметки в символах
+const MaxNoteLength = 1024
+
+// Note - произвольная заметка оператора или курьера к посылке,
+// например код домофона
+type Note struct {
+	ID        int
+	Author    string
+	Text      string
+	CreatedAt string
+}
+
+// AddNote добавляет заметку к посылке и возвращает её идентификатор
+func (s ParcelStore) AddNote(number int64, n Note) (int, error) {
+	res, err := s.db.ExecContext(s.context(), "INSERT INTO parcel_notes (number, author, text, created_at, tenant_id) VALUES (:number, :author, :text, :created_at, "+parcelTenant+")",
+		sql.Named("number", number),
+		sql.Named("author", n.Author),
+		sql.Named("text", n.Text),
+		sql.Named("created_at", n.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// ListNotes возвращает заметки посылки в порядке добавления
+func (s ParcelStore) ListNotes(number int64) ([]Note, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT id, author, text, created_at FROM parcel_notes WHERE number = :number AND "+tenantScope+" ORDER BY id",
+		sql.Named("number", number), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Note{}
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.ID, &n.Author, &n.Text, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, rows.Err()
+}
+
+// AddNote добавляет заметку к посылке в любом статусе
+func (s ParcelService) AddNote(ctx context.Context, number int64, author, text string) (Note, error) {
+	if strings.TrimSpace(author) == "" {
+		return Note{}, ValidationError{Field: "author", Message: "must not be empty"}
+	}
+	if strings.TrimSpace(text) == "" {
+		return Note{}, ValidationError{Field: "text", Message: "must not be empty"}
+	}
+	if utf8.RuneCountInString(text) > MaxNoteLength {
+		return Note{}, ValidationError{Field: "text", Message: "is too long"}
+	}
+	if _, err := s.Get(ctx, number); err != nil {
+		return Note{}, err
+	}
+
+	n := Note{
+		Author:    author,
+		Text:      text,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	id, err := s.store.WithContext(ctx).AddNote(number, n)
+	if err != nil {
+		return Note{}, err
+	}
+	n.ID = id
+	return n, nil
+}
+
+// ListNotes возвращает заметки к посылке
+func (s ParcelService) ListNotes(ctx context.Context, number int64) ([]Note, error) {
+	if _, err := s.Get(ctx, number); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).ListNotes(number)
+}
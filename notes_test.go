@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNotes проверяет добавление заметок и их удаление вместе с посылкой
+func TestNotes(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+
+	// add
+	gate, err := service.AddNote(ctx, p.Number, "operator-1", "код домофона 1234")
+	require.NoError(t, err)
+	require.NotZero(t, gate.ID)
+	// заметку можно оставить и после отправки
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	absent, err := service.AddNote(ctx, p.Number, "courier-7", "получатель не отвечает")
+	require.NoError(t, err)
+
+	// check
+	notes, err := service.ListNotes(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, []Note{gate, absent}, notes)
+
+	// validation
+	_, err = service.AddNote(ctx, p.Number, "", "текст")
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.AddNote(ctx, p.Number, "operator-1", " ")
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.AddNote(ctx, p.Number, "operator-1", strings.Repeat("я", MaxNoteLength+1))
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.AddNote(ctx, p.Number+1000, "operator-1", "текст")
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+
+	// delete
+	p, err = service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	_, err = service.AddNote(ctx, p.Number, "operator-1", "текст")
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(ctx, p.Number))
+	notes, err = store.ListNotes(p.Number)
+	require.NoError(t, err)
+	assert.Empty(t, notes)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// openAPISpec - спецификация OpenAPI 3 для REST API, её отдаёт APIHandler на /openapi.yaml
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// loadOpenAPI разбирает и проверяет openAPISpec
+func loadOpenAPI() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// serveOpenAPI отдаёт openAPISpec
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
+
+// openAPIValidator проверяет запросы к next по спецификации и отвечает 400
+// тем же телом apiError, что и проверки ParcelService. Запросы к путям и методам
+// вне спецификации, а также с некорректным номером в пути, next обрабатывает сам
+type openAPIValidator struct {
+	router routers.Router
+	next   http.Handler
+}
+
+func newOpenAPIValidator(doc *openapi3.T, next http.Handler) (openAPIValidator, error) {
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return openAPIValidator{}, err
+	}
+	return openAPIValidator{router: router, next: next}, nil
+}
+
+func (v openAPIValidator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, params, err := v.router.FindRoute(r)
+	if err != nil {
+		v.next.ServeHTTP(w, r)
+		return
+	}
+	// по шаблону пути спаны разных посылок попадают в одну операцию
+	span := trace.SpanFromContext(r.Context())
+	span.SetName(r.Method + " " + route.Path)
+	span.SetAttributes(semconv.HTTPRoute(route.Path))
+
+	// тело без Content-Type, как и раньше, считается JSON
+	if r.ContentLength != 0 && r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIBody)
+
+	err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: params,
+		Route:      route,
+		// токен администратора проверяет сам обработчик, см. WithAdminToken
+		Options: &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	})
+	var reqErr *openapi3filter.RequestError
+	switch {
+	case err == nil:
+		v.next.ServeHTTP(w, r)
+	case errors.As(err, &reqErr) && reqErr.Parameter != nil && reqErr.Parameter.In == openapi3.ParameterInPath:
+		v.next.ServeHTTP(w, r)
+	default:
+		writeAPIError(w, openAPIError(err))
+	}
+}
+
+// openAPIError переводит ошибку проверки запроса в ValidationError
+func openAPIError(err error) ValidationError {
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return ValidationError{Field: "request", Message: err.Error()}
+	}
+
+	field, message := "body", reqErr.Reason
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		message = schemaErr.Reason
+		if path := schemaErr.JSONPointer(); len(path) > 0 {
+			field = strings.Join(path, ".")
+		}
+	} else if reqErr.Err != nil {
+		message = reqErr.Err.Error()
+	}
+	if reqErr.Parameter != nil {
+		field = reqErr.Parameter.Name
+	}
+	return ValidationError{Field: field, Message: message}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenAPISpec проверяет, что спецификация корректна и знает все статусы
+func TestOpenAPISpec(t *testing.T) {
+	doc, err := loadOpenAPI()
+	require.NoError(t, err)
+
+	var want []string
+	for status := range parcelTransitions {
+		want = append(want, status)
+	}
+	var got []string
+	for _, v := range doc.Components.Schemas["Status"].Value.Enum {
+		got = append(got, v.(string))
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	assert.Equal(t, want, got)
+
+	service, _ := newTestService(t)
+	handler := NewAPIHandler(service)
+	rec := apiCall(t, handler, http.MethodGet, "/openapi.yaml", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, openAPISpec, rec.Body.Bytes())
+}
+
+// TestOpenAPIValidation проверяет отклонение запросов, не подходящих под спецификацию
+func TestOpenAPIValidation(t *testing.T) {
+	service, _ := newTestService(t)
+	handler := NewAPIHandler(service)
+
+	tests := []struct {
+		method, target, body string
+		field                string
+	}{
+		{http.MethodPost, "/parcels", `{"address": "Псков"}`, "client"},
+		{http.MethodPost, "/parcels", `{"client": 1, "address": "Псков", "extra": 1}`, "body"},
+		{http.MethodPost, "/parcels", `{"client": "1", "address": "Псков"}`, "client"},
+		{http.MethodPost, "/parcels", `{"client": 1, "address": ""}`, "address"},
+		{http.MethodPost, "/parcels", `{"client": 1`, "body"},
+		{http.MethodPatch, "/parcels/1/status", `{"status": "lost"}`, "status"},
+		{http.MethodGet, "/clients/0/parcels", "", "client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target+" "+tt.body, func(t *testing.T) {
+			rec := apiCall(t, handler, tt.method, tt.target, tt.body)
+			require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+			var body apiError
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, tt.field, body.Field)
+			assert.Contains(t, body.Error, ErrInvalidParcel.Error())
+		})
+	}
+}
+
+// TestOpenAPIResponses проверяет, что ответы API соответствуют спецификации
+func TestOpenAPIResponses(t *testing.T) {
+	service, _ := newTestService(t)
+	handler := NewAPIHandler(service)
+	doc, err := loadOpenAPI()
+	require.NoError(t, err)
+	router, err := legacy.NewRouter(doc)
+	require.NoError(t, err)
+
+	check := func(method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rec := apiCall(t, handler, method, target, body)
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		route, params, err := router.FindRoute(req)
+		require.NoError(t, err)
+		err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: &openapi3filter.RequestValidationInput{Request: req, PathParams: params, Route: route},
+			Status:                 rec.Code,
+			Header:                 rec.Header(),
+			Body:                   io.NopCloser(strings.NewReader(rec.Body.String())),
+		})
+		require.NoError(t, err, rec.Body.String())
+		return rec
+	}
+
+	rec := check(http.MethodPost, "/parcels", `{"client": 1, "address": "Псков"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := rec.Header().Get("Location")
+
+	check(http.MethodGet, url+"?include=history,items,notes", "")
+	check(http.MethodPatch, url+"/address", `{"address": "Тверь"}`)
+	check(http.MethodPatch, url+"/status", `{"status": "delivered"}`)
+	check(http.MethodGet, "/clients/1/parcels", "")
+	check(http.MethodGet, "/parcels/1000", "")
+	var created apiParcel
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	check(http.MethodGet, "/track/"+created.Tracking, "")
+	check(http.MethodGet, "/healthz", "")
+	check(http.MethodGet, "/readyz", "")
+	check(http.MethodDelete, url, "")
+}
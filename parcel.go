@@ -1,24 +1,166 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// ErrCancelNotAllowed возвращается при попытке отменить посылку,
+// которая не находится в статусе registered
+var ErrCancelNotAllowed = errors.New("parcel can be cancelled only in registered status")
+
+// DefaultActor записывается в историю статусов, если исполнитель не задан через WithActor
+const DefaultActor = "system"
+
+// ParcelStore хранит посылки в SQLite.
+//
+// Методы, возвращающие список, при отсутствии подходящих записей возвращают
+// пустой срез, а не nil, и ошибку nil: в JSON такой результат записывается как [].
+// Методы, возвращающие одну запись, при её отсутствии возвращают sql.ErrNoRows,
+// ParcelService заменяет её на ErrParcelNotFound. При ошибке срез всегда nil.
+//
+// Списки посылок упорядочены по номеру по возрастанию, если в описании метода
+// не указан другой порядок, так что постраничный вывод не пропускает
+// и не повторяет строки
 type ParcelStore struct {
-	db *sql.DB
+	db       *sql.DB   // основная БД, в которую идут все изменения
+	replicas []*sql.DB // реплики только для чтения
+	actor    string    // кто выполняет изменения, см. WithActor
+	tenant   int64     // магазин, строки которого видит хранилище, 0 - все, см. AllTenants
+	ctx      context.Context
+	events   *observers
+	fields   *FieldCipher // шифрование персональных данных, см. WithEncryption
+	logger   *slog.Logger // журнал операций, см. WithLogger
+
+	slowQuery time.Duration // порог медленного запроса, см. WithSlowQueryThreshold
+	filter    string        // условие фильтра текущего запроса, см. withFilter
+
+	deviceTime time.Time // время изменения по часам устройства, см. WithDeviceTime
+}
+
+// NewParcelStore создаёт хранилище посылок и при необходимости
+// создаёт в основной БД таблицу parcel и её индексы.
+// Чтение выполняется из реплик по порядку, а если все они недоступны - из основной БД
+func NewParcelStore(db *sql.DB, replicas ...*sql.DB) (ParcelStore, error) {
+	if err := migrate(db); err != nil {
+		return ParcelStore{}, err
+	}
+	return ParcelStore{db: db, replicas: replicas, actor: DefaultActor, tenant: DefaultTenant, ctx: context.Background(), events: &observers{}}, nil
+}
+
+// WithActor возвращает копию хранилища, которая записывает actor
+// исполнителем всех изменений статуса
+func (s ParcelStore) WithActor(actor string) ParcelStore {
+	s.actor = actor
+	return s
+}
+
+// WithContext возвращает копию хранилища, запросы которой выполняются с ctx:
+// при отмене ctx запрос прерывается, а транзакция откатывается.
+// Если в ctx есть субъект запроса, см. WithPrincipal, он становится исполнителем изменений,
+// а магазин из WithTenant ограничивает запросы его строками
+func (s ParcelStore) WithContext(ctx context.Context) ParcelStore {
+	s.ctx = ctx
+	if p, ok := PrincipalFrom(ctx); ok {
+		s.actor = p.Actor()
+	}
+	if tenant, ok := TenantFrom(ctx); ok {
+		s.tenant = tenant
+	}
+	return s
+}
+
+// context возвращает контекст запросов хранилища
+func (s ParcelStore) context() context.Context {
+	if s.ctx == nil {
+		return s.withSlowQuery(context.Background())
+	}
+	return s.withSlowQuery(s.ctx)
+}
+
+// inTx выполняет fn в транзакции основной БД и фиксирует её, если fn не вернула ошибку
+func (s ParcelStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(s.context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func NewParcelStore(db *sql.DB) ParcelStore {
-	return ParcelStore{db: db}
+// readers возвращает подключения для чтения в порядке обращения к ним
+func (s ParcelStore) readers() []*sql.DB {
+	return append(s.replicas[:len(s.replicas):len(s.replicas)], s.db)
 }
 
-func (s ParcelStore) Add(p Parcel) (int, error) {
+func (s ParcelStore) Add(p Parcel) (_ int64, err error) {
+	s, span := s.startSpan("add")
+	defer func() { endSpan(span, err) }()
+	defer s.logOp("add", time.Now(), &err, slog.Int64("client", p.Client))
 	// реализуйте добавление строки в таблицу parcel, используйте данные из переменной p
-	res, err := s.db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (:client, :status, :address, :created_at)",
+	// начальный статус сразу попадает в историю статусов
+	if err := s.preAdd(p); err != nil {
+		return 0, err
+	}
+	sealed, err := s.sealParcel(p)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = s.inTx(func(tx *sql.Tx) (err error) {
+		id, err = s.insertParcel(tx, p, sealed)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.notify(ParcelEvent{Type: ParcelEventAdded, Number: id, Client: p.Client, Status: p.Status, Address: p.Address})
+	return id, nil
+}
+
+// insertParcel добавляет строку посылки p в транзакции tx вместе с начальным
+// статусом в истории и записью аудита. sealed - p с зашифрованными персональными данными
+func (s ParcelStore) insertParcel(tx *sql.Tx, p, sealed Parcel) (int64, error) {
+	res, err := tx.ExecContext(s.context(), "INSERT INTO parcel (tracking_number, client, status, address, created_at, return_of, deadline, zone, eta, origin_id, destination_id, weight_kg, length_cm, width_cm, height_cm, declared_value, delivery_price, cod_amount, priority, "+
+		"recipient_client, recipient_name, recipient_phone, recipient_phone_idx, parent_number, tenant_id) "+
+		"VALUES (:tracking, :client, :status, :address, :created_at, :return_of, :deadline, :zone, :eta, :origin, :destination, :weight, :length, :width, :height, "+
+		":declared_value, :delivery_price, :cod, :priority, :recipient_client, :recipient_name, :recipient_phone, :phone_idx, :parent, :tenant)",
+		sql.Named("tracking", p.Tracking),
 		sql.Named("client", p.Client),
 		sql.Named("status", p.Status),
-		sql.Named("address", p.Address),
-		sql.Named("created_at", p.CreatedAt))
+		sql.Named("address", sealed.Address),
+		sql.Named("created_at", p.CreatedAt),
+		sql.Named("return_of", p.ReturnOf),
+		sql.Named("deadline", p.Deadline),
+		sql.Named("zone", deliveryZone(p.Address)),
+		sql.Named("eta", p.ETA),
+		sql.Named("origin", p.Origin),
+		sql.Named("destination", p.Destination),
+		sql.Named("weight", p.WeightKg),
+		sql.Named("length", p.LengthCm),
+		sql.Named("width", p.WidthCm),
+		sql.Named("height", p.HeightCm),
+		sql.Named("declared_value", p.DeclaredValue),
+		sql.Named("delivery_price", p.DeliveryPrice),
+		sql.Named("cod", p.COD),
+		sql.Named("priority", p.Priority),
+		sql.Named("recipient_client", p.Recipient.Client),
+		sql.Named("recipient_name", sealed.Recipient.Name),
+		sql.Named("recipient_phone", sealed.Recipient.Phone),
+		sql.Named("phone_idx", s.fields.blindIndex(p.Recipient.Phone)),
+		sql.Named("parent", p.Parent),
+		s.tenantArg())
 	if err != nil {
 		return 0, err
 	}
@@ -27,28 +169,92 @@ func (s ParcelStore) Add(p Parcel) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return int(id), nil
+	if err := s.addStatusChange(tx, id, p.Status, ""); err != nil {
+		return 0, err
+	}
+	after, err := s.auditValues(tx, id, auditParcelColumns)
+	if err != nil {
+		return 0, err
+	}
+	return id, s.addAudit(tx, id, AuditAdd, nil, after)
 }
 
-func (s ParcelStore) Get(number int) (Parcel, error) {
-	// реализуйте чтение строки по заданному number
-	// здесь из таблицы должна вернуться только одна строка
-	// заполните объект Parcel данными из таблицы
+// parcelColumns перечисляет столбцы таблицы parcel в порядке полей, которые заполняет scanParcel
+const parcelColumns = "number, tracking_number, client, status, address, created_at, cancel_reason, return_of, deadline, eta, courier_id, origin_id, destination_id, weight_kg, length_cm, width_cm, height_cm, declared_value, delivery_price, cod_amount, priority, recipient_client, recipient_name, recipient_phone, parent_number"
+
+// rowScanner позволяет сканировать как *sql.Row, так и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanParcel заполняет Parcel из строки, выбранной с parcelColumns,
+// и расшифровывает персональные данные
+func (s ParcelStore) scanParcel(row rowScanner) (Parcel, error) {
 	p := Parcel{}
-	row := s.db.QueryRow("SELECT number, client, status, address, created_at FROM parcel WHERE number = :id",
-		sql.Named("id", number))
-	err := row.Scan(&p.Number, &p.Client, &p.Status, &p.Address, &p.CreatedAt)
+	err := row.Scan(&p.Number, &p.Tracking, &p.Client, &p.Status, &p.Address, &p.CreatedAt, &p.CancelReason, &p.ReturnOf, &p.Deadline, &p.ETA, &p.Courier, &p.Origin, &p.Destination, &p.WeightKg, &p.LengthCm, &p.WidthCm, &p.HeightCm, &p.DeclaredValue, &p.DeliveryPrice, &p.COD, &p.Priority,
+		&p.Recipient.Client, &p.Recipient.Name, &p.Recipient.Phone, &p.Parent)
 	if err != nil {
-		return Parcel{}, err
+		return p, err
 	}
-	return p, nil
+	return p, s.openParcel(&p)
 }
 
-func (s ParcelStore) GetByClient(client int) ([]Parcel, error) {
+// scanParcels читает все посылки из rows, выбранные по parcelColumns
+func (s ParcelStore) scanParcels(rows *sql.Rows) ([]Parcel, error) {
+	res := []Parcel{}
+	for rows.Next() {
+		p, err := s.scanParcel(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s ParcelStore) Get(number int64) (_ Parcel, err error) {
+	s, span := s.startSpan("get")
+	defer func() { endSpan(span, err) }()
+	defer s.logOp("get", time.Now(), &err, slog.Int64("number", number))
+	// реализуйте чтение строки по заданному number
+	// здесь из таблицы должна вернуться только одна строка
+	// реплика может отставать от основной БД, поэтому при любой ошибке,
+	// включая отсутствие строки, пробуем следующее подключение
+	for _, db := range s.readers() {
+		var p Parcel
+		p, err = s.scanParcel(db.QueryRowContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE number = :id AND "+tenantScope,
+			sql.Named("id", number), s.tenantArg()))
+		if err == nil {
+			return p, nil
+		}
+	}
+	return Parcel{}, err
+}
+
+func (s ParcelStore) GetByClient(client int64) (_ []Parcel, err error) {
+	s, span := s.startSpan("get_by_client")
+	defer func() { endSpan(span, err) }()
+	defer s.logOp("get_by_client", time.Now(), &err, slog.Int64("client", client))
 	// реализуйте чтение строк из таблицы parcel по заданному client
 	// здесь из таблицы может вернуться несколько строк
-	rows, err := s.db.Query("SELECT number, client, status, address, created_at FROM parcel WHERE client = :client",
-		sql.Named("client", client))
+	for _, db := range s.readers() {
+		var res []Parcel
+		res, err = s.getByClient(db, client)
+		if err == nil {
+			return res, nil
+		}
+	}
+	return nil, err
+}
+
+// getByClient читает посылки клиента из конкретного подключения
+func (s ParcelStore) getByClient(db *sql.DB, client int64) ([]Parcel, error) {
+	rows, err := db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE client = :client AND "+tenantScope+" ORDER BY number",
+		sql.Named("client", client), s.tenantArg())
 	if err != nil {
 		return nil, err
 	}
@@ -56,55 +262,272 @@ func (s ParcelStore) GetByClient(client int) ([]Parcel, error) {
 	defer rows.Close()
 
 	// заполните срез Parcel данными из таблицы
-	var res []Parcel
-	for rows.Next() {
-		p := Parcel{}
-		err := rows.Scan(&p.Number, &p.Client, &p.Status, &p.Address, &p.CreatedAt)
-		if err != nil {
-			return nil, err
+	return s.scanParcels(rows)
+}
+
+// GetStatuses возвращает статусы посылок по номерам, не читая остальные поля.
+// Номеров, для которых посылка не найдена, в результате нет
+func (s ParcelStore) GetStatuses(numbers []int64) (map[int64]string, error) {
+	var err error
+	for _, db := range s.readers() {
+		var res map[int64]string
+		res, err = getStatuses(s.context(), db, numbers, s.tenantArg())
+		if err == nil {
+			return res, nil
 		}
-		res = append(res, p)
 	}
-	if err := rows.Err(); err != nil {
+	return nil, err
+}
+
+// namedList возвращает список параметров для IN (...) и их значения.
+// SQLite не умеет передавать список в один параметр, поэтому
+// для каждого значения добавляется свой именованный параметр
+func namedList(values []int64) (string, []any) {
+	names := make([]string, len(values))
+	args := make([]any, len(values))
+	for i, v := range values {
+		name := "n" + strconv.Itoa(i)
+		names[i] = ":" + name
+		args[i] = sql.Named(name, v)
+	}
+	return strings.Join(names, ", "), args
+}
+
+// getStatuses читает статусы посылок из конкретного подключения
+func getStatuses(ctx context.Context, db *sql.DB, numbers []int64, tenant sql.NamedArg) (map[int64]string, error) {
+	res := make(map[int64]string, len(numbers))
+	if len(numbers) == 0 {
+		return res, nil
+	}
+
+	in, args := namedList(numbers)
+	rows, err := db.QueryContext(ctx, "SELECT number, status FROM parcel WHERE number IN ("+in+") AND "+tenantScope, append(args, tenant)...)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return res, nil
+	for rows.Next() {
+		var (
+			number int64
+			status string
+		)
+		if err := rows.Scan(&number, &status); err != nil {
+			return nil, err
+		}
+		res[number] = status
+	}
+	return res, rows.Err()
+}
+
+func (s ParcelStore) SetStatus(number int64, status string) error {
+	return s.SetStatusFrom(number, "", status)
 }
 
-func (s ParcelStore) SetStatus(number int, status string) error {
+// SetStatusFrom переводит посылку в статус status, только если она всё ещё
+// в статусе from, иначе возвращает ErrForbiddenTransition. Так переход,
+// проверенный по прочитанной ранее посылке, не выполнится, если её статус
+// успели изменить. Пустой from - статус не проверяется
+func (s ParcelStore) SetStatusFrom(number int64, from, status string) (err error) {
+	s, span := s.startSpan("set_status")
+	defer func() { endSpan(span, err) }()
+	defer s.logOp("set_status", time.Now(), &err, slog.Int64("number", number), slog.String("status", status))
 	// реализуйте обновление статуса в таблице parcel
-	_, err := s.db.Exec("UPDATE parcel SET status = :status WHERE number = :number",
-		sql.Named("status", status),
-		sql.Named("number", number))
+	if err := s.preStatusChange(number, status); err != nil {
+		return err
+	}
+	var changed bool
+	err = s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(s.context(), "UPDATE parcel SET status = :status WHERE number = :number AND (:from = '' OR status = :from) AND "+tenantScope,
+			sql.Named("status", status),
+			sql.Named("number", number),
+			sql.Named("from", from),
+			s.tenantArg())
+		if err != nil {
+			return err
+		}
+		changed, err = s.recordStatusChange(tx, res, number, status)
+		if err == nil && !changed && from != "" {
+			return fmt.Errorf("%w: parcel %d is no longer %s", ErrForbiddenTransition, number, from)
+		}
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
+	if changed {
+		s.notify(ParcelEvent{Type: ParcelEventStatusChanged, Number: number, Status: status})
+	}
 	return nil
 }
 
-func (s ParcelStore) SetAddress(number int, address string) error {
+func (s ParcelStore) SetAddress(number int64, address string) (err error) {
+	s, span := s.startSpan("set_address")
+	defer func() { endSpan(span, err) }()
+	defer s.logOp("set_address", time.Now(), &err, slog.Int64("number", number))
 	// реализуйте обновление адреса в таблице parcel
 	// менять адрес можно только если значение статуса registered
-	_, err := s.db.Exec("UPDATE parcel SET address = :address WHERE number = :number AND status = :status",
-		sql.Named("address", address),
-		sql.Named("number", number),
-		sql.Named("status", ParcelStatusRegistered))
+	// зона доставки вычисляется из адреса и меняется вместе с ним,
+	// прежний адрес сохраняется в parcel_address_history
+	var changed bool
+	err = s.inTx(func(tx *sql.Tx) error {
+		var previous string
+		err := tx.QueryRowContext(s.context(), "SELECT address FROM parcel WHERE number = :number AND status = :status AND "+tenantScope,
+			sql.Named("number", number),
+			sql.Named("status", ParcelStatusRegistered),
+			s.tenantArg()).Scan(&previous)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		sealed, err := s.fields.encrypt("address", address)
+		if err != nil {
+			return err
+		}
+		err = s.audited(tx, number, AuditSetAddress, []string{"address", "zone"}, func() error {
+			_, err := tx.ExecContext(s.context(), "UPDATE parcel SET address = :address, zone = :zone WHERE number = :number AND "+tenantScope,
+				sql.Named("address", sealed),
+				sql.Named("zone", deliveryZone(address)),
+				sql.Named("number", number),
+				s.tenantArg())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		changed = true
+		return s.addAddressChange(tx, number, previous)
+	})
 	if err != nil {
 		return err
 	}
+	if changed {
+		s.notify(ParcelEvent{Type: ParcelEventAddressChanged, Number: number, Address: address})
+	}
 	return nil
 }
 
-func (s ParcelStore) Delete(number int) error {
+func (s ParcelStore) Delete(number int64) (err error) {
+	s, span := s.startSpan("delete")
+	defer func() { endSpan(span, err) }()
+	defer s.logOp("delete", time.Now(), &err, slog.Int64("number", number))
 	// реализуйте удаление строки из таблицы parcel
 	// удалять строку можно только если значение статуса registered
-	_, err := s.db.Exec("DELETE FROM parcel WHERE number = :number AND status  = :status",
-		sql.Named("number", number),
-		sql.Named("status", ParcelStatusRegistered))
+	// вместе с посылкой удаляются её история статусов и адресов, вложения, маршрут, заметки,
+	// теги и попытки вручения. Посылки удалённой консолидированной отправки становятся самостоятельными.
+	// Внешних ключей с каскадом нет намеренно: архивированные посылки
+	// уходят из parcel, а их вложения нужны для претензий
+	var deleted bool
+	err = s.inTx(func(tx *sql.Tx) error {
+		before, err := s.auditValues(tx, number, auditParcelColumns)
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(s.context(), "DELETE FROM parcel WHERE number = :number AND status  = :status AND "+tenantScope,
+			sql.Named("number", number),
+			sql.Named("status", ParcelStatusRegistered),
+			s.tenantArg())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+		deleted = true
+		if err := s.addAudit(tx, number, AuditDelete, before, nil); err != nil {
+			return err
+		}
+		for _, table := range []string{"parcel_status_history", "parcel_address_history", "parcel_items", "parcel_route", "parcel_notes", "parcel_tags", "parcel_delivery_attempts"} {
+			if _, err := tx.ExecContext(s.context(), "DELETE FROM "+table+" WHERE number = :number AND "+tenantScope,
+				sql.Named("number", number), s.tenantArg()); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(s.context(), "UPDATE parcel SET parent_number = 0 WHERE parent_number = :number AND "+tenantScope,
+			sql.Named("number", number), s.tenantArg())
+		return err
+	})
 	if err != nil {
 		return err
 	}
+
+	if deleted {
+		s.notify(ParcelEvent{Type: ParcelEventDeleted, Number: number})
+	}
 	return nil
 }
+
+func (s ParcelStore) Cancel(number int64, reason string) (err error) {
+	s, span := s.startSpan("cancel")
+	defer func() { endSpan(span, err) }()
+	defer s.logOp("cancel", time.Now(), &err, slog.Int64("number", number))
+	// отменить можно только посылку в статусе registered,
+	// запись при этом сохраняется для отчётности
+	if err := s.preStatusChange(number, ParcelStatusCancelled); err != nil {
+		return err
+	}
+	err = s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(s.context(), "UPDATE parcel SET status = :cancelled, cancel_reason = :reason WHERE number = :number AND status = :status AND "+tenantScope,
+			sql.Named("cancelled", ParcelStatusCancelled),
+			sql.Named("reason", reason),
+			sql.Named("number", number),
+			sql.Named("status", ParcelStatusRegistered),
+			s.tenantArg())
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrCancelNotAllowed
+		}
+		// у отмены своя запись в истории с причиной
+		return s.addStatusChange(tx, number, ParcelStatusCancelled, reason)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notify(ParcelEvent{Type: ParcelEventStatusChanged, Number: number, Status: ParcelStatusCancelled})
+	return nil
+}
+
+// HealthCheckResult описывает состояние хранилища для liveness/readiness проверок
+type HealthCheckResult struct {
+	Alive    bool          // соединение с БД установлено
+	Ready    bool          // таблица parcel доступна для запросов
+	Error    string        // текст первой возникшей ошибки
+	Duration time.Duration // время выполнения проверки
+}
+
+func (s ParcelStore) HealthCheck(ctx context.Context) HealthCheckResult {
+	// проверяем соединение и выполняем простой запрос к таблице parcel
+	start := time.Now()
+	res := HealthCheckResult{}
+
+	if err := s.db.PingContext(ctx); err != nil {
+		res.Error = err.Error()
+		res.Duration = time.Since(start)
+		return res
+	}
+	res.Alive = true
+
+	var one int
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM parcel LIMIT 1").Scan(&one)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		res.Error = err.Error()
+	} else {
+		res.Ready = true
+	}
+	res.Duration = time.Since(start)
+
+	return res
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"github.com/stretchr/testify/assert"
 	"math/rand"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -19,6 +21,17 @@ var (
 	randRange = rand.New(randSource)
 )
 
+// openTestDB подключается к БД, заданной переменными окружения (по умолчанию tracker.db)
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	db, err := Open(cfg)
+	require.NoError(t, err)
+	return db
+}
+
 // getTestParcel возвращает тестовую посылку
 func getTestParcel() Parcel {
 	return Parcel{
@@ -32,12 +45,12 @@ func getTestParcel() Parcel {
 // TestAddGetDelete проверяет добавление, получение и удаление посылки
 func TestAddGetDelete(t *testing.T) {
 	// prepare
-	// настраиваем подключение к tracker.db
-	db, err := sql.Open("sqlite", "tracker.db")
-	require.NoError(t, err)
+	// настраиваем подключение к БД из конфигурации
+	db := openTestDB(t)
 	defer db.Close()
 
-	store := NewParcelStore(db)
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
 	parcel := getTestParcel()
 
 	// add
@@ -68,12 +81,12 @@ func TestAddGetDelete(t *testing.T) {
 // TestSetAddress проверяет обновление адреса
 func TestSetAddress(t *testing.T) {
 	// prepare
-	// настраиваем подключение к tracker.db
-	db, err := sql.Open("sqlite", "tracker.db")
-	require.NoError(t, err)
+	// настраиваем подключение к БД из конфигурации
+	db := openTestDB(t)
 	defer db.Close()
 
-	store := NewParcelStore(db)
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
 	parcel := getTestParcel()
 
 	// add
@@ -99,12 +112,12 @@ func TestSetAddress(t *testing.T) {
 // TestSetStatus проверяет обновление статуса
 func TestSetStatus(t *testing.T) {
 	// prepare
-	// настраиваем подключение к tracker.db
-	db, err := sql.Open("sqlite", "tracker.db")
-	require.NoError(t, err)
+	// настраиваем подключение к БД из конфигурации
+	db := openTestDB(t)
 	defer db.Close()
 
-	store := NewParcelStore(db)
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
 	parcel := getTestParcel()
 
 	// add
@@ -130,22 +143,22 @@ func TestSetStatus(t *testing.T) {
 // TestGetByClient проверяет получение посылок по идентификатору клиента
 func TestGetByClient(t *testing.T) {
 	// prepare
-	// настраиваем подключение к tracker.db
-	db, err := sql.Open("sqlite", "tracker.db")
-	require.NoError(t, err)
+	// настраиваем подключение к БД из конфигурации
+	db := openTestDB(t)
 	defer db.Close()
 
-	store := NewParcelStore(db)
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
 
 	parcels := []Parcel{
 		getTestParcel(),
 		getTestParcel(),
 		getTestParcel(),
 	}
-	parcelMap := map[int]Parcel{}
+	parcelMap := map[int64]Parcel{}
 
 	// задаём всем посылкам один и тот же идентификатор клиента
-	client := randRange.Intn(10_000_000)
+	client := randRange.Int63n(10_000_000)
 	parcels[0].Client = client
 	parcels[1].Client = client
 	parcels[2].Client = client
@@ -181,3 +194,184 @@ func TestGetByClient(t *testing.T) {
 	}
 
 }
+
+// TestGetStatuses проверяет чтение статусов нескольких посылок
+func TestGetStatuses(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+
+	// add
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	second, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(second, ParcelStatusSent))
+
+	// check
+	// ненайденный номер в результат не попадает
+	statuses, err := store.GetStatuses([]int64{first, second, second + 1000})
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{first: ParcelStatusRegistered, second: ParcelStatusSent}, statuses)
+
+	statuses, err = store.GetStatuses(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, statuses)
+	assert.Empty(t, statuses)
+}
+
+// TestNewParcelStoreCreatesSchema проверяет создание схемы в пустой БД
+func TestNewParcelStoreCreatesSchema(t *testing.T) {
+	// prepare
+	// подключаемся к новому файлу БД, в котором ещё нет таблиц
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "fresh.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+
+	// check
+	// убеждаемся, что в новой БД можно сохранить и получить посылку
+	parcel := getTestParcel()
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	parcel.Number = id
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, parcel, stored)
+
+	// повторное создание хранилища не должно ломать существующую схему
+	_, err = NewParcelStore(db)
+	require.NoError(t, err)
+}
+
+// TestLargeNumbers проверяет номера и идентификаторы клиентов за пределами int32
+func TestLargeNumbers(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "large.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+	// следующая посылка получит номер больше 2^32
+	_, err = db.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES ('parcel', 1 << 32)")
+	require.NoError(t, err)
+
+	// add
+	parcel := getTestParcel()
+	parcel.Client = 1<<40 + 7
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	assert.Greater(t, id, int64(1<<32))
+	parcel.Number = id
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, parcel, stored)
+
+	batch, err := store.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	assert.Equal(t, []Parcel{parcel}, batch)
+}
+
+// TestCancel проверяет отмену посылки
+func TestCancel(t *testing.T) {
+	// prepare
+	// настраиваем подключение к БД из конфигурации
+	db := openTestDB(t)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+
+	// add
+	// добавляем новую посылку в БД, убеждаемся в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NotZero(t, id)
+
+	// cancel
+	// отменяем посылку и убеждаемся, что запись осталась со статусом cancelled и причиной
+	reason := "client changed his mind"
+	err = store.Cancel(id, reason)
+	require.NoError(t, err)
+
+	cancelled, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusCancelled, cancelled.Status)
+	assert.Equal(t, reason, cancelled.CancelReason)
+
+	// повторная отмена невозможна, т.к. статус уже не registered
+	err = store.Cancel(id, reason)
+	require.ErrorIs(t, err, ErrCancelNotAllowed)
+}
+
+// TestHealthCheck проверяет результат проверки состояния хранилища
+func TestHealthCheck(t *testing.T) {
+	// prepare
+	// настраиваем подключение к БД из конфигурации
+	db := openTestDB(t)
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+
+	// check
+	// при рабочем подключении хранилище живо и готово к запросам
+	res := store.HealthCheck(context.Background())
+	assert.True(t, res.Alive)
+	assert.True(t, res.Ready)
+	assert.Empty(t, res.Error)
+
+	// после закрытия подключения проверка должна вернуть ошибку
+	require.NoError(t, db.Close())
+	res = store.HealthCheck(context.Background())
+	assert.False(t, res.Alive)
+	assert.False(t, res.Ready)
+	assert.NotEmpty(t, res.Error)
+}
+
+// TestReplicaReads проверяет чтение из реплики и переход на основную БД
+func TestReplicaReads(t *testing.T) {
+	// prepare
+	// основная БД и реплика - два разных файла, реплика заполняется вручную
+	dir := t.TempDir()
+	primary, err := OpenDB(filepath.Join(dir, "primary.db"))
+	require.NoError(t, err)
+	defer primary.Close()
+	replica, err := OpenDB(filepath.Join(dir, "replica.db"))
+	require.NoError(t, err)
+	defer replica.Close()
+
+	replicaStore, err := NewParcelStore(replica)
+	require.NoError(t, err)
+	store, err := NewParcelStore(primary, replica)
+	require.NoError(t, err)
+
+	parcel := getTestParcel()
+	parcel.Client = randRange.Int63n(10_000_000)
+	id, err := replicaStore.Add(parcel)
+	require.NoError(t, err)
+	parcel.Number = id
+
+	// get
+	// посылка есть только в реплике, значит чтение идёт из неё
+	stored, err := store.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	assert.Equal(t, []Parcel{parcel}, stored)
+
+	// недоступная реплика не мешает чтению из основной БД
+	id, err = store.Add(parcel)
+	require.NoError(t, err)
+	require.NoError(t, replica.Close())
+
+	got, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, id, got.Number)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Приоритеты доставки посылки
+const (
+	PriorityNormal  = "normal"
+	PriorityExpress = "express"
+	PriorityUrgent  = "urgent"
+)
+
+// dispatchOrder упорядочивает посылки от самого высокого приоритета к обычному.
+// Пустой или неизвестный приоритет считается обычным
+const dispatchOrder = "CASE priority WHEN 'urgent' THEN 0 WHEN 'express' THEN 1 ELSE 2 END, created_at, number"
+
+// SetPriority меняет приоритет доставки посылки
+func (s ParcelStore) SetPriority(number int64, priority string) error {
+	return s.auditedUpdate(number, []string{"priority"}, "UPDATE parcel SET priority = :priority WHERE number = :number AND "+tenantScope,
+		sql.Named("priority", priority),
+		sql.Named("number", number),
+		s.tenantArg())
+}
+
+// ListForDispatch возвращает не больше limit зарегистрированных посылок в порядке
+// отправки: сначала срочные, затем экспресс, затем обычные, внутри приоритета - от старых к новым
+func (s ParcelStore) ListForDispatch(limit int) ([]Parcel, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE status = :status AND "+tenantScope+" ORDER BY "+dispatchOrder+" LIMIT :limit",
+		sql.Named("status", ParcelStatusRegistered),
+		sql.Named("limit", limit),
+		s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// validatePriority проверяет, что приоритет - один из известных
+func validatePriority(priority string) error {
+	switch priority {
+	case PriorityNormal, PriorityExpress, PriorityUrgent:
+		return nil
+	}
+	return ValidationError{Field: "priority", Message: fmt.Sprintf("must be %s, %s or %s", PriorityNormal, PriorityExpress, PriorityUrgent)}
+}
+
+// SetPriority меняет приоритет доставки посылки, пока она не отправлена
+func (s ParcelService) SetPriority(ctx context.Context, number int64, priority string) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	if err := validatePriority(priority); err != nil {
+		return err
+	}
+	if err := s.checkRegistered(ctx, number); err != nil {
+		return err
+	}
+	return s.store.WithContext(ctx).SetPriority(number, priority)
+}
+
+// ListForDispatch возвращает очередь посылок на отправку, см. ParcelStore.ListForDispatch.
+// limit <= 0 означает DefaultPageSize
+func (s ParcelService) ListForDispatch(ctx context.Context, limit int) ([]Parcel, error) {
+	if err := requireStaff(ctx); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return nil, ValidationError{Field: "limit", Message: fmt.Sprintf("must be at most %d", MaxPageSize)}
+	}
+	return s.store.WithContext(ctx).ListForDispatch(limit)
+}
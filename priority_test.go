@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListForDispatch проверяет порядок очереди на отправку
+func TestListForDispatch(t *testing.T) {
+	// prepare
+	// отдельная БД, чтобы в очереди не было посылок других тестов
+	_, store := newTestService(t)
+
+	add := func(priority, createdAt string) int64 {
+		p := getTestParcel()
+		p.Priority = priority
+		p.CreatedAt = createdAt
+		id, err := store.Add(p)
+		require.NoError(t, err)
+		return id
+	}
+	oldNormal := add(PriorityNormal, "2024-01-01T00:00:00Z")
+	newExpress := add(PriorityExpress, "2024-01-03T00:00:00Z")
+	urgent := add(PriorityUrgent, "2024-01-04T00:00:00Z")
+	oldExpress := add(PriorityExpress, "2024-01-02T00:00:00Z")
+	sent := add(PriorityUrgent, "2024-01-01T00:00:00Z")
+	require.NoError(t, store.SetStatus(sent, ParcelStatusSent))
+
+	// check
+	parcels, err := store.ListForDispatch(10)
+	require.NoError(t, err)
+	var numbers []int64
+	for _, p := range parcels {
+		numbers = append(numbers, p.Number)
+	}
+	assert.Equal(t, []int64{urgent, oldExpress, newExpress, oldNormal}, numbers)
+
+	parcels, err = store.ListForDispatch(1)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, urgent, parcels[0].Number)
+}
+
+// TestServiceSetPriority проверяет проверку и смену приоритета
+func TestServiceSetPriority(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	assert.Equal(t, PriorityNormal, p.Priority)
+
+	require.NoError(t, service.SetPriority(ctx, p.Number, PriorityExpress))
+	stored, err := service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, PriorityExpress, stored.Priority)
+
+	assert.ErrorIs(t, service.SetPriority(ctx, p.Number, "asap"), ErrInvalidParcel)
+	_, err = service.ListForDispatch(ctx, MaxPageSize+1)
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	assert.ErrorIs(t, service.SetPriority(ctx, p.Number, PriorityUrgent), ErrParcelLocked)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProbeClient - зарезервированный идентификатор клиента для проверочных посылок,
+// по нему их можно отличить от настоящих и исключить из отчётов
+const ProbeClient = 999_999_999
+
+// ProbeResult - результат одного прогона синтетической проверки
+type ProbeResult struct {
+	OK       bool
+	Step     string // шаг, на котором проверка завершилась ошибкой
+	Err      error
+	Duration time.Duration
+	At       time.Time
+}
+
+// Probe выполняет через сервис типичный сценарий работы с посылкой:
+// регистрация, чтение, смена адреса и удаление, - и сообщает, на каком шаге он сломался
+func (s ParcelService) Probe(ctx context.Context) ProbeResult {
+	start := time.Now()
+	res := ProbeResult{At: start.UTC()}
+
+	fail := func(step string, err error) ProbeResult {
+		res.Step = step
+		res.Err = err
+		res.Duration = time.Since(start)
+		return res
+	}
+
+	p, err := s.Register(ctx, ProbeClient, "probe")
+	if err != nil {
+		return fail("register", err)
+	}
+	if _, err := s.Get(ctx, p.Number); err != nil {
+		return fail("get", err)
+	}
+	if err := s.ChangeAddress(ctx, p.Number, "probe updated"); err != nil {
+		return fail("change address", err)
+	}
+	if err := s.Delete(ctx, p.Number); err != nil {
+		return fail("delete", err)
+	}
+	if _, err := s.Get(ctx, p.Number); !errors.Is(err, ErrParcelNotFound) {
+		return fail("verify delete", fmt.Errorf("parcel %d still exists: %v", p.Number, err))
+	}
+
+	res.OK = true
+	res.Duration = time.Since(start)
+	return res
+}
+
+// RunProbe выполняет Probe каждые interval до отмены ctx и передаёт результаты в report
+func (s ParcelService) RunProbe(ctx context.Context, interval time.Duration, report func(ProbeResult)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report(s.Probe(ctx))
+		}
+	}
+}
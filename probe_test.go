@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProbe проверяет успешный и неуспешный прогон синтетической проверки
+func TestProbe(t *testing.T) {
+	service, store := newTestService(t)
+
+	res := service.Probe(context.Background())
+	require.True(t, res.OK, res.Err)
+	assert.Positive(t, res.Duration)
+
+	// проверочные посылки не должны оставаться в БД
+	parcels, err := store.GetByClient(ProbeClient)
+	require.NoError(t, err)
+	assert.Empty(t, parcels)
+
+	// при недоступной БД проверка падает на первом шаге
+	require.NoError(t, store.db.Close())
+	res = service.Probe(context.Background())
+	assert.False(t, res.OK)
+	assert.Equal(t, "register", res.Step)
+	assert.Error(t, res.Err)
+}
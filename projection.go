@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownField возвращается ParseFields для поля, которого нет в projectionFields
+var ErrUnknownField = errors.New("unknown field")
+
+// projectionFields - поля, которые можно выбрать в проекции, и их колонки в таблице parcel.
+// Как и в filterFields, имена колонок берутся только отсюда
+var projectionFields = map[string]string{
+	"number":          "number",
+	"tracking_number": "tracking_number",
+	"client":          "client",
+	"status":          "status",
+	"address":         "address",
+	"created_at":      "created_at",
+	"cancel_reason":   "cancel_reason",
+	"return_of":       "return_of",
+	"deadline":        "deadline",
+	"eta":             "eta",
+	"courier":         "courier_id",
+	"origin":          "origin_id",
+	"destination":     "destination_id",
+	"weight_kg":       "weight_kg",
+	"length_cm":       "length_cm",
+	"width_cm":        "width_cm",
+	"height_cm":       "height_cm",
+	"declared_value":  "declared_value",
+	"delivery_price":  "delivery_price",
+	"cod_amount":      "cod_amount",
+	"priority":        "priority",
+	"recipient":       "recipient_client",
+	"recipient_name":  "recipient_name",
+	"recipient_phone": "recipient_phone",
+	"parent":          "parent_number",
+}
+
+// Fields - список полей проекции. Получается через ParseFields
+type Fields struct {
+	names []string
+}
+
+// ParseFields разбирает список полей через запятую, как в параметре
+// запроса fields=number,status,address. Номер посылки включается всегда,
+// чтобы строки можно было сопоставить с посылками. Пустой список выбирает все поля
+func ParseFields(spec string) (Fields, error) {
+	names := []string{"number"}
+	seen := map[string]bool{"number": true}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := projectionFields[name]; !ok {
+			return Fields{}, fmt.Errorf("%w: %q", ErrUnknownField, name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if strings.TrimSpace(spec) == "" {
+		for name := range projectionFields {
+			if name != "number" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names[1:])
+	}
+	return Fields{names: names}, nil
+}
+
+// columns возвращает список колонок для SELECT
+func (f Fields) columns() string {
+	columns := make([]string, len(f.names))
+	for i, name := range f.names {
+		columns[i] = projectionFields[name]
+	}
+	return strings.Join(columns, ", ")
+}
+
+// Names возвращает поля проекции в порядке колонок
+func (f Fields) Names() []string {
+	return append([]string(nil), f.names...)
+}
+
+// scanFields читает строки проекции в словари "поле - значение", см. eachFields
+func (s ParcelStore) scanFields(rows *sql.Rows, f Fields) ([]map[string]any, error) {
+	res := []map[string]any{}
+	err := s.eachFields(rows, f, func(row map[string]any) error {
+		res = append(res, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// eachFields передаёт fn строки проекции по одной в виде словарей "поле - значение"
+// и останавливается на первой ошибке fn. Денежные поля передаются как Money,
+// чтобы в JSON они были строками в рублях, зашифрованные - расшифрованными
+func (s ParcelStore) eachFields(rows *sql.Rows, f Fields, fn func(row map[string]any) error) error {
+	for rows.Next() {
+		values := make([]any, len(f.names))
+		dest := make([]any, len(f.names))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		row := make(map[string]any, len(f.names))
+		for i, name := range f.names {
+			if v, ok := values[i].(int64); ok && moneyFields[name] != "" {
+				row[name] = Money(v)
+				continue
+			}
+			if column := projectionFields[name]; encryptedColumns[column] {
+				if v, ok := values[i].(string); ok {
+					plain, err := s.fields.decrypt(column, v)
+					if err != nil {
+						return err
+					}
+					values[i] = plain
+				}
+			}
+			row[name] = values[i]
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetByClientFields возвращает выбранные поля посылок клиента, упорядоченных по номеру
+func (s ParcelStore) GetByClientFields(client int64, f Fields) ([]map[string]any, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+f.columns()+" FROM parcel WHERE client = :client AND "+tenantScope+" ORDER BY number",
+		sql.Named("client", client), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanFields(rows, f)
+}
+
+// SearchFields возвращает выбранные поля посылок, подходящих под фильтр, упорядоченных по номеру
+func (s ParcelStore) SearchFields(filter Filter, f Fields) ([]map[string]any, error) {
+	res := []map[string]any{}
+	err := s.EachFields(filter, f, func(row map[string]any) error {
+		res = append(res, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// parseFields переводит ошибку ParseFields в ValidationError
+func parseFields(spec string) (Fields, error) {
+	f, err := ParseFields(spec)
+	if err != nil {
+		return Fields{}, ValidationError{Field: "fields", Message: strings.TrimPrefix(err.Error(), ErrUnknownField.Error()+": ")}
+	}
+	return f, nil
+}
+
+// ClientParcelsFields возвращает только перечисленные в fields поля посылок клиента,
+// чтобы списки в мобильном приложении не загружали полные записи
+func (s ParcelService) ClientParcelsFields(ctx context.Context, client int64, fields string) ([]map[string]any, error) {
+	if err := validateClient(client); err != nil {
+		return nil, err
+	}
+	if err := requireClient(ctx, client); err != nil {
+		return nil, err
+	}
+	f, err := parseFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetByClientFields(client, f)
+}
+
+// SearchFields возвращает только перечисленные в fields поля посылок,
+// подходящих под выражение фильтра
+func (s ParcelService) SearchFields(ctx context.Context, expr, fields string) ([]map[string]any, error) {
+	filter, err := s.parseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).SearchFields(scopeFilter(ctx, filter), f)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseFields проверяет разбор списка полей проекции
+func TestParseFields(t *testing.T) {
+	f, err := ParseFields("status, address,status")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"number", "status", "address"}, f.names)
+	assert.Equal(t, "number, status, address", f.columns())
+
+	f, err = ParseFields("courier")
+	require.NoError(t, err)
+	assert.Equal(t, "number, courier_id", f.columns())
+
+	f, err = ParseFields("")
+	require.NoError(t, err)
+	assert.Len(t, f.names, len(projectionFields))
+	assert.Equal(t, "number", f.names[0])
+
+	_, err = ParseFields("status,zone; DROP TABLE parcel")
+	assert.ErrorIs(t, err, ErrUnknownField)
+}
+
+// TestSearchFields проверяет чтение только выбранных полей
+func TestSearchFields(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, store.SetCharges(p.Number, Charges{DeclaredValue: 150050}))
+
+	// check
+	rows, err := service.SearchFields(ctx, `status = "registered"`, "status,declared_value")
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, map[string]any{"number": p.Number, "status": ParcelStatusRegistered, "declared_value": Money(150050)}, rows[0])
+
+	data, err := json.Marshal(rows[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"number": %d, "status": "registered", "declared_value": "1500.50"}`, p.Number), string(data))
+
+	rows, err = service.ClientParcelsFields(ctx, 1, "address")
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"number": p.Number, "address": "Псков"}}, rows)
+
+	rows, err = service.ClientParcelsFields(ctx, 2, "address")
+	require.NoError(t, err)
+	assert.NotNil(t, rows)
+	assert.Empty(t, rows)
+
+	_, err = service.SearchFields(ctx, "", "unknown")
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit - ограничение частоты запросов по алгоритму token bucket
+type RateLimit struct {
+	Rate  float64 // сколько запросов в секунду восполняется, 0 - без ограничения
+	Burst int     // сколько запросов можно сделать подряд
+}
+
+// DefaultIPRateLimit и DefaultClientRateLimit не дают одному источнику
+// занять единственного писателя SQLite
+var (
+	DefaultIPRateLimit     = RateLimit{Rate: 20, Burst: 40}
+	DefaultClientRateLimit = RateLimit{Rate: 10, Burst: 20}
+)
+
+// rateSweepInterval - как часто rateLimiter удаляет восполненные корзины
+const rateSweepInterval = time.Minute
+
+// tokenBucket - корзина одного ключа: tokens на момент updated
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter хранит по корзине на ключ. Полная корзина ничем не отличается
+// от отсутствующей, поэтому такие корзины периодически удаляются
+type rateLimiter struct {
+	limit RateLimit
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{limit: limit, now: time.Now, buckets: map[string]*tokenBucket{}}
+}
+
+// allow забирает токен из корзины key. Если токена нет, возвращает false
+// и время до появления следующего
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	if l == nil || l.limit.Rate <= 0 {
+		return true, 0
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) >= rateSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.limit.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	return math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*l.limit.Rate)
+}
+
+func (l *rateLimiter) sweep(now time.Time) {
+	l.swept = now
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// WithRateLimits возвращает копию обработчика, которая ограничивает частоту
+// запросов с одного IP-адреса и к посылкам одного клиента.
+// Клиент определяется по адресам /clients/{id}/...
+func (h APIHandler) WithRateLimits(perIP, perClient RateLimit) APIHandler {
+	h.ipLimiter = newRateLimiter(perIP)
+	h.clientLimiter = newRateLimiter(perClient)
+	return h
+}
+
+// rateLimited проверяет ограничения частоты. Если они превышены,
+// отвечает 429 с заголовком Retry-After и возвращает true
+func (h APIHandler) rateLimited(w http.ResponseWriter, r *http.Request) bool {
+	ok, wait := h.ipLimiter.allow(remoteIP(r))
+	if ok {
+		if client, found := pathClient(r.URL.Path); found {
+			ok, wait = h.clientLimiter.allow(client)
+		}
+	}
+	if ok {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeJSON(w, http.StatusTooManyRequests, apiError{Error: fmt.Sprintf("rate limit exceeded, retry in %s", wait.Round(time.Millisecond))})
+	return true
+}
+
+// remoteIP возвращает IP-адрес соединения. X-Forwarded-For не учитывается:
+// его может подставить кто угодно
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// pathClient возвращает идентификатор клиента из адреса /clients/{id}/...
+func pathClient(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, "/clients/")
+	if !ok {
+		return "", false
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	return id, id != ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRateLimiter проверяет расход и восполнение токенов
+func TestRateLimiter(t *testing.T) {
+	// prepare
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(RateLimit{Rate: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	// add
+	for i := 0; i < 3; i++ {
+		ok, _ := l.allow("a")
+		require.True(t, ok)
+	}
+
+	// check
+	ok, wait := l.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+	ok, _ = l.allow("b")
+	assert.True(t, ok, "корзины ключей независимы")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.allow("a")
+	assert.True(t, ok)
+
+	// восполненные корзины удаляются
+	now = now.Add(rateSweepInterval)
+	l.allow("c")
+	assert.Len(t, l.buckets, 1)
+
+	ok, _ = newRateLimiter(RateLimit{}).allow("a")
+	assert.True(t, ok)
+}
+
+// TestAPIRateLimits проверяет ответ 429 по IP-адресу и по клиенту
+func TestAPIRateLimits(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	handler := NewAPIHandler(service).WithRateLimits(RateLimit{Rate: 0.01, Burst: 3}, RateLimit{Rate: 0.01, Burst: 1})
+
+	// prepare
+	_, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	call := func(ip, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// add
+	assert.Equal(t, http.StatusOK, call("10.0.0.1", "/clients/7/parcels").Code)
+	rec := call("10.0.0.2", "/clients/7/parcels")
+
+	// check
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "100", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, call("10.0.0.2", "/clients/8/parcels").Code)
+
+	assert.Equal(t, http.StatusOK, call("10.0.0.1", "/parcels/1").Code)
+	assert.Equal(t, http.StatusOK, call("10.0.0.1", "/parcels/1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, call("10.0.0.1", "/parcels/1").Code)
+	assert.Equal(t, http.StatusOK, call("10.0.0.3", "/parcels/1").Code)
+}
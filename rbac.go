@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrForbidden возвращается, если роли субъекта запроса не хватает для операции
+var ErrForbidden = errors.New("forbidden")
+
+// Роли субъектов запроса. Проверки выполняет ParcelService: если в контексте
+// нет субъекта, см. WithPrincipal, вызов считается внутренним и разрешён
+const (
+	RoleAdmin      = "admin"      // всё, включая ключи API
+	RoleDispatcher = "dispatcher" // все операции с посылками и курьерами
+	RoleCourier    = "courier"    // видит и продвигает только назначенные ему посылки
+	RoleClient     = "client"     // видит, создаёт и правит только свои посылки
+)
+
+// Виды изменения посылки, см. checkParcelAccess
+const (
+	accessStatus = "update status of" // смена статуса и вручение, доступна курьеру посылки
+	accessEdit   = "edit"             // адрес, получатель, отмена и удаление, доступны клиенту посылки
+)
+
+// validateRole проверяет роль субъекта: курьеру нужен идентификатор курьера,
+// клиенту - идентификатор клиента
+func validateRole(p Principal) error {
+	switch p.Role {
+	case RoleAdmin, RoleDispatcher:
+		return nil
+	case RoleCourier:
+		if p.Courier <= 0 {
+			return ValidationError{Field: "courier", Message: "must be positive for the courier role"}
+		}
+		return nil
+	case RoleClient:
+		return validateClient(p.Client)
+	}
+	return ValidationError{Field: "role", Message: fmt.Sprintf("unknown role %q", p.Role)}
+}
+
+// requireRole разрешает операцию только субъектам с одной из ролей roles
+func requireRole(ctx context.Context, roles ...string) error {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		return nil
+	}
+	for _, role := range roles {
+		if p.Role == role {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: role %q is not allowed", ErrForbidden, p.Role)
+}
+
+// requireStaff разрешает операцию администраторам и диспетчерам
+func requireStaff(ctx context.Context) error {
+	return requireRole(ctx, RoleAdmin, RoleDispatcher)
+}
+
+// requireClient разрешает операцию с посылками клиента client
+// сотрудникам и самому клиенту
+func requireClient(ctx context.Context, client int64) error {
+	p, ok := PrincipalFrom(ctx)
+	if !ok || p.Role == RoleAdmin || p.Role == RoleDispatcher || (p.Role == RoleClient && p.Client == client) {
+		return nil
+	}
+	return fmt.Errorf("%w: parcels of client %d", ErrForbidden, client)
+}
+
+// canSee сообщает, видна ли посылка субъекту запроса. Чужие посылки
+// для клиента и курьера не существуют: Get возвращает ErrParcelNotFound
+func canSee(ctx context.Context, parcel Parcel) bool {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		return true
+	}
+	switch p.Role {
+	case RoleAdmin, RoleDispatcher:
+		return true
+	case RoleCourier:
+		return parcel.Courier == p.Courier
+	case RoleClient:
+		return parcel.Client == p.Client
+	}
+	return false
+}
+
+// checkParcelAccess проверяет право изменить видимую субъекту посылку
+func checkParcelAccess(ctx context.Context, access string, parcel Parcel) error {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		return nil
+	}
+	switch {
+	case p.Role == RoleAdmin, p.Role == RoleDispatcher:
+		return nil
+	case p.Role == RoleCourier && access == accessStatus && parcel.Courier == p.Courier:
+		return nil
+	case p.Role == RoleClient && access == accessEdit && parcel.Client == p.Client:
+		return nil
+	}
+	return fmt.Errorf("%w: role %q may not %s parcel %d", ErrForbidden, p.Role, access, parcel.Number)
+}
+
+// scopeFilter ограничивает фильтр поиска посылками, которые видит субъект запроса
+func scopeFilter(ctx context.Context, f Filter) Filter {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		return f
+	}
+	switch p.Role {
+	case RoleAdmin, RoleDispatcher:
+		return f
+	case RoleCourier:
+		return f.and("courier_id", p.Courier)
+	case RoleClient:
+		return f.and("client", p.Client)
+	}
+	return Filter{where: "0"}
+}
+
+// and добавляет к фильтру условие column = value
+func (f Filter) and(column string, value any) Filter {
+	name := fmt.Sprintf("scope%d", len(f.args))
+	f.where = "(" + f.where + ") AND " + column + " = :" + name
+	f.args = append(append([]any{}, f.args...), sql.Named(name, value))
+	return f
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRBACClient проверяет, что клиент видит и правит только свои посылки
+func TestRBACClient(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	client := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleClient, Client: 7})
+
+	// prepare
+	own, err := service.Register(client, 7, "Псков")
+	require.NoError(t, err)
+	other, err := service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+
+	// check
+	_, err = service.Get(client, own.Number)
+	require.NoError(t, err)
+	_, err = service.Get(client, other.Number)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	found, err := service.Search(client, `address ~ "в"`)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, own.Number, found[0].Number)
+
+	_, err = service.Register(client, 8, "Орёл")
+	require.ErrorIs(t, err, ErrForbidden)
+	_, err = service.ClientParcelsDetails(client, 8, "")
+	require.ErrorIs(t, err, ErrForbidden)
+
+	require.NoError(t, service.ChangeAddress(client, own.Number, "Орёл"))
+	require.ErrorIs(t, service.NextStatus(client, own.Number), ErrForbidden)
+	require.ErrorIs(t, service.AddTag(client, own.Number, "fragile"), ErrForbidden)
+	require.ErrorIs(t, service.ChangeAddress(client, other.Number, "Орёл"), ErrParcelNotFound)
+	require.NoError(t, service.Delete(client, own.Number))
+}
+
+// TestRBACCourier проверяет, что курьер продвигает только назначенные ему посылки
+func TestRBACCourier(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	courier, err := service.AddCourier(ctx, "Иван", "+79990000000")
+	require.NoError(t, err)
+	assigned, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.AssignCourier(ctx, assigned.Number, courier.ID))
+	other, err := service.Register(ctx, 7, "Тверь")
+	require.NoError(t, err)
+	ivan := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "ivan", Role: RoleCourier, Courier: courier.ID})
+
+	// check
+	require.NoError(t, service.SetStatus(ivan, assigned.Number, ParcelStatusSent))
+	require.ErrorIs(t, service.SetStatus(ivan, other.Number, ParcelStatusSent), ErrParcelNotFound)
+	require.ErrorIs(t, service.ChangeAddress(ivan, assigned.Number, "Орёл"), ErrForbidden)
+	require.ErrorIs(t, service.AssignCourier(ivan, other.Number, courier.ID), ErrForbidden)
+
+	parcels, err := service.GetByCourier(ivan, courier.ID)
+	require.NoError(t, err)
+	assert.Len(t, parcels, 1)
+	_, err = service.GetByCourier(ivan, courier.ID+1)
+	require.ErrorIs(t, err, ErrForbidden)
+
+	found, err := service.Search(ivan, "")
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+}
+
+// TestRBACStaff проверяет права диспетчера и администратора
+func TestRBACStaff(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	dispatcher := WithPrincipal(ctx, Principal{Kind: PrincipalAPIKey, Subject: "crm", Role: RoleDispatcher})
+	admin := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "root", Role: RoleAdmin})
+
+	// prepare
+	p, err := service.Register(dispatcher, 7, "Псков")
+	require.NoError(t, err)
+
+	// check
+	require.NoError(t, service.AddTag(dispatcher, p.Number, "fragile"))
+	_, err = service.BulkSetStatus(dispatcher, []int64{p.Number}, ParcelStatusSent)
+	require.NoError(t, err)
+	found, err := service.Search(dispatcher, "")
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	_, _, err = service.CreateAPIKey(dispatcher, "billing", RoleDispatcher)
+	require.ErrorIs(t, err, ErrForbidden)
+	_, _, err = service.CreateAPIKey(admin, "billing", RoleDispatcher)
+	require.NoError(t, err)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPhone возвращается normalizePhone для номера, который нельзя привести к E.164
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// Recipient - получатель посылки. Адрес получателя хранится в Parcel.Address
+type Recipient struct {
+	Client int64 // идентификатор получателя, если он тоже клиент, иначе 0
+	Name   string
+	Phone  string // в формате E.164, см. normalizePhone
+}
+
+// SetRecipient сохраняет получателя посылки
+func (s ParcelStore) SetRecipient(number int64, r Recipient) error {
+	sealed, err := s.sealRecipient(r)
+	if err != nil {
+		return err
+	}
+	return s.auditedUpdate(number, []string{"recipient_client", "recipient_name", "recipient_phone"}, "UPDATE parcel SET recipient_client = :client, recipient_name = :name, recipient_phone = :phone, recipient_phone_idx = :phone_idx WHERE number = :number AND "+tenantScope,
+		sql.Named("client", r.Client),
+		sql.Named("name", sealed.Name),
+		sql.Named("phone", sealed.Phone),
+		sql.Named("phone_idx", s.fields.blindIndex(r.Phone)),
+		sql.Named("number", number),
+		s.tenantArg())
+}
+
+// GetByRecipient возвращает посылки, адресованные клиенту, упорядоченные по номеру
+func (s ParcelStore) GetByRecipient(client int64) ([]Parcel, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE recipient_client = :client AND "+tenantScope+" ORDER BY number",
+		sql.Named("client", client), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// GetByPhone возвращает посылки получателя с телефоном phone в формате E.164,
+// упорядоченные по номеру. С шифрованием телефон ищется по слепому индексу
+func (s ParcelStore) GetByPhone(phone string) ([]Parcel, error) {
+	where := "recipient_phone = :phone"
+	args := []any{sql.Named("phone", phone)}
+	if s.fields != nil {
+		indexes := s.fields.blindIndexes(phone)
+		names := make([]string, len(indexes))
+		args = make([]any, len(indexes))
+		for i, index := range indexes {
+			names[i] = ":idx" + strconv.Itoa(i)
+			args[i] = sql.Named("idx"+strconv.Itoa(i), index)
+		}
+		where = "recipient_phone_idx IN (" + strings.Join(names, ", ") + ")"
+	}
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE "+where+" AND "+tenantScope+" ORDER BY number",
+		append(args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// normalizePhone приводит телефон к формату E.164: "+", код страны и номер,
+// всего не больше 15 цифр. Пробелы, дефисы, точки и скобки отбрасываются.
+// Российский номер из 11 цифр, начинающийся с 8, считается номером с кодом +7
+func normalizePhone(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+
+	plus := strings.HasPrefix(digits, "+")
+	digits = strings.TrimPrefix(digits, "+")
+	if !plus && len(digits) == 11 && digits[0] == '8' {
+		digits = "7" + digits[1:]
+		plus = true
+	}
+	if !plus || len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPhone, phone)
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPhone, phone)
+		}
+	}
+	return "+" + digits, nil
+}
+
+// phoneError переводит ошибку normalizePhone в ValidationError поля field
+func phoneError(field string, err error) error {
+	return ValidationError{Field: field, Message: strings.TrimPrefix(err.Error(), ErrInvalidPhone.Error()+": ") + " is not a valid E.164 number"}
+}
+
+// SetRecipient задаёт получателя посылки, пока она не отправлена.
+// Телефон получателя необязателен и сохраняется в формате E.164
+func (s ParcelService) SetRecipient(ctx context.Context, number int64, r Recipient) error {
+	if strings.TrimSpace(r.Name) == "" {
+		return ValidationError{Field: "recipient_name", Message: "must not be empty"}
+	}
+	if r.Client < 0 {
+		return ValidationError{Field: "recipient_client", Message: "must not be negative"}
+	}
+	if r.Phone != "" {
+		phone, err := normalizePhone(r.Phone)
+		if err != nil {
+			return phoneError("recipient_phone", err)
+		}
+		r.Phone = phone
+	}
+	if err := s.checkRegistered(ctx, number); err != nil {
+		return err
+	}
+	return s.store.WithContext(ctx).SetRecipient(number, r)
+}
+
+// GetByRecipient возвращает посылки, которые клиент получает
+func (s ParcelService) GetByRecipient(ctx context.Context, client int64) ([]Parcel, error) {
+	if err := validateClient(client); err != nil {
+		return nil, err
+	}
+	if err := requireClient(ctx, client); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetByRecipient(client)
+}
+
+// GetByPhone возвращает посылки получателя по телефону, чтобы оператор
+// колл-центра мог найти посылку по номеру звонящего
+func (s ParcelService) GetByPhone(ctx context.Context, phone string) ([]Parcel, error) {
+	if err := requireStaff(ctx); err != nil {
+		return nil, err
+	}
+	phone, err := normalizePhone(phone)
+	if err != nil {
+		return nil, phoneError("phone", err)
+	}
+	return s.store.WithContext(ctx).GetByPhone(phone)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecipient проверяет, что посылку находят и отправитель, и получатель
+func TestRecipient(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "Псков, ул. Некрасова, 1")
+	require.NoError(t, err)
+	recipient := Recipient{Client: 2, Name: "Пётр Петров", Phone: "+79110000000"}
+
+	// add
+	require.NoError(t, service.SetRecipient(ctx, p.Number, recipient))
+
+	// check
+	stored, err := service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, recipient, stored.Recipient)
+
+	received, err := service.GetByRecipient(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []Parcel{stored}, received)
+
+	found, err := service.Search(ctx, `recipient_phone = "+79110000000"`)
+	require.NoError(t, err)
+	assert.Equal(t, []Parcel{stored}, found)
+
+	received, err = service.GetByRecipient(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, received)
+
+	// validation
+	assert.ErrorIs(t, service.SetRecipient(ctx, p.Number, Recipient{}), ErrInvalidParcel)
+	assert.ErrorIs(t, service.SetRecipient(ctx, p.Number, Recipient{Client: -1, Name: "Пётр"}), ErrInvalidParcel)
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	assert.ErrorIs(t, service.SetRecipient(ctx, p.Number, recipient), ErrParcelLocked)
+}
+
+// TestNormalizePhone проверяет приведение телефонов к E.164
+func TestNormalizePhone(t *testing.T) {
+	for in, want := range map[string]string{
+		"+7 (911) 000-00-00": "+79110000000",
+		"8 911 000 00 00":    "+79110000000",
+		"+44 20 7946 0958":   "+442079460958",
+		" +1.212.555.0100 ":  "+12125550100",
+	} {
+		got, err := normalizePhone(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", "9110000000", "+0 911 000 00 00", "+7 911 ABC 00 00", "+1234567890123456", "+7911"} {
+		_, err := normalizePhone(in)
+		assert.ErrorIs(t, err, ErrInvalidPhone, in)
+	}
+}
+
+// TestGetByPhone проверяет поиск посылок по телефону получателя
+func TestGetByPhone(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.SetRecipient(ctx, p.Number, Recipient{Name: "Пётр Петров", Phone: "8 (911) 000-00-00"}))
+
+	// check
+	stored, err := service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "+79110000000", stored.Recipient.Phone)
+
+	found, err := service.GetByPhone(ctx, "+7 911 000 00 00")
+	require.NoError(t, err)
+	assert.Equal(t, []Parcel{stored}, found)
+
+	found, err = service.GetByPhone(ctx, "+7 911 000 00 01")
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	_, err = service.GetByPhone(ctx, "911")
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	assert.ErrorIs(t, service.SetRecipient(ctx, p.Number, Recipient{Name: "Пётр", Phone: "911"}), ErrInvalidParcel)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы результата отчёта
+const (
+	ReportFormatCSV  = "csv"
+	ReportFormatJSON = "json"
+)
+
+// Report - сохранённое определение отчёта: какие посылки считать (Filter, см. ParseFilter),
+// по какому полю группировать, в каком формате и как часто отправлять получателям
+type Report struct {
+	ID         int
+	Name       string
+	Filter     string
+	GroupBy    string        // поле из filterFields, пусто - общее количество
+	Sum        string        // денежное поле из moneyFields, пусто - только количество
+	Format     string        // ReportFormatCSV или ReportFormatJSON
+	Interval   time.Duration // периодичность, 0 - только ручной запуск
+	Recipients []string
+	LastRunAt  string // RFC3339, пусто - ещё не выполнялся
+	Tenant     int64  // магазин отчёта, заполняется хранилищем
+}
+
+// ReportRow - строка результата отчёта: значение поля группировки, число посылок
+// и сумма денежного поля, если она запрошена
+type ReportRow struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+	Sum   Money  `json:"sum"`
+}
+
+// moneyFields - денежные поля, которые можно суммировать в отчётах, и их колонки.
+// Суммы считаются в копейках целыми числами, поэтому итог точный
+// при любом количестве строк, а переполнение int64 возвращается ошибкой
+var moneyFields = map[string]string{
+	"declared_value": "declared_value",
+	"delivery_price": "delivery_price",
+	"cod_amount":     "cod_amount",
+}
+
+// AddReport сохраняет определение отчёта и возвращает его идентификатор
+func (s ParcelStore) AddReport(r Report) (int, error) {
+	res, err := s.db.ExecContext(s.context(), "INSERT INTO report (name, filter, group_by, sum, format, interval_s, recipients, tenant_id) "+
+		"VALUES (:name, :filter, :group_by, :sum, :format, :interval, :recipients, :tenant)",
+		sql.Named("name", r.Name),
+		sql.Named("filter", r.Filter),
+		sql.Named("group_by", r.GroupBy),
+		sql.Named("sum", r.Sum),
+		sql.Named("format", r.Format),
+		sql.Named("interval", int64(r.Interval/time.Second)),
+		sql.Named("recipients", strings.Join(r.Recipients, ",")),
+		s.tenantArg())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// ListReports возвращает все сохранённые отчёты
+func (s ParcelStore) ListReports() ([]Report, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT id, name, filter, group_by, sum, format, interval_s, recipients, last_run_at, tenant_id FROM report WHERE "+tenantScope+" ORDER BY id",
+		s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Report{}
+	for rows.Next() {
+		var r Report
+		var interval int64
+		var recipients string
+		if err := rows.Scan(&r.ID, &r.Name, &r.Filter, &r.GroupBy, &r.Sum, &r.Format, &interval, &recipients, &r.LastRunAt, &r.Tenant); err != nil {
+			return nil, err
+		}
+		r.Interval = time.Duration(interval) * time.Second
+		if recipients != "" {
+			r.Recipients = strings.Split(recipients, ",")
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+// SetReportRun запоминает время последнего выполнения отчёта
+func (s ParcelStore) SetReportRun(id int, at time.Time) error {
+	_, err := s.db.ExecContext(s.context(), "UPDATE report SET last_run_at = :at WHERE id = :id AND "+tenantScope,
+		sql.Named("at", at.UTC().Format(time.RFC3339)),
+		sql.Named("id", id),
+		s.tenantArg())
+	return err
+}
+
+// Aggregate считает посылки, подходящие под фильтр, с группировкой по полю groupBy
+// из filterFields. Пустой groupBy возвращает одну строку с общим количеством.
+// Если задан sum из moneyFields, в строках считается и сумма этого поля
+func (s ParcelStore) Aggregate(f Filter, groupBy, sum string) ([]ReportRow, error) {
+	s = s.withFilter(f)
+	key := "''"
+	if groupBy != "" {
+		column, ok := filterFields[groupBy]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, groupBy)
+		}
+		if err := s.checkEncryptedFields(column); err != nil {
+			return nil, err
+		}
+		key = column
+	}
+	// SUM, а не TOTAL: TOTAL всегда возвращает число с плавающей точкой
+	total := "0"
+	if sum != "" {
+		column, ok := moneyFields[sum]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown money field %q", ErrInvalidFilter, sum)
+		}
+		total = "COALESCE(SUM(" + column + "), 0)"
+	}
+
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+key+", COUNT(*), "+total+" FROM parcel WHERE ("+f.where+") AND "+tenantScope+
+		" GROUP BY 1 ORDER BY 1", append(f.args, s.tenantArg())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []ReportRow{}
+	for rows.Next() {
+		var k any
+		var row ReportRow
+		if err := rows.Scan(&k, &row.Count, &row.Sum); err != nil {
+			return nil, err
+		}
+		row.Key = fmt.Sprint(k)
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
+
+// SaveReport проверяет и сохраняет определение отчёта
+func (s ParcelService) SaveReport(ctx context.Context, r Report) (Report, error) {
+	if err := requireStaff(ctx); err != nil {
+		return Report{}, err
+	}
+	if strings.TrimSpace(r.Name) == "" {
+		return Report{}, ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if _, err := s.parseFilter(r.Filter); err != nil {
+		return Report{}, err
+	}
+	if _, ok := filterFields[r.GroupBy]; r.GroupBy != "" && !ok {
+		return Report{}, ValidationError{Field: "group_by", Message: fmt.Sprintf("unknown field %q", r.GroupBy)}
+	}
+	if err := s.store.checkEncryptedFields(filterFields[r.GroupBy]); err != nil {
+		return Report{}, ValidationError{Field: "group_by", Message: fmt.Sprintf("field %q is encrypted", r.GroupBy)}
+	}
+	if _, ok := moneyFields[r.Sum]; r.Sum != "" && !ok {
+		return Report{}, ValidationError{Field: "sum", Message: fmt.Sprintf("unknown money field %q", r.Sum)}
+	}
+	if r.Format != ReportFormatCSV && r.Format != ReportFormatJSON {
+		return Report{}, ValidationError{Field: "format", Message: fmt.Sprintf("unknown format %q", r.Format)}
+	}
+	if r.Interval < 0 {
+		return Report{}, ValidationError{Field: "interval", Message: "must not be negative"}
+	}
+	if r.Interval > 0 && len(r.Recipients) == 0 {
+		return Report{}, ValidationError{Field: "recipients", Message: "scheduled report needs recipients"}
+	}
+	for _, rcpt := range r.Recipients {
+		if strings.TrimSpace(rcpt) == "" || strings.Contains(rcpt, ",") {
+			return Report{}, ValidationError{Field: "recipients", Message: fmt.Sprintf("invalid recipient %q", rcpt)}
+		}
+	}
+
+	id, err := s.store.WithContext(ctx).AddReport(r)
+	if err != nil {
+		return Report{}, err
+	}
+	r.ID = id
+	return r, nil
+}
+
+// RunReport выполняет отчёт и возвращает результат в формате отчёта
+func (s ParcelService) RunReport(ctx context.Context, r Report) ([]byte, error) {
+	f, err := ParseFilter(r.Filter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.store.WithContext(ctx).Aggregate(f, r.GroupBy, r.Sum)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch r.Format {
+	case ReportFormatJSON:
+		err = json.NewEncoder(&buf).Encode(rows)
+	case ReportFormatCSV:
+		w := csv.NewWriter(&buf)
+		header := r.GroupBy
+		if header == "" {
+			header = "key"
+		}
+		columns := []string{header, "count"}
+		if r.Sum != "" {
+			columns = append(columns, r.Sum)
+		}
+		w.Write(columns)
+		for _, row := range rows {
+			line := []string{row.Key, strconv.Itoa(row.Count)}
+			if r.Sum != "" {
+				line = append(line, row.Sum.String())
+			}
+			w.Write(line)
+		}
+		w.Flush()
+		err = w.Error()
+	default:
+		err = ValidationError{Field: "format", Message: fmt.Sprintf("unknown format %q", r.Format)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RunReports проверяет каждые interval, какие отчёты пора выполнить, выполняет их
+// и передаёт результат в deliver для отправки получателям отчёта.
+// Ошибки не прерывают расписание и передаются в onError, если он задан
+func (s ParcelService) RunReports(ctx context.Context, interval time.Duration, deliver func(Report, []byte) error, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.runDueReports(ctx, now, deliver); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// runDueReports выполняет отчёты всех магазинов, у которых с прошлого выполнения
+// прошёл их Interval. Каждый отчёт считается в своём магазине
+func (s ParcelService) runDueReports(ctx context.Context, now time.Time, deliver func(Report, []byte) error) error {
+	reports, err := s.store.WithContext(ctx).AllTenants().ListReports()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range reports {
+		if r.Interval == 0 {
+			continue
+		}
+		if last, err := time.Parse(time.RFC3339, r.LastRunAt); err == nil && now.Before(last.Add(r.Interval)) {
+			continue
+		}
+
+		ctx := WithTenant(ctx, r.Tenant)
+		data, err := s.RunReport(ctx, r)
+		if err != nil {
+			return fmt.Errorf("report %d: %w", r.ID, err)
+		}
+		if err := deliver(r, data); err != nil {
+			return fmt.Errorf("report %d: %w", r.ID, err)
+		}
+		if err := s.store.WithContext(ctx).SetReportRun(r.ID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
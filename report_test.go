@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunReport проверяет агрегацию и форматы отчёта
+func TestRunReport(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	for _, client := range []int64{1, 1, 2} {
+		_, err := service.Register(ctx, client, "Псков")
+		require.NoError(t, err)
+	}
+	r, err := service.SaveReport(ctx, Report{Name: "по клиентам", Filter: `status = "registered"`, GroupBy: "client", Format: ReportFormatCSV})
+	require.NoError(t, err)
+	require.NotZero(t, r.ID)
+
+	// csv
+	data, err := service.RunReport(ctx, r)
+	require.NoError(t, err)
+	assert.Equal(t, "client,count\n1,2\n2,1\n", string(data))
+
+	// json без группировки
+	r.GroupBy, r.Format = "", ReportFormatJSON
+	data, err = service.RunReport(ctx, r)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"key":"","count":3,"sum":"0.00"}]`, string(data))
+
+	// валидация
+	_, err = service.SaveReport(ctx, Report{Name: "x", Filter: "status =", Format: ReportFormatCSV})
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.SaveReport(ctx, Report{Name: "x", GroupBy: "password", Format: ReportFormatCSV})
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.SaveReport(ctx, Report{Name: "x", Format: "xlsx"})
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.SaveReport(ctx, Report{Name: "x", Format: ReportFormatCSV, Interval: time.Hour})
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+}
+
+// TestReportMoneySum проверяет, что суммы денежных полей точные на большом объёме:
+// 100 000 посылок по 0.10 дают ровно 10000.00, а не 10000.000000018 как во float64
+func TestReportMoneySum(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	_, err := store.db.Exec(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 100000)
+		INSERT INTO parcel (client, status, address, created_at, delivery_price, cod_amount)
+		SELECT n % 2 + 1, 'registered', 'test', '2024-01-01T00:00:00Z', 10, 1999 FROM seq`)
+	require.NoError(t, err)
+
+	var float float64
+	for i := 0; i < 100000; i++ {
+		float += 0.10
+	}
+	require.NotEqual(t, 10000.0, float)
+
+	// sum
+	r := Report{Name: "выручка", GroupBy: "client", Sum: "delivery_price", Format: ReportFormatCSV}
+	data, err := service.RunReport(ctx, r)
+	require.NoError(t, err)
+	assert.Equal(t, "client,count,delivery_price\n1,50000,5000.00\n2,50000,5000.00\n", string(data))
+
+	r.GroupBy, r.Sum, r.Format = "", "cod_amount", ReportFormatJSON
+	data, err = service.RunReport(ctx, r)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"key":"","count":100000,"sum":"1999000.00"}]`, string(data))
+
+	_, err = service.SaveReport(ctx, Report{Name: "x", Sum: "weight_kg", Format: ReportFormatCSV})
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+}
+
+// TestRunReports проверяет выполнение отчётов по расписанию
+func TestRunReports(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	scheduled, err := service.SaveReport(ctx, Report{Name: "ежечасный", Format: ReportFormatCSV, Interval: time.Hour, Recipients: []string{"ops@example.com"}})
+	require.NoError(t, err)
+	_, err = service.SaveReport(ctx, Report{Name: "ручной", Format: ReportFormatCSV})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var delivered []Report
+	deliver := func(r Report, _ []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, r)
+		return nil
+	}
+
+	// ручной отчёт не выполняется, ежечасный выполняется один раз за час
+	now := time.Now()
+	require.NoError(t, service.runDueReports(ctx, now, deliver))
+	require.NoError(t, service.runDueReports(ctx, now.Add(time.Minute), deliver))
+	require.Len(t, delivered, 1)
+	assert.Equal(t, scheduled.ID, delivered[0].ID)
+	assert.Equal(t, []string{"ops@example.com"}, delivered[0].Recipients)
+
+	reports, err := store.ListReports()
+	require.NoError(t, err)
+	assert.NotEmpty(t, reports[0].LastRunAt)
+	assert.Empty(t, reports[1].LastRunAt)
+
+	require.NoError(t, service.runDueReports(ctx, now.Add(time.Hour+time.Second), deliver))
+	assert.Len(t, delivered, 2)
+}
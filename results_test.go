@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEmptyResults проверяет, что списки без записей - пустые срезы, а не nil,
+// и что отсутствующая запись возвращается как sql.ErrNoRows
+func TestEmptyResults(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	all, err := ParseFilter("")
+	require.NoError(t, err)
+
+	lists := map[string]func() (any, error){
+		"GetByClient":           func() (any, error) { return store.GetByClient(42) },
+		"GetByCourier":          func() (any, error) { return store.GetByCourier(42) },
+		"GetByDestinationPoint": func() (any, error) { return store.GetByDestinationPoint(42) },
+		"ListOverdue":           func() (any, error) { return store.ListOverdue(time.Now()) },
+		"Search":                func() (any, error) { return store.Search(all) },
+		"GetStatusHistory":      func() (any, error) { return store.GetStatusHistory(42) },
+		"GetItems":              func() (any, error) { return store.GetItems(42) },
+		"ListReports":           func() (any, error) { return store.ListReports() },
+		"Aggregate":             func() (any, error) { return store.Aggregate(all, "status", "") },
+		"service.Search":        func() (any, error) { return service.Search(ctx, "") },
+		"service.ListOverdue":   func() (any, error) { return service.ListOverdue(ctx, time.Now()) },
+	}
+	for name, list := range lists {
+		res, err := list()
+		require.NoError(t, err, name)
+		data, err := json.Marshal(res)
+		require.NoError(t, err, name)
+		assert.Equal(t, "[]", string(data), name)
+	}
+
+	_, err = store.Get(42)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = service.Get(ctx, 42)
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestShardedEmptyResults проверяет те же правила для ShardedParcelStore
+func TestShardedEmptyResults(t *testing.T) {
+	dir := t.TempDir()
+	var shards []ParcelStore
+	for i := 0; i < 2; i++ {
+		db, err := OpenDB(filepath.Join(dir, fmt.Sprintf("shard%d.db", i)))
+		require.NoError(t, err)
+		defer db.Close()
+
+		store, err := NewParcelStore(db)
+		require.NoError(t, err)
+		shards = append(shards, store)
+	}
+	store, err := NewShardedParcelStore(shards...)
+	require.NoError(t, err)
+
+	res, err := store.GetByClient(42)
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+	assert.Empty(t, res)
+
+	_, err = store.Get(42)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+// TestListOrdering проверяет, что списки посылок упорядочены по номеру
+// в обоих хранилищах
+func TestListOrdering(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	courier, err := service.AddCourier(ctx, "Иван", "")
+	require.NoError(t, err)
+	point, err := service.AddLocation(ctx, LocationPickupPoint, "ПВЗ", "Псков")
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		p, err := service.Register(ctx, 7, "Псков")
+		require.NoError(t, err)
+		require.NoError(t, service.AssignCourier(ctx, p.Number, courier.ID))
+		require.NoError(t, service.SetLocations(ctx, p.Number, 0, point.ID))
+	}
+	// изменения строк не должны влиять на порядок
+	require.NoError(t, service.ChangeAddress(ctx, 3, "Москва"))
+	require.NoError(t, service.NextStatus(ctx, 1))
+
+	all, err := ParseFilter("client = 7")
+	require.NoError(t, err)
+	lists := map[string]func() ([]Parcel, error){
+		"GetByClient":           func() ([]Parcel, error) { return store.GetByClient(7) },
+		"GetByCourier":          func() ([]Parcel, error) { return store.GetByCourier(courier.ID) },
+		"GetByDestinationPoint": func() ([]Parcel, error) { return store.GetByDestinationPoint(point.ID) },
+		"Search":                func() ([]Parcel, error) { return store.Search(all) },
+	}
+	for name, list := range lists {
+		res, err := list()
+		require.NoError(t, err, name)
+		assertNumbersAscending(t, res, 5, name)
+	}
+
+	// sharded
+	dir := t.TempDir()
+	var shards []ParcelStore
+	for i := 0; i < 3; i++ {
+		db, err := OpenDB(filepath.Join(dir, fmt.Sprintf("shard%d.db", i)))
+		require.NoError(t, err)
+		defer db.Close()
+
+		shard, err := NewParcelStore(db)
+		require.NoError(t, err)
+		shards = append(shards, shard)
+	}
+	sharded, err := NewShardedParcelStore(shards...)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err := sharded.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+	res, err := sharded.GetByClient(getTestParcel().Client)
+	require.NoError(t, err)
+	assertNumbersAscending(t, res, 5, "sharded GetByClient")
+}
+
+func assertNumbersAscending(t *testing.T, parcels []Parcel, n int, msg string) {
+	t.Helper()
+
+	require.Len(t, parcels, n, msg)
+	for i := 1; i < len(parcels); i++ {
+		assert.Less(t, parcels[i-1].Number, parcels[i].Number, msg)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// GetReturn возвращает посылку обратной доставки, созданную для посылки number
+func (s ParcelStore) GetReturn(number int64) (Parcel, error) {
+	return s.scanParcel(s.db.QueryRowContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE return_of = :number AND "+tenantScope+" ORDER BY number DESC LIMIT 1",
+		sql.Named("number", number), s.tenantArg()))
+}
+
+// InitiateReturn начинает возврат отправленной или доставленной посылки:
+// переводит её в статус return_requested и регистрирует посылку обратной доставки
+// на адрес address, связанную с исходной через ReturnOf
+func (s ParcelService) InitiateReturn(ctx context.Context, number int64, address string) (_ Parcel, err error) {
+	defer s.logOp(ctx, "initiate_return", time.Now(), &err, slog.Int64("number", number))
+	if err := validateAddress(address); err != nil {
+		return Parcel{}, err
+	}
+
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return Parcel{}, err
+	}
+	if err := checkParcelAccess(ctx, accessEdit, parcel); err != nil {
+		return Parcel{}, err
+	}
+	if parcel.ReturnOf != 0 {
+		return Parcel{}, fmt.Errorf("%w: parcel %d is already a return", ErrForbiddenTransition, number)
+	}
+	if err := checkTransition(parcel.Status, ParcelStatusReturnRequested); err != nil {
+		return Parcel{}, err
+	}
+
+	leg := Parcel{
+		Client:    parcel.Client,
+		Status:    ParcelStatusRegistered,
+		Address:   address,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		ReturnOf:  parcel.Number,
+	}
+
+	store := s.store.WithContext(ctx)
+	if err := store.SetStatus(number, ParcelStatusReturnRequested); err != nil {
+		return Parcel{}, err
+	}
+	leg, err = addTracked(store, leg)
+	if err != nil {
+		return Parcel{}, err
+	}
+	return leg, nil
+}
+
+// ShipReturn отмечает, что посылка обратной доставки для number отправлена:
+// исходная посылка переходит в статус returning
+func (s ParcelService) ShipReturn(ctx context.Context, number int64) error {
+	return s.advanceReturn(ctx, number, ParcelStatusReturning, ParcelStatusSent)
+}
+
+// CompleteReturn отмечает, что возврат посылки number доставлен отправителю:
+// исходная посылка переходит в статус returned
+func (s ParcelService) CompleteReturn(ctx context.Context, number int64) error {
+	return s.advanceReturn(ctx, number, ParcelStatusReturned, ParcelStatusDelivered)
+}
+
+// advanceReturn переводит исходную посылку в статус status,
+// а её посылку обратной доставки - в статус legStatus
+func (s ParcelService) advanceReturn(ctx context.Context, number int64, status, legStatus string) error {
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if err := checkParcelAccess(ctx, accessStatus, parcel); err != nil {
+		return err
+	}
+	if err := checkTransition(parcel.Status, status); err != nil {
+		return err
+	}
+
+	store := s.store.WithContext(ctx)
+	leg, err := store.GetReturn(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: return of parcel %d", ErrParcelNotFound, number)
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkTransition(leg.Status, legStatus); err != nil {
+		return err
+	}
+
+	if err := store.SetStatus(leg.Number, legStatus); err != nil {
+		return err
+	}
+
+	return store.SetStatus(number, status)
+}
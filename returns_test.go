@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReturnWorkflow проверяет полный цикл возврата доставленной посылки
+func TestReturnWorkflow(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	p, err := service.Register(ctx, 1, "test")
+	require.NoError(t, err)
+
+	// вернуть можно только отправленную или доставленную посылку
+	_, err = service.InitiateReturn(ctx, p.Number, "warehouse")
+	require.ErrorIs(t, err, ErrForbiddenTransition)
+
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+
+	// initiate
+	leg, err := service.InitiateReturn(ctx, p.Number, "warehouse")
+	require.NoError(t, err)
+	assert.Equal(t, p.Number, leg.ReturnOf)
+	assert.Equal(t, ParcelStatusRegistered, leg.Status)
+
+	stored, err := service.Get(ctx, leg.Number)
+	require.NoError(t, err)
+	assert.Equal(t, leg, stored)
+
+	// ship
+	require.NoError(t, service.ShipReturn(ctx, p.Number))
+	assertStatus(t, service, p.Number, ParcelStatusReturning)
+	assertStatus(t, service, leg.Number, ParcelStatusSent)
+
+	// complete
+	require.NoError(t, service.CompleteReturn(ctx, p.Number))
+	assertStatus(t, service, p.Number, ParcelStatusReturned)
+	assertStatus(t, service, leg.Number, ParcelStatusDelivered)
+
+	// возврат не меняет обычный маршрут: NextStatus больше ничего не делает
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	assertStatus(t, service, p.Number, ParcelStatusReturned)
+}
+
+// assertStatus проверяет текущий статус посылки
+func assertStatus(t *testing.T, service ParcelService, number int64, status string) {
+	t.Helper()
+
+	p, err := service.Get(context.Background(), number)
+	require.NoError(t, err)
+	assert.Equal(t, status, p.Status)
+}
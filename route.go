@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrRouteCompleted возвращается AdvanceToNextHop, если посылка уже прибыла
+// в последний пункт маршрута или маршрут не задан
+var ErrRouteCompleted = errors.New("parcel route is completed")
+
+// RouteHop - пункт маршрута посылки
+type RouteHop struct {
+	Seq       int // порядковый номер пункта, начиная с 1
+	Location  int
+	ArrivedAt string // RFC3339, пусто - посылка ещё не прибыла
+}
+
+// SetRoute заменяет маршрут посылки списком мест в порядке следования
+func (s ParcelStore) SetRoute(number int64, locations []int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(s.context(), "DELETE FROM parcel_route WHERE number = :number AND "+tenantScope,
+			sql.Named("number", number), s.tenantArg()); err != nil {
+			return err
+		}
+		for i, location := range locations {
+			_, err := tx.ExecContext(s.context(), "INSERT INTO parcel_route (number, seq, location_id, tenant_id) VALUES (:number, :seq, :location, "+parcelTenant+")",
+				sql.Named("number", number),
+				sql.Named("seq", i+1),
+				sql.Named("location", location))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRoute возвращает маршрут посылки в порядке следования
+func (s ParcelStore) GetRoute(number int64) ([]RouteHop, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT seq, location_id, arrived_at FROM parcel_route WHERE number = :number AND "+tenantScope+" ORDER BY seq",
+		sql.Named("number", number), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []RouteHop{}
+	for rows.Next() {
+		var h RouteHop
+		if err := rows.Scan(&h.Seq, &h.Location, &h.ArrivedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, h)
+	}
+	return res, rows.Err()
+}
+
+// ArriveAtHop отмечает прибытие посылки в пункт маршрута seq и переводит её
+// по очереди в статусы statuses в одной транзакции. Если прибытие в пункт
+// уже отмечено, возвращает ErrRouteCompleted
+func (s ParcelStore) ArriveAtHop(number int64, seq int, statuses []string) (string, error) {
+	for _, status := range statuses {
+		if err := s.preStatusChange(number, status); err != nil {
+			return "", err
+		}
+	}
+
+	arrived := time.Now().UTC().Format(time.RFC3339)
+	err := s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(s.context(), "UPDATE parcel_route SET arrived_at = :arrived WHERE number = :number AND seq = :seq AND arrived_at = '' AND "+tenantScope,
+			sql.Named("arrived", arrived),
+			sql.Named("number", number),
+			sql.Named("seq", seq),
+			s.tenantArg())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: hop %d of parcel %d", ErrRouteCompleted, seq, number)
+		}
+
+		comment := fmt.Sprintf("arrived at route hop %d", seq)
+		for _, status := range statuses {
+			if _, err := tx.ExecContext(s.context(), "UPDATE parcel SET status = :status WHERE number = :number AND "+tenantScope,
+				sql.Named("status", status),
+				sql.Named("number", number),
+				s.tenantArg()); err != nil {
+				return err
+			}
+			if err := s.addStatusChange(tx, number, status, comment); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, status := range statuses {
+		s.notify(ParcelEvent{Type: ParcelEventStatusChanged, Number: number, Status: status})
+	}
+	return arrived, nil
+}
+
+// SetRoute задаёт маршрут посылки через склады, сортировочные центры и пункты выдачи,
+// пока посылка не отправлена
+func (s ParcelService) SetRoute(ctx context.Context, number int64, locations []int) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		return ValidationError{Field: "route", Message: "must not be empty"}
+	}
+	if err := s.checkRegistered(ctx, number); err != nil {
+		return err
+	}
+	for _, id := range locations {
+		if _, err := s.GetLocation(ctx, id); err != nil {
+			return err
+		}
+	}
+	return s.store.WithContext(ctx).SetRoute(number, locations)
+}
+
+// GetRoute возвращает маршрут посылки
+func (s ParcelService) GetRoute(ctx context.Context, number int64) ([]RouteHop, error) {
+	if _, err := s.Get(ctx, number); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetRoute(number)
+}
+
+// AdvanceToNextHop отмечает прибытие посылки в следующий пункт маршрута.
+// При прибытии в первый пункт посылка считается отправленной, при прибытии
+// в последний - доставленной
+func (s ParcelService) AdvanceToNextHop(ctx context.Context, number int64) (_ RouteHop, err error) {
+	defer s.logOp(ctx, "advance_to_next_hop", time.Now(), &err, slog.Int64("number", number))
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return RouteHop{}, err
+	}
+	if err := checkParcelAccess(ctx, accessStatus, parcel); err != nil {
+		return RouteHop{}, err
+	}
+	store := s.store.WithContext(ctx)
+	route, err := store.GetRoute(number)
+	if err != nil {
+		return RouteHop{}, err
+	}
+
+	next := -1
+	for i, hop := range route {
+		if hop.ArrivedAt == "" {
+			next = i
+			break
+		}
+	}
+	if next < 0 {
+		return RouteHop{}, fmt.Errorf("%w: parcel %d", ErrRouteCompleted, number)
+	}
+
+	target := ParcelStatusSent
+	if next == len(route)-1 {
+		target = ParcelStatusDelivered
+	}
+	var statuses []string
+	for status := parcel.Status; status != target; {
+		step, ok := nextStatus(status)
+		if !ok {
+			return RouteHop{}, fmt.Errorf("%w: parcel %d is %s", ErrForbiddenTransition, number, parcel.Status)
+		}
+		statuses = append(statuses, step)
+		status = step
+	}
+
+	hop := route[next]
+	if hop.ArrivedAt, err = store.ArriveAtHop(number, hop.Seq, statuses); err != nil {
+		return RouteHop{}, err
+	}
+
+	return hop, nil
+}
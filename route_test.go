@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoute проверяет движение посылки по маршруту и смену статусов
+func TestRoute(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	var route []int
+	for _, kind := range []string{LocationWarehouse, LocationSortingCenter, LocationPickupPoint} {
+		l, err := service.AddLocation(ctx, kind, kind, "Псков")
+		require.NoError(t, err)
+		route = append(route, l.ID)
+	}
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.SetRoute(ctx, p.Number, route))
+
+	// первый пункт - посылка отправлена
+	hop, err := service.AdvanceToNextHop(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, 1, hop.Seq)
+	assert.Equal(t, route[0], hop.Location)
+	assert.NotEmpty(t, hop.ArrivedAt)
+	assertStatus(t, service, p.Number, ParcelStatusSent)
+
+	// после отправки маршрут не меняется
+	assert.ErrorIs(t, service.SetRoute(ctx, p.Number, route[:1]), ErrParcelLocked)
+
+	// промежуточный пункт - статус прежний
+	_, err = service.AdvanceToNextHop(ctx, p.Number)
+	require.NoError(t, err)
+	assertStatus(t, service, p.Number, ParcelStatusSent)
+
+	// последний пункт - посылка доставлена
+	_, err = service.AdvanceToNextHop(ctx, p.Number)
+	require.NoError(t, err)
+	assertStatus(t, service, p.Number, ParcelStatusDelivered)
+
+	_, err = service.AdvanceToNextHop(ctx, p.Number)
+	assert.ErrorIs(t, err, ErrRouteCompleted)
+
+	hops, err := service.GetRoute(ctx, p.Number)
+	require.NoError(t, err)
+	require.Len(t, hops, 3)
+	for _, h := range hops {
+		assert.NotEmpty(t, h.ArrivedAt)
+	}
+
+	history, err := service.GetStatusHistory(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "arrived at route hop 3", history[len(history)-1].Comment)
+}
+
+// TestRouteSingleHop проверяет маршрут из одного пункта: посылка сразу доставлена
+func TestRouteSingleHop(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	point, err := service.AddLocation(ctx, LocationPickupPoint, "ПВЗ", "Псков")
+	require.NoError(t, err)
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.SetRoute(ctx, p.Number, []int{point.ID}))
+
+	_, err = service.AdvanceToNextHop(ctx, p.Number)
+	require.NoError(t, err)
+	assertStatus(t, service, p.Number, ParcelStatusDelivered)
+
+	// отменённую посылку по маршруту не двигаем
+	p, err = service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.SetRoute(ctx, p.Number, []int{point.ID}))
+	require.NoError(t, service.Cancel(ctx, p.Number, "передумал"))
+	_, err = service.AdvanceToNextHop(ctx, p.Number)
+	assert.ErrorIs(t, err, ErrForbiddenTransition)
+
+	assert.ErrorIs(t, service.SetRoute(ctx, p.Number, nil), ErrInvalidParcel)
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations содержит шаги создания и изменения схемы БД.
+// Номер шага (начиная с 1) хранится в PRAGMA user_version,
+// поэтому новые шаги добавляются только в конец списка.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS parcel
+(
+    number     integer
+        constraint parcel_pk
+            primary key autoincrement,
+    client     integer      not null,
+    status     VARCHAR(128) not null,
+    address    VARCHAR(512) not null,
+    created_at text         not null
+);
+CREATE INDEX IF NOT EXISTS parcel_client_idx ON parcel (client);
+CREATE INDEX IF NOT EXISTS parcel_status_idx ON parcel (status);`,
+	`ALTER TABLE parcel ADD COLUMN cancel_reason VARCHAR(512) not null default '';`,
+	`CREATE TABLE parcel_archive
+(
+    number        integer      not null
+        constraint parcel_archive_pk
+            primary key,
+    client        integer      not null,
+    status        VARCHAR(128) not null,
+    address       VARCHAR(512) not null,
+    created_at    text         not null,
+    cancel_reason VARCHAR(512) not null default '',
+    archived_at   text         not null
+);`,
+	`CREATE TABLE parcel_status_history
+(
+    id         integer
+        constraint parcel_status_history_pk
+            primary key autoincrement,
+    number     integer      not null,
+    status     VARCHAR(128) not null,
+    changed_at text         not null,
+    actor      VARCHAR(128) not null
+);
+CREATE INDEX parcel_status_history_number_idx ON parcel_status_history (number);`,
+	`ALTER TABLE parcel_status_history ADD COLUMN comment VARCHAR(512) not null default '';`,
+	`ALTER TABLE parcel_status_history ADD COLUMN received_at text not null default '';
+ALTER TABLE parcel_status_history ADD COLUMN device_at text not null default '';
+UPDATE parcel_status_history SET received_at = changed_at;`,
+	`ALTER TABLE parcel ADD COLUMN return_of integer not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN return_of integer not null default 0;
+CREATE INDEX parcel_return_of_idx ON parcel (return_of);`,
+	`CREATE TABLE parcel_delivery_proof
+(
+    number         integer      not null
+        constraint parcel_delivery_proof_pk
+            primary key,
+    recipient_name VARCHAR(256) not null,
+    delivered_at   text         not null,
+    photo_ref      VARCHAR(512) not null default '',
+    signature_ref  VARCHAR(512) not null default ''
+);`,
+	`ALTER TABLE parcel ADD COLUMN deadline text not null default '';
+ALTER TABLE parcel_archive ADD COLUMN deadline text not null default '';
+CREATE INDEX parcel_deadline_idx ON parcel (deadline) WHERE deadline != '';`,
+	`ALTER TABLE parcel ADD COLUMN zone VARCHAR(256) not null default '';
+ALTER TABLE parcel ADD COLUMN eta text not null default '';
+ALTER TABLE parcel_archive ADD COLUMN zone VARCHAR(256) not null default '';
+ALTER TABLE parcel_archive ADD COLUMN eta text not null default '';
+CREATE INDEX parcel_zone_idx ON parcel (zone);`,
+	`CREATE TABLE courier
+(
+    id    integer
+        constraint courier_pk
+            primary key autoincrement,
+    name  VARCHAR(256) not null,
+    phone VARCHAR(64)  not null default ''
+);
+ALTER TABLE parcel ADD COLUMN courier_id integer not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN courier_id integer not null default 0;
+CREATE INDEX parcel_courier_idx ON parcel (courier_id) WHERE courier_id != 0;`,
+	`CREATE TABLE location
+(
+    id      integer
+        constraint location_pk
+            primary key autoincrement,
+    kind    VARCHAR(32)  not null,
+    name    VARCHAR(256) not null,
+    address VARCHAR(512) not null
+);
+ALTER TABLE parcel ADD COLUMN origin_id integer not null default 0;
+ALTER TABLE parcel ADD COLUMN destination_id integer not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN origin_id integer not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN destination_id integer not null default 0;
+CREATE INDEX parcel_destination_idx ON parcel (destination_id) WHERE destination_id != 0;`,
+	`ALTER TABLE parcel ADD COLUMN tracking_number VARCHAR(16) not null default '';
+ALTER TABLE parcel_archive ADD COLUMN tracking_number VARCHAR(16) not null default '';
+CREATE UNIQUE INDEX parcel_tracking_number_idx ON parcel (tracking_number) WHERE tracking_number != '';`,
+	`CREATE TABLE report
+(
+    id          integer
+        constraint report_pk
+            primary key autoincrement,
+    name        VARCHAR(256)  not null,
+    filter      VARCHAR(2048) not null default '',
+    group_by    VARCHAR(64)   not null default '',
+    format      VARCHAR(16)   not null,
+    interval_s  integer       not null default 0,
+    recipients  VARCHAR(2048) not null default '',
+    last_run_at text          not null default ''
+);`,
+	`ALTER TABLE parcel ADD COLUMN weight_kg real not null default 0;
+ALTER TABLE parcel ADD COLUMN length_cm real not null default 0;
+ALTER TABLE parcel ADD COLUMN width_cm real not null default 0;
+ALTER TABLE parcel ADD COLUMN height_cm real not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN weight_kg real not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN length_cm real not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN width_cm real not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN height_cm real not null default 0;`,
+	`ALTER TABLE parcel ADD COLUMN declared_value integer not null default 0;
+ALTER TABLE parcel ADD COLUMN delivery_price integer not null default 0;
+ALTER TABLE parcel ADD COLUMN cod_amount integer not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN declared_value integer not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN delivery_price integer not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN cod_amount integer not null default 0;`,
+	`CREATE TABLE parcel_items
+(
+    id          integer
+        constraint parcel_items_pk
+            primary key autoincrement,
+    number      integer      not null,
+    description VARCHAR(512) not null,
+    quantity    integer      not null,
+    unit_value  integer      not null default 0
+);
+CREATE INDEX parcel_items_number_idx ON parcel_items (number);`,
+	`ALTER TABLE report ADD COLUMN sum VARCHAR(64) not null default '';`,
+	`CREATE TABLE parcel_route
+(
+    number      integer not null,
+    seq         integer not null,
+    location_id integer not null,
+    arrived_at  text    not null default '',
+    constraint parcel_route_pk
+        primary key (number, seq)
+);`,
+	`CREATE TABLE parcel_address_history
+(
+    id         integer
+        constraint parcel_address_history_pk
+            primary key autoincrement,
+    number     integer      not null,
+    address    VARCHAR(512) not null,
+    changed_at text         not null,
+    actor      VARCHAR(128) not null
+);
+CREATE INDEX parcel_address_history_number_idx ON parcel_address_history (number);`,
+	`CREATE TABLE parcel_notes
+(
+    id         integer
+        constraint parcel_notes_pk
+            primary key autoincrement,
+    number     integer       not null,
+    author     VARCHAR(128)  not null,
+    text       VARCHAR(1024) not null,
+    created_at text          not null
+);
+CREATE INDEX parcel_notes_number_idx ON parcel_notes (number);`,
+	`CREATE TABLE parcel_tags
+(
+    number integer     not null,
+    tag    VARCHAR(64) not null,
+    constraint parcel_tags_pk
+        primary key (number, tag)
+);
+CREATE INDEX parcel_tags_tag_idx ON parcel_tags (tag);`,
+	`ALTER TABLE parcel ADD COLUMN priority VARCHAR(16) not null default 'normal';
+ALTER TABLE parcel_archive ADD COLUMN priority VARCHAR(16) not null default 'normal';`,
+	`ALTER TABLE parcel ADD COLUMN recipient_client integer not null default 0;
+ALTER TABLE parcel ADD COLUMN recipient_name VARCHAR(256) not null default '';
+ALTER TABLE parcel ADD COLUMN recipient_phone VARCHAR(64) not null default '';
+ALTER TABLE parcel_archive ADD COLUMN recipient_client integer not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN recipient_name VARCHAR(256) not null default '';
+ALTER TABLE parcel_archive ADD COLUMN recipient_phone VARCHAR(64) not null default '';
+CREATE INDEX parcel_recipient_client_idx ON parcel (recipient_client) WHERE recipient_client != 0;`,
+	`CREATE INDEX parcel_recipient_phone_idx ON parcel (recipient_phone) WHERE recipient_phone != '';`,
+	`CREATE TABLE parcel_delivery_attempts
+(
+    id           integer
+        constraint parcel_delivery_attempts_pk
+            primary key autoincrement,
+    number       integer      not null,
+    attempted_at text         not null,
+    outcome      VARCHAR(32)  not null,
+    reason       VARCHAR(512) not null default ''
+);
+CREATE INDEX parcel_delivery_attempts_number_idx ON parcel_delivery_attempts (number);`,
+	`ALTER TABLE parcel ADD COLUMN parent_number integer not null default 0;
+ALTER TABLE parcel_archive ADD COLUMN parent_number integer not null default 0;
+CREATE INDEX parcel_parent_number_idx ON parcel (parent_number) WHERE parent_number != 0;`,
+	`CREATE TABLE webhook
+(
+    id         integer
+        constraint webhook_pk
+            primary key autoincrement,
+    client     integer       not null,
+    url        VARCHAR(2048) not null,
+    secret     VARCHAR(256)  not null,
+    created_at text          not null
+);
+CREATE INDEX webhook_client_idx ON webhook (client);
+CREATE TABLE webhook_delivery
+(
+    id              integer
+        constraint webhook_delivery_pk
+            primary key autoincrement,
+    webhook_id      integer      not null,
+    event_type      VARCHAR(32)  not null,
+    payload         text         not null,
+    state           VARCHAR(16)  not null,
+    attempts        integer      not null default 0,
+    next_attempt_at text         not null,
+    last_error      VARCHAR(512) not null default ''
+);
+CREATE INDEX webhook_delivery_due_idx ON webhook_delivery (state, next_attempt_at);`,
+	`CREATE TABLE api_key
+(
+    id         integer
+        constraint api_key_pk
+            primary key autoincrement,
+    name       VARCHAR(256) not null,
+    prefix     VARCHAR(16)  not null,
+    hash       VARCHAR(64)  not null,
+    created_at text         not null
+);
+CREATE UNIQUE INDEX api_key_hash_idx ON api_key (hash);`,
+	`ALTER TABLE api_key ADD COLUMN role VARCHAR(16) not null default 'dispatcher';`,
+	`CREATE TABLE tenant
+(
+    id         integer
+        constraint tenant_pk
+            primary key autoincrement,
+    name       VARCHAR(256) not null,
+    created_at text         not null
+);
+INSERT INTO tenant (id, name, created_at) VALUES (1, 'default', strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+ALTER TABLE parcel ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE parcel_archive ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE parcel_status_history ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE parcel_address_history ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE parcel_items ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE parcel_route ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE parcel_notes ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE parcel_tags ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE parcel_delivery_attempts ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE parcel_delivery_proof ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE courier ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE location ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE report ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE webhook ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE webhook_delivery ADD COLUMN tenant_id integer not null default 1;
+ALTER TABLE api_key ADD COLUMN tenant_id integer not null default 1;
+CREATE INDEX parcel_tenant_client_idx ON parcel (tenant_id, client);
+CREATE INDEX courier_tenant_idx ON courier (tenant_id);
+CREATE INDEX location_tenant_idx ON location (tenant_id);
+CREATE INDEX report_tenant_idx ON report (tenant_id);
+CREATE INDEX webhook_tenant_client_idx ON webhook (tenant_id, client);`,
+	`CREATE TABLE audit_log
+(
+    id         integer
+        constraint audit_log_pk
+            primary key autoincrement,
+    number     integer      not null,
+    action     VARCHAR(32)  not null,
+    actor      VARCHAR(256) not null,
+    at         text         not null,
+    before     text         not null default '',
+    after      text         not null default '',
+    tenant_id  integer      not null default 1
+);
+CREATE INDEX audit_log_number_idx ON audit_log (tenant_id, number);
+CREATE INDEX audit_log_at_idx ON audit_log (tenant_id, at);
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;`,
+	`ALTER TABLE parcel ADD COLUMN recipient_phone_idx VARCHAR(128) not null default '';
+CREATE INDEX parcel_recipient_phone_blind_idx ON parcel (recipient_phone_idx) WHERE recipient_phone_idx != '';`,
+	`CREATE TABLE client_erasure
+(
+    id        integer
+        constraint client_erasure_pk
+            primary key autoincrement,
+    client    integer      not null,
+    erased_at text         not null,
+    actor     VARCHAR(256) not null,
+    parcels   integer      not null,
+    tenant_id integer      not null default 1
+);
+CREATE INDEX client_erasure_client_idx ON client_erasure (tenant_id, client);
+DROP TRIGGER audit_log_no_update;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+WHEN NOT (NEW.id = OLD.id AND NEW.number = OLD.number AND NEW.action = OLD.action AND NEW.actor = OLD.actor
+    AND NEW.at = OLD.at AND NEW.tenant_id = OLD.tenant_id
+    AND json_remove(NULLIF(NEW.before, ''), '$.address', '$.recipient_name', '$.recipient_phone')
+        IS json_remove(NULLIF(OLD.before, ''), '$.address', '$.recipient_name', '$.recipient_phone')
+    AND json_remove(NULLIF(NEW.after, ''), '$.address', '$.recipient_name', '$.recipient_phone')
+        IS json_remove(NULLIF(OLD.after, ''), '$.address', '$.recipient_name', '$.recipient_phone'))
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;`,
+}
+
+// migrate применяет к БД ещё не выполненные шаги из migrations
+func migrate(db *sql.DB) error {
+	version, err := schemaVersion(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := applyMigration(db, i+1, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// migrationBackfills - заполнение данных, которое нельзя выразить в SQL шага миграции.
+// Выполняется в транзакции шага с тем же номером после его запроса
+var migrationBackfills = map[int]func(tx *sql.Tx) error{
+	13: backfillTrackingNumbers,
+}
+
+// applyMigration выполняет один шаг миграции и обновляет версию схемы в одной транзакции
+func applyMigration(db *sql.DB, version int, query string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if backfill, ok := migrationBackfills[version]; ok {
+		if err := backfill(tx); err != nil {
+			return err
+		}
+	}
+	// PRAGMA не поддерживает параметры запроса
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
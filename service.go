@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Ошибки предметной области, которые возвращает ParcelService.
+// Вызывающий код проверяет их через errors.Is
+var (
+	ErrParcelNotFound = errors.New("parcel not found")
+	ErrInvalidParcel  = errors.New("invalid parcel")
+	ErrParcelLocked   = errors.New("parcel can be changed only in registered status")
+)
+
+// ValidationError описывает некорректное входное значение.
+// errors.Is(err, ErrInvalidParcel) выполняется для любой ValidationError
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrInvalidParcel, e.Field, e.Message)
+}
+
+func (e ValidationError) Is(target error) bool {
+	return target == ErrInvalidParcel
+}
+
+type ParcelService struct {
+	store     ParcelStore
+	eta       ETACalculator
+	limits    DimensionLimits
+	cursorKey []byte // ключ подписи курсоров, см. WithCursorKey
+
+	maxAttempts int          // см. WithMaxAttempts
+	logger      *slog.Logger // журнал операций, см. WithLogger
+}
+
+func NewParcelService(store ParcelStore) ParcelService {
+	return ParcelService{
+		store:       store,
+		eta:         NewETACalculator(store, DefaultETA),
+		limits:      DefaultDimensionLimits,
+		cursorKey:   randomCursorKey(),
+		maxAttempts: DefaultMaxAttempts,
+	}
+}
+
+func (s ParcelService) Register(ctx context.Context, client int64, address string) (_ Parcel, err error) {
+	defer s.logOp(ctx, "register", time.Now(), &err, slog.Int64("client", client))
+	if err := validateClient(client); err != nil {
+		return Parcel{}, err
+	}
+	if err := requireClient(ctx, client); err != nil {
+		return Parcel{}, err
+	}
+	if err := validateAddress(address); err != nil {
+		return Parcel{}, err
+	}
+
+	now := time.Now().UTC()
+	eta, err := s.eta.Estimate(ctx, address, now)
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	parcel := Parcel{
+		Client:    client,
+		Status:    ParcelStatusRegistered,
+		Address:   address,
+		CreatedAt: now.Format(time.RFC3339),
+		ETA:       eta,
+		Priority:  PriorityNormal,
+	}
+
+	parcel, err = addTracked(s.store.WithContext(ctx), parcel)
+	if err != nil {
+		return parcel, err
+	}
+
+	return parcel, nil
+}
+
+// Get возвращает посылку по номеру или ErrParcelNotFound
+func (s ParcelService) Get(ctx context.Context, number int64) (Parcel, error) {
+	p, err := s.store.WithContext(ctx).Get(number)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !canSee(ctx, p)) {
+		return Parcel{}, fmt.Errorf("%w: %d", ErrParcelNotFound, number)
+	}
+	return p, err
+}
+
+// GetStatuses возвращает статусы нескольких посылок без чтения полных записей,
+// например для списка заказов витрины. Ненайденных посылок в результате нет
+func (s ParcelService) GetStatuses(ctx context.Context, numbers []int64) (map[int64]string, error) {
+	if err := requireStaff(ctx); err != nil {
+		return nil, err
+	}
+	if len(numbers) > MaxPageSize {
+		return nil, ValidationError{Field: "numbers", Message: fmt.Sprintf("must contain at most %d numbers", MaxPageSize)}
+	}
+	return s.store.WithContext(ctx).GetStatuses(numbers)
+}
+
+// GetStatusHistory возвращает историю изменений статуса посылки
+func (s ParcelService) GetStatusHistory(ctx context.Context, number int64) ([]StatusChange, error) {
+	if _, err := s.Get(ctx, number); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetStatusHistory(number)
+}
+
+func (s ParcelService) PrintClientParcels(ctx context.Context, client int64) (err error) {
+	defer s.logOp(ctx, "client_parcels", time.Now(), &err, slog.Int64("client", client))
+	if err := validateClient(client); err != nil {
+		return err
+	}
+	if err := requireClient(ctx, client); err != nil {
+		return err
+	}
+
+	parcels, err := s.store.WithContext(ctx).GetByClient(client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Посылки клиента %d:\n", client)
+	for _, parcel := range parcels {
+		fmt.Printf("Посылка № %d на адрес %s от клиента с идентификатором %d зарегистрирована %s, статус %s\n",
+			parcel.Number, parcel.Address, parcel.Client, parcel.CreatedAt, parcel.Status)
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func (s ParcelService) NextStatus(ctx context.Context, number int64) (err error) {
+	defer s.logOp(ctx, "next_status", time.Now(), &err, slog.Int64("number", number))
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if err := checkParcelAccess(ctx, accessStatus, parcel); err != nil {
+		return err
+	}
+
+	if err := checkConsolidated(parcel); err != nil {
+		return err
+	}
+
+	next, ok := nextStatus(parcel.Status)
+	if !ok {
+		return nil
+	}
+
+	return s.store.WithContext(ctx).SetStatusFrom(number, parcel.Status, next)
+}
+
+// SetStatus переводит посылку в указанный статус, если такой переход
+// разрешён parcelTransitions, иначе возвращает ErrForbiddenTransition
+func (s ParcelService) SetStatus(ctx context.Context, number int64, status string) error {
+	return s.setStatus(ctx, s.store, number, status)
+}
+
+// ReportStatus работает как SetStatus для изменения, зафиксированного на устройстве
+// курьера в момент deviceTime. Если часы устройства расходятся с серверными
+// больше чем на MaxClockSkew, в истории используется время получения изменения
+func (s ParcelService) ReportStatus(ctx context.Context, number int64, status string, deviceTime time.Time) error {
+	return s.setStatus(ctx, s.store.WithDeviceTime(deviceTime), number, status)
+}
+
+// setStatus проверяет и выполняет переход посылки в статус status через store
+func (s ParcelService) setStatus(ctx context.Context, store ParcelStore, number int64, status string) (err error) {
+	defer s.logOp(ctx, "set_status", time.Now(), &err, slog.Int64("number", number), slog.String("status", status))
+	if err := validateStatus(status); err != nil {
+		return err
+	}
+
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if err := checkParcelAccess(ctx, accessStatus, parcel); err != nil {
+		return err
+	}
+
+	if err := checkConsolidated(parcel); err != nil {
+		return err
+	}
+	if err := checkTransition(parcel.Status, status); err != nil {
+		return err
+	}
+
+	return store.WithContext(ctx).SetStatusFrom(number, parcel.Status, status)
+}
+
+// ChangeAddress меняет адрес посылки, пока она не отправлена,
+// иначе возвращает ErrParcelLocked
+func (s ParcelService) ChangeAddress(ctx context.Context, number int64, address string) (err error) {
+	defer s.logOp(ctx, "change_address", time.Now(), &err, slog.Int64("number", number))
+	if err := validateAddress(address); err != nil {
+		return err
+	}
+
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if err := checkParcelAccess(ctx, accessEdit, parcel); err != nil {
+		return err
+	}
+	if parcel.Status != ParcelStatusRegistered {
+		return fmt.Errorf("%w: parcel %d is %s", ErrParcelLocked, number, parcel.Status)
+	}
+
+	// зона доставки могла измениться, поэтому срок пересчитывается от даты регистрации
+	registered, err := time.Parse(time.RFC3339, parcel.CreatedAt)
+	if err != nil {
+		return err
+	}
+	eta, err := s.eta.Estimate(ctx, address, registered)
+	if err != nil {
+		return err
+	}
+
+	store := s.store.WithContext(ctx)
+	if err := store.SetAddress(number, address); err != nil {
+		return err
+	}
+	return store.SetETA(number, eta)
+}
+
+// Cancel отменяет посылку до отправки. В отличие от Delete запись
+// о посылке остаётся в БД со статусом cancelled и причиной отмены
+func (s ParcelService) Cancel(ctx context.Context, number int64, reason string) (err error) {
+	defer s.logOp(ctx, "cancel", time.Now(), &err, slog.Int64("number", number))
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if err := checkParcelAccess(ctx, accessEdit, parcel); err != nil {
+		return err
+	}
+
+	if err := checkConsolidated(parcel); err != nil {
+		return err
+	}
+	if err := checkTransition(parcel.Status, ParcelStatusCancelled); err != nil {
+		return err
+	}
+
+	err = s.store.WithContext(ctx).Cancel(number, reason)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete удаляет посылку, пока она не отправлена, иначе возвращает ErrParcelLocked
+func (s ParcelService) Delete(ctx context.Context, number int64) (err error) {
+	defer s.logOp(ctx, "delete", time.Now(), &err, slog.Int64("number", number))
+	if err := s.checkRegistered(ctx, number); err != nil {
+		return err
+	}
+
+	return s.store.WithContext(ctx).Delete(number)
+}
+
+// checkRegistered проверяет, что посылка существует и ещё не отправлена
+func (s ParcelService) checkRegistered(ctx context.Context, number int64) error {
+	parcel, err := s.Get(ctx, number)
+	if err != nil {
+		return err
+	}
+	if err := checkParcelAccess(ctx, accessEdit, parcel); err != nil {
+		return err
+	}
+	if parcel.Status != ParcelStatusRegistered {
+		return fmt.Errorf("%w: parcel %d is %s", ErrParcelLocked, number, parcel.Status)
+	}
+	return nil
+}
+
+func validateClient(client int64) error {
+	if client <= 0 {
+		return ValidationError{Field: "client", Message: "must be positive"}
+	}
+	return nil
+}
+
+func validateAddress(address string) error {
+	if strings.TrimSpace(address) == "" {
+		return ValidationError{Field: "address", Message: "must not be empty"}
+	}
+	return nil
+}
+
+func validateStatus(status string) error {
+	if _, ok := parcelTransitions[status]; !ok {
+		return ValidationError{Field: "status", Message: fmt.Sprintf("unknown status %q", status)}
+	}
+	return nil
+}
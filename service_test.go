@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestService создаёт сервис поверх новой БД во временном каталоге
+func newTestService(t *testing.T) (ParcelService, ParcelStore) {
+	t.Helper()
+
+	db, err := OpenDB(filepath.Join(t.TempDir(), "service.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+	return NewParcelService(store), store
+}
+
+// TestServiceValidation проверяет отклонение некорректных входных данных
+func TestServiceValidation(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	_, err := service.Register(ctx, 0, "test")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+	var verr ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "client", verr.Field)
+
+	_, err = service.Register(ctx, 1, "  ")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	p, err := service.Register(ctx, 1, "test")
+	require.NoError(t, err)
+
+	err = service.SetStatus(ctx, p.Number, "lost")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+	err = service.ChangeAddress(ctx, p.Number, "")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+}
+
+// TestServiceErrors проверяет ошибки предметной области
+func TestServiceErrors(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	_, err := service.Get(ctx, 0)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+	err = service.NextStatus(ctx, 0)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	// отправленную посылку нельзя удалить и нельзя изменить её адрес
+	p, err := service.Register(ctx, 1, "test")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+
+	err = service.Delete(ctx, p.Number)
+	require.ErrorIs(t, err, ErrParcelLocked)
+	err = service.ChangeAddress(ctx, p.Number, "new address")
+	require.ErrorIs(t, err, ErrParcelLocked)
+
+	_, err = service.GetStatuses(ctx, make([]int64, MaxPageSize+1))
+	require.ErrorIs(t, err, ErrInvalidParcel)
+}
+
+// TestServiceContext проверяет, что отменённый контекст прерывает операцию
+func TestServiceContext(t *testing.T) {
+	service, _ := newTestService(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := service.Register(ctx, 1, "test")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+// TestServiceCancel проверяет отмену посылки и запись об этом в истории
+func TestServiceCancel(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	p, err := service.Register(ctx, 1, "test")
+	require.NoError(t, err)
+
+	require.NoError(t, service.Cancel(ctx, p.Number, "duplicate order"))
+
+	// отменённая посылка остаётся в БД, в отличие от удалённой
+	cancelled, err := service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusCancelled, cancelled.Status)
+
+	history, err := store.GetStatusHistory(p.Number)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, ParcelStatusCancelled, history[1].Status)
+	assert.Equal(t, "duplicate order", history[1].Comment)
+
+	// отменить можно только зарегистрированную посылку
+	err = service.Cancel(ctx, p.Number, "again")
+	require.ErrorIs(t, err, ErrForbiddenTransition)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ShardedParcelStore распределяет посылки по нескольким ParcelStore
+// по хешу идентификатора клиента. Номер посылки, который видит вызывающий код,
+// кодирует шард: number = локальный номер * количество шардов + индекс шарда,
+// поэтому операции по номеру сразу попадают в нужную БД.
+// Количество и порядок шардов нельзя менять после записи данных.
+// Пустые результаты и ошибки возвращаются так же, как у ParcelStore
+type ShardedParcelStore struct {
+	shards []ParcelStore
+}
+
+func NewShardedParcelStore(shards ...ParcelStore) (ShardedParcelStore, error) {
+	if len(shards) == 0 {
+		return ShardedParcelStore{}, errors.New("at least one shard is required")
+	}
+	return ShardedParcelStore{shards: shards}, nil
+}
+
+// shardFor возвращает индекс шарда, в котором хранятся посылки клиента
+func (s ShardedParcelStore) shardFor(client int64) int {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatInt(client, 10)))
+	return int(h.Sum32() % uint32(len(s.shards)))
+}
+
+// split раскладывает глобальный номер посылки на шард и локальный номер.
+// Отрицательных номеров не бывает, для них возвращается sql.ErrNoRows
+func (s ShardedParcelStore) split(number int64) (ParcelStore, int64, error) {
+	if number < 0 {
+		return ParcelStore{}, 0, sql.ErrNoRows
+	}
+	n := int64(len(s.shards))
+	return s.shards[number%n], number / n, nil
+}
+
+// global переводит локальный номер посылки шарда в глобальный
+func (s ShardedParcelStore) global(shard int, number int64) int64 {
+	return number*int64(len(s.shards)) + int64(shard)
+}
+
+func (s ShardedParcelStore) Add(p Parcel) (int64, error) {
+	shard := s.shardFor(p.Client)
+	id, err := s.shards[shard].Add(p)
+	if err != nil {
+		return 0, err
+	}
+	return s.global(shard, id), nil
+}
+
+func (s ShardedParcelStore) Get(number int64) (Parcel, error) {
+	store, local, err := s.split(number)
+	if err != nil {
+		return Parcel{}, err
+	}
+	p, err := store.Get(local)
+	if err != nil {
+		return Parcel{}, err
+	}
+	p.Number = number
+	return p, nil
+}
+
+func (s ShardedParcelStore) GetByClient(client int64) ([]Parcel, error) {
+	shard := s.shardFor(client)
+	res, err := s.shards[shard].GetByClient(client)
+	if err != nil {
+		return nil, err
+	}
+	for i := range res {
+		res[i].Number = s.global(shard, res[i].Number)
+	}
+	return res, nil
+}
+
+// GetStatuses группирует номера по шардам и читает статусы из каждого шарда одним запросом.
+// Неположительных номеров не бывает, их статусы в результат не попадают
+func (s ShardedParcelStore) GetStatuses(numbers []int64) (map[int64]string, error) {
+	local := make(map[int][]int64)
+	for _, number := range numbers {
+		if number <= 0 {
+			continue
+		}
+		shard := int(number % int64(len(s.shards)))
+		local[shard] = append(local[shard], number/int64(len(s.shards)))
+	}
+
+	res := make(map[int64]string, len(numbers))
+	for shard, numbers := range local {
+		statuses, err := s.shards[shard].GetStatuses(numbers)
+		if err != nil {
+			return nil, err
+		}
+		for number, status := range statuses {
+			res[s.global(shard, number)] = status
+		}
+	}
+	return res, nil
+}
+
+func (s ShardedParcelStore) SetStatus(number int64, status string) error {
+	store, local, err := s.split(number)
+	if err != nil {
+		return err
+	}
+	return store.SetStatus(local, status)
+}
+
+func (s ShardedParcelStore) SetAddress(number int64, address string) error {
+	store, local, err := s.split(number)
+	if err != nil {
+		return err
+	}
+	return store.SetAddress(local, address)
+}
+
+func (s ShardedParcelStore) Delete(number int64) error {
+	store, local, err := s.split(number)
+	if err != nil {
+		return err
+	}
+	return store.Delete(local)
+}
+
+func (s ShardedParcelStore) Cancel(number int64, reason string) error {
+	store, local, err := s.split(number)
+	if err != nil {
+		return err
+	}
+	return store.Cancel(local, reason)
+}
+
+// HealthCheck параллельно опрашивает все шарды и объединяет результаты:
+// хранилище живо и готово, только если живы и готовы все шарды
+func (s ShardedParcelStore) HealthCheck(ctx context.Context) HealthCheckResult {
+	start := time.Now()
+	results := make([]HealthCheckResult, len(s.shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func(i int, shard ParcelStore) {
+			defer wg.Done()
+			results[i] = shard.HealthCheck(ctx)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	res := HealthCheckResult{Alive: true, Ready: true}
+	for i, r := range results {
+		res.Alive = res.Alive && r.Alive
+		res.Ready = res.Ready && r.Ready
+		if r.Error != "" && res.Error == "" {
+			res.Error = "shard " + strconv.Itoa(i) + ": " + r.Error
+		}
+	}
+	res.Duration = time.Since(start)
+
+	return res
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShardedParcelStore проверяет маршрутизацию посылок по шардам
+func TestShardedParcelStore(t *testing.T) {
+	// prepare
+	// создаём три шарда в отдельных файлах БД
+	dir := t.TempDir()
+	var shards []ParcelStore
+	for i := 0; i < 3; i++ {
+		db, err := OpenDB(filepath.Join(dir, fmt.Sprintf("shard%d.db", i)))
+		require.NoError(t, err)
+		defer db.Close()
+
+		store, err := NewParcelStore(db)
+		require.NoError(t, err)
+		shards = append(shards, store)
+	}
+	store, err := NewShardedParcelStore(shards...)
+	require.NoError(t, err)
+
+	// add
+	// добавляем посылки разных клиентов, номера не должны совпадать
+	numbers := map[int64]Parcel{}
+	for client := int64(1); client <= 6; client++ {
+		parcel := getTestParcel()
+		parcel.Client = client
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		parcel.Number = id
+		numbers[id] = parcel
+	}
+	assert.Len(t, numbers, 6)
+
+	// get
+	for id, parcel := range numbers {
+		stored, err := store.Get(id)
+		require.NoError(t, err)
+		assert.Equal(t, parcel, stored)
+
+		byClient, err := store.GetByClient(parcel.Client)
+		require.NoError(t, err)
+		assert.Equal(t, []Parcel{parcel}, byClient)
+	}
+
+	// set status
+	for id := range numbers {
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		stored, err := store.Get(id)
+		require.NoError(t, err)
+		assert.Equal(t, ParcelStatusSent, stored.Status)
+	}
+
+	// get statuses
+	var all []int64
+	for id := range numbers {
+		all = append(all, id)
+	}
+	statuses, err := store.GetStatuses(all)
+	require.NoError(t, err)
+	assert.Len(t, statuses, len(numbers))
+	for id := range numbers {
+		assert.Equal(t, ParcelStatusSent, statuses[id])
+	}
+	statuses, err = store.GetStatuses(append(all, 0, -2))
+	require.NoError(t, err)
+	assert.Len(t, statuses, len(numbers))
+
+	// отрицательный номер не относится ни к одному шарду
+	_, err = store.Get(-1)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, store.SetStatus(-4, ParcelStatusSent), sql.ErrNoRows)
+	assert.ErrorIs(t, store.Delete(-3), sql.ErrNoRows)
+
+	// health check
+	res := store.HealthCheck(context.Background())
+	assert.True(t, res.Alive)
+	assert.True(t, res.Ready)
+}
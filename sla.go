@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SetDeadline задаёт обещанный срок доставки посылки
+func (s ParcelStore) SetDeadline(number int64, deadline time.Time) error {
+	return s.auditedUpdate(number, []string{"deadline"}, "UPDATE parcel SET deadline = :deadline WHERE number = :number AND "+tenantScope,
+		sql.Named("deadline", deadline.UTC().Format(time.RFC3339)),
+		sql.Named("number", number),
+		s.tenantArg())
+}
+
+// ListOverdue возвращает посылки, срок доставки которых истёк к моменту now,
+// но которые ещё не доставлены: они зарегистрированы или в пути.
+// Посылки упорядочены по сроку, начиная с самого просроченного
+func (s ParcelStore) ListOverdue(now time.Time) ([]Parcel, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel "+
+		"WHERE deadline != '' AND deadline < :now AND status IN (:registered, :sent) AND "+tenantScope+" ORDER BY deadline, number",
+		sql.Named("now", now.UTC().Format(time.RFC3339)),
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("sent", ParcelStatusSent),
+		s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// SetDeadline задаёт обещанный срок доставки посылки
+func (s ParcelService) SetDeadline(ctx context.Context, number int64, deadline time.Time) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	if _, err := s.Get(ctx, number); err != nil {
+		return err
+	}
+	return s.store.WithContext(ctx).SetDeadline(number, deadline)
+}
+
+// ListOverdue возвращает недоставленные посылки с истёкшим сроком доставки
+func (s ParcelService) ListOverdue(ctx context.Context, now time.Time) ([]Parcel, error) {
+	if err := requireStaff(ctx); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).ListOverdue(now)
+}
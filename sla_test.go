@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListOverdue проверяет выборку просроченных недоставленных посылок
+func TestListOverdue(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	register := func(deadline time.Time) Parcel {
+		p, err := service.Register(ctx, 1, "test")
+		require.NoError(t, err)
+		require.NoError(t, service.SetDeadline(ctx, p.Number, deadline))
+		p, err = service.Get(ctx, p.Number)
+		require.NoError(t, err)
+		return p
+	}
+
+	late := register(now.Add(-2 * time.Hour))
+	later := register(now.Add(-time.Hour))
+	register(now.Add(time.Hour))
+	delivered := register(now.Add(-3 * time.Hour))
+	require.NoError(t, service.NextStatus(ctx, later.Number))
+	require.NoError(t, service.NextStatus(ctx, delivered.Number))
+	require.NoError(t, service.NextStatus(ctx, delivered.Number))
+	later.Status = ParcelStatusSent
+
+	// посылки без срока в выборку не попадают
+	_, err := service.Register(ctx, 1, "test")
+	require.NoError(t, err)
+
+	overdue, err := service.ListOverdue(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, []Parcel{late, later}, overdue)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// slowQueryKey - ключ контекста с настройками медленных запросов хранилища
+type slowQueryKey struct{}
+
+// slowQuery - что sqlConn нужно знать о хранилище, чтобы сообщить о медленном запросе
+type slowQuery struct {
+	threshold time.Duration
+	filter    string // условие фильтра, по которому выполняется запрос
+	logger    *slog.Logger
+}
+
+// WithSlowQueryThreshold возвращает копию хранилища, которая записывает в журнал
+// на уровне warn и считает в метрике tracker.db.slow_queries каждый запрос,
+// выполнявшийся дольше threshold, вместе с условием фильтра, из которого он построен.
+// Так видны запросы без подходящего индекса. 0 - медленные запросы не отслеживаются
+func (s ParcelStore) WithSlowQueryThreshold(threshold time.Duration) ParcelStore {
+	s.slowQuery = threshold
+	return s
+}
+
+// withFilter возвращает копию хранилища, медленные запросы которой записываются
+// с условием фильтра f. Записывается SQL-условие с именами параметров,
+// без значений: в них могут быть адреса и телефоны
+func (s ParcelStore) withFilter(f Filter) ParcelStore {
+	s.filter = f.where
+	return s
+}
+
+// withSlowQuery добавляет в ctx настройки медленных запросов хранилища для sqlConn
+func (s ParcelStore) withSlowQuery(ctx context.Context) context.Context {
+	if s.slowQuery <= 0 {
+		return ctx
+	}
+	logger := s.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return context.WithValue(ctx, slowQueryKey{}, slowQuery{threshold: s.slowQuery, filter: s.filter, logger: logger})
+}
+
+// slowQueries возвращает счётчик медленных запросов глобального провайдера метрик
+func slowQueries() (metric.Int64Counter, error) {
+	return otel.Meter("github.com/Yandex-Practicum/go-db-sql-final").Int64Counter("tracker.db.slow_queries",
+		metric.WithDescription("Запросы к БД дольше TRACKER_SLOW_QUERY_THRESHOLD"))
+}
+
+// reportSlowQuery сообщает о запросе query метода хранилища op, начатом в start,
+// если он выполнялся дольше порога из ctx, см. WithSlowQueryThreshold
+func reportSlowQuery(ctx context.Context, op, query string, start time.Time) {
+	q, ok := ctx.Value(slowQueryKey{}).(slowQuery)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed < q.threshold {
+		return
+	}
+
+	if counter, err := slowQueries(); err == nil {
+		counter.Add(ctx, 1, metric.WithAttributes(semconv.DBOperationName(op)))
+	}
+	attrs := []slog.Attr{
+		slog.String("operation", op),
+		slog.String("query", strings.Join(strings.Fields(query), " ")),
+		slog.Duration("duration", elapsed),
+		slog.Duration("threshold", q.threshold),
+	}
+	if q.filter != "" {
+		attrs = append(attrs, slog.String("filter", q.filter))
+	}
+	q.logger.LogAttrs(ctx, slog.LevelWarn, "slow query", attrs...)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// TestSlowQueries проверяет журнал и метрику запросов дольше порога
+func TestSlowQueries(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+
+	var buf bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.LogFormat = LogFormatJSON
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	_, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+
+	// add
+	// любой запрос дольше наносекунды
+	slow := store.WithLogger(NewLogger(cfg, &buf)).WithSlowQueryThreshold(time.Nanosecond)
+	f, err := ParseFilter(`status = "registered" AND address ~ "Псков"`)
+	require.NoError(t, err)
+	parcels, err := slow.Search(f)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+
+	// check
+	entries := logEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "WARN", entries[0]["level"])
+	assert.Equal(t, "slow query", entries[0]["msg"])
+	assert.Equal(t, "search", entries[0]["operation"])
+	assert.Contains(t, entries[0]["query"], "FROM parcel WHERE")
+	assert.Contains(t, entries[0]["filter"], "status = :")
+	assert.NotContains(t, buf.String(), "Псков")
+
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &data))
+	require.Len(t, data.ScopeMetrics, 1)
+	require.Len(t, data.ScopeMetrics[0].Metrics, 1)
+	m := data.ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "tracker.db.slow_queries", m.Name)
+	sum, ok := m.Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, sum.DataPoints, 1)
+	assert.EqualValues(t, 1, sum.DataPoints[0].Value)
+
+	// быстрые запросы и хранилище без порога не записываются
+	buf.Reset()
+	_, err = store.WithLogger(NewLogger(cfg, &buf)).WithSlowQueryThreshold(time.Hour).Search(f)
+	require.NoError(t, err)
+	_, err = store.WithLogger(NewLogger(cfg, &buf)).Search(f)
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
+
+// TestSlowQueryWithoutFilter проверяет медленные запросы не по фильтру
+func TestSlowQueryWithoutFilter(t *testing.T) {
+	var buf bytes.Buffer
+	_, store := newTestService(t)
+	store = store.WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))).WithSlowQueryThreshold(time.Nanosecond)
+
+	// add
+	_, err := store.Add(Parcel{Client: 7, Status: ParcelStatusRegistered, Address: "Псков", CreatedAt: time.Now().UTC().Format(time.RFC3339)})
+	require.NoError(t, err)
+
+	// check
+	entries := logEntries(t, &buf)
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		assert.Equal(t, "slow query", entry["msg"])
+		assert.Equal(t, "add", entry["operation"])
+		assert.NotContains(t, entry, "filter")
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSnapshot - снимок ImportJSON повреждён или записан не ExportJSON
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// snapshotTables - таблицы снимка в порядке записи: сначала посылки, затем
+// их история и подробности, которые относятся к посылке по столбцу number
+var snapshotTables = []string{
+	"parcel",
+	"parcel_status_history",
+	"parcel_address_history",
+	"parcel_delivery_attempts",
+	"parcel_delivery_proof",
+	"parcel_items",
+	"parcel_notes",
+	"parcel_route",
+	"parcel_tags",
+}
+
+// snapshotLine - строка снимка. Первая строка содержит только Version и ExportedAt,
+// остальные - строку Row таблицы Table со значениями столбцов как в БД
+type snapshotLine struct {
+	Version    int            `json:"version,omitempty"`
+	ExportedAt string         `json:"exported_at,omitempty"`
+	Table      string         `json:"table,omitempty"`
+	Row        map[string]any `json:"row,omitempty"`
+}
+
+// parcelRefs - ссылки посылки на другие посылки снимка по старым номерам
+type parcelRefs struct {
+	number, returnOf, parent int64
+}
+
+// ExportJSON записывает в w снимок посылок магазина хранилища вместе с историей
+// статусов и адресов, попытками доставки, подтверждениями, вложениями,
+// маршрутами, заметками и метками - по JSON-объекту на строку. Все таблицы
+// читаются в одной транзакции, поэтому снимок согласован. Зашифрованные
+// столбцы записываются как есть: для ImportJSON нужны те же ключи шифрования
+func (s ParcelStore) ExportJSON(w io.Writer) error {
+	version, err := schemaVersion(s.context(), s.db)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := enc.Encode(snapshotLine{Version: version, ExportedAt: time.Now().UTC().Format(time.RFC3339)}); err != nil {
+			return err
+		}
+		for _, table := range snapshotTables {
+			query := "SELECT * FROM " + table + " WHERE number IN (SELECT number FROM parcel WHERE " + tenantScope + ") ORDER BY rowid"
+			if table == "parcel" {
+				query = "SELECT * FROM parcel WHERE " + tenantScope + " ORDER BY number"
+			}
+			if err := s.exportTable(tx, enc, table, query); err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s ParcelStore) exportTable(tx *sql.Tx, enc *json.Encoder, table, query string) error {
+	rows, err := tx.QueryContext(s.context(), query, s.tenantArg())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		if err := enc.Encode(snapshotLine{Table: table, Row: row}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportJSON добавляет посылки из снимка ExportJSON, например из другого окружения,
+// и возвращает число добавленных строк по таблицам. Посылки получают новые номера,
+// строки истории и ссылки return_of и parent_number переводятся на них, а ссылки
+// на посылки вне снимка обнуляются. Коды отслеживания сохраняются, поэтому снимок
+// не добавить в БД, где они уже выданы, например повторно. Строки попадают в магазин хранилища, а у
+// хранилища всех магазинов, см. AllTenants, - в магазины из снимка. Снимок
+// добавляется в одной транзакции целиком или никак, без хуков, событий и записей
+// аудита. Снимок с более новой схемой, чем у БД, отклоняется с ErrSchemaVersion
+func (s ParcelStore) ImportJSON(r io.Reader) (map[string]int, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var head snapshotLine
+	if err := dec.Decode(&head); err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrInvalidSnapshot, err)
+	}
+	if head.Version <= 0 || head.Table != "" {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidSnapshot)
+	}
+	version, err := schemaVersion(s.context(), s.db)
+	if err != nil {
+		return nil, err
+	}
+	if head.Version > version {
+		return nil, fmt.Errorf("%w: snapshot %d, database %d", ErrSchemaVersion, head.Version, version)
+	}
+
+	counts := map[string]int{}
+	err = s.inTx(func(tx *sql.Tx) error {
+		columns := map[string]map[string]bool{}
+		numbers := map[int64]int64{}
+		var refs []parcelRefs
+		for line := 2; ; line++ {
+			var rec snapshotLine
+			err := dec.Decode(&rec)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%w: line %d: %w", ErrInvalidSnapshot, line, err)
+			}
+			row, err := s.snapshotRow(tx, columns, rec)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+
+			old, _ := row["number"].(int64)
+			if rec.Table == "parcel" {
+				delete(row, "number")
+				number, err := s.insertSnapshotRow(tx, rec.Table, row)
+				if err != nil {
+					return fmt.Errorf("line %d: %w", line, err)
+				}
+				numbers[old] = number
+				returnOf, _ := row["return_of"].(int64)
+				parent, _ := row["parent_number"].(int64)
+				if returnOf != 0 || parent != 0 {
+					refs = append(refs, parcelRefs{number: number, returnOf: returnOf, parent: parent})
+				}
+			} else {
+				number, ok := numbers[old]
+				if !ok {
+					return fmt.Errorf("%w: line %d: %s row of unknown parcel %d", ErrInvalidSnapshot, line, rec.Table, old)
+				}
+				delete(row, "id")
+				row["number"] = number
+				if _, err := s.insertSnapshotRow(tx, rec.Table, row); err != nil {
+					return fmt.Errorf("line %d: %w", line, err)
+				}
+			}
+			counts[rec.Table]++
+		}
+
+		// посылка может ссылаться на посылку, записанную в снимке после неё
+		for _, ref := range refs {
+			_, err := tx.ExecContext(s.context(), "UPDATE parcel SET return_of = :return_of, parent_number = :parent WHERE number = :number",
+				sql.Named("return_of", numbers[ref.returnOf]),
+				sql.Named("parent", numbers[ref.parent]),
+				sql.Named("number", ref.number))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// snapshotRow проверяет строку снимка rec по столбцам её таблицы в БД и возвращает
+// значения для вставки. columns запоминает столбцы уже встреченных таблиц
+func (s ParcelStore) snapshotRow(tx *sql.Tx, columns map[string]map[string]bool, rec snapshotLine) (map[string]any, error) {
+	known, ok := columns[rec.Table]
+	if !ok {
+		found := false
+		for _, table := range snapshotTables {
+			found = found || table == rec.Table
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: unknown table %q", ErrInvalidSnapshot, rec.Table)
+		}
+		var err error
+		if known, err = s.tableColumns(tx, rec.Table); err != nil {
+			return nil, err
+		}
+		columns[rec.Table] = known
+	}
+
+	row := make(map[string]any, len(rec.Row)+1)
+	for column, v := range rec.Row {
+		if !known[column] {
+			return nil, fmt.Errorf("%w: unknown column %s.%s", ErrInvalidSnapshot, rec.Table, column)
+		}
+		switch v := v.(type) {
+		case nil, string:
+			row[column] = v
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				row[column] = n
+			} else if row[column], err = v.Float64(); err != nil {
+				return nil, fmt.Errorf("%w: %s.%s: %w", ErrInvalidSnapshot, rec.Table, column, err)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s.%s: unsupported value %v", ErrInvalidSnapshot, rec.Table, column, v)
+		}
+	}
+	if _, ok := row["number"].(int64); !ok {
+		return nil, fmt.Errorf("%w: %s row without number", ErrInvalidSnapshot, rec.Table)
+	}
+	if s.tenant != 0 {
+		row["tenant_id"] = s.tenant
+	}
+	return row, nil
+}
+
+// tableColumns возвращает имена столбцов таблицы table
+func (s ParcelStore) tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(s.context(), "SELECT name FROM pragma_table_info(:table)", sql.Named("table", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// insertSnapshotRow добавляет в table строку row, столбцы которой проверены
+// snapshotRow, и возвращает её rowid
+func (s ParcelStore) insertSnapshotRow(tx *sql.Tx, table string, row map[string]any) (int64, error) {
+	names := make([]string, 0, len(row))
+	for name := range row {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := make([]any, len(names))
+	params := make([]string, len(names))
+	for i, name := range names {
+		args[i] = sql.Named(name, row[name])
+		params[i] = ":" + name
+	}
+
+	res, err := tx.ExecContext(s.context(), "INSERT INTO "+table+" ("+strings.Join(names, ", ")+") VALUES ("+strings.Join(params, ", ")+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSnapshotJSON проверяет перенос посылок с историей снимком ExportJSON в другую БД
+func TestSnapshotJSON(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	staff := WithPrincipal(ctx, Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleDispatcher, Tenant: DefaultTenant})
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Орёл"))
+	_, err = service.AddNote(ctx, p.Number, "курьер", "код домофона 15")
+	require.NoError(t, err)
+	require.NoError(t, service.AddTag(ctx, p.Number, "fragile"))
+	require.NoError(t, service.AddItems(ctx, p.Number, []Item{{Description: "книга", Quantity: 2, UnitValue: 50000}}))
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	a, err := service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+	b, err := service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+	parent, err := service.Consolidate(staff, []int64{a.Number, b.Number})
+	require.NoError(t, err)
+
+	var snapshot bytes.Buffer
+	require.NoError(t, store.ExportJSON(&snapshot))
+	lines := strings.Split(strings.TrimSpace(snapshot.String()), "\n")
+	var head snapshotLine
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &head))
+	assert.Equal(t, len(migrations), head.Version)
+
+	target, targetStore := newTestService(t)
+	// в целевой БД уже есть посылки, поэтому номера из снимка заняты
+	_, err = target.Register(ctx, 1, "Москва")
+	require.NoError(t, err)
+	_, err = target.Register(ctx, 1, "Москва")
+	require.NoError(t, err)
+
+	// add
+	counts, err := targetStore.ImportJSON(bytes.NewReader(snapshot.Bytes()))
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, 4, counts["parcel"])
+	assert.Equal(t, 1, counts["parcel_notes"])
+	assert.Equal(t, 1, counts["parcel_tags"])
+	assert.Equal(t, 1, counts["parcel_items"])
+	assert.Equal(t, len(lines)-1, counts["parcel"]+counts["parcel_status_history"]+counts["parcel_address_history"]+
+		counts["parcel_notes"]+counts["parcel_tags"]+counts["parcel_items"])
+
+	got, err := target.GetByTrackingNumber(ctx, p.Tracking)
+	require.NoError(t, err)
+	assert.NotEqual(t, p.Number, got.Number)
+	assert.Equal(t, "Орёл", got.Address)
+	assert.Equal(t, ParcelStatusSent, got.Status)
+	assert.Equal(t, p.CreatedAt, got.CreatedAt)
+	history, err := targetStore.GetStatusHistory(got.Number)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+	addresses, err := targetStore.GetAddressHistory(got.Number)
+	require.NoError(t, err)
+	assert.Len(t, addresses, 1)
+	tags, err := targetStore.GetTags(got.Number)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fragile"}, tags)
+	items, err := targetStore.GetItems(got.Number)
+	require.NoError(t, err)
+	assert.Equal(t, []Item{{Description: "книга", Quantity: 2, UnitValue: 50000}}, items)
+
+	// отправка зарегистрирована после вложенных посылок, ссылки на неё переведены
+	gotParent, err := target.GetByTrackingNumber(ctx, parent.Tracking)
+	require.NoError(t, err)
+	for _, child := range []Parcel{a, b} {
+		got, err := target.GetByTrackingNumber(ctx, child.Tracking)
+		require.NoError(t, err)
+		assert.Equal(t, gotParent.Number, got.Parent)
+	}
+
+	// повторный импорт нарушает уникальность кодов отслеживания и не добавляет ничего
+	_, err = targetStore.ImportJSON(bytes.NewReader(snapshot.Bytes()))
+	require.Error(t, err)
+	all, err := targetStore.GetByClient(8)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+}
+
+// TestSnapshotJSONInvalid проверяет отклонение повреждённых снимков
+func TestSnapshotJSONInvalid(t *testing.T) {
+	_, store := newTestService(t)
+
+	// check
+	for _, snapshot := range []string{
+		"",
+		`{"table":"parcel","row":{"number":1}}`,
+		`{"version":1}` + "\n" + `{"table":"courier","row":{"number":1}}`,
+		`{"version":1}` + "\n" + `{"table":"parcel","row":{"number":1,"volume":2}}`,
+		`{"version":1}` + "\n" + `{"table":"parcel_notes","row":{"number":1,"text":"x"}}`,
+		`{"version":1}` + "\n" + `{"table":"parcel","row":{"number":1,"client":[7]}}`,
+	} {
+		_, err := store.ImportJSON(strings.NewReader(snapshot))
+		assert.ErrorIs(t, err, ErrInvalidSnapshot, snapshot)
+	}
+	_, err := store.ImportJSON(strings.NewReader(`{"version":1000}`))
+	assert.ErrorIs(t, err, ErrSchemaVersion)
+	parcels, err := store.GetByClient(7)
+	require.NoError(t, err)
+	assert.Empty(t, parcels)
+}
+
+// TestSnapshotCLI проверяет команды snapshot export и snapshot import
+func TestSnapshotCLI(t *testing.T) {
+	service, store := newTestService(t)
+	target, targetStore := newTestService(t)
+	tenant, err := target.CreateTenant(context.Background(), "staging")
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "snapshot.ndjson")
+
+	// prepare
+	_, err = service.Register(context.Background(), 7, "Псков")
+	require.NoError(t, err)
+
+	// add
+	_, err = runCLI(t, store, service, "snapshot", "export", "--file", file)
+	require.NoError(t, err)
+	out, err := runCLI(t, targetStore, target, "snapshot", "import", "--file", file, "--tenant", strconv.FormatInt(tenant.ID, 10), "-o", "json")
+	require.NoError(t, err)
+
+	// check
+	var counts map[string]int
+	require.NoError(t, json.Unmarshal([]byte(out), &counts))
+	assert.Equal(t, map[string]int{"parcel": 1, "parcel_status_history": 1}, counts)
+	parcels, err := targetStore.WithTenant(tenant.ID).GetByClient(7)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, "Псков", parcels[0].Address)
+	parcels, err = targetStore.GetByClient(7)
+	require.NoError(t, err)
+	assert.Empty(t, parcels, "снимок добавлен в магазин из --tenant")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// soapNamespace - пространство имён операций SOAP-фасада
+const soapNamespace = "urn:tracker"
+
+// soapEnvelope - конверт SOAP 1.1, тело которого разбирается отдельно
+type soapEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    struct {
+		Content []byte `xml:",innerxml"`
+	} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+// soapNumberRequest - запрос операций, принимающих номер посылки
+type soapNumberRequest struct {
+	Number int64 `xml:"number"`
+}
+
+// soapParcel - посылка в ответах SOAP-фасада
+type soapParcel struct {
+	Number    int64  `xml:"number"`
+	Client    int64  `xml:"client"`
+	Status    string `xml:"status"`
+	Address   string `xml:"address"`
+	CreatedAt string `xml:"createdAt"`
+}
+
+type soapGetParcelResponse struct {
+	XMLName xml.Name   `xml:"urn:tracker GetParcelResponse"`
+	Parcel  soapParcel `xml:"parcel"`
+}
+
+type soapNextStatusResponse struct {
+	XMLName xml.Name `xml:"urn:tracker NextStatusResponse"`
+	Status  string   `xml:"status"`
+}
+
+type soapFault struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault"`
+	Code    string   `xml:"faultcode"`
+	String  string   `xml:"faultstring"`
+}
+
+// SOAPHandler - тонкий SOAP 1.1 фасад над ParcelService для партнёров,
+// которые не работают с другими протоколами. GET ?wsdl отдаёт описание
+// сервиса, POST выполняет операции GetParcel и NextStatus
+type SOAPHandler struct {
+	service ParcelService
+}
+
+func NewSOAPHandler(service ParcelService) SOAPHandler {
+	return SOAPHandler{service: service}
+}
+
+func (h SOAPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		fmt.Fprintf(w, soapWSDL, "http://"+r.Host+r.URL.Path)
+	case http.MethodPost:
+		h.serveCall(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// serveCall разбирает конверт и вызывает соответствующий метод сервиса
+func (h SOAPHandler) serveCall(w http.ResponseWriter, r *http.Request) {
+	var env soapEnvelope
+	if err := xml.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody)).Decode(&env); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeSOAP(w, http.StatusRequestEntityTooLarge, soapFault{Code: "soap:Client", String: err.Error()})
+			return
+		}
+		writeSOAP(w, http.StatusBadRequest, soapFault{Code: "soap:Client", String: err.Error()})
+		return
+	}
+
+	op, err := soapOperation(env.Body.Content)
+	if err != nil {
+		writeSOAP(w, http.StatusBadRequest, soapFault{Code: "soap:Client", String: err.Error()})
+		return
+	}
+
+	var req soapNumberRequest
+	if err := xml.Unmarshal(env.Body.Content, &req); err != nil {
+		writeSOAP(w, http.StatusBadRequest, soapFault{Code: "soap:Client", String: err.Error()})
+		return
+	}
+
+	switch op {
+	case "GetParcel":
+		p, err := h.service.Get(r.Context(), req.Number)
+		if err != nil {
+			writeSOAPError(w, err)
+			return
+		}
+		writeSOAP(w, http.StatusOK, soapGetParcelResponse{Parcel: soapParcel{
+			Number:    p.Number,
+			Client:    p.Client,
+			Status:    p.Status,
+			Address:   p.Address,
+			CreatedAt: p.CreatedAt,
+		}})
+	case "NextStatus":
+		if err := h.service.NextStatus(r.Context(), req.Number); err != nil {
+			writeSOAPError(w, err)
+			return
+		}
+		p, err := h.service.Get(r.Context(), req.Number)
+		if err != nil {
+			writeSOAPError(w, err)
+			return
+		}
+		writeSOAP(w, http.StatusOK, soapNextStatusResponse{Status: p.Status})
+	default:
+		writeSOAP(w, http.StatusBadRequest, soapFault{Code: "soap:Client", String: "unknown operation " + op})
+	}
+}
+
+// soapOperation возвращает имя первого элемента в теле конверта
+func soapOperation(body []byte) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", fmt.Errorf("empty soap body: %w", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			if start.Name.Space != soapNamespace {
+				return "", fmt.Errorf("unexpected namespace %q", start.Name.Space)
+			}
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// writeSOAPError отвечает ошибкой сервиса с тем же кодом HTTP, что и REST API.
+// Ошибки запроса возвращаются как soap:Client, а текст внутренних ошибок
+// не раскрывается клиенту: они уже записаны в журнал операций сервиса
+func writeSOAPError(w http.ResponseWriter, err error) {
+	status := apiStatus(err)
+	if status == http.StatusInternalServerError {
+		writeSOAP(w, status, soapFault{Code: "soap:Server", String: http.StatusText(status)})
+		return
+	}
+	writeSOAP(w, status, soapFault{Code: "soap:Client", String: err.Error()})
+}
+
+// writeSOAP заворачивает content в конверт и отправляет его клиенту
+func writeSOAP(w http.ResponseWriter, status int, content any) {
+	body, err := xml.Marshal(content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`)
+	w.Write(body)
+	io.WriteString(w, `</soap:Body></soap:Envelope>`)
+}
+
+// soapWSDL описывает операции фасада, %s заменяется адресом сервиса
+const soapWSDL = `<?xml version="1.0" encoding="utf-8"?>
+<definitions name="Tracker"
+    targetNamespace="urn:tracker"
+    xmlns="http://schemas.xmlsoap.org/wsdl/"
+    xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/"
+    xmlns:tns="urn:tracker"
+    xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+  <types>
+    <xsd:schema targetNamespace="urn:tracker" elementFormDefault="unqualified">
+      <xsd:complexType name="Parcel">
+        <xsd:sequence>
+          <xsd:element name="number" type="xsd:long"/>
+          <xsd:element name="client" type="xsd:long"/>
+          <xsd:element name="status" type="xsd:string"/>
+          <xsd:element name="address" type="xsd:string"/>
+          <xsd:element name="createdAt" type="xsd:string"/>
+        </xsd:sequence>
+      </xsd:complexType>
+      <xsd:element name="GetParcel">
+        <xsd:complexType><xsd:sequence><xsd:element name="number" type="xsd:long"/></xsd:sequence></xsd:complexType>
+      </xsd:element>
+      <xsd:element name="GetParcelResponse">
+        <xsd:complexType><xsd:sequence><xsd:element name="parcel" type="tns:Parcel"/></xsd:sequence></xsd:complexType>
+      </xsd:element>
+      <xsd:element name="NextStatus">
+        <xsd:complexType><xsd:sequence><xsd:element name="number" type="xsd:long"/></xsd:sequence></xsd:complexType>
+      </xsd:element>
+      <xsd:element name="NextStatusResponse">
+        <xsd:complexType><xsd:sequence><xsd:element name="status" type="xsd:string"/></xsd:sequence></xsd:complexType>
+      </xsd:element>
+    </xsd:schema>
+  </types>
+  <message name="GetParcelInput"><part name="parameters" element="tns:GetParcel"/></message>
+  <message name="GetParcelOutput"><part name="parameters" element="tns:GetParcelResponse"/></message>
+  <message name="NextStatusInput"><part name="parameters" element="tns:NextStatus"/></message>
+  <message name="NextStatusOutput"><part name="parameters" element="tns:NextStatusResponse"/></message>
+  <portType name="TrackerPortType">
+    <operation name="GetParcel"><input message="tns:GetParcelInput"/><output message="tns:GetParcelOutput"/></operation>
+    <operation name="NextStatus"><input message="tns:NextStatusInput"/><output message="tns:NextStatusOutput"/></operation>
+  </portType>
+  <binding name="TrackerBinding" type="tns:TrackerPortType">
+    <soap:binding style="document" transport="http://schemas.xmlsoap.org/soap/http"/>
+    <operation name="GetParcel">
+      <soap:operation soapAction="urn:tracker#GetParcel"/>
+      <input><soap:body use="literal"/></input>
+      <output><soap:body use="literal"/></output>
+    </operation>
+    <operation name="NextStatus">
+      <soap:operation soapAction="urn:tracker#NextStatus"/>
+      <input><soap:body use="literal"/></input>
+      <output><soap:body use="literal"/></output>
+    </operation>
+  </binding>
+  <service name="TrackerService">
+    <port name="TrackerPort" binding="tns:TrackerBinding">
+      <soap:address location="%s"/>
+    </port>
+  </service>
+</definitions>
+`
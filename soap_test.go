@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// soapCall формирует конверт SOAP с операцией op над посылкой number
+func soapCall(op string, number string) string {
+	return `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<` + op + ` xmlns="urn:tracker"><number>` + number + `</number></` + op + `>` +
+		`</soap:Body></soap:Envelope>`
+}
+
+// TestSOAPHandler проверяет WSDL и операции SOAP-фасада
+func TestSOAPHandler(t *testing.T) {
+	// prepare
+	db, err := OpenDB(filepath.Join(t.TempDir(), "soap.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+	service := NewParcelService(store)
+	handler := NewSOAPHandler(service)
+
+	p, err := service.Register(context.Background(), 1, "test")
+	require.NoError(t, err)
+	number := strconv.FormatInt(p.Number, 10)
+
+	// wsdl
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/soap?wsdl", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<operation name="GetParcel">`)
+
+	// next status
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/soap", strings.NewReader(soapCall("NextStatus", number))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<status>"+ParcelStatusSent+"</status>")
+
+	// get parcel
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/soap", strings.NewReader(soapCall("GetParcel", number))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<number>"+number+"</number>")
+	assert.Contains(t, rec.Body.String(), "<address>test</address>")
+
+	// unknown operation
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/soap", strings.NewReader(soapCall("Delete", number))))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<faultcode>soap:Client</faultcode>")
+
+	// unknown parcel
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/soap", strings.NewReader(soapCall("GetParcel", "999"))))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<faultcode>soap:Client</faultcode>")
+
+	// too large
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/soap", strings.NewReader(soapCall("GetParcel", strings.Repeat("1", maxAPIBody)))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	// internal error
+	// текст ошибки БД не должен попасть к клиенту
+	require.NoError(t, db.Close())
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/soap", strings.NewReader(soapCall("GetParcel", number))))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<faultcode>soap:Server</faultcode>")
+	assert.Contains(t, rec.Body.String(), "<faultstring>Internal Server Error</faultstring>")
+	assert.NotContains(t, rec.Body.String(), "sql")
+}
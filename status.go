@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrForbiddenTransition возвращается при попытке перевести посылку
+// в статус, который не разрешён parcelTransitions
+var ErrForbiddenTransition = errors.New("forbidden parcel status transition")
+
+// parcelTransitions задаёт допустимые переходы между статусами посылки.
+// Статусы без переходов считаются финальными
+var parcelTransitions = map[string][]string{
+	ParcelStatusRegistered:      {ParcelStatusSent, ParcelStatusCancelled, ParcelStatusExpired},
+	ParcelStatusSent:            {ParcelStatusDelivered, ParcelStatusReturnRequested, ParcelStatusReturnToSender},
+	ParcelStatusDelivered:       {ParcelStatusReturnRequested},
+	ParcelStatusCancelled:       {},
+	ParcelStatusReturnRequested: {ParcelStatusReturning},
+	ParcelStatusReturning:       {ParcelStatusReturned},
+	ParcelStatusReturned:        {},
+	ParcelStatusExpired:         {},
+	ParcelStatusReturnToSender:  {ParcelStatusReturned},
+}
+
+// parcelRoute задаёт следующий статус по обычному маршруту посылки,
+// его выбирает NextStatus. Возврат начинается только явным вызовом InitiateReturn
+var parcelRoute = map[string]string{
+	ParcelStatusRegistered: ParcelStatusSent,
+	ParcelStatusSent:       ParcelStatusDelivered,
+}
+
+// canTransition сообщает, можно ли перевести посылку из статуса from в статус to
+func canTransition(from, to string) bool {
+	for _, next := range parcelTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// nextStatus возвращает следующий статус по обычному маршруту посылки
+// и false, если обычный маршрут для статуса закончен
+func nextStatus(status string) (string, bool) {
+	next, ok := parcelRoute[status]
+	return next, ok
+}
+
+// checkTransition возвращает ErrForbiddenTransition с описанием перехода,
+// если он не разрешён
+func checkTransition(from, to string) error {
+	if !canTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrForbiddenTransition, from, to)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParcelTransitions проверяет таблицу переходов между статусами
+func TestParcelTransitions(t *testing.T) {
+	assert.True(t, canTransition(ParcelStatusRegistered, ParcelStatusSent))
+	assert.True(t, canTransition(ParcelStatusSent, ParcelStatusDelivered))
+	assert.True(t, canTransition(ParcelStatusRegistered, ParcelStatusCancelled))
+
+	// обратные переходы и переходы из финальных статусов запрещены
+	assert.False(t, canTransition(ParcelStatusSent, ParcelStatusRegistered))
+	assert.False(t, canTransition(ParcelStatusDelivered, ParcelStatusSent))
+	assert.False(t, canTransition(ParcelStatusSent, ParcelStatusCancelled))
+	assert.False(t, canTransition(ParcelStatusCancelled, ParcelStatusRegistered))
+
+	next, ok := nextStatus(ParcelStatusRegistered)
+	assert.True(t, ok)
+	assert.Equal(t, ParcelStatusSent, next)
+	_, ok = nextStatus(ParcelStatusDelivered)
+	assert.False(t, ok)
+}
+
+// TestServiceSetStatus проверяет, что сервис отклоняет запрещённые переходы
+func TestServiceSetStatus(t *testing.T) {
+	// prepare
+	db, err := OpenDB(filepath.Join(t.TempDir(), "status.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewParcelStore(db)
+	require.NoError(t, err)
+	service := NewParcelService(store)
+
+	p, err := service.Register(context.Background(), 1, "test")
+	require.NoError(t, err)
+
+	// check
+	// перескочить через статус sent нельзя
+	err = service.SetStatus(context.Background(), p.Number, ParcelStatusDelivered)
+	require.ErrorIs(t, err, ErrForbiddenTransition)
+
+	require.NoError(t, service.SetStatus(context.Background(), p.Number, ParcelStatusSent))
+
+	// вернуться назад и отменить отправленную посылку тоже нельзя
+	err = service.SetStatus(context.Background(), p.Number, ParcelStatusRegistered)
+	require.ErrorIs(t, err, ErrForbiddenTransition)
+	err = service.Cancel(context.Background(), p.Number, "late")
+	require.ErrorIs(t, err, ErrForbiddenTransition)
+
+	stored, err := store.Get(p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, stored.Status)
+}
+
+// TestServiceSetStatusRace проверяет, что переход не выполняется, если статус
+// посылки изменился между проверкой перехода и записью нового статуса
+func TestServiceSetStatusRace(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "test")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	// хук выполняется после проверки перехода: за это время посылку успевают вручить
+	store.Use(Hooks{PreStatusChange: func(ctx context.Context, number int64, status string) error {
+		if status == ParcelStatusReturnRequested {
+			_, err := store.db.Exec("UPDATE parcel SET status = ? WHERE number = ?", ParcelStatusDelivered, number)
+			return err
+		}
+		return nil
+	}})
+
+	// check
+	err = service.SetStatus(ctx, p.Number, ParcelStatusReturnRequested)
+	require.ErrorIs(t, err, ErrForbiddenTransition)
+	stored, err := store.Get(p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, stored.Status)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// streamBuffer - сколько событий подписчик потока может не забрать,
+// прежде чем следующие будут для него пропущены
+const streamBuffer = 16
+
+// streamHeartbeat - как часто поток шлёт комментарий, чтобы прокси не закрывали соединение
+const streamHeartbeat = 15 * time.Second
+
+// eventBroker раздаёт события OnChange подписчикам потоков /events.
+// OnChange вызывает обработчики синхронно, поэтому брокер никогда не ждёт
+// подписчика: если его буфер полон, событие для него пропускается
+type eventBroker struct {
+	store ParcelStore
+
+	mu     sync.Mutex
+	subs   map[*eventSubscription]struct{}
+	closed bool
+}
+
+// eventSubscription - подписка на события одной посылки или всех посылок клиента.
+// Номера посылок уникальны на весь экземпляр, а клиенты - только в магазине
+type eventSubscription struct {
+	number int64 // 0 - подписка по клиенту
+	client int64
+	tenant int64 // магазин клиента
+	events chan ParcelEvent
+}
+
+func newEventBroker(store ParcelStore) *eventBroker {
+	b := &eventBroker{store: store, subs: map[*eventSubscription]struct{}{}}
+	store.OnChange(b.publish)
+	return b
+}
+
+// subscribe регистрирует подписку. Канал events закрывается при unsubscribe или close
+func (b *eventBroker) subscribe(number, client, tenant int64) *eventSubscription {
+	sub := &eventSubscription{number: number, client: client, tenant: tenant, events: make(chan ParcelEvent, streamBuffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *eventBroker) unsubscribe(sub *eventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// close завершает все потоки, например при остановке сервера
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+func (b *eventBroker) publish(event ParcelEvent) {
+	if event.Type != ParcelEventStatusChanged && event.Type != ParcelEventAddressChanged {
+		return
+	}
+
+	b.mu.Lock()
+	byClient := false
+	for sub := range b.subs {
+		byClient = byClient || sub.number == 0
+	}
+	b.mu.Unlock()
+
+	// клиента ищем, только если он кому-то нужен
+	if byClient && event.Client == 0 {
+		if client, err := b.store.clientOf(event.Number); err == nil {
+			event.Client = client
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		if sub.number != event.Number && (sub.number != 0 || sub.client != event.Client || sub.tenant != event.Tenant) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// serveEvents отдаёт поток Server-Sent Events для подписки sub.
+// Каждое событие - WebhookEvent в JSON с типом события в поле event.
+// Если задан first, он отправляется первым сообщением
+func (b *eventBroker) serveEvents(w http.ResponseWriter, r *http.Request, sub *eventSubscription, first *apiParcel) {
+	defer b.unsubscribe(sub)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "streaming is not supported"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if first != nil {
+		writeSSE(w, "parcel", first)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			writeSSE(w, event.Type, newWebhookEvent(event))
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSSE записывает одно сообщение потока. JSON не содержит переводов строк,
+// поэтому данные помещаются в одно поле data
+func writeSSE(w http.ResponseWriter, event string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
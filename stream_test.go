@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseMessage - одно сообщение потока Server-Sent Events
+type sseMessage struct {
+	Event string
+	Data  string
+}
+
+// openStream подключается к потоку и возвращает канал его сообщений
+func openStream(t *testing.T, url string) <-chan sseMessage {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	messages := make(chan sseMessage, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(messages)
+
+		var msg sseMessage
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				msg.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.Data = strings.TrimPrefix(line, "data: ")
+			case line == "" && msg.Event != "":
+				messages <- msg
+				msg = sseMessage{}
+			}
+		}
+	}()
+	return messages
+}
+
+// nextMessage ждёт следующее сообщение потока
+func nextMessage(t *testing.T, messages <-chan sseMessage) sseMessage {
+	t.Helper()
+
+	select {
+	case msg, ok := <-messages:
+		require.True(t, ok, "stream closed")
+		return msg
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no message in stream")
+	}
+	return sseMessage{}
+}
+
+// TestParcelEventStream проверяет поток изменений одной посылки
+func TestParcelEventStream(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	handler := NewAPIHandler(service)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	other, err := service.Register(ctx, 7, "Тверь")
+	require.NoError(t, err)
+	messages := openStream(t, fmt.Sprintf("%s/parcels/%d/events", srv.URL, p.Number))
+
+	first := nextMessage(t, messages)
+	assert.Equal(t, "parcel", first.Event)
+	var got apiParcel
+	require.NoError(t, json.Unmarshal([]byte(first.Data), &got))
+	assert.Equal(t, ParcelStatusRegistered, got.Status)
+
+	// add
+	require.NoError(t, service.NextStatus(ctx, other.Number))
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+
+	// check
+	msg := nextMessage(t, messages)
+	assert.Equal(t, ParcelEventStatusChanged, msg.Event)
+	var event WebhookEvent
+	require.NoError(t, json.Unmarshal([]byte(msg.Data), &event))
+	assert.Equal(t, p.Number, event.Number)
+	assert.Equal(t, ParcelStatusSent, event.Status)
+
+	// остановка сервера завершает поток
+	handler.events.close()
+	_, ok := <-messages
+	assert.False(t, ok)
+
+	rec := apiCall(t, handler, http.MethodGet, "/parcels/1000/events", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+// TestClientEventStream проверяет поток изменений всех посылок клиента
+func TestClientEventStream(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	srv := httptest.NewServer(NewAPIHandler(service))
+	t.Cleanup(srv.Close)
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	other, err := service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+	messages := openStream(t, srv.URL+"/clients/7/events")
+
+	// add
+	require.NoError(t, service.ChangeAddress(ctx, other.Number, "Орёл"))
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Орёл"))
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+
+	// check
+	var events []WebhookEvent
+	for i := 0; i < 2; i++ {
+		var event WebhookEvent
+		require.NoError(t, json.Unmarshal([]byte(nextMessage(t, messages).Data), &event))
+		events = append(events, event)
+	}
+	assert.Equal(t, ParcelEventAddressChanged, events[0].Type)
+	assert.Equal(t, p.Number, events[0].Number)
+	assert.Equal(t, ParcelEventStatusChanged, events[1].Type)
+	assert.Equal(t, int64(7), events[1].Client)
+}
+
+// TestClientEventStreamForbidden проверяет, что клиент не подписывается на события чужих посылок
+func TestClientEventStreamForbidden(t *testing.T) {
+	service, store := newTestService(t)
+	auth := NewAuthenticator(store, "secret")
+	handler := NewAPIHandler(service).WithAuth(auth)
+
+	// prepare
+	token, err := auth.IssueToken(Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleClient, Client: 7, Tenant: DefaultTenant}, time.Hour)
+	require.NoError(t, err)
+	courier, err := auth.IssueToken(Principal{Kind: PrincipalUser, Subject: "oleg", Role: RoleCourier, Courier: 1, Tenant: DefaultTenant}, time.Hour)
+	require.NoError(t, err)
+
+	// открытый поток обрывается по таймауту, а не держит тест
+	call := func(token, target string) int {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// check
+	assert.Equal(t, http.StatusForbidden, call(token, "/clients/8/parcels"))
+	assert.Equal(t, http.StatusForbidden, call(token, "/clients/8/events"))
+	assert.Equal(t, http.StatusForbidden, call(courier, "/clients/7/events"))
+}
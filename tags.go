@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+)
+
+// Теги, которыми операционный отдел обычно помечает посылки
+const (
+	TagFragile     = "fragile"
+	TagPriority    = "priority"
+	TagCustomsHold = "customs-hold"
+)
+
+// tagPattern - допустимый тег после normalizeTag
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// normalizeTag приводит тег к единому виду, чтобы "Fragile" и "fragile" совпадали
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// AddTag помечает посылку тегом. Повторное добавление тега ничего не меняет
+func (s ParcelStore) AddTag(number int64, tag string) error {
+	_, err := s.db.ExecContext(s.context(), "INSERT OR IGNORE INTO parcel_tags (number, tag, tenant_id) VALUES (:number, :tag, "+parcelTenant+")",
+		sql.Named("number", number),
+		sql.Named("tag", tag))
+	return err
+}
+
+// RemoveTag снимает тег с посылки
+func (s ParcelStore) RemoveTag(number int64, tag string) error {
+	_, err := s.db.ExecContext(s.context(), "DELETE FROM parcel_tags WHERE number = :number AND tag = :tag AND "+tenantScope,
+		sql.Named("number", number),
+		sql.Named("tag", tag),
+		s.tenantArg())
+	return err
+}
+
+// GetTags возвращает теги посылки по алфавиту
+func (s ParcelStore) GetTags(number int64) ([]string, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT tag FROM parcel_tags WHERE number = :number AND "+tenantScope+" ORDER BY tag",
+		sql.Named("number", number), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		res = append(res, tag)
+	}
+	return res, rows.Err()
+}
+
+// FindByTag возвращает посылки с тегом, упорядоченные по номеру
+func (s ParcelStore) FindByTag(tag string) ([]Parcel, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE number IN (SELECT number FROM parcel_tags WHERE tag = :tag) AND "+tenantScope+" ORDER BY number",
+		sql.Named("tag", tag), s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanParcels(rows)
+}
+
+// validateTag нормализует тег и проверяет его по tagPattern
+func validateTag(tag string) (string, error) {
+	tag = normalizeTag(tag)
+	if !tagPattern.MatchString(tag) {
+		return "", ValidationError{Field: "tag", Message: "must be 1-64 latin letters, digits, - or _"}
+	}
+	return tag, nil
+}
+
+// AddTag помечает посылку тегом в любом статусе
+func (s ParcelService) AddTag(ctx context.Context, number int64, tag string) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	tag, err := validateTag(tag)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Get(ctx, number); err != nil {
+		return err
+	}
+	return s.store.WithContext(ctx).AddTag(number, tag)
+}
+
+// RemoveTag снимает тег с посылки
+func (s ParcelService) RemoveTag(ctx context.Context, number int64, tag string) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	tag, err := validateTag(tag)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Get(ctx, number); err != nil {
+		return err
+	}
+	return s.store.WithContext(ctx).RemoveTag(number, tag)
+}
+
+// GetTags возвращает теги посылки
+func (s ParcelService) GetTags(ctx context.Context, number int64) ([]string, error) {
+	if _, err := s.Get(ctx, number); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).GetTags(number)
+}
+
+// FindByTag возвращает посылки с тегом. Для сочетания тегов с другими
+// условиями используется Search с выражением tag = "..."
+func (s ParcelService) FindByTag(ctx context.Context, tag string) ([]Parcel, error) {
+	if err := requireStaff(ctx); err != nil {
+		return nil, err
+	}
+	tag, err := validateTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).FindByTag(tag)
+}
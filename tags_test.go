@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTags проверяет добавление, снятие тегов и поиск по ним
+func TestTags(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	fragile, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	other, err := service.Register(ctx, 1, "Тверь")
+	require.NoError(t, err)
+
+	// add
+	require.NoError(t, service.AddTag(ctx, fragile.Number, "Fragile"))
+	require.NoError(t, service.AddTag(ctx, fragile.Number, TagFragile))
+	require.NoError(t, service.AddTag(ctx, fragile.Number, TagCustomsHold))
+	require.NoError(t, service.AddTag(ctx, other.Number, TagPriority))
+
+	// check
+	tags, err := service.GetTags(ctx, fragile.Number)
+	require.NoError(t, err)
+	assert.Equal(t, []string{TagCustomsHold, TagFragile}, tags)
+
+	found, err := service.FindByTag(ctx, TagFragile)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, fragile.Number, found[0].Number)
+
+	// теги в выражениях фильтра
+	found, err = service.Search(ctx, `tag = "priority" OR tag = "customs-hold"`)
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+	found, err = service.Search(ctx, `address = "Тверь" AND tag != "fragile"`)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, other.Number, found[0].Number)
+	_, err = service.Search(ctx, `tag ~ "fra"`)
+	assert.ErrorIs(t, err, ErrInvalidParcel)
+
+	// remove
+	require.NoError(t, service.RemoveTag(ctx, fragile.Number, TagFragile))
+	found, err = service.FindByTag(ctx, TagFragile)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	// validation
+	assert.ErrorIs(t, service.AddTag(ctx, fragile.Number, "хрупкое"), ErrInvalidParcel)
+	assert.ErrorIs(t, service.AddTag(ctx, fragile.Number, " "), ErrInvalidParcel)
+	assert.ErrorIs(t, service.AddTag(ctx, fragile.Number+1000, TagFragile), ErrParcelNotFound)
+
+	// delete
+	require.NoError(t, service.Delete(ctx, other.Number))
+	tags, err = store.GetTags(other.Number)
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTenantNotFound возвращается, если магазина с указанным идентификатором нет
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// DefaultTenant - магазин, которому принадлежат все данные до появления
+// нескольких магазинов и запросы без явного магазина
+const DefaultTenant int64 = 1
+
+// TenantHeader - заголовок, которым запрос без субъекта, например с токеном
+// администратора, выбирает магазин. Субъект запроса всегда работает в своём магазине
+const TenantHeader = "X-Tenant-ID"
+
+// tenantScope ограничивает запрос строками магазина хранилища, см. ParcelStore.tenant.
+// Каждый запрос с ним получает параметр tenantArg
+const tenantScope = "(:tenant = 0 OR tenant_id = :tenant)"
+
+// parcelTenant - магазин посылки :number для строк, которые к ней относятся.
+// Так фоновые задачи, работающие со всеми магазинами, пишут строки в нужный
+const parcelTenant = "(SELECT tenant_id FROM parcel WHERE number = :number)"
+
+// Tenant - магазин: независимый набор посылок, курьеров, пунктов, отчётов,
+// вебхуков и ключей API на общем экземпляре трекера
+type Tenant struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+type tenantKey struct{}
+
+// WithTenant возвращает контекст, все запросы в котором выполняются в магазине tenant
+func WithTenant(ctx context.Context, tenant int64) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom возвращает магазин, сохранённый WithTenant
+func TenantFrom(ctx context.Context) (int64, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(int64)
+	return tenant, ok
+}
+
+// WithTenant возвращает копию хранилища, которая видит и создаёт только строки магазина tenant
+func (s ParcelStore) WithTenant(tenant int64) ParcelStore {
+	s.tenant = tenant
+	return s
+}
+
+// AllTenants возвращает копию хранилища, которая видит строки всех магазинов.
+// Нужна фоновым задачам: истечению, архиву, вебхукам и отчётам
+func (s ParcelStore) AllTenants() ParcelStore {
+	s.tenant = 0
+	return s
+}
+
+// tenantArg - значение параметра :tenant в tenantScope
+func (s ParcelStore) tenantArg() sql.NamedArg {
+	return sql.Named("tenant", s.tenant)
+}
+
+// tenantOf возвращает магазин посылки
+func (s ParcelStore) tenantOf(number int64) (int64, error) {
+	var tenant int64
+	err := s.db.QueryRowContext(s.context(), "SELECT tenant_id FROM parcel WHERE number = :number",
+		sql.Named("number", number)).Scan(&tenant)
+	return tenant, err
+}
+
+// AddTenant сохраняет магазин и возвращает его идентификатор
+func (s ParcelStore) AddTenant(t Tenant) (int64, error) {
+	res, err := s.db.ExecContext(s.context(), "INSERT INTO tenant (name, created_at) VALUES (:name, :created_at)",
+		sql.Named("name", t.Name),
+		sql.Named("created_at", t.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetTenant возвращает магазин или sql.ErrNoRows
+func (s ParcelStore) GetTenant(id int64) (Tenant, error) {
+	var t Tenant
+	err := s.db.QueryRowContext(s.context(), "SELECT id, name, created_at FROM tenant WHERE id = :id", sql.Named("id", id)).
+		Scan(&t.ID, &t.Name, &t.CreatedAt)
+	return t, err
+}
+
+// ListTenants возвращает все магазины
+func (s ParcelStore) ListTenants() ([]Tenant, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT id, name, created_at FROM tenant ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Tenant{}
+	for rows.Next() {
+		var t Tenant
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// CreateTenant создаёт магазин. Магазинами управляет администратор экземпляра,
+// поэтому вызов с субъектом запроса, у которого всегда есть свой магазин, запрещён
+func (s ParcelService) CreateTenant(ctx context.Context, name string) (_ Tenant, err error) {
+	defer s.logOp(ctx, "create_tenant", time.Now(), &err)
+	if _, ok := PrincipalFrom(ctx); ok {
+		return Tenant{}, fmt.Errorf("%w: tenants are managed by the instance administrator", ErrForbidden)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Tenant{}, ValidationError{Field: "name", Message: "must not be empty"}
+	}
+
+	t := Tenant{Name: name, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	id, err := s.store.WithContext(ctx).AddTenant(t)
+	if err != nil {
+		return Tenant{}, err
+	}
+	t.ID = id
+
+	return t, nil
+}
+
+// GetTenant возвращает магазин или ErrTenantNotFound
+func (s ParcelService) GetTenant(ctx context.Context, id int64) (Tenant, error) {
+	t, err := s.store.WithContext(ctx).GetTenant(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tenant{}, fmt.Errorf("%w: %d", ErrTenantNotFound, id)
+	}
+	return t, err
+}
+
+// requireTenantAuth не даёт запустить серверы без авторизации, когда кроме
+// DefaultTenant есть другие магазины: без субъекта запрос попадает
+// в DefaultTenant без проверки прав, и магазины не разделены
+func requireTenantAuth(store ParcelStore, authRequired bool) error {
+	if authRequired {
+		return nil
+	}
+	tenants, err := store.ListTenants()
+	if err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		if t.ID != DefaultTenant {
+			return fmt.Errorf("instance has %d tenants, set %s=true", len(tenants), EnvAuthRequired)
+		}
+	}
+	return nil
+}
+
+// ListTenants возвращает все магазины экземпляра
+func (s ParcelService) ListTenants(ctx context.Context) ([]Tenant, error) {
+	if _, ok := PrincipalFrom(ctx); ok {
+		return nil, fmt.Errorf("%w: tenants are managed by the instance administrator", ErrForbidden)
+	}
+	return s.store.WithContext(ctx).ListTenants()
+}
+
+// requestTenant определяет магазин запроса: магазин субъекта, если он есть,
+// иначе из заголовка TenantHeader, но только в запросе с токеном администратора
+// (admin), иначе DefaultTenant. Анонимный запрос не выбирает магазин сам
+func (h APIHandler) requestTenant(r *http.Request, admin bool) (int64, error) {
+	if p, ok := PrincipalFrom(r.Context()); ok {
+		return p.Tenant, nil
+	}
+	v := r.Header.Get(TenantHeader)
+	if v == "" {
+		return DefaultTenant, nil
+	}
+	if !admin {
+		return 0, fmt.Errorf("%w: %s requires the admin token", ErrForbidden, TenantHeader)
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ValidationError{Field: "tenant", Message: "must be a positive integer"}
+	}
+	if _, err := h.service.GetTenant(r.Context(), id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
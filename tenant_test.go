@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTenantIsolation проверяет, что магазины не видят данные друг друга
+func TestTenantIsolation(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	north, err := service.CreateTenant(ctx, "Север")
+	require.NoError(t, err)
+	northCtx := WithTenant(ctx, north.ID)
+
+	// add
+	own, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	other, err := service.Register(northCtx, 7, "Тверь")
+	require.NoError(t, err)
+	courier, err := service.AddCourier(northCtx, "Иван", "+79990000000")
+	require.NoError(t, err)
+
+	// check
+	_, err = service.Get(northCtx, own.Number)
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+	_, err = service.Get(ctx, other.Number)
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+	assert.ErrorIs(t, service.NextStatus(northCtx, own.Number), ErrParcelNotFound)
+
+	parcels, err := service.Search(northCtx, "")
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, other.Number, parcels[0].Number)
+	parcels, err = service.Search(ctx, "client = 7")
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, own.Number, parcels[0].Number)
+
+	_, err = service.GetCourier(ctx, courier.ID)
+	assert.ErrorIs(t, err, ErrCourierNotFound)
+	_, err = service.GetCourier(northCtx, courier.ID)
+	assert.NoError(t, err)
+
+	// субъект запроса работает в своём магазине
+	principal := WithPrincipal(northCtx, Principal{Kind: PrincipalUser, Subject: "anna", Role: RoleClient, Client: 7, Tenant: north.ID})
+	_, err = service.CreateTenant(principal, "Юг")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// код отслеживания уникален на весь экземпляр
+	tracking, err := service.Track(ctx, other.Tracking)
+	require.NoError(t, err)
+	assert.Equal(t, "Тверь", tracking.City)
+}
+
+// TestTenantAPI проверяет выбор магазина запроса и адреса /admin/tenants
+func TestTenantAPI(t *testing.T) {
+	service, store := newTestService(t)
+	handler := NewAPIHandler(service).WithAdminToken("secret")
+
+	// add
+	rec := adminCall(t, handler, "secret", http.MethodPost, "/admin/tenants", `{"name":"Север"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var north Tenant
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &north))
+	assert.Equal(t, "Север", north.Name)
+
+	rec = adminCall(t, handler, "secret", http.MethodPost, "/admin/tenants", `{"name":" "}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/tenants", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var tenants []Tenant
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tenants))
+	require.Len(t, tenants, 2)
+	assert.Equal(t, DefaultTenant, tenants[0].ID)
+
+	// check
+	tenantCall := func(token, tenant, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set(TenantHeader, tenant)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	p, err := service.Register(WithTenant(context.Background(), north.ID), 1, "Псков")
+	require.NoError(t, err)
+
+	// магазин заголовком выбирает только администратор
+	rec = tenantCall("", fmt.Sprint(north.ID), http.MethodPost, "/parcels", `{"client": 1, "address": "Псков"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = tenantCall("", fmt.Sprint(north.ID), http.MethodGet, fmt.Sprintf("/parcels/%d", p.Number), "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = apiCall(t, handler, http.MethodGet, fmt.Sprintf("/parcels/%d", p.Number), "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = tenantCall("secret", fmt.Sprint(north.ID), http.MethodGet, "/admin/parcels", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var found []apiParcel
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &found))
+	require.Len(t, found, 1)
+	assert.Equal(t, p.Number, found[0].Number)
+	rec = adminCall(t, handler, "secret", http.MethodGet, "/admin/parcels", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &found))
+	assert.Empty(t, found)
+
+	rec = tenantCall("secret", "99", http.MethodGet, "/admin/parcels", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = tenantCall("secret", "север", http.MethodGet, "/admin/parcels", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// без авторизации экземпляр с несколькими магазинами не запускается
+	require.Error(t, requireTenantAuth(store, false))
+	require.NoError(t, requireTenantAuth(store, true))
+	_, single := newTestService(t)
+	require.NoError(t, requireTenantAuth(single, false))
+
+	// магазин субъекта важнее заголовка
+	auth := NewAuthenticator(store, "jwt-secret")
+	token, err := auth.IssueToken(Principal{Subject: "anna", Role: RoleDispatcher}, time.Hour)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/parcels/%d", p.Number), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(TenantHeader, fmt.Sprint(north.ID))
+	rec = httptest.NewRecorder()
+	handler.WithAuth(auth).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TracingServiceName - имя сервиса в отправляемых трассировках
+const TracingServiceName = "tracker"
+
+// tracer возвращает трассировщик глобального провайдера, см. SetupTelemetry.
+// Пока провайдер не настроен, спаны ничего не записывают
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/Yandex-Practicum/go-db-sql-final")
+}
+
+// Атрибуты спанов запросов к БД, которых нет в семантических соглашениях OTel
+const (
+	attrRowsAffected = attribute.Key("db.rows_affected")
+	attrRowsReturned = attribute.Key("db.rows_returned")
+)
+
+// SetupTelemetry включает передачу контекста трассировки в заголовках W3C traceparent
+// и, если задан cfg.OTLPEndpoint, отправку туда спанов и метрик по OTLP/HTTP.
+// Возвращённая функция отправляет оставшиеся данные, её нужно вызвать перед выходом
+func SetupTelemetry(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res := resource.NewSchemaless(semconv.ServiceName(TracingServiceName))
+	spans, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spans),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TraceSampleRatio))),
+		sdktrace.WithResource(res),
+	)
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metrics)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	return func(ctx context.Context) error {
+		return errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx))
+	}, nil
+}
+
+// endSpan отмечает ошибку err в span и завершает его
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// storeOpKey - ключ контекста с именем операции хранилища, см. ParcelStore.startSpan
+type storeOpKey struct{}
+
+// startSpan начинает спан операции хранилища op, например store.get_by_client,
+// и возвращает копию хранилища, запросы которой попадают в этот спан и относятся
+// к op в спанах запросов и журнале медленных запросов
+func (s ParcelStore) startSpan(op string) (ParcelStore, trace.Span) {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracer().Start(ctx, "store."+op, trace.WithAttributes(semconv.DBSystemSqlite, semconv.DBOperationName(op)))
+	s.ctx = context.WithValue(ctx, storeOpKey{}, op)
+	return s, span
+}
+
+// storeOperation возвращает имя операции хранилища из ctx
+// или "", если запрос выполняется не из операции хранилища
+func storeOperation(ctx context.Context) string {
+	op, _ := ctx.Value(storeOpKey{}).(string)
+	return op
+}
+
+// startDBSpan начинает спан запроса к БД sql.query или sql.exec. Запрос из операции
+// хранилища op попадает в её спан и получает её имя в атрибуте db.operation.name
+func startDBSpan(ctx context.Context, kind, op, query string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{semconv.DBSystemSqlite, semconv.DBQueryText(strings.Join(strings.Fields(query), " "))}
+	if op != "" {
+		attrs = append(attrs, semconv.DBOperationName(op))
+	}
+	return tracer().Start(ctx, "sql."+kind, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// tracedRows вызывает end с числом прочитанных строк и ошибкой чтения, когда
+// строки результата закрыты, поэтому в длительность спана запроса входит и чтение строк
+type tracedRows struct {
+	driver.Rows
+	end func(n int64, err error)
+	n   int64
+	err error
+}
+
+func (r *tracedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch {
+	case err == nil:
+		r.n++
+	case err != io.EOF:
+		r.err = err
+	}
+	return err
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	if r.err == nil {
+		r.err = err
+	}
+	r.end(r.n, r.err)
+	return err
+}
+
+// traceHTTP начинает серверный спан запроса API в трассировке из заголовка traceparent.
+// Спан называется по методу и шаблону пути из спецификации, см. openAPIValidator,
+// а код ответа 5xx отмечается как ошибка
+func traceHTTP(w http.ResponseWriter, r *http.Request) (*statusRecorder, *http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer().Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(r.Method),
+		semconv.URLPath(r.URL.Path),
+	))
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}, r.WithContext(ctx), span
+}
+
+// endHTTPSpan записывает в span код ответа и завершает его
+func endHTTPSpan(span trace.Span, status int) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// statusRecorder запоминает код ответа для спана запроса
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush нужен потокам событий, см. serveEvents
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// traceUnary начинает серверный спан вызова gRPC в трассировке из метаданных traceparent
+func traceUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	service, method, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+	ctx, span := tracer().Start(ctx, strings.TrimPrefix(info.FullMethod, "/"), trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		semconv.RPCSystemGRPC,
+		semconv.RPCService(service),
+		semconv.RPCMethod(method),
+	))
+	res, err := handler(ctx, req)
+	endSpan(span, err)
+	return res, err
+}
+
+// metadataCarrier позволяет читать контекст трассировки из метаданных gRPC
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
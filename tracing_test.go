@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/Yandex-Practicum/go-db-sql-final/trackerpb"
+)
+
+// testTraceparent - входящий контекст трассировки из заголовка traceparent
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentID    = "00f067aa0ba902b7"
+	testTraceparent = "00-" + testTraceID + "-" + testParentID + "-01"
+)
+
+// recordSpans направляет спаны до конца теста в память
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+	return rec
+}
+
+// findSpans возвращает завершённые спаны с именем name
+func findSpans(rec *tracetest.SpanRecorder, name string) []sdktrace.ReadOnlySpan {
+	var res []sdktrace.ReadOnlySpan
+	for _, span := range rec.Ended() {
+		if span.Name() == name {
+			res = append(res, span)
+		}
+	}
+	return res
+}
+
+// spanAttr возвращает значение атрибута key спана
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// TestDBSpans проверяет спаны операций хранилища и запросов к БД
+func TestDBSpans(t *testing.T) {
+	rec := recordSpans(t)
+	service, store := newTestService(t)
+	ctx, root := tracer().Start(context.Background(), "test")
+
+	// add
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	_, err = service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	_, err = store.db.ExecContext(ctx, "UPDATE missing SET x = 1")
+	require.Error(t, err)
+	root.End()
+
+	// check
+	add := findSpans(rec, "store.add")
+	require.Len(t, add, 1)
+	assert.Equal(t, root.SpanContext().SpanID(), add[0].Parent().SpanID())
+	assert.Equal(t, "add", spanAttr(add[0], "db.operation.name").AsString())
+	var inserted bool
+	for _, span := range findSpans(rec, "sql.exec") {
+		if span.Parent().SpanID() != add[0].SpanContext().SpanID() {
+			continue
+		}
+		// запросы из транзакции и вспомогательных методов относятся к Add
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+		assert.Equal(t, "sqlite", spanAttr(span, "db.system").AsString())
+		assert.Equal(t, "add", spanAttr(span, "db.operation.name").AsString())
+		if strings.HasPrefix(spanAttr(span, "db.query.text").AsString(), "INSERT INTO parcel ") {
+			inserted = true
+			assert.EqualValues(t, 1, spanAttr(span, attrRowsAffected).AsInt64())
+		}
+	}
+	assert.True(t, inserted)
+
+	get := findSpans(rec, "store.get")
+	require.NotEmpty(t, get)
+	var read int64
+	for _, span := range findSpans(rec, "sql.query") {
+		if span.Parent().SpanID() == get[len(get)-1].SpanContext().SpanID() {
+			read += spanAttr(span, attrRowsReturned).AsInt64()
+		}
+	}
+	assert.EqualValues(t, 1, read)
+
+	// запрос не из хранилища, например миграция, называется по виду запроса
+	var failed sdktrace.ReadOnlySpan
+	for _, span := range findSpans(rec, "sql.exec") {
+		if span.Parent().SpanID() == root.SpanContext().SpanID() {
+			failed = span
+		}
+	}
+	require.NotNil(t, failed)
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	assert.NotEmpty(t, failed.Events(), "ошибка записана событием спана")
+}
+
+// TestHTTPTracing проверяет, что запросы к БД попадают в трассировку запроса REST API
+func TestHTTPTracing(t *testing.T) {
+	rec := recordSpans(t)
+	service, _ := newTestService(t)
+	handler := NewAPIHandler(service)
+
+	// prepare
+	p, err := service.Register(context.Background(), 7, "Псков")
+	require.NoError(t, err)
+
+	// add
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/parcels/%d", p.Number), nil)
+	req.Header.Set("traceparent", testTraceparent)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	// check
+	server := findSpans(rec, "GET /parcels/{number}")
+	require.Len(t, server, 1)
+	assert.Equal(t, testTraceID, server[0].SpanContext().TraceID().String())
+	assert.Equal(t, testParentID, server[0].Parent().SpanID().String())
+	assert.Equal(t, "/parcels/{number}", spanAttr(server[0], "http.route").AsString())
+	assert.EqualValues(t, http.StatusOK, spanAttr(server[0], "http.response.status_code").AsInt64())
+
+	get := findSpans(rec, "store.get")
+	require.NotEmpty(t, get)
+	for _, span := range get[len(get)-1:] {
+		assert.Equal(t, server[0].SpanContext().SpanID(), span.Parent().SpanID())
+	}
+}
+
+// TestGRPCTracing проверяет, что запросы к БД попадают в трассировку вызова gRPC
+func TestGRPCTracing(t *testing.T) {
+	rec := recordSpans(t)
+	service, _ := newTestService(t)
+	client := newTestGRPCClient(t, service)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", testTraceparent)
+
+	// prepare
+	p, err := service.Register(context.Background(), 7, "Псков")
+	require.NoError(t, err)
+
+	// add
+	_, err = client.GetParcel(ctx, &trackerpb.GetParcelRequest{Number: p.Number})
+	require.NoError(t, err)
+	_, err = client.GetParcel(ctx, &trackerpb.GetParcelRequest{Number: p.Number + 100})
+	require.Error(t, err)
+
+	// check
+	calls := findSpans(rec, "tracker.v1.ParcelService/GetParcel")
+	require.Len(t, calls, 2)
+	assert.Equal(t, testTraceID, calls[0].SpanContext().TraceID().String())
+	assert.Equal(t, "GetParcel", spanAttr(calls[0], "rpc.method").AsString())
+	assert.Equal(t, codes.Unset, calls[0].Status().Code)
+	assert.Equal(t, codes.Error, calls[1].Status().Code)
+
+	var children int
+	for _, span := range findSpans(rec, "store.get") {
+		if span.Parent().SpanID() == calls[0].SpanContext().SpanID() {
+			children++
+		}
+	}
+	assert.NotZero(t, children)
+}
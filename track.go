@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// PublicTracking - сведения о посылке, которые можно показать любому, кто знает
+// код отслеживания: без клиента, полного адреса, исполнителей и комментариев
+type PublicTracking struct {
+	Tracking string        `json:"tracking_number"`
+	Status   string        `json:"status"`
+	City     string        `json:"destination_city"`
+	ETA      string        `json:"eta,omitempty"`
+	Timeline []PublicEvent `json:"timeline"`
+}
+
+// PublicEvent - шаг истории статусов в PublicTracking
+type PublicEvent struct {
+	Status string `json:"status"`
+	At     string `json:"at"`
+}
+
+// destinationCity возвращает город из адреса вида "Город, улица, дом" -
+// часть до первой запятой
+func destinationCity(address string) string {
+	city, _, _ := strings.Cut(address, ",")
+	return strings.TrimSpace(city)
+}
+
+// Track возвращает публичные сведения о посылке по коду отслеживания
+// или ErrParcelNotFound. Коды уникальны на весь экземпляр, поэтому посылка
+// ищется во всех магазинах
+func (s ParcelService) Track(ctx context.Context, tracking string) (PublicTracking, error) {
+	ctx = WithTenant(ctx, 0)
+	p, err := s.GetByTrackingNumber(ctx, tracking)
+	if err != nil {
+		return PublicTracking{}, err
+	}
+	history, err := s.store.WithContext(ctx).GetStatusHistory(p.Number)
+	if err != nil {
+		return PublicTracking{}, err
+	}
+
+	res := PublicTracking{
+		Tracking: p.Tracking,
+		Status:   p.Status,
+		City:     destinationCity(p.Address),
+		ETA:      p.ETA,
+		Timeline: make([]PublicEvent, len(history)),
+	}
+	for i, h := range history {
+		res.Timeline[i] = PublicEvent{Status: h.Status, At: h.ChangedAt}
+	}
+	return res, nil
+}
+
+// serveTrack обрабатывает /track/{tracking}. Адрес открыт без авторизации,
+// поэтому отдаёт только PublicTracking
+func (h APIHandler) serveTrack(w http.ResponseWriter, r *http.Request) {
+	tracking := strings.TrimPrefix(r.URL.Path, "/track/")
+	if tracking == "" || strings.Contains(tracking, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	res, err := h.service.Track(r.Context(), tracking)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDestinationCity проверяет выделение города из адреса
+func TestDestinationCity(t *testing.T) {
+	assert.Equal(t, "Псков", destinationCity("Псков, д. Пушкина, ул. Колотушкина, д. 5"))
+	assert.Equal(t, "Тверь", destinationCity(" Тверь "))
+	assert.Equal(t, "", destinationCity(""))
+}
+
+// TestTrack проверяет, что публичный ответ не раскрывает лишнего
+func TestTrack(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	handler := NewAPIHandler(service)
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков, ул. Льва Толстого, д. 12")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+
+	// check
+	rec := apiCall(t, handler, http.MethodGet, "/track/"+strings.ToLower(p.Tracking), "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var got PublicTracking
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, p.Tracking, got.Tracking)
+	assert.Equal(t, ParcelStatusSent, got.Status)
+	assert.Equal(t, "Псков", got.City)
+	require.Len(t, got.Timeline, 2)
+	assert.Equal(t, ParcelStatusRegistered, got.Timeline[0].Status)
+	assert.Equal(t, ParcelStatusSent, got.Timeline[1].Status)
+	assert.NotContains(t, rec.Body.String(), "Толстого")
+	assert.NotContains(t, rec.Body.String(), `"client"`)
+
+	rec = apiCall(t, handler, http.MethodGet, "/track/TRK-000000", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiCall(t, handler, http.MethodPost, "/track/"+p.Tracking, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,395 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: parcel.proto
+
+// Пакет trackerpb описывает gRPC-интерфейс трекера посылок
+
+package trackerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ParcelService_RegisterParcel_FullMethodName    = "/tracker.v1.ParcelService/RegisterParcel"
+	ParcelService_GetParcel_FullMethodName         = "/tracker.v1.ParcelService/GetParcel"
+	ParcelService_ListClientParcels_FullMethodName = "/tracker.v1.ParcelService/ListClientParcels"
+	ParcelService_ChangeAddress_FullMethodName     = "/tracker.v1.ParcelService/ChangeAddress"
+	ParcelService_SetStatus_FullMethodName         = "/tracker.v1.ParcelService/SetStatus"
+	ParcelService_NextStatus_FullMethodName        = "/tracker.v1.ParcelService/NextStatus"
+	ParcelService_CancelParcel_FullMethodName      = "/tracker.v1.ParcelService/CancelParcel"
+	ParcelService_DeleteParcel_FullMethodName      = "/tracker.v1.ParcelService/DeleteParcel"
+)
+
+// ParcelServiceClient is the client API for ParcelService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ParcelService повторяет операции REST API. Ошибки проверки возвращаются с кодом
+// INVALID_ARGUMENT, ненайденная посылка - NOT_FOUND, запрещённое изменение - FAILED_PRECONDITION
+type ParcelServiceClient interface {
+	RegisterParcel(ctx context.Context, in *RegisterParcelRequest, opts ...grpc.CallOption) (*Parcel, error)
+	GetParcel(ctx context.Context, in *GetParcelRequest, opts ...grpc.CallOption) (*Parcel, error)
+	ListClientParcels(ctx context.Context, in *ListClientParcelsRequest, opts ...grpc.CallOption) (*ListClientParcelsResponse, error)
+	ChangeAddress(ctx context.Context, in *ChangeAddressRequest, opts ...grpc.CallOption) (*Parcel, error)
+	SetStatus(ctx context.Context, in *SetStatusRequest, opts ...grpc.CallOption) (*Parcel, error)
+	NextStatus(ctx context.Context, in *NextStatusRequest, opts ...grpc.CallOption) (*Parcel, error)
+	CancelParcel(ctx context.Context, in *CancelParcelRequest, opts ...grpc.CallOption) (*Parcel, error)
+	DeleteParcel(ctx context.Context, in *DeleteParcelRequest, opts ...grpc.CallOption) (*DeleteParcelResponse, error)
+}
+
+type parcelServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewParcelServiceClient(cc grpc.ClientConnInterface) ParcelServiceClient {
+	return &parcelServiceClient{cc}
+}
+
+func (c *parcelServiceClient) RegisterParcel(ctx context.Context, in *RegisterParcelRequest, opts ...grpc.CallOption) (*Parcel, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Parcel)
+	err := c.cc.Invoke(ctx, ParcelService_RegisterParcel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parcelServiceClient) GetParcel(ctx context.Context, in *GetParcelRequest, opts ...grpc.CallOption) (*Parcel, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Parcel)
+	err := c.cc.Invoke(ctx, ParcelService_GetParcel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parcelServiceClient) ListClientParcels(ctx context.Context, in *ListClientParcelsRequest, opts ...grpc.CallOption) (*ListClientParcelsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListClientParcelsResponse)
+	err := c.cc.Invoke(ctx, ParcelService_ListClientParcels_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parcelServiceClient) ChangeAddress(ctx context.Context, in *ChangeAddressRequest, opts ...grpc.CallOption) (*Parcel, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Parcel)
+	err := c.cc.Invoke(ctx, ParcelService_ChangeAddress_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parcelServiceClient) SetStatus(ctx context.Context, in *SetStatusRequest, opts ...grpc.CallOption) (*Parcel, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Parcel)
+	err := c.cc.Invoke(ctx, ParcelService_SetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parcelServiceClient) NextStatus(ctx context.Context, in *NextStatusRequest, opts ...grpc.CallOption) (*Parcel, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Parcel)
+	err := c.cc.Invoke(ctx, ParcelService_NextStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parcelServiceClient) CancelParcel(ctx context.Context, in *CancelParcelRequest, opts ...grpc.CallOption) (*Parcel, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Parcel)
+	err := c.cc.Invoke(ctx, ParcelService_CancelParcel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parcelServiceClient) DeleteParcel(ctx context.Context, in *DeleteParcelRequest, opts ...grpc.CallOption) (*DeleteParcelResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteParcelResponse)
+	err := c.cc.Invoke(ctx, ParcelService_DeleteParcel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ParcelServiceServer is the server API for ParcelService service.
+// All implementations must embed UnimplementedParcelServiceServer
+// for forward compatibility.
+//
+// ParcelService повторяет операции REST API. Ошибки проверки возвращаются с кодом
+// INVALID_ARGUMENT, ненайденная посылка - NOT_FOUND, запрещённое изменение - FAILED_PRECONDITION
+type ParcelServiceServer interface {
+	RegisterParcel(context.Context, *RegisterParcelRequest) (*Parcel, error)
+	GetParcel(context.Context, *GetParcelRequest) (*Parcel, error)
+	ListClientParcels(context.Context, *ListClientParcelsRequest) (*ListClientParcelsResponse, error)
+	ChangeAddress(context.Context, *ChangeAddressRequest) (*Parcel, error)
+	SetStatus(context.Context, *SetStatusRequest) (*Parcel, error)
+	NextStatus(context.Context, *NextStatusRequest) (*Parcel, error)
+	CancelParcel(context.Context, *CancelParcelRequest) (*Parcel, error)
+	DeleteParcel(context.Context, *DeleteParcelRequest) (*DeleteParcelResponse, error)
+	mustEmbedUnimplementedParcelServiceServer()
+}
+
+// UnimplementedParcelServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedParcelServiceServer struct{}
+
+func (UnimplementedParcelServiceServer) RegisterParcel(context.Context, *RegisterParcelRequest) (*Parcel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterParcel not implemented")
+}
+func (UnimplementedParcelServiceServer) GetParcel(context.Context, *GetParcelRequest) (*Parcel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetParcel not implemented")
+}
+func (UnimplementedParcelServiceServer) ListClientParcels(context.Context, *ListClientParcelsRequest) (*ListClientParcelsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListClientParcels not implemented")
+}
+func (UnimplementedParcelServiceServer) ChangeAddress(context.Context, *ChangeAddressRequest) (*Parcel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeAddress not implemented")
+}
+func (UnimplementedParcelServiceServer) SetStatus(context.Context, *SetStatusRequest) (*Parcel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetStatus not implemented")
+}
+func (UnimplementedParcelServiceServer) NextStatus(context.Context, *NextStatusRequest) (*Parcel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method NextStatus not implemented")
+}
+func (UnimplementedParcelServiceServer) CancelParcel(context.Context, *CancelParcelRequest) (*Parcel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelParcel not implemented")
+}
+func (UnimplementedParcelServiceServer) DeleteParcel(context.Context, *DeleteParcelRequest) (*DeleteParcelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteParcel not implemented")
+}
+func (UnimplementedParcelServiceServer) mustEmbedUnimplementedParcelServiceServer() {}
+func (UnimplementedParcelServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeParcelServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ParcelServiceServer will
+// result in compilation errors.
+type UnsafeParcelServiceServer interface {
+	mustEmbedUnimplementedParcelServiceServer()
+}
+
+func RegisterParcelServiceServer(s grpc.ServiceRegistrar, srv ParcelServiceServer) {
+	// If the following call pancis, it indicates UnimplementedParcelServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ParcelService_ServiceDesc, srv)
+}
+
+func _ParcelService_RegisterParcel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterParcelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParcelServiceServer).RegisterParcel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParcelService_RegisterParcel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParcelServiceServer).RegisterParcel(ctx, req.(*RegisterParcelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParcelService_GetParcel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetParcelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParcelServiceServer).GetParcel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParcelService_GetParcel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParcelServiceServer).GetParcel(ctx, req.(*GetParcelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParcelService_ListClientParcels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListClientParcelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParcelServiceServer).ListClientParcels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParcelService_ListClientParcels_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParcelServiceServer).ListClientParcels(ctx, req.(*ListClientParcelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParcelService_ChangeAddress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeAddressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParcelServiceServer).ChangeAddress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParcelService_ChangeAddress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParcelServiceServer).ChangeAddress(ctx, req.(*ChangeAddressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParcelService_SetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParcelServiceServer).SetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParcelService_SetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParcelServiceServer).SetStatus(ctx, req.(*SetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParcelService_NextStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NextStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParcelServiceServer).NextStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParcelService_NextStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParcelServiceServer).NextStatus(ctx, req.(*NextStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParcelService_CancelParcel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelParcelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParcelServiceServer).CancelParcel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParcelService_CancelParcel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParcelServiceServer).CancelParcel(ctx, req.(*CancelParcelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParcelService_DeleteParcel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteParcelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParcelServiceServer).DeleteParcel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParcelService_DeleteParcel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParcelServiceServer).DeleteParcel(ctx, req.(*DeleteParcelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ParcelService_ServiceDesc is the grpc.ServiceDesc for ParcelService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ParcelService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tracker.v1.ParcelService",
+	HandlerType: (*ParcelServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RegisterParcel",
+			Handler:    _ParcelService_RegisterParcel_Handler,
+		},
+		{
+			MethodName: "GetParcel",
+			Handler:    _ParcelService_GetParcel_Handler,
+		},
+		{
+			MethodName: "ListClientParcels",
+			Handler:    _ParcelService_ListClientParcels_Handler,
+		},
+		{
+			MethodName: "ChangeAddress",
+			Handler:    _ParcelService_ChangeAddress_Handler,
+		},
+		{
+			MethodName: "SetStatus",
+			Handler:    _ParcelService_SetStatus_Handler,
+		},
+		{
+			MethodName: "NextStatus",
+			Handler:    _ParcelService_NextStatus_Handler,
+		},
+		{
+			MethodName: "CancelParcel",
+			Handler:    _ParcelService_CancelParcel_Handler,
+		},
+		{
+			MethodName: "DeleteParcel",
+			Handler:    _ParcelService_DeleteParcel_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "parcel.proto",
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// trackingAlphabet не содержит похожих символов (0/O, 1/I/L),
+// чтобы код было легко продиктовать и ввести вручную
+const trackingAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// trackingLength - число случайных символов в коде: 31^6 ≈ 887 млн вариантов
+const trackingLength = 6
+
+// trackingAttempts - сколько раз addTracked генерирует код заново при совпадении
+const trackingAttempts = 5
+
+// newTrackingNumber возвращает случайный код отслеживания вида TRK-9F3K2A.
+// В отличие от номера посылки код нельзя угадать перебором соседних значений
+func newTrackingNumber() string {
+	// байты от limit отбрасываются, иначе b % 31 выдавал бы первые символы алфавита чаще
+	limit := 256 - 256%len(trackingAlphabet)
+	buf := make([]byte, trackingLength)
+	code := make([]byte, 0, trackingLength)
+	for len(code) < trackingLength {
+		if _, err := rand.Read(buf); err != nil {
+			panic(err)
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(code) < trackingLength {
+				code = append(code, trackingAlphabet[int(b)%len(trackingAlphabet)])
+			}
+		}
+	}
+	return "TRK-" + string(code)
+}
+
+// isTrackingConflict сообщает, что вставка нарушила уникальность кода отслеживания
+func isTrackingConflict(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) &&
+		sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE &&
+		strings.Contains(sqliteErr.Error(), "tracking_number")
+}
+
+// backfillTrackingNumbers выдаёт коды отслеживания посылкам, добавленным до их
+// появления. Как и addTracked, при совпадении кода пробует другой
+func backfillTrackingNumbers(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT number FROM parcel WHERE tracking_number = ''")
+	if err != nil {
+		return err
+	}
+	var numbers []int64
+	for rows.Next() {
+		var number int64
+		if err := rows.Scan(&number); err != nil {
+			rows.Close()
+			return err
+		}
+		numbers = append(numbers, number)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, number := range numbers {
+		for attempt := 1; ; attempt++ {
+			_, err := tx.Exec("UPDATE parcel SET tracking_number = :tracking WHERE number = :number",
+				sql.Named("tracking", newTrackingNumber()),
+				sql.Named("number", number))
+			if isTrackingConflict(err) && attempt < trackingAttempts {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("parcel %d: %w", number, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// addTracked добавляет посылку через store с новым кодом отслеживания
+// и возвращает её с заполненными номером и кодом
+func addTracked(store ParcelStore, p Parcel) (Parcel, error) {
+	for attempt := 1; ; attempt++ {
+		p.Tracking = newTrackingNumber()
+		id, err := store.Add(p)
+		// сгенерированный код совпал с уже выданным - пробуем другой
+		if isTrackingConflict(err) && attempt < trackingAttempts {
+			continue
+		}
+		if err != nil {
+			return p, err
+		}
+		p.Number = id
+		return p, nil
+	}
+}
+
+// addTrackedBatch добавляет посылки ps через store одной транзакцией с новыми
+// кодами отслеживания и возвращает их с заполненными номерами и кодами.
+// При совпадении любого кода партия повторяется с новыми кодами
+func addTrackedBatch(store ParcelStore, ps []Parcel) ([]Parcel, error) {
+	for attempt := 1; ; attempt++ {
+		for i := range ps {
+			ps[i].Tracking = newTrackingNumber()
+		}
+		ids, err := store.AddBatch(ps)
+		if isTrackingConflict(err) && attempt < trackingAttempts {
+			continue
+		}
+		if err != nil {
+			return ps, err
+		}
+		for i, id := range ids {
+			ps[i].Number = id
+		}
+		return ps, nil
+	}
+}
+
+// GetByTrackingNumber возвращает посылку по коду отслеживания
+func (s ParcelStore) GetByTrackingNumber(tracking string) (Parcel, error) {
+	var err error
+	for _, db := range s.readers() {
+		var p Parcel
+		p, err = s.scanParcel(db.QueryRowContext(s.context(), "SELECT "+parcelColumns+" FROM parcel WHERE tracking_number = :tracking AND "+tenantScope,
+			sql.Named("tracking", tracking), s.tenantArg()))
+		if err == nil {
+			return p, nil
+		}
+	}
+	return Parcel{}, err
+}
+
+// GetByTrackingNumber возвращает посылку по коду отслеживания без учёта регистра
+// или ErrParcelNotFound
+func (s ParcelService) GetByTrackingNumber(ctx context.Context, tracking string) (Parcel, error) {
+	tracking = strings.ToUpper(strings.TrimSpace(tracking))
+	if tracking == "" {
+		return Parcel{}, ValidationError{Field: "tracking_number", Message: "must not be empty"}
+	}
+
+	p, err := s.store.WithContext(ctx).GetByTrackingNumber(tracking)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Parcel{}, fmt.Errorf("%w: %s", ErrParcelNotFound, tracking)
+	}
+	return p, err
+}
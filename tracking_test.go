@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewTrackingNumber проверяет формат кода отслеживания
+func TestNewTrackingNumber(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		code := newTrackingNumber()
+		require.Len(t, code, len("TRK-")+trackingLength)
+		require.True(t, strings.HasPrefix(code, "TRK-"))
+		for _, c := range code[len("TRK-"):] {
+			require.Contains(t, trackingAlphabet, string(c))
+		}
+		seen[code] = true
+	}
+	assert.Greater(t, len(seen), 990)
+}
+
+// TestBackfillTrackingNumbers проверяет выдачу кодов отслеживания посылкам,
+// добавленным до миграции с кодами
+func TestBackfillTrackingNumbers(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "old.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// prepare
+	// схема до появления кодов отслеживания
+	for i := 0; i < 12; i++ {
+		require.NoError(t, applyMigration(db, i+1, migrations[i]))
+	}
+	for i := 0; i < 100; i++ {
+		_, err := db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (1, 'registered', 'Псков', '2024-01-01T00:00:00Z')")
+		require.NoError(t, err)
+	}
+
+	// add
+	require.NoError(t, migrate(db))
+
+	// check
+	rows, err := db.Query("SELECT tracking_number FROM parcel")
+	require.NoError(t, err)
+	defer rows.Close()
+	seen := map[string]bool{}
+	for rows.Next() {
+		var code string
+		require.NoError(t, rows.Scan(&code))
+		require.True(t, strings.HasPrefix(code, "TRK-"), code)
+		for _, c := range code[len("TRK-"):] {
+			require.Contains(t, trackingAlphabet, string(c))
+		}
+		seen[code] = true
+	}
+	require.NoError(t, rows.Err())
+	assert.Len(t, seen, 100)
+}
+
+// TestGetByTrackingNumber проверяет выдачу кода при регистрации и поиск по нему
+func TestGetByTrackingNumber(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 1, "Псков")
+	require.NoError(t, err)
+	require.NotEmpty(t, p.Tracking)
+
+	// get
+	stored, err := service.GetByTrackingNumber(ctx, strings.ToLower(p.Tracking))
+	require.NoError(t, err)
+	assert.Equal(t, p.Number, stored.Number)
+
+	_, err = service.GetByTrackingNumber(ctx, "TRK-000000")
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+
+	// повторно выданный код отклоняется уникальным индексом
+	dup := getTestParcel()
+	dup.Tracking = p.Tracking
+	_, err = store.Add(dup)
+	assert.True(t, isTrackingConflict(err))
+}
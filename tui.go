@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tuiMode - что сейчас вводит оператор в TUI
+type tuiMode int
+
+const (
+	tuiBrowse       tuiMode = iota // навигация по списку
+	tuiFilterClient                // фильтр по клиенту, применяется на каждое нажатие
+	tuiFilterStatus                // фильтр по статусу, применяется на каждое нажатие
+	tuiEditAddress                 // новый адрес выбранной посылки
+	tuiEditStatus                  // новый статус выбранной посылки
+)
+
+// tuiModel - состояние TUI для просмотра и правки посылок.
+// Все изменения идут через ParcelService, поэтому проверки те же, что и в API
+type tuiModel struct {
+	ctx     context.Context
+	service ParcelService
+
+	client  string // фильтр по клиенту, пусто - все клиенты
+	status  string // фильтр по статусу, пусто - все статусы
+	parcels []Parcel
+	cursor  int
+
+	mode  tuiMode
+	input string // вводимый адрес или статус
+	msg   string // результат последнего действия или ошибка
+}
+
+func newTUIModel(ctx context.Context, service ParcelService) tuiModel {
+	m := tuiModel{ctx: ctx, service: service}
+	m.reload()
+	return m
+}
+
+// RunTUI показывает TUI в терминале, пока оператор не выйдет
+func RunTUI(ctx context.Context, service ParcelService) error {
+	_, err := tea.NewProgram(newTUIModel(ctx, service), tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	return err
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	if key.Type == tea.KeyCtrlC {
+		return m, tea.Quit
+	}
+
+	if m.mode == tuiBrowse {
+		return m.browse(key)
+	}
+
+	switch key.Type {
+	case tea.KeyEsc:
+		m.mode = tuiBrowse
+		m.input = ""
+		return m, nil
+	case tea.KeyEnter:
+		m.apply()
+		return m, nil
+	case tea.KeyBackspace:
+		m.edit(func(s string) string {
+			r := []rune(s)
+			if len(r) == 0 {
+				return s
+			}
+			return string(r[:len(r)-1])
+		})
+	case tea.KeyRunes, tea.KeySpace:
+		m.edit(func(s string) string { return s + string(key.Runes) })
+	}
+	return m, nil
+}
+
+// browse обрабатывает клавиши в режиме навигации
+func (m tuiModel) browse(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch key.String() {
+	case "q":
+		return m, tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.parcels)-1 {
+			m.cursor++
+		}
+	case "c":
+		m.mode = tuiFilterClient
+	case "f":
+		m.mode = tuiFilterStatus
+	case "r":
+		m.reload()
+	case "a", "s":
+		p, ok := m.selected()
+		if !ok {
+			return m, nil
+		}
+		m.mode = tuiEditAddress
+		m.input = p.Address
+		if key.String() == "s" {
+			m.mode = tuiEditStatus
+			m.input = ""
+		}
+	case "n":
+		if p, ok := m.selected(); ok {
+			m.done(p.Number, m.service.NextStatus(m.ctx, p.Number))
+		}
+	}
+	return m, nil
+}
+
+// edit меняет вводимое значение; фильтры применяются сразу
+func (m *tuiModel) edit(f func(string) string) {
+	switch m.mode {
+	case tuiFilterClient:
+		m.client = f(m.client)
+		m.reload()
+	case tuiFilterStatus:
+		m.status = f(m.status)
+		m.reload()
+	default:
+		m.input = f(m.input)
+	}
+}
+
+// apply завершает ввод: фильтр остаётся, адрес или статус сохраняются
+func (m *tuiModel) apply() {
+	mode, input := m.mode, strings.TrimSpace(m.input)
+	m.mode = tuiBrowse
+	m.input = ""
+
+	p, ok := m.selected()
+	if !ok {
+		return
+	}
+	switch mode {
+	case tuiEditAddress:
+		m.done(p.Number, m.service.ChangeAddress(m.ctx, p.Number, input))
+	case tuiEditStatus:
+		m.done(p.Number, m.service.SetStatus(m.ctx, p.Number, input))
+	}
+}
+
+// done показывает результат изменения посылки и обновляет список
+func (m *tuiModel) done(number int64, err error) {
+	if err != nil {
+		m.msg = err.Error()
+		return
+	}
+	m.reload()
+	m.msg = fmt.Sprintf("Посылка %d изменена", number)
+}
+
+// reload перечитывает посылки под текущие фильтры
+func (m *tuiModel) reload() {
+	var terms []string
+	if m.client != "" {
+		client, err := strconv.ParseInt(m.client, 10, 64)
+		if err != nil {
+			m.parcels, m.cursor = nil, 0
+			m.msg = "клиент должен быть числом"
+			return
+		}
+		terms = append(terms, fmt.Sprintf("client = %d", client))
+	}
+	if m.status != "" {
+		terms = append(terms, "status ~ "+strconv.Quote(m.status))
+	}
+
+	parcels, err := m.service.Search(m.ctx, strings.Join(terms, " AND "))
+	if err != nil {
+		m.msg = err.Error()
+		return
+	}
+	m.parcels, m.msg = parcels, ""
+	if m.cursor >= len(parcels) {
+		m.cursor = max(len(parcels)-1, 0)
+	}
+}
+
+func (m tuiModel) selected() (Parcel, bool) {
+	if m.cursor >= len(m.parcels) {
+		return Parcel{}, false
+	}
+	return m.parcels[m.cursor], true
+}
+
+func (m tuiModel) View() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Клиент: %s%s  Статус: %s%s\n\n", m.client, m.caret(tuiFilterClient), m.status, m.caret(tuiFilterStatus))
+	if len(m.parcels) == 0 {
+		b.WriteString("  нет посылок\n")
+	}
+	for i, p := range m.parcels {
+		marker := "  "
+		if i == m.cursor {
+			marker = "> "
+		}
+		fmt.Fprintf(&b, "%s%-6d %-10s %-6d %-16s %s\n", marker, p.Number, p.Tracking, p.Client, p.Status, p.Address)
+	}
+	b.WriteString("\n")
+
+	switch m.mode {
+	case tuiEditAddress:
+		fmt.Fprintf(&b, "Новый адрес: %s_\n", m.input)
+	case tuiEditStatus:
+		fmt.Fprintf(&b, "Новый статус: %s_\n", m.input)
+	}
+	if m.msg != "" {
+		b.WriteString(m.msg + "\n")
+	}
+	if m.mode == tuiBrowse {
+		b.WriteString("↑/↓ выбор  c клиент  f статус  a адрес  s статус посылки  n следующий статус  r обновить  q выход\n")
+	} else {
+		b.WriteString("enter применить  esc отмена\n")
+	}
+	return b.String()
+}
+
+// caret отмечает поле фильтра, которое сейчас редактируется
+func (m tuiModel) caret(mode tuiMode) string {
+	if m.mode == mode {
+		return "_"
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tuiKeys передаёт модели нажатия клавиш; строки вводятся посимвольно
+func tuiKeys(m tuiModel, keys ...any) tuiModel {
+	for _, k := range keys {
+		switch k := k.(type) {
+		case tea.KeyType:
+			next, _ := m.Update(tea.KeyMsg{Type: k})
+			m = next.(tuiModel)
+		case string:
+			for _, r := range k {
+				next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+				m = next.(tuiModel)
+			}
+		}
+	}
+	return m
+}
+
+// TestTUIFilter проверяет фильтрацию списка по клиенту и статусу
+func TestTUIFilter(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p1, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	p2, err := service.Register(ctx, 7, "Тверь")
+	require.NoError(t, err)
+	_, err = service.Register(ctx, 8, "Орёл")
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(p2.Number, ParcelStatusSent))
+
+	// check
+	m := newTUIModel(ctx, service)
+	assert.Len(t, m.parcels, 3)
+
+	m = tuiKeys(m, "c", "7")
+	assert.Len(t, m.parcels, 2)
+
+	m = tuiKeys(m, tea.KeyEnter, "f", "sen")
+	require.Len(t, m.parcels, 1)
+	assert.Equal(t, p2.Number, m.parcels[0].Number)
+	assert.Contains(t, m.View(), "Тверь")
+
+	m = tuiKeys(m, tea.KeyBackspace, tea.KeyBackspace, tea.KeyBackspace, tea.KeyEsc)
+	require.Len(t, m.parcels, 2)
+	assert.Equal(t, p1.Number, m.parcels[0].Number)
+
+	m = tuiKeys(m, "c", tea.KeyBackspace, "x")
+	assert.Empty(t, m.parcels)
+	assert.Contains(t, m.View(), "клиент должен быть числом")
+}
+
+// TestTUIEdit проверяет изменение адреса и статуса выбранной посылки
+func TestTUIEdit(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	// prepare
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	m := newTUIModel(ctx, service)
+
+	// address
+	m = tuiKeys(m, "a", tea.KeyBackspace, tea.KeyBackspace, tea.KeyBackspace, tea.KeyBackspace, tea.KeyBackspace, "Тверь", tea.KeyEnter)
+	assert.Equal(t, "Тверь", m.parcels[0].Address)
+
+	// status
+	m = tuiKeys(m, "s", ParcelStatusDelivered, tea.KeyEnter)
+	assert.Contains(t, m.msg, ErrForbiddenTransition.Error())
+	assert.Equal(t, ParcelStatusRegistered, m.parcels[0].Status)
+
+	m = tuiKeys(m, "n")
+	assert.Equal(t, ParcelStatusSent, m.parcels[0].Status)
+
+	// check
+	got, err := service.Get(ctx, p.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "Тверь", got.Address)
+	assert.Equal(t, ParcelStatusSent, got.Status)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// warmupQueries выполняются на каждом подключении при прогреве,
+// чтобы SQLite заранее прочитал схему и горячие страницы индексов
+var warmupQueries = []string{
+	"SELECT " + parcelColumns + " FROM parcel ORDER BY number DESC LIMIT 1",
+	"SELECT " + parcelColumns + " FROM parcel WHERE client = 0",
+	"SELECT status, changed_at, received_at, device_at, actor, comment FROM parcel_status_history WHERE number = 0",
+}
+
+// Warmup прогревает основную БД и реплики и проверяет отставание реплик.
+// Реплика, которая недоступна или отстаёт от основной БД больше чем на maxLag
+// посылок, исключается из возвращаемой копии хранилища, чтобы после старта
+// чтение не попадало на устаревшие данные. Ошибка возвращается,
+// только если не удалось прогреть основную БД
+func (s ParcelStore) Warmup(ctx context.Context, maxLag int) (ParcelStore, error) {
+	if err := warmup(ctx, s.db); err != nil {
+		return s, fmt.Errorf("warm up primary: %w", err)
+	}
+	primaryMax, err := maxNumber(ctx, s.db)
+	if err != nil {
+		return s, fmt.Errorf("warm up primary: %w", err)
+	}
+
+	replicas := make([]*sql.DB, 0, len(s.replicas))
+	for _, replica := range s.replicas {
+		if err := warmup(ctx, replica); err != nil {
+			continue
+		}
+		replicaMax, err := maxNumber(ctx, replica)
+		if err != nil || primaryMax-replicaMax > int64(maxLag) {
+			continue
+		}
+		replicas = append(replicas, replica)
+	}
+	s.replicas = replicas
+
+	return s, nil
+}
+
+// warmup выполняет warmupQueries на подключении db
+func warmup(ctx context.Context, db *sql.DB) error {
+	for _, q := range warmupQueries {
+		rows, err := db.QueryContext(ctx, q)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			// результат не нужен, важно прочитать страницы с диска
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxNumber возвращает наибольший номер посылки в БД, по нему оценивается отставание реплики
+func maxNumber(ctx context.Context, db *sql.DB) (int64, error) {
+	var n sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT MAX(number) FROM parcel").Scan(&n); err != nil {
+		return 0, err
+	}
+	return n.Int64, nil
+}
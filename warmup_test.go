@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWarmup проверяет исключение отстающих и недоступных реплик при прогреве
+func TestWarmup(t *testing.T) {
+	// prepare
+	dir := t.TempDir()
+	open := func(name string) ParcelStore {
+		db, err := OpenDB(filepath.Join(dir, name))
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		store, err := NewParcelStore(db)
+		require.NoError(t, err)
+		return store
+	}
+	primary := open("primary.db")
+	fresh := open("fresh.db")
+	stale := open("stale.db")
+	down := open("down.db")
+
+	for i := 0; i < 3; i++ {
+		_, err := primary.Add(getTestParcel())
+		require.NoError(t, err)
+		_, err = fresh.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+	require.NoError(t, down.db.Close())
+
+	store, err := NewParcelStore(primary.db, fresh.db, stale.db, down.db)
+	require.NoError(t, err)
+
+	// warm up
+	warm, err := store.Warmup(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []*sql.DB{fresh.db}, warm.replicas)
+}
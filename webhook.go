@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrWebhookNotFound возвращается, если подписки или доставки с указанным идентификатором нет
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Состояния доставки вебхука
+const (
+	WebhookPending   = "pending"   // ждёт первой или повторной попытки
+	WebhookDelivered = "delivered" // получатель ответил 2xx
+	WebhookDead      = "dead"      // попытки исчерпаны, см. RetryWebhookDelivery
+)
+
+// Заголовки запроса вебхука. Подпись - HMAC-SHA256 тела с секретом подписки
+// в виде "sha256=<hex>"
+const (
+	WebhookSignatureHeader = "X-Tracker-Signature"
+	WebhookEventHeader     = "X-Tracker-Event"
+	WebhookDeliveryHeader  = "X-Tracker-Delivery"
+)
+
+// DefaultWebhookAttempts - после скольких неудачных попыток доставка становится dead
+const DefaultWebhookAttempts = 5
+
+// webhookBackoff - пауза перед второй попыткой, перед каждой следующей она удваивается
+const webhookBackoff = 30 * time.Second
+
+// webhookBatch - сколько доставок DispatchWebhooks отправляет за один вызов
+const webhookBatch = 100
+
+// Webhook - подписка клиента на изменения его посылок
+type Webhook struct {
+	ID        int
+	Client    int64
+	URL       string
+	Secret    string
+	CreatedAt string
+}
+
+// WebhookEvent - тело запроса вебхука, в том же виде события отдаёт и поток /events
+type WebhookEvent struct {
+	Type       string `json:"type"`
+	Number     int64  `json:"number"`
+	Client     int64  `json:"client"`
+	Status     string `json:"status,omitempty"`
+	Address    string `json:"address,omitempty"`
+	Actor      string `json:"actor,omitempty"`
+	OccurredAt string `json:"occurred_at"`
+}
+
+func newWebhookEvent(e ParcelEvent) WebhookEvent {
+	return WebhookEvent{
+		Type:       e.Type,
+		Number:     e.Number,
+		Client:     e.Client,
+		Status:     e.Status,
+		Address:    e.Address,
+		Actor:      e.Actor,
+		OccurredAt: e.OccurredAt.Format(time.RFC3339),
+	}
+}
+
+// WebhookDelivery - отправка одного события на одну подписку
+type WebhookDelivery struct {
+	ID            int64
+	Webhook       int
+	EventType     string
+	Payload       string // тело запроса, WebhookEvent в JSON
+	State         string
+	Attempts      int
+	NextAttemptAt string
+	LastError     string
+}
+
+// AddWebhook сохраняет подписку и возвращает её идентификатор
+func (s ParcelStore) AddWebhook(w Webhook) (int, error) {
+	res, err := s.db.ExecContext(s.context(), "INSERT INTO webhook (client, url, secret, created_at, tenant_id) VALUES (:client, :url, :secret, :created_at, :tenant)",
+		sql.Named("client", w.Client),
+		sql.Named("url", w.URL),
+		sql.Named("secret", w.Secret),
+		sql.Named("created_at", w.CreatedAt),
+		s.tenantArg())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// ListWebhooks возвращает подписки клиента
+func (s ParcelStore) ListWebhooks(client int64) ([]Webhook, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT id, client, url, secret, created_at FROM webhook WHERE client = :client AND "+tenantScope+" ORDER BY id",
+		sql.Named("client", client),
+		s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.Client, &w.URL, &w.Secret, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, w)
+	}
+	return res, rows.Err()
+}
+
+// DeleteWebhook удаляет подписку вместе с её доставками
+func (s ParcelStore) DeleteWebhook(id int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(s.context(), "DELETE FROM webhook WHERE id = :id AND "+tenantScope, sql.Named("id", id), s.tenantArg())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		_, err = tx.ExecContext(s.context(), "DELETE FROM webhook_delivery WHERE webhook_id = :id", sql.Named("id", id))
+		return err
+	})
+}
+
+// EnqueueWebhooks ставит событие в очередь на каждую подписку клиента посылки
+// в магазине события. Отправляются только изменения статуса и адреса
+func (s ParcelStore) EnqueueWebhooks(event ParcelEvent) error {
+	if event.Type != ParcelEventStatusChanged && event.Type != ParcelEventAddressChanged {
+		return nil
+	}
+	if event.Client == 0 {
+		client, err := s.clientOf(event.Number)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		event.Client = client
+	}
+	if event.Tenant == 0 {
+		tenant, err := s.tenantOf(event.Number)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		event.Tenant = tenant
+	}
+
+	payload, err := json.Marshal(newWebhookEvent(event))
+	if err != nil {
+		return err
+	}
+	// в событии изменения адреса - новый адрес
+	sealed, err := s.fields.encrypt("payload", string(payload))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(s.context(), "INSERT INTO webhook_delivery (webhook_id, event_type, payload, state, next_attempt_at, tenant_id) "+
+		"SELECT id, :type, :payload, :state, :now, tenant_id FROM webhook WHERE client = :client AND tenant_id = :event_tenant",
+		sql.Named("type", event.Type),
+		sql.Named("payload", sealed),
+		sql.Named("state", WebhookPending),
+		sql.Named("now", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("client", event.Client),
+		sql.Named("event_tenant", event.Tenant))
+	return err
+}
+
+// clientOf возвращает клиента посылки: в событиях status_changed он не заполнен
+func (s ParcelStore) clientOf(number int64) (int64, error) {
+	var client int64
+	err := s.db.QueryRowContext(s.context(), "SELECT client FROM parcel WHERE number = :number",
+		sql.Named("number", number)).Scan(&client)
+	return client, err
+}
+
+// ListWebhookDeliveries возвращает доставки клиента в состоянии state
+func (s ParcelStore) ListWebhookDeliveries(client int64, state string) ([]WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+webhookDeliveryColumns+" FROM webhook_delivery d JOIN webhook w ON w.id = d.webhook_id "+
+		"WHERE w.client = :client AND d.state = :state AND (:tenant = 0 OR w.tenant_id = :tenant) ORDER BY d.id",
+		sql.Named("client", client),
+		sql.Named("state", state),
+		s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanWebhookDeliveries(rows)
+}
+
+// RetryWebhookDelivery возвращает dead-доставку в очередь с обнулённым счётчиком попыток
+func (s ParcelStore) RetryWebhookDelivery(id int64) error {
+	res, err := s.db.ExecContext(s.context(), "UPDATE webhook_delivery SET state = :pending, attempts = 0, next_attempt_at = :now "+
+		"WHERE id = :id AND state = :dead AND "+tenantScope,
+		sql.Named("pending", WebhookPending),
+		sql.Named("now", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("id", id),
+		sql.Named("dead", WebhookDead),
+		s.tenantArg())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const webhookDeliveryColumns = "d.id, d.webhook_id, d.event_type, d.payload, d.state, d.attempts, d.next_attempt_at, d.last_error"
+
+func (s ParcelStore) scanWebhookDeliveries(rows *sql.Rows) ([]WebhookDelivery, error) {
+	res := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.Webhook, &d.EventType, &d.Payload, &d.State, &d.Attempts, &d.NextAttemptAt, &d.LastError); err != nil {
+			return nil, err
+		}
+		var err error
+		if d.Payload, err = s.fields.decrypt("payload", d.Payload); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// dueWebhookDelivery - доставка, которую пора отправить, с адресом и секретом подписки
+type dueWebhookDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+// dueWebhookDeliveries возвращает не больше limit доставок, которые пора отправить к моменту now
+func (s ParcelStore) dueWebhookDeliveries(now time.Time, limit int) ([]dueWebhookDelivery, error) {
+	rows, err := s.db.QueryContext(s.context(), "SELECT "+webhookDeliveryColumns+", w.url, w.secret FROM webhook_delivery d JOIN webhook w ON w.id = d.webhook_id "+
+		"WHERE d.state = :state AND d.next_attempt_at <= :now AND (:tenant = 0 OR d.tenant_id = :tenant) ORDER BY d.id LIMIT :limit",
+		sql.Named("state", WebhookPending),
+		sql.Named("now", now.UTC().Format(time.RFC3339)),
+		sql.Named("limit", limit),
+		s.tenantArg())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []dueWebhookDelivery{}
+	for rows.Next() {
+		var d dueWebhookDelivery
+		err := rows.Scan(&d.ID, &d.Webhook, &d.EventType, &d.Payload, &d.State, &d.Attempts, &d.NextAttemptAt, &d.LastError, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+		if d.Payload, err = s.fields.decrypt("payload", d.Payload); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// updateWebhookDelivery сохраняет результат попытки доставки
+func (s ParcelStore) updateWebhookDelivery(d WebhookDelivery) error {
+	_, err := s.db.ExecContext(s.context(), "UPDATE webhook_delivery SET state = :state, attempts = :attempts, next_attempt_at = :next, last_error = :error WHERE id = :id AND "+tenantScope,
+		sql.Named("state", d.State),
+		sql.Named("attempts", d.Attempts),
+		sql.Named("next", d.NextAttemptAt),
+		sql.Named("error", d.LastError),
+		sql.Named("id", d.ID),
+		s.tenantArg())
+	return err
+}
+
+// WebhookDispatcher ставит изменения посылок в очередь вебхуков и отправляет её.
+// Очередь хранится в БД, поэтому недоставленные события переживают перезапуск
+type WebhookDispatcher struct {
+	store       ParcelStore
+	client      *http.Client
+	maxAttempts int
+}
+
+func NewWebhookDispatcher(store ParcelStore, maxAttempts int) WebhookDispatcher {
+	return WebhookDispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Subscribe ставит в очередь события OnChange. Ошибки передаются в onError, если он задан
+func (d WebhookDispatcher) Subscribe(onError func(error)) {
+	d.store.OnChange(func(event ParcelEvent) {
+		if err := d.store.EnqueueWebhooks(event); err != nil && onError != nil {
+			onError(err)
+		}
+	})
+}
+
+// DispatchWebhooks отправляет доставки, которые пора отправить к моменту now,
+// и возвращает количество успешных. Неудачная доставка повторяется с удвоением
+// паузы, а после maxAttempts попыток становится dead
+func (d WebhookDispatcher) DispatchWebhooks(ctx context.Context, now time.Time) (int, error) {
+	store := d.store.WithContext(ctx)
+	due, err := store.dueWebhookDeliveries(now, webhookBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, w := range due {
+		if err := ctx.Err(); err != nil {
+			return delivered, err
+		}
+
+		res := w.WebhookDelivery
+		res.Attempts++
+		if err := d.post(ctx, w); err != nil {
+			res.LastError = err.Error()
+			if res.Attempts >= d.maxAttempts {
+				res.State = WebhookDead
+			} else {
+				res.NextAttemptAt = now.Add(webhookBackoff << (res.Attempts - 1)).UTC().Format(time.RFC3339)
+			}
+		} else {
+			res.State = WebhookDelivered
+			res.LastError = ""
+			delivered++
+		}
+		if err := store.updateWebhookDelivery(res); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// post отправляет одну доставку. Ошибкой считается и ответ не 2xx
+func (d WebhookDispatcher) post(ctx context.Context, w dueWebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, strings.NewReader(w.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, w.EventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(w.ID, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(w.Secret, []byte(w.Payload)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Run отправляет очередь каждые interval до отмены ctx.
+// Ошибки не прерывают расписание и передаются в onError, если он задан
+func (d WebhookDispatcher) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := d.DispatchWebhooks(ctx, now); err != nil && ctx.Err() == nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// SignWebhook возвращает значение WebhookSignatureHeader для тела body.
+// Получатель проверяет подпись, вычисляя её с тем же секретом
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook проверяет подпись тела body за постоянное время
+func VerifyWebhook(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
+
+// AddWebhook подписывает клиента на изменения статуса и адреса его посылок.
+// URL должен быть абсолютным http или https, секрет - непустым
+func (s ParcelService) AddWebhook(ctx context.Context, client int64, rawURL, secret string) (Webhook, error) {
+	if err := validateClient(client); err != nil {
+		return Webhook{}, err
+	}
+	if err := requireClient(ctx, client); err != nil {
+		return Webhook{}, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, ValidationError{Field: "url", Message: "must be an absolute http or https URL"}
+	}
+	if secret == "" {
+		return Webhook{}, ValidationError{Field: "secret", Message: "must not be empty"}
+	}
+
+	w := Webhook{Client: client, URL: rawURL, Secret: secret, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	id, err := s.store.WithContext(ctx).AddWebhook(w)
+	if err != nil {
+		return Webhook{}, err
+	}
+	w.ID = id
+	return w, nil
+}
+
+// ListWebhooks возвращает подписки клиента
+func (s ParcelService) ListWebhooks(ctx context.Context, client int64) ([]Webhook, error) {
+	if err := validateClient(client); err != nil {
+		return nil, err
+	}
+	if err := requireClient(ctx, client); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).ListWebhooks(client)
+}
+
+// RemoveWebhook удаляет подписку или возвращает ErrWebhookNotFound
+func (s ParcelService) RemoveWebhook(ctx context.Context, id int) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	err := s.store.WithContext(ctx).DeleteWebhook(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %d", ErrWebhookNotFound, id)
+	}
+	return err
+}
+
+// DeadWebhookDeliveries возвращает доставки клиента, для которых исчерпаны попытки
+func (s ParcelService) DeadWebhookDeliveries(ctx context.Context, client int64) ([]WebhookDelivery, error) {
+	if err := validateClient(client); err != nil {
+		return nil, err
+	}
+	if err := requireClient(ctx, client); err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).ListWebhookDeliveries(client, WebhookDead)
+}
+
+// RetryWebhookDelivery снова ставит dead-доставку в очередь
+// или возвращает ErrWebhookNotFound, если такой dead-доставки нет
+func (s ParcelService) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	if err := requireStaff(ctx); err != nil {
+		return err
+	}
+	err := s.store.WithContext(ctx).RetryWebhookDelivery(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: delivery %d", ErrWebhookNotFound, id)
+	}
+	return err
+}
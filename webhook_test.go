@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver - тестовый получатель вебхуков, отвечает кодом status
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	events   []WebhookEvent
+	verified []bool
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var e WebhookEvent
+	json.Unmarshal(body, &e)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	r.verified = append(r.verified, VerifyWebhook("secret", body, req.Header.Get(WebhookSignatureHeader)))
+	w.WriteHeader(r.status)
+}
+
+// TestWebhookDispatch проверяет постановку в очередь и подписанную отправку событий
+func TestWebhookDispatch(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	receiver := &webhookReceiver{status: http.StatusNoContent}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	dispatcher := NewWebhookDispatcher(store, DefaultWebhookAttempts)
+	dispatcher.Subscribe(func(err error) { t.Error(err) })
+
+	// prepare
+	_, err := service.AddWebhook(ctx, 7, srv.URL, "secret")
+	require.NoError(t, err)
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	other, err := service.Register(ctx, 8, "Тверь")
+	require.NoError(t, err)
+
+	// add
+	require.NoError(t, service.ChangeAddress(ctx, p.Number, "Орёл"))
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+	require.NoError(t, service.NextStatus(ctx, other.Number))
+
+	n, err := dispatcher.DispatchWebhooks(ctx, time.Now())
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, 2, n)
+	require.Len(t, receiver.events, 2)
+	assert.Equal(t, []bool{true, true}, receiver.verified)
+	assert.Equal(t, ParcelEventAddressChanged, receiver.events[0].Type)
+	assert.Equal(t, "Орёл", receiver.events[0].Address)
+	assert.Equal(t, ParcelEventStatusChanged, receiver.events[1].Type)
+	assert.Equal(t, ParcelStatusSent, receiver.events[1].Status)
+	assert.Equal(t, int64(7), receiver.events[1].Client)
+
+	n, err = dispatcher.DispatchWebhooks(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+// TestWebhookDeadLetter проверяет повторы с паузой и перевод доставки в dead
+func TestWebhookDeadLetter(t *testing.T) {
+	service, store := newTestService(t)
+	ctx := context.Background()
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	dispatcher := NewWebhookDispatcher(store, 2)
+	dispatcher.Subscribe(nil)
+
+	// prepare
+	_, err := service.AddWebhook(ctx, 7, srv.URL, "secret")
+	require.NoError(t, err)
+	p, err := service.Register(ctx, 7, "Псков")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(ctx, p.Number))
+
+	// первая попытка неудачна, вторая - только после паузы
+	now := time.Now()
+	_, err = dispatcher.DispatchWebhooks(ctx, now)
+	require.NoError(t, err)
+	_, err = dispatcher.DispatchWebhooks(ctx, now)
+	require.NoError(t, err)
+	assert.Len(t, receiver.events, 1)
+
+	_, err = dispatcher.DispatchWebhooks(ctx, now.Add(webhookBackoff))
+	require.NoError(t, err)
+	assert.Len(t, receiver.events, 2)
+
+	// check
+	dead, err := service.DeadWebhookDeliveries(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Contains(t, dead[0].LastError, "500")
+
+	receiver.status = http.StatusOK
+	require.NoError(t, service.RetryWebhookDelivery(ctx, dead[0].ID))
+	n, err := dispatcher.DispatchWebhooks(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	dead, err = service.DeadWebhookDeliveries(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+	require.ErrorIs(t, service.RetryWebhookDelivery(ctx, 999), ErrWebhookNotFound)
+}
+
+// TestWebhookSubscriptions проверяет проверку, список и удаление подписок
+func TestWebhookSubscriptions(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+
+	_, err := service.AddWebhook(ctx, 7, "ftp://example.com", "secret")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.AddWebhook(ctx, 7, "/hooks", "secret")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+	_, err = service.AddWebhook(ctx, 7, "https://example.com/hooks", "")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	w, err := service.AddWebhook(ctx, 7, "https://example.com/hooks", "secret")
+	require.NoError(t, err)
+	list, err := service.ListWebhooks(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, []Webhook{w}, list)
+
+	require.NoError(t, service.RemoveWebhook(ctx, w.ID))
+	require.ErrorIs(t, service.RemoveWebhook(ctx, w.ID), ErrWebhookNotFound)
+	list, err = service.ListWebhooks(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}